@@ -11,17 +11,22 @@ import (
 	"os/signal"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/edvart/dota-inhouse/internal/auth"
 	"github.com/edvart/dota-inhouse/internal/bot"
 	"github.com/edvart/dota-inhouse/internal/coordinator"
+	"github.com/edvart/dota-inhouse/internal/discordnotify"
 	"github.com/edvart/dota-inhouse/internal/dotaapi"
+	"github.com/edvart/dota-inhouse/internal/email"
+	"github.com/edvart/dota-inhouse/internal/logging"
 	"github.com/edvart/dota-inhouse/internal/matchrecorder"
 	"github.com/edvart/dota-inhouse/internal/push"
 	"github.com/edvart/dota-inhouse/internal/store"
 	"github.com/edvart/dota-inhouse/internal/web"
+	"github.com/edvart/dota-inhouse/internal/webhook"
 )
 
 func main() {
@@ -36,8 +41,10 @@ func main() {
 		log.Fatalf("Failed to open log file: %v", err)
 	}
 	defer logFile.Close()
-	log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
-	log.SetOutput(io.MultiWriter(os.Stdout, logFile))
+	// LOG_FORMAT=json writes structured lines for log aggregators
+	if err := logging.Setup(getEnv("LOG_FORMAT", ""), io.MultiWriter(os.Stdout, logFile)); err != nil {
+		log.Fatalf("Invalid LOG_FORMAT: %v", err)
+	}
 
 	// Configuration from environment
 	port := getEnv("PORT", "8080")
@@ -45,16 +52,43 @@ func main() {
 	steamAPIKey := getEnv("STEAM_API_KEY", "")
 	dbPath := getEnv("DATABASE_PATH", "./data/inhouse.db")
 	devMode := getEnv("DEV_MODE", "") == "true"
+	metricsEnabled := getEnv("METRICS_ENABLED", "") == "true"
+	queueAllowlist := getEnv("QUEUE_ALLOWLIST", "") == "true"
+
+	// Games a player needs before appearing on the leaderboard
+	minGames := 5
+	if v := getEnv("LEADERBOARD_MIN_GAMES", ""); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			minGames = n
+		} else {
+			log.Printf("Warning: invalid LEADERBOARD_MIN_GAMES %q (must be integer >= 0)", v)
+		}
+	}
 
 	// Bot credentials (host bots)
-	bot1User := getEnv("BOT1_USERNAME", "")
-	bot1Pass := getEnv("BOT1_PASSWORD", "")
+	botCreds := loadBotCredentials()
+
+	// Fake lobbies play out matches without Steam for end-to-end testing
+	fakeLobbies := devMode && getEnv("DEV_FAKE_LOBBIES", "") == "true"
 
-	bot2User := getEnv("BOT2_USERNAME", "")
-	bot2Pass := getEnv("BOT2_PASSWORD", "")
+	// How long a running lobby may go without events before its bot is freed
+	var staleLobbyTimeout time.Duration
+	if v := getEnv("BOT_STALE_LOBBY_TIMEOUT", ""); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			staleLobbyTimeout = d
+		} else {
+			log.Printf("Warning: invalid BOT_STALE_LOBBY_TIMEOUT %q (must be a duration like 10m)", v)
+		}
+	}
 
-	bot3User := getEnv("BOT3_USERNAME", "")
-	bot3Pass := getEnv("BOT3_PASSWORD", "")
+	// How long a login lasts when the user made no "remember me" choice
+	if v := getEnv("SESSION_DURATION", ""); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			auth.SessionDuration = d
+		} else {
+			log.Printf("Warning: invalid SESSION_DURATION %q (must be a duration like 168h)", v)
+		}
+	}
 
 	// Admin Steam IDs (comma-separated)
 	adminSteamIDs := getEnv("ADMIN_STEAM_IDS", "")
@@ -64,13 +98,198 @@ func main() {
 	vapidPrivateKey := getEnv("VAPID_PRIVATE_KEY", "")
 	vapidSubject := getEnv("VAPID_SUBJECT", "mailto:noreply@example.com")
 
+	// Discord OAuth (optional alternative login)
+	discordClientID := getEnv("DISCORD_CLIENT_ID", "")
+	discordClientSecret := getEnv("DISCORD_CLIENT_SECRET", "")
+
+	// Outgoing webhook for match lifecycle events
+	webhookURL := getEnv("WEBHOOK_URL", "")
+
+	// Discord webhook for posting match results to a channel
+	discordWebhookURL := getEnv("DISCORD_WEBHOOK_URL", "")
+
+	// SMTP for opt-in email notifications
+	smtpHost := getEnv("SMTP_HOST", "")
+	smtpPort := 587
+	if v := getEnv("SMTP_PORT", ""); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			smtpPort = n
+		} else {
+			log.Printf("Warning: invalid SMTP_PORT %q (must be a positive integer)", v)
+		}
+	}
+
 	// Configurable max players
 	if maxPlayersStr := getEnv("MAX_PLAYERS", ""); maxPlayersStr != "" {
-		if n, err := strconv.Atoi(maxPlayersStr); err == nil && n >= 2 {
-			coordinator.MaxPlayers = n
-			log.Printf("MaxPlayers set to %d", n)
+		n, err := strconv.Atoi(maxPlayersStr)
+		if err != nil {
+			log.Fatalf("Invalid MAX_PLAYERS %q: must be an integer", maxPlayersStr)
+		}
+		if err := coordinator.ValidateMaxPlayers(n); err != nil {
+			log.Fatalf("Invalid MAX_PLAYERS: %v", err)
+		}
+		coordinator.MaxPlayers = n
+		log.Printf("MaxPlayers set to %d (%dv%d)", n, n/2, n/2)
+	}
+
+	if v := getEnv("MAX_QUEUE_SIZE", ""); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && (n == 0 || n >= coordinator.MaxPlayers) {
+			coordinator.MaxQueueSize = n
+			log.Printf("Max queue size set to %d", n)
+		} else {
+			log.Printf("Warning: invalid MAX_QUEUE_SIZE %q (must be 0 or at least %d)", v, coordinator.MaxPlayers)
+		}
+	}
+
+	// Extra named queues alongside the default one, e.g. "eu:Europe,na:NA:6"
+	if v := getEnv("QUEUES", ""); v != "" {
+		queues, err := coordinator.ParseQueueConfigs(v)
+		if err != nil {
+			log.Fatalf("Invalid QUEUES: %v", err)
+		}
+		coordinator.ExtraQueues = queues
+		for _, q := range queues {
+			log.Printf("Queue %s (%s) enabled with %d players per match (game mode %q, region %q)",
+				q.ID, q.Name, q.MaxPlayers, q.GameMode, q.ServerRegion)
+		}
+	}
+
+	// One match per bot by default, so matches don't stack up waiting for a lobby
+	coordinator.MaxConcurrentMatches = len(botCreds)
+	if v := getEnv("MAX_CONCURRENT_MATCHES", ""); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			coordinator.MaxConcurrentMatches = n
+		} else {
+			log.Printf("Warning: invalid MAX_CONCURRENT_MATCHES %q (must be integer >= 0)", v)
+		}
+	}
+	if len(botCreds) == 0 && !fakeLobbies {
+		coordinator.ManualLobbies = true
+	}
+	if coordinator.MaxConcurrentMatches > 0 {
+		log.Printf("Max concurrent matches set to %d", coordinator.MaxConcurrentMatches)
+	}
+
+	if graceStr := getEnv("REJOIN_GRACE_SECONDS", ""); graceStr != "" {
+		if n, err := strconv.Atoi(graceStr); err == nil && n >= 0 {
+			coordinator.RejoinGraceDur = time.Duration(n) * time.Second
+			log.Printf("Rejoin grace window set to %v", coordinator.RejoinGraceDur)
+		} else {
+			log.Printf("Warning: invalid REJOIN_GRACE_SECONDS %q (must be integer >= 0)", graceStr)
+		}
+	}
+
+	if v := getEnv("AFK_TIMEOUT_MINUTES", ""); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			coordinator.AFKTimeout = time.Duration(n) * time.Minute
+			log.Printf("AFK timeout set to %v", coordinator.AFKTimeout)
+		} else {
+			log.Printf("Warning: invalid AFK_TIMEOUT_MINUTES %q (must be integer >= 0)", v)
+		}
+	}
+
+	if v := getEnv("MAX_QUEUE_MINUTES", ""); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			coordinator.MaxQueueTime = time.Duration(n) * time.Minute
+			log.Printf("Max queue time set to %v", coordinator.MaxQueueTime)
+		} else {
+			log.Printf("Warning: invalid MAX_QUEUE_MINUTES %q (must be integer >= 0)", v)
+		}
+	}
+
+	if v := getEnv("DRAFT_PICK_WARNING_SECONDS", ""); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			coordinator.DraftPickWarningLead = time.Duration(n) * time.Second
+			log.Printf("Draft pick warning set to %v before the deadline", coordinator.DraftPickWarningLead)
+		} else {
+			log.Printf("Warning: invalid DRAFT_PICK_WARNING_SECONDS %q (must be integer >= 0)", v)
+		}
+	}
+
+	if v := getEnv("QUEUE_ALMOST_FULL_COOLDOWN_SECONDS", ""); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			coordinator.QueueAlmostFullCooldown = time.Duration(n) * time.Second
+			log.Printf("Queue almost full notifications at most every %v", coordinator.QueueAlmostFullCooldown)
+		} else {
+			log.Printf("Warning: invalid QUEUE_ALMOST_FULL_COOLDOWN_SECONDS %q (must be integer >= 0)", v)
+		}
+	}
+
+	if v := getEnv("LOBBY_JOIN_WARNING_SECONDS", ""); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			coordinator.LobbyJoinWarningLead = time.Duration(n) * time.Second
+			log.Printf("Lobby join warning set to %v before the timeout", coordinator.LobbyJoinWarningLead)
+		} else {
+			log.Printf("Warning: invalid LOBBY_JOIN_WARNING_SECONDS %q (must be integer >= 0)", v)
+		}
+	}
+
+	if v := getEnv("CAPTAIN_DECAY_HOURS", ""); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			coordinator.CaptainDecayDur = time.Duration(n) * time.Hour
+			log.Printf("Captain priority decay set to %v", coordinator.CaptainDecayDur)
+		} else {
+			log.Printf("Warning: invalid CAPTAIN_DECAY_HOURS %q (must be integer >= 0)", v)
+		}
+	}
+
+	if v := getEnv("DEFAULT_CAPTAIN_PRIORITY", ""); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 1 && n <= 10 {
+			auth.DefaultCaptainPriority = n
+			log.Printf("Default captain priority set to %d", n)
+		} else {
+			log.Printf("Warning: invalid DEFAULT_CAPTAIN_PRIORITY %q (must be between 1 and 10)", v)
+		}
+	}
+
+	if v := getEnv("NEW_PLAYER_GAMES", ""); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			coordinator.NewPlayerGames = n
+			log.Printf("New players' captain priority capped until %d games", n)
+		} else {
+			log.Printf("Warning: invalid NEW_PLAYER_GAMES %q (must be integer >= 0)", v)
+		}
+	}
+
+	if v := getEnv("NEW_PLAYER_CAPTAIN_PRIORITY", ""); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 1 && n <= 10 {
+			coordinator.NewPlayerCaptainPriority = n
+		} else {
+			log.Printf("Warning: invalid NEW_PLAYER_CAPTAIN_PRIORITY %q (must be between 1 and 10)", v)
+		}
+	}
+
+	if v := getEnv("FAILED_ACCEPT_LIMIT", ""); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			coordinator.FailedAcceptLimit = n
+			log.Printf("Failed accept limit set to %d", n)
+		} else {
+			log.Printf("Warning: invalid FAILED_ACCEPT_LIMIT %q (must be integer >= 0)", v)
+		}
+	}
+
+	if v := getEnv("FAILED_ACCEPT_WINDOW_HOURS", ""); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			coordinator.FailedAcceptWindow = time.Duration(n) * time.Hour
+		} else {
+			log.Printf("Warning: invalid FAILED_ACCEPT_WINDOW_HOURS %q (must be positive integer)", v)
+		}
+	}
+
+	if v := getEnv("FAILED_ACCEPT_COOLDOWN_MINUTES", ""); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			coordinator.FailedAcceptCooldown = time.Duration(n) * time.Minute
+		} else {
+			log.Printf("Warning: invalid FAILED_ACCEPT_COOLDOWN_MINUTES %q (must be integer >= 0)", v)
+		}
+	}
+
+	if v := getEnv("VOTE_CANCEL_THRESHOLD", ""); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil && f >= 0 && f <= 1 {
+			coordinator.VoteCancelThreshold = f
+			log.Printf("Vote cancel threshold set to %v", f)
 		} else {
-			log.Printf("Warning: invalid MAX_PLAYERS %q (must be integer >= 2)", maxPlayersStr)
+			log.Printf("Warning: invalid VOTE_CANCEL_THRESHOLD %q (must be between 0 and 1)", v)
 		}
 	}
 
@@ -111,10 +330,33 @@ func main() {
 		}
 	})
 
+	// Restore active matches from disk and set up persistence
+	matchesPath := filepath.Join(filepath.Dir(dbPath), "matches.json")
+	if savedMatches := loadMatches(matchesPath); len(savedMatches) > 0 {
+		coord.RestoreMatches(savedMatches)
+		log.Printf("Restored %d matches from %s", len(savedMatches), matchesPath)
+	}
+	coord.SetMatchPersistence(func(matches []*coordinator.Match) {
+		if err := saveMatches(matchesPath, matches); err != nil {
+			log.Printf("Failed to save matches: %v", err)
+		}
+	})
+	coord.SetLobbyCounter(func(day string) (int, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return db.NextLobbyNumber(ctx, day)
+	})
+
 	// Initialize auth
-	sessions := auth.NewSessionManager(db)
+	sessions := auth.NewSessionManager(db, getEnv("CSRF_SECRET", ""))
 	steamAuth := auth.NewSteamAuth(steamAPIKey, baseURL, db, sessions)
 
+	var discordAuth *auth.DiscordAuth
+	if discordClientID != "" && discordClientSecret != "" {
+		discordAuth = auth.NewDiscordAuth(discordClientID, discordClientSecret, baseURL, db, sessions)
+		log.Println("Discord login enabled")
+	}
+
 	// Create fake users in dev mode
 	if devMode {
 		log.Println("Dev mode enabled")
@@ -150,10 +392,15 @@ func main() {
 
 	// Initialize web server
 	server := web.NewServer(coord, steamAuth, sessions, db, templates, staticFS, web.Config{
-		DevMode:       devMode,
-		AdminSteamIDs: adminSteamIDs,
-		PushService:   pushService,
-		LogPath:       logPath,
+		DevMode:        devMode,
+		AdminSteamIDs:  adminSteamIDs,
+		PushService:    pushService,
+		LogPath:        logPath,
+		DiscordAuth:    discordAuth,
+		MetricsEnabled: metricsEnabled,
+		QueueAllowlist: queueAllowlist,
+		MinGames:       minGames,
+		EmailEnabled:   smtpHost != "",
 	})
 
 	// Create context for graceful shutdown
@@ -170,6 +417,14 @@ func main() {
 	var dotaAPIClient *dotaapi.Client
 	if steamAPIKey != "" {
 		dotaAPIClient = dotaapi.NewClient(steamAPIKey)
+		if v := getEnv("DOTA_API_RATE_LIMIT", ""); v != "" {
+			if rate, err := strconv.ParseFloat(v, 64); err == nil && rate > 0 {
+				dotaAPIClient.SetRateLimit(rate)
+				log.Printf("Dota API rate limit set to %v requests/sec", rate)
+			} else {
+				log.Printf("Warning: invalid DOTA_API_RATE_LIMIT %q (must be a positive number)", v)
+			}
+		}
 		log.Println("Dota API client initialized")
 	} else {
 		log.Println("Warning: No Steam API key, match details won't be fetched from Dota API")
@@ -179,6 +434,25 @@ func main() {
 	recorder := matchrecorder.New(db, dotaAPIClient)
 	recorderEvents := coord.Subscribe()
 	go recorder.Run(ctx, recorderEvents)
+	if dotaAPIClient != nil {
+		server.SetMatchImporter(recorder)
+	}
+
+	// Start webhook notifier if a URL is configured
+	if webhookURL != "" {
+		webhookNotifier := webhook.New(webhookURL)
+		webhookEvents := coord.Subscribe()
+		go webhookNotifier.Run(ctx, webhookEvents)
+		log.Println("Webhook notifications enabled")
+	}
+
+	// Start Discord result posts if a Discord webhook is configured
+	if discordWebhookURL != "" {
+		discordNotifier := discordnotify.New(discordWebhookURL)
+		discordEvents := coord.Subscribe()
+		go discordNotifier.Run(ctx, discordEvents)
+		log.Println("Discord match result posts enabled")
+	}
 
 	// Start push notifier if push service is enabled
 	if pushService != nil {
@@ -188,6 +462,26 @@ func main() {
 		log.Println("Push notifier started")
 	}
 
+	// Start email notifier if SMTP is configured
+	if smtpHost != "" {
+		emailNotifier := email.New(email.Config{
+			Host:     smtpHost,
+			Port:     smtpPort,
+			Username: getEnv("SMTP_USERNAME", ""),
+			Password: getEnv("SMTP_PASSWORD", ""),
+			From:     getEnv("SMTP_FROM", "noreply@example.com"),
+			BaseURL:  baseURL,
+		}, db)
+		go emailNotifier.Run(ctx, coord.Subscribe())
+		log.Println("Email notifications enabled")
+	}
+
+	// Fake players accept matches on their own for end-to-end testing
+	if devMode && getEnv("DEV_AUTO_ACCEPT", "") == "true" {
+		go runDevAutoAccept(ctx, coord, coord.Subscribe())
+		log.Println("Dev auto-accept enabled for fake players")
+	}
+
 	// Start session cleanup job (runs every hour)
 	go func() {
 		ticker := time.NewTicker(1 * time.Hour)
@@ -206,21 +500,31 @@ func main() {
 		}
 	}()
 
-	// Initialize and start bot manager if credentials are configured
-	var botManager *bot.Manager
-	botCreds := []bot.BotCredentials{
-		{Username: bot1User, Password: bot1Pass},
-		{Username: bot2User, Password: bot2Pass},
-		{Username: bot3User, Password: bot3Pass},
-	}
-	// Filter out empty credentials
-	var validCreds []bot.BotCredentials
-	for _, cred := range botCreds {
-		if cred.Username != "" && cred.Password != "" {
-			validCreds = append(validCreds, cred)
-		}
+	// Refresh names and avatars of active users from Steam (runs every hour)
+	if steamAPIKey != "" {
+		go func() {
+			ticker := time.NewTicker(1 * time.Hour)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					n, err := steamAuth.RefreshStaleUsers(ctx, 24*time.Hour)
+					if err != nil {
+						log.Printf("Failed to refresh stale users: %v", err)
+					} else if n > 0 {
+						log.Printf("Refreshed %d Steam profiles", n)
+					}
+				}
+			}
+		}()
 	}
-	if len(validCreds) > 0 {
+
+	// Initialize and start bot manager if credentials are configured, or
+	// fake lobbies in dev mode
+	var botManager bot.LobbyProvider
+	if len(botCreds) > 0 || fakeLobbies {
 		// Create a command channel for bots to send commands back
 		botCommands := make(chan coordinator.Command, 100)
 		go func() {
@@ -229,13 +533,20 @@ func main() {
 			}
 		}()
 
-		botManager = bot.NewManager(bot.Config{
-			Bots: validCreds,
-		}, botCommands)
+		if fakeLobbies {
+			botManager = bot.NewFakeProvider(bot.FakeConfig{}, botCommands)
+			log.Println("Dev fake lobbies enabled")
+		} else {
+			botManager = bot.NewManager(bot.Config{
+				Bots:              botCreds,
+				StaleLobbyTimeout: staleLobbyTimeout,
+			}, botCommands)
+		}
+		server.SetBotManager(botManager)
 		botEvents := coord.Subscribe()
 		go botManager.Run(ctx, botEvents)
 	} else {
-		log.Println("No bot credentials configured. Lobby creation will be skipped.")
+		log.Println("No bot credentials configured. Admins must create lobbies manually.")
 	}
 
 	// Start HTTP server
@@ -278,6 +589,27 @@ func main() {
 	log.Println("Server stopped")
 }
 
+// runDevAutoAccept accepts every match found for the dev fake players
+// (Steam IDs starting with "fake_") as soon as the accept phase starts.
+func runDevAutoAccept(ctx context.Context, coord *coordinator.Coordinator, events <-chan coordinator.Event) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-events:
+			e, ok := event.(coordinator.MatchAcceptStarted)
+			if !ok {
+				continue
+			}
+			for _, p := range e.Players {
+				if strings.HasPrefix(p.SteamID, "fake_") {
+					coord.Send(coordinator.AcceptMatch{PlayerID: p.SteamID, MatchID: e.MatchID})
+				}
+			}
+		}
+	}
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -285,6 +617,47 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// loadBotCredentials reads bot logins from BOT_CREDENTIALS, a JSON array of
+// {"username": ..., "password": ...} objects, or otherwise from numbered
+// BOTn_USERNAME/BOTn_PASSWORD pairs starting at 1 and stopping at the first gap.
+func loadBotCredentials() []bot.BotCredentials {
+	var creds []bot.BotCredentials
+
+	if raw := getEnv("BOT_CREDENTIALS", ""); raw != "" {
+		var entries []struct {
+			Username string `json:"username"`
+			Password string `json:"password"`
+		}
+		if err := json.Unmarshal([]byte(raw), &entries); err != nil {
+			log.Printf("Warning: invalid BOT_CREDENTIALS: %v", err)
+			return nil
+		}
+		for i, e := range entries {
+			if e.Username == "" || e.Password == "" {
+				log.Printf("Warning: BOT_CREDENTIALS entry %d is missing a username or password, skipping", i)
+				continue
+			}
+			creds = append(creds, bot.BotCredentials{Username: e.Username, Password: e.Password})
+		}
+	} else {
+		for n := 1; ; n++ {
+			user := getEnv(fmt.Sprintf("BOT%d_USERNAME", n), "")
+			pass := getEnv(fmt.Sprintf("BOT%d_PASSWORD", n), "")
+			if user == "" && pass == "" {
+				break
+			}
+			if user == "" || pass == "" {
+				log.Printf("Warning: BOT%d_USERNAME and BOT%d_PASSWORD must both be set, skipping", n, n)
+				continue
+			}
+			creds = append(creds, bot.BotCredentials{Username: user, Password: pass})
+		}
+	}
+
+	log.Printf("Configured %d bot(s)", len(creds))
+	return creds
+}
+
 // rotateLogFile renames the log file to .old if it exceeds maxBytes.
 // Keeps one backup only. Errors are non-fatal (logged to stderr).
 func rotateLogFile(path string, maxBytes int64) {
@@ -322,6 +695,12 @@ func loadQueue(path string, db store.Store) []coordinator.Player {
 			Name:            user.Name,
 			AvatarURL:       user.AvatarURL,
 			CaptainPriority: user.CaptainPriority,
+			Rating:          p.Rating,
+			LastCaptainedAt: user.LastCaptainedAt,
+			QueuedAt:        p.QueuedAt,
+			PreferredRoles:  p.PreferredRoles,
+			PreferredHeroes: p.PreferredHeroes,
+			QueueID:         p.QueueID,
 		})
 	}
 	return result
@@ -332,7 +711,39 @@ func saveQueue(path string, queue []coordinator.Player) error {
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(path, data, 0644)
+	return writeFileAtomic(path, data)
+}
+
+// loadMatches reads the saved active matches from a JSON file.
+func loadMatches(path string) []*coordinator.Match {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var matches []*coordinator.Match
+	if err := json.Unmarshal(data, &matches); err != nil {
+		log.Printf("Failed to parse matches file: %v", err)
+		return nil
+	}
+	return matches
+}
+
+func saveMatches(path string, matches []*coordinator.Match) error {
+	data, err := json.Marshal(matches)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+// writeFileAtomic writes data to a temporary file and renames it over path,
+// so a crash mid-write leaves the previous file intact.
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
 }
 
 func findProjectRoot() string {
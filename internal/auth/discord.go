@@ -0,0 +1,335 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/edvart/dota-inhouse/internal/store"
+)
+
+const (
+	discordAuthorizeURL = "https://discord.com/api/oauth2/authorize"
+	discordTokenURL     = "https://discord.com/api/oauth2/token"
+	discordAPIURL       = "https://discord.com/api/v10"
+	discordStateCookie  = "discord_oauth_state"
+	discordLinkCookie   = "discord_link_target"
+)
+
+// DiscordAuth handles Discord OAuth2 authentication. Discord accounts are
+// resolved to Steam IDs through the discord_links table, so a Discord login
+// ends up as the same store.User as the linked Steam login.
+type DiscordAuth struct {
+	clientID     string
+	clientSecret string
+	baseURL      string
+	store        store.Store
+	sessions     *SessionManager
+	httpClient   *http.Client
+}
+
+// DiscordUser represents user data from the Discord API.
+type DiscordUser struct {
+	ID         string `json:"id"`
+	Username   string `json:"username"`
+	GlobalName string `json:"global_name"`
+	Avatar     string `json:"avatar"`
+}
+
+// DisplayName returns the user's global name, falling back to the username.
+func (u *DiscordUser) DisplayName() string {
+	if u.GlobalName != "" {
+		return u.GlobalName
+	}
+	return u.Username
+}
+
+// AvatarURL returns the CDN URL for the user's avatar, or "" if unset.
+func (u *DiscordUser) AvatarURL() string {
+	if u.Avatar == "" {
+		return ""
+	}
+	return fmt.Sprintf("https://cdn.discordapp.com/avatars/%s/%s.png", u.ID, u.Avatar)
+}
+
+type discordConnection struct {
+	Type     string `json:"type"`
+	ID       string `json:"id"`
+	Verified bool   `json:"verified"`
+}
+
+// NewDiscordAuth creates a new Discord authentication handler.
+func NewDiscordAuth(clientID, clientSecret, baseURL string, store store.Store, sessions *SessionManager) *DiscordAuth {
+	return &DiscordAuth{
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		baseURL:      baseURL,
+		store:        store,
+		sessions:     sessions,
+		httpClient:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (da *DiscordAuth) callbackURL() string {
+	return da.baseURL + "/auth/discord/callback"
+}
+
+// LoginHandler redirects to Discord's OAuth2 authorize page. A steam_id query
+// parameter names the player to link the Discord account to when it isn't
+// linked yet, as used by the profile page's link button.
+func (da *DiscordAuth) LoginHandler(w http.ResponseWriter, r *http.Request) {
+	saveRememberChoice(w, r)
+
+	target := &http.Cookie{
+		Name:     discordLinkCookie,
+		Path:     "/auth/discord",
+		MaxAge:   -1,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+	if steamID := r.URL.Query().Get("steam_id"); steamID != "" {
+		target.Value = steamID
+		target.MaxAge = 600
+	}
+	http.SetCookie(w, target)
+
+	state, err := generateSessionID()
+	if err != nil {
+		http.Error(w, "Failed to create auth state", http.StatusInternalServerError)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     discordStateCookie,
+		Value:    state,
+		Path:     "/auth/discord",
+		MaxAge:   600,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	params := url.Values{}
+	params.Set("client_id", da.clientID)
+	params.Set("redirect_uri", da.callbackURL())
+	params.Set("response_type", "code")
+	params.Set("scope", "identify connections")
+	params.Set("state", state)
+
+	http.Redirect(w, r, discordAuthorizeURL+"?"+params.Encode(), http.StatusFound)
+}
+
+// CallbackHandler handles the OAuth2 callback from Discord.
+func (da *DiscordAuth) CallbackHandler(w http.ResponseWriter, r *http.Request) {
+	stateCookie, err := r.Cookie(discordStateCookie)
+	if err != nil || stateCookie.Value == "" || stateCookie.Value != r.URL.Query().Get("state") {
+		http.Error(w, "Invalid OAuth state", http.StatusBadRequest)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:   discordStateCookie,
+		Value:  "",
+		Path:   "/auth/discord",
+		MaxAge: -1,
+	})
+
+	var target string
+	if c, err := r.Cookie(discordLinkCookie); err == nil {
+		target = c.Value
+		http.SetCookie(w, &http.Cookie{
+			Name:   discordLinkCookie,
+			Value:  "",
+			Path:   "/auth/discord",
+			MaxAge: -1,
+		})
+	}
+
+	code := r.URL.Query().Get("code")
+	if code == "" {
+		http.Error(w, "Missing authorization code", http.StatusBadRequest)
+		return
+	}
+
+	token, err := da.exchangeCode(r.Context(), code)
+	if err != nil {
+		http.Error(w, "Discord token exchange failed: "+err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	discordUser, err := da.fetchDiscordUser(r.Context(), token)
+	if err != nil {
+		http.Error(w, "Failed to fetch Discord user: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	steamID, err := da.resolveSteamID(r, token, discordUser.ID, target)
+	if errors.Is(err, errLinkForbidden) {
+		http.Error(w, "You can only link Discord to your own account", http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to resolve Steam account: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if steamID == "" {
+		http.Error(w, "No Steam account linked to this Discord account. Log in with Steam once (or add Steam as a Discord connection) to link them.", http.StatusForbidden)
+		return
+	}
+
+	// Create the user from Discord data if they've never logged in with Steam.
+	existing, err := da.store.GetUser(r.Context(), steamID)
+	if err != nil {
+		http.Error(w, "Failed to load user", http.StatusInternalServerError)
+		return
+	}
+	if existing == nil {
+		now := time.Now()
+		user := &store.User{
+			SteamID:         steamID,
+			Name:            discordUser.DisplayName(),
+			AvatarURL:       discordUser.AvatarURL(),
+			CaptainPriority: DefaultCaptainPriority,
+			CreatedAt:       now,
+			UpdatedAt:       now,
+		}
+		if err := da.store.UpsertUser(r.Context(), user); err != nil {
+			http.Error(w, "Failed to save user", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := da.store.LinkDiscord(r.Context(), discordUser.ID, steamID); err != nil {
+		http.Error(w, "Failed to save Discord link", http.StatusInternalServerError)
+		return
+	}
+
+	if err := da.sessions.CreateSession(r.Context(), w, steamID, loginSessionDuration(w, r)); err != nil {
+		http.Error(w, "Failed to create session", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+var errLinkForbidden = errors.New("not allowed to link Discord to this player")
+
+// resolveSteamID finds the Steam ID for a Discord account. It checks, in order:
+// an existing discord_links row, a verified Steam connection on the Discord
+// account, and the player the link was started for (target), falling back to
+// the Steam user currently logged in on this browser. A target may only be
+// linked while logged in as that player.
+func (da *DiscordAuth) resolveSteamID(r *http.Request, token, discordID, target string) (string, error) {
+	steamID, err := da.store.GetDiscordLink(r.Context(), discordID)
+	if err != nil {
+		return "", err
+	}
+	if steamID != "" {
+		return steamID, nil
+	}
+
+	if steamID := da.fetchSteamConnection(r.Context(), token); steamID != "" {
+		return steamID, nil
+	}
+
+	user, err := da.sessions.GetUser(r.Context(), r)
+	if err != nil {
+		return "", err
+	}
+	if user == nil {
+		return "", nil
+	}
+	if target == "" {
+		return user.SteamID, nil
+	}
+	if user.SteamID != target {
+		return "", errLinkForbidden
+	}
+	return target, nil
+}
+
+func (da *DiscordAuth) exchangeCode(ctx context.Context, code string) (string, error) {
+	form := url.Values{}
+	form.Set("client_id", da.clientID)
+	form.Set("client_secret", da.clientSecret)
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", da.callbackURL())
+
+	req, err := http.NewRequestWithContext(ctx, "POST", discordTokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := da.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("discord token endpoint returned status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", err
+	}
+	if result.AccessToken == "" {
+		return "", fmt.Errorf("no access token returned")
+	}
+
+	return result.AccessToken, nil
+}
+
+func (da *DiscordAuth) getJSON(ctx context.Context, token, path string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", discordAPIURL+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := da.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("discord API returned status %d", resp.StatusCode)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (da *DiscordAuth) fetchDiscordUser(ctx context.Context, token string) (*DiscordUser, error) {
+	var user DiscordUser
+	if err := da.getJSON(ctx, token, "/users/@me", &user); err != nil {
+		return nil, err
+	}
+	if user.ID == "" {
+		return nil, fmt.Errorf("no user data returned")
+	}
+	return &user, nil
+}
+
+// fetchSteamConnection returns the Steam ID from the user's verified Discord
+// connections, or "" if there is none.
+func (da *DiscordAuth) fetchSteamConnection(ctx context.Context, token string) string {
+	var connections []discordConnection
+	if err := da.getJSON(ctx, token, "/users/@me/connections", &connections); err != nil {
+		return ""
+	}
+	for _, c := range connections {
+		if c.Type == "steam" && c.Verified && c.ID != "" {
+			return c.ID
+		}
+	}
+	return ""
+}
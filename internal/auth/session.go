@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/hex"
+	"log"
 	"net/http"
 	"time"
 
@@ -12,49 +13,123 @@ import (
 
 const (
 	SessionCookieName = "session_id"
-	SessionDuration   = 7 * 24 * time.Hour
+
+	// RememberMeDuration is how long a session lasts when the user ticks
+	// "remember me" at login.
+	RememberMeDuration = 30 * 24 * time.Hour
+
+	// BrowserSessionDuration bounds a session whose cookie is dropped when
+	// the browser closes, in case the browser restores it anyway.
+	BrowserSessionDuration = 24 * time.Hour
+
+	// rememberCookie carries the "remember me" choice through the round
+	// trip to Steam or Discord.
+	rememberCookie = "login_remember"
 )
 
+// SessionDuration is how long a session lasts when the user made no
+// "remember me" choice. Can be overridden via SESSION_DURATION env var.
+var SessionDuration = 7 * 24 * time.Hour
+
 // SessionManager handles user sessions.
 type SessionManager struct {
-	store store.Store
+	store   store.Store
+	csrfKey []byte
 }
 
-// NewSessionManager creates a new session manager.
-func NewSessionManager(store store.Store) *SessionManager {
-	return &SessionManager{store: store}
+// NewSessionManager creates a new session manager. csrfSecret keys the CSRF
+// tokens; if empty a random key is used and tokens change on restart.
+func NewSessionManager(store store.Store, csrfSecret string) *SessionManager {
+	key := []byte(csrfSecret)
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			log.Fatalf("Failed to generate CSRF key: %v", err)
+		}
+		log.Println("CSRF_SECRET not set, CSRF tokens will change on restart")
+	}
+	return &SessionManager{store: store, csrfKey: key}
 }
 
-// CreateSession creates a new session for a user and sets the cookie.
-func (sm *SessionManager) CreateSession(ctx context.Context, w http.ResponseWriter, steamID string) error {
+// CreateSession creates a new session for a user and sets the cookie. A
+// duration of 0 makes a browser session cookie that expires server-side
+// after BrowserSessionDuration.
+func (sm *SessionManager) CreateSession(ctx context.Context, w http.ResponseWriter, steamID string, duration time.Duration) error {
 	sessionID, err := generateSessionID()
 	if err != nil {
 		return err
 	}
 
+	persistent := duration > 0
+	if !persistent {
+		duration = BrowserSessionDuration
+	}
+
 	session := &store.Session{
 		ID:        sessionID,
 		SteamID:   steamID,
 		CreatedAt: time.Now(),
-		ExpiresAt: time.Now().Add(SessionDuration),
+		ExpiresAt: time.Now().Add(duration),
 	}
 
 	if err := sm.store.CreateSession(ctx, session); err != nil {
 		return err
 	}
 
-	http.SetCookie(w, &http.Cookie{
+	cookie := &http.Cookie{
 		Name:     SessionCookieName,
 		Value:    sessionID,
 		Path:     "/",
-		Expires:  session.ExpiresAt,
 		HttpOnly: true,
 		SameSite: http.SameSiteLaxMode,
-	})
+	}
+	if persistent {
+		cookie.Expires = session.ExpiresAt
+		cookie.MaxAge = int(duration.Seconds())
+	}
+	http.SetCookie(w, cookie)
 
 	return nil
 }
 
+// saveRememberChoice stores the login form's "remember me" choice, if it
+// made one, until the login callback. The form sends remember=off from a
+// hidden field followed by remember=on from the checkbox when ticked.
+func saveRememberChoice(w http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()["remember"]
+	if len(values) == 0 {
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     rememberCookie,
+		Value:    values[len(values)-1],
+		Path:     "/auth",
+		MaxAge:   600,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// loginSessionDuration returns the session duration for a login callback
+// based on the saved "remember me" choice, and clears the choice.
+func loginSessionDuration(w http.ResponseWriter, r *http.Request) time.Duration {
+	cookie, err := r.Cookie(rememberCookie)
+	if err != nil {
+		return SessionDuration
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:   rememberCookie,
+		Value:  "",
+		Path:   "/auth",
+		MaxAge: -1,
+	})
+
+	if cookie.Value == "on" {
+		return max(RememberMeDuration, SessionDuration)
+	}
+	return 0
+}
+
 // GetSession retrieves the session from the request cookie.
 func (sm *SessionManager) GetSession(ctx context.Context, r *http.Request) (*store.Session, error) {
 	cookie, err := r.Cookie(SessionCookieName)
@@ -100,6 +175,31 @@ func (sm *SessionManager) DeleteSession(ctx context.Context, w http.ResponseWrit
 	return nil
 }
 
+// DeleteAllSessions logs the current user out on every device.
+func (sm *SessionManager) DeleteAllSessions(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	session, err := sm.GetSession(ctx, r)
+	if err != nil {
+		return err
+	}
+	if session == nil {
+		return nil
+	}
+
+	if err := sm.store.DeleteSessionsForUser(ctx, session.SteamID); err != nil {
+		return err
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+	})
+
+	return nil
+}
+
 func generateSessionID() (string, error) {
 	b := make([]byte, 32)
 	if _, err := rand.Read(b); err != nil {
@@ -4,11 +4,13 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"log"
 	"net/http"
 	"regexp"
 	"strings"
 	"time"
 
+	"github.com/edvart/dota-inhouse/internal/steamid"
 	"github.com/edvart/dota-inhouse/internal/store"
 	"github.com/yohcop/openid-go"
 )
@@ -16,10 +18,23 @@ import (
 const (
 	steamOpenIDEndpoint = "https://steamcommunity.com/openid"
 	steamAPIURL         = "https://api.steampowered.com/ISteamUser/GetPlayerSummaries/v0002/"
+
+	// maxSummariesPerCall is how many Steam IDs GetPlayerSummaries accepts
+	// at once.
+	maxSummariesPerCall = 100
+
+	// Retries for fetching a user's profile at login, e.g. when Steam rate
+	// limits a burst of logins. Kept short as the user is waiting.
+	steamFetchAttempts     = 3
+	steamFetchInitialDelay = 500 * time.Millisecond
 )
 
 var steamIDRegex = regexp.MustCompile(`https://steamcommunity\.com/openid/id/(\d+)`)
 
+// DefaultCaptainPriority is the captain priority new users start with. Can be
+// overridden via DEFAULT_CAPTAIN_PRIORITY env var.
+var DefaultCaptainPriority = 5
+
 // SteamAuth handles Steam OpenID authentication.
 type SteamAuth struct {
 	apiKey         string
@@ -35,6 +50,7 @@ type SteamUser struct {
 	SteamID     string `json:"steamid"`
 	PersonaName string `json:"personaname"`
 	AvatarURL   string `json:"avatarfull"`
+	AvatarHash  string `json:"avatarhash"`
 }
 
 // NewSteamAuth creates a new Steam authentication handler.
@@ -51,6 +67,7 @@ func NewSteamAuth(apiKey, baseURL string, store store.Store, sessions *SessionMa
 
 // LoginHandler redirects to Steam's OpenID login.
 func (sa *SteamAuth) LoginHandler(w http.ResponseWriter, r *http.Request) {
+	saveRememberChoice(w, r)
 	callbackURL := sa.baseURL + "/auth/callback"
 
 	authURL, err := openid.RedirectURL(
@@ -85,30 +102,37 @@ func (sa *SteamAuth) CallbackHandler(w http.ResponseWriter, r *http.Request) {
 	steamID := matches[1]
 
 	// Fetch user info from Steam API
-	steamUser, err := sa.fetchSteamUser(r.Context(), steamID)
+	steamUser, err := sa.fetchSteamUserWithRetry(r.Context(), steamID)
 	if err != nil {
-		http.Error(w, "Failed to fetch Steam user: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	// Create or update user in database
-	now := time.Now()
-	user := &store.User{
-		SteamID:         steamUser.SteamID,
-		Name:            steamUser.PersonaName,
-		AvatarURL:       steamUser.AvatarURL,
-		CaptainPriority: 5, // Default priority
-		CreatedAt:       now,
-		UpdatedAt:       now,
-	}
+		// Don't lock players out while the Steam API is down or rate
+		// limiting. Their profile is filled in on a later login or by
+		// RefreshStaleUsers.
+		log.Printf("Steam API unavailable for %s, logging in without profile: %v", steamID, err)
+		if err := sa.ensureUser(r.Context(), steamID); err != nil {
+			http.Error(w, "Failed to save user", http.StatusInternalServerError)
+			return
+		}
+	} else {
+		// Create or update user in database
+		now := time.Now()
+		user := &store.User{
+			SteamID:         steamUser.SteamID,
+			Name:            steamUser.PersonaName,
+			AvatarURL:       steamUser.AvatarURL,
+			AvatarHash:      steamUser.AvatarHash,
+			CaptainPriority: DefaultCaptainPriority,
+			CreatedAt:       now,
+			UpdatedAt:       now,
+		}
 
-	if err := sa.store.UpsertUser(r.Context(), user); err != nil {
-		http.Error(w, "Failed to save user", http.StatusInternalServerError)
-		return
+		if err := sa.store.UpsertUser(r.Context(), user); err != nil {
+			http.Error(w, "Failed to save user", http.StatusInternalServerError)
+			return
+		}
 	}
 
 	// Create session
-	if err := sa.sessions.CreateSession(r.Context(), w, steamID); err != nil {
+	if err := sa.sessions.CreateSession(r.Context(), w, steamID, loginSessionDuration(w, r)); err != nil {
 		http.Error(w, "Failed to create session", http.StatusInternalServerError)
 		return
 	}
@@ -123,8 +147,69 @@ func (sa *SteamAuth) LogoutHandler(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/", http.StatusFound)
 }
 
+// LogoutAllHandler logs the user out of every session, on all devices.
+func (sa *SteamAuth) LogoutAllHandler(w http.ResponseWriter, r *http.Request) {
+	if err := sa.sessions.DeleteAllSessions(r.Context(), w, r); err != nil {
+		http.Error(w, "Failed to log out", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
 func (sa *SteamAuth) fetchSteamUser(ctx context.Context, steamID string) (*SteamUser, error) {
-	reqURL := fmt.Sprintf("%s?key=%s&steamids=%s", steamAPIURL, sa.apiKey, steamID)
+	users, err := sa.fetchSteamUsers(ctx, []string{steamID})
+	if err != nil {
+		return nil, err
+	}
+	if len(users) == 0 {
+		return nil, fmt.Errorf("no player data returned")
+	}
+	return &users[0], nil
+}
+
+// fetchSteamUserWithRetry calls fetchSteamUser, retrying failures with a
+// short backoff.
+func (sa *SteamAuth) fetchSteamUserWithRetry(ctx context.Context, steamID string) (*SteamUser, error) {
+	delay := steamFetchInitialDelay
+	for attempt := 1; ; attempt++ {
+		user, err := sa.fetchSteamUser(ctx, steamID)
+		if err == nil || attempt == steamFetchAttempts {
+			return user, err
+		}
+		log.Printf("Steam API fetch for %s failed (attempt %d): %v; retrying in %s", steamID, attempt, err, delay)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// ensureUser creates a placeholder user named after their Steam ID if they
+// don't exist yet. Existing users are left alone so their name is kept.
+// The placeholder is marked as never updated, so RefreshStaleUsers fetches
+// the real profile on its next run.
+func (sa *SteamAuth) ensureUser(ctx context.Context, steamID string) error {
+	existing, err := sa.store.GetUser(ctx, steamID)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return nil
+	}
+	return sa.store.UpsertUser(ctx, &store.User{
+		SteamID:         steamID,
+		Name:            steamID,
+		CaptainPriority: DefaultCaptainPriority,
+		CreatedAt:       time.Now(),
+	})
+}
+
+// fetchSteamUsers looks up at most maxSummariesPerCall users in one call.
+// Unknown Steam IDs are left out of the result.
+func (sa *SteamAuth) fetchSteamUsers(ctx context.Context, steamIDs []string) ([]SteamUser, error) {
+	reqURL := fmt.Sprintf("%s?key=%s&steamids=%s", steamAPIURL, sa.apiKey, strings.Join(steamIDs, ","))
 
 	req, err := http.NewRequestWithContext(ctx, "GET", reqURL, nil)
 	if err != nil {
@@ -151,11 +236,58 @@ func (sa *SteamAuth) fetchSteamUser(ctx context.Context, steamID string) (*Steam
 		return nil, err
 	}
 
-	if len(result.Response.Players) == 0 {
-		return nil, fmt.Errorf("no player data returned")
+	return result.Response.Players, nil
+}
+
+// RefreshStaleUsers updates the names and avatars of logged in users whose
+// profile is older than maxAge from the Steam API, in batches, and returns
+// how many changed. Users Steam doesn't return are marked fresh anyway so
+// they aren't retried on every run.
+func (sa *SteamAuth) RefreshStaleUsers(ctx context.Context, maxAge time.Duration) (int, error) {
+	stale, err := sa.store.GetStaleUsers(ctx, time.Now().Add(-maxAge))
+	if err != nil {
+		return 0, err
 	}
 
-	return &result.Response.Players[0], nil
+	// Dev fake users and the like have no Steam profile
+	var users []store.User
+	for _, u := range stale {
+		if _, err := steamid.Parse(u.SteamID); err == nil {
+			users = append(users, u)
+		}
+	}
+
+	changed := 0
+	for start := 0; start < len(users); start += maxSummariesPerCall {
+		batch := users[start:min(start+maxSummariesPerCall, len(users))]
+		ids := make([]string, len(batch))
+		for i, u := range batch {
+			ids[i] = u.SteamID
+		}
+		summaries, err := sa.fetchSteamUsers(ctx, ids)
+		if err != nil {
+			return changed, err
+		}
+		byID := make(map[string]SteamUser, len(summaries))
+		for _, su := range summaries {
+			byID[su.SteamID] = su
+		}
+
+		now := time.Now()
+		for _, u := range batch {
+			if su, ok := byID[u.SteamID]; ok {
+				if su.PersonaName != u.Name || su.AvatarHash != u.AvatarHash || su.AvatarURL != u.AvatarURL {
+					changed++
+				}
+				u.Name, u.AvatarURL, u.AvatarHash = su.PersonaName, su.AvatarURL, su.AvatarHash
+			}
+			u.UpdatedAt = now
+			if err := sa.store.UpsertUser(ctx, &u); err != nil {
+				return changed, err
+			}
+		}
+	}
+	return changed, nil
 }
 
 // DevLoginHandler provides a development-only login mechanism.
@@ -174,7 +306,7 @@ func (sa *SteamAuth) DevLoginHandler(w http.ResponseWriter, r *http.Request) {
 		SteamID:         steamID,
 		Name:            name,
 		AvatarURL:       "",
-		CaptainPriority: 5,
+		CaptainPriority: DefaultCaptainPriority,
 		CreatedAt:       now,
 		UpdatedAt:       now,
 	}
@@ -185,7 +317,7 @@ func (sa *SteamAuth) DevLoginHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Create session
-	if err := sa.sessions.CreateSession(r.Context(), w, steamID); err != nil {
+	if err := sa.sessions.CreateSession(r.Context(), w, steamID, SessionDuration); err != nil {
 		http.Error(w, "Failed to create session", http.StatusInternalServerError)
 		return
 	}
@@ -249,7 +381,7 @@ func (sa *SteamAuth) CreateFakeUsers(ctx context.Context, count int) error {
 			SteamID:         fmt.Sprintf("fake_%d", i),
 			Name:            fmt.Sprintf("Player %d", i),
 			AvatarURL:       "",
-			CaptainPriority: 5,
+			CaptainPriority: DefaultCaptainPriority,
 			CreatedAt:       now,
 			UpdatedAt:       now,
 		}
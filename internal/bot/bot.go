@@ -2,38 +2,59 @@ package bot
 
 import (
 	"context"
+	"crypto/rand"
 	"fmt"
-	"log"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/edvart/dota-inhouse/internal/coordinator"
+	"github.com/edvart/dota-inhouse/internal/dotaapi"
+	"github.com/edvart/dota-inhouse/internal/logging"
+	"github.com/edvart/dota-inhouse/internal/steamid"
 	"github.com/golang/protobuf/proto"
 	"github.com/paralin/go-dota2"
 	"github.com/paralin/go-dota2/cso"
 	"github.com/paralin/go-dota2/protocol"
 	"github.com/paralin/go-steam"
-	"github.com/paralin/go-steam/steamid"
+	gosteamid "github.com/paralin/go-steam/steamid"
 	"github.com/sirupsen/logrus"
 )
 
+var logger = logging.New("bot")
+
 type Bot struct {
 	name         string
+	logger       *logging.Logger
 	client       *steam.Client
 	dota2Client  *dota2.Dota2
 	loggedIn     bool
 	busy         bool
+	matchID      string // Match being hosted while busy
 	autoEndDelay time.Duration
+	staleTimeout time.Duration
+	lobbyCancel  context.CancelFunc // Cancels the lobby currently being hosted
+	lobbyGen     uint64             // Incremented per lobby and on force-free, see CreateLobby
+	teamUpdates  chan teamAssignment
 	ctx          context.Context
 	cancel       context.CancelFunc
 	mu           sync.Mutex
 }
 
+// teamAssignment is a change to the expected teams of the hosted lobby.
+type teamAssignment struct {
+	radiant []coordinator.Player
+	dire    []coordinator.Player
+}
+
 func NewBot(username, password string) *Bot {
 	bot := &Bot{
-		name:   username,
-		client: steam.NewClient(),
+		name:        username,
+		logger:      logger.Named("bot", username),
+		client:      steam.NewClient(),
+		teamUpdates: make(chan teamAssignment, 1),
 	}
 
 	loginInfo := &steam.LogOnDetails{
@@ -50,14 +71,14 @@ func (b *Bot) connectWithRetry(loginInfo *steam.LogOnDetails, maxRetries int, ti
 	attempt := 0
 	for {
 		attempt++
-		log.Printf("[%s] Connection attempt %d", b.name, attempt)
+		b.logger.Infof("Connection attempt %d", attempt)
 
 		firstEvent := b.attemptConnection(timeout)
 		if firstEvent != nil {
-			log.Printf("[%s] Connection established, listening to events", b.name)
+			b.logger.Infof("Connection established, listening to events")
 			b.handleEvents(loginInfo, firstEvent)
 			// If handleEvents returns, the connection was lost - reconnect
-			log.Printf("[%s] Connection lost, will reconnect...", b.name)
+			b.logger.Infof("Connection lost, will reconnect...")
 			attempt = 0 // Reset attempt counter after successful connection
 		}
 
@@ -66,7 +87,7 @@ func (b *Bot) connectWithRetry(loginInfo *steam.LogOnDetails, maxRetries int, ti
 		if backoff > 60*time.Second {
 			backoff = 60 * time.Second
 		}
-		log.Printf("[%s] Connection failed, retrying in %v...", b.name, backoff)
+		b.logger.Infof("Connection failed, retrying in %v...", backoff)
 		time.Sleep(backoff)
 
 		b.mu.Lock()
@@ -93,11 +114,11 @@ func (b *Bot) attemptConnection(timeout time.Duration) interface{} {
 		if event != nil {
 			return event
 		}
-		log.Printf("[%s] Connection timed out", b.name)
+		b.logger.Infof("Connection timed out")
 		b.client.Disconnect()
 		return nil
 	case <-time.After(timeout + 2*time.Second):
-		log.Printf("[%s] Connection attempt timed out", b.name)
+		b.logger.Infof("Connection attempt timed out")
 		b.client.Disconnect()
 		return nil
 	}
@@ -111,7 +132,7 @@ func (b *Bot) handleEvents(loginInfo *steam.LogOnDetails, firstEvent interface{}
 	b.mu.Unlock()
 	defer cancel()
 
-	log.Printf("[%s] Listening to steam client events", b.name)
+	b.logger.Infof("Listening to steam client events")
 
 	b.processEvent(firstEvent, loginInfo)
 
@@ -123,17 +144,17 @@ func (b *Bot) handleEvents(loginInfo *steam.LogOnDetails, firstEvent interface{}
 func (b *Bot) processEvent(event interface{}, loginInfo *steam.LogOnDetails) {
 	switch event.(type) {
 	case *steam.ConnectedEvent:
-		log.Printf("[%s] Connected, logging on…", b.name)
+		b.logger.Infof("Connected, logging on…")
 		b.client.Auth.LogOn(loginInfo)
 
 	case *steam.LoggedOnEvent:
 		b.mu.Lock()
 		b.loggedIn = true
 		b.mu.Unlock()
-		log.Printf("[%s] Logged on successfully!", b.name)
+		b.logger.Infof("Logged on successfully!")
 
 	case *steam.DisconnectedEvent:
-		log.Printf("[%s] Disconnected.", b.name)
+		b.logger.Infof("Disconnected.")
 		b.mu.Lock()
 		b.loggedIn = false
 		b.mu.Unlock()
@@ -146,8 +167,45 @@ func (b *Bot) IsAvailable() bool {
 	return b.loggedIn && !b.busy
 }
 
+// Status is a snapshot of a bot's state for the admin panel.
+type Status struct {
+	Name           string `json:"name"`
+	LoggedIn       bool   `json:"loggedIn"`
+	Busy           bool   `json:"busy"`
+	CurrentMatchID string `json:"currentMatchId,omitempty"`
+}
+
+func (b *Bot) Status() Status {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return Status{
+		Name:           b.name,
+		LoggedIn:       b.loggedIn,
+		Busy:           b.busy,
+		CurrentMatchID: b.matchID,
+	}
+}
+
+// LobbyJoinTimeout is used when a lobby request doesn't specify its own timeout.
 const LobbyJoinTimeout = 5 * time.Minute
 
+// MaxLobbyRelaunches is how many times a lobby that fell back to UI after
+// launching (e.g. a player never connected) is relaunched before giving up.
+const MaxLobbyRelaunches = 2
+
+// MatchProgressInterval is how often a running game's live status is
+// reported to the coordinator.
+const MatchProgressInterval = 30 * time.Second
+
+// LobbyJoinProgressInterval is how often the bot checks who has joined the
+// lobby, reporting to the coordinator only when that changes.
+const LobbyJoinProgressInterval = 5 * time.Second
+
+// StrangerKickInterval is how long the bot waits before kicking a stranger
+// who is still sitting in a team slot again.
+const StrangerKickInterval = 5 * time.Second
+
+// gameModeFromString maps a ValidGameModes key to the Dota lobby game mode.
 func gameModeFromString(mode string) protocol.DOTA_GameMode {
 	switch mode {
 	case "ap":
@@ -161,28 +219,72 @@ func gameModeFromString(mode string) protocol.DOTA_GameMode {
 	case "ar":
 		return protocol.DOTA_GameMode_DOTA_GAMEMODE_AR
 	default:
-		return protocol.DOTA_GameMode_DOTA_GAMEMODE_CM
+		logger.Warnf("Unknown game mode %q, falling back to All Pick", mode)
+		return protocol.DOTA_GameMode_DOTA_GAMEMODE_AP
 	}
 }
 
-func (b *Bot) CreateLobby(ctx context.Context, matchID string, players []coordinator.Player, radiant []coordinator.Player, dire []coordinator.Player, gameMode string, commands chan<- coordinator.Command) bool {
+// allowedHeroes returns the known hero IDs minus the banned ones. The
+// practice lobby has no ban list; it restricts selection to the requested
+// hero IDs instead.
+func allowedHeroes(banned []int) []int32 {
+	isBanned := make(map[int]bool, len(banned))
+	for _, id := range banned {
+		isBanned[id] = true
+	}
+	var ids []int32
+	for _, hero := range dotaapi.Heroes() {
+		if !isBanned[hero.ID] {
+			ids = append(ids, int32(hero.ID))
+		}
+	}
+	return ids
+}
+
+// tvDelayFromSeconds maps a spectator delay in seconds to the closest
+// supported DotaTV delay that is at least as long.
+func tvDelayFromSeconds(seconds int) protocol.LobbyDotaTVDelay {
+	switch {
+	case seconds <= 10:
+		return protocol.LobbyDotaTVDelay_LobbyDotaTV_10
+	case seconds <= 120:
+		return protocol.LobbyDotaTVDelay_LobbyDotaTV_120
+	case seconds <= 300:
+		return protocol.LobbyDotaTVDelay_LobbyDotaTV_300
+	default:
+		return protocol.LobbyDotaTVDelay_LobbyDotaTV_900
+	}
+}
+
+func (b *Bot) CreateLobby(ctx context.Context, req coordinator.RequestBotLobby, commands chan<- coordinator.Command) bool {
 	b.mu.Lock()
 	if !b.loggedIn {
 		b.mu.Unlock()
-		log.Printf("[%s] Cannot create lobby: not logged in", b.name)
+		b.logger.Errorf("Cannot create lobby: not logged in")
 		return false
 	}
 	b.busy = true
+	b.matchID = req.MatchID
+	ctx, lobbyCancel := context.WithCancel(ctx)
+	b.lobbyCancel = lobbyCancel
+	b.lobbyGen++
+	gen := b.lobbyGen
 	b.mu.Unlock()
 
 	defer func() {
+		lobbyCancel()
 		b.mu.Lock()
-		b.busy = false
+		// After a force-free the bot may already be hosting another lobby.
+		if b.lobbyGen == gen {
+			b.busy = false
+			b.matchID = ""
+			b.lobbyCancel = nil
+		}
 		b.mu.Unlock()
 	}()
 
 	if b.dota2Client == nil {
-		log.Printf("[%s] Creating new Dota 2 client", b.name)
+		b.logger.Infof("Creating new Dota 2 client")
 		logger := logrus.New()
 		logger.SetLevel(logrus.WarnLevel)
 		b.dota2Client = dota2.New(b.client, logger)
@@ -191,50 +293,117 @@ func (b *Bot) CreateLobby(ctx context.Context, matchID string, players []coordin
 		b.dota2Client.SayHello()
 		time.Sleep(3 * time.Second)
 	} else {
-		log.Printf("[%s] Reusing existing Dota 2 client", b.name)
+		b.logger.Infof("Reusing existing Dota 2 client")
 		b.dota2Client.SetPlaying(true)
 		b.dota2Client.SayHello()
 	}
 
-	log.Printf("[%s] Creating lobby for match %s", b.name, matchID)
+	b.logger.Match(req.MatchID).Infof("Creating lobby for match %s", req.MatchID)
 
-	lobbyName := fmt.Sprintf("Inhouse Match %s", matchID[:8])
-	dotaGameMode := gameModeFromString(gameMode)
-	log.Printf("[%s] Creating lobby with game mode: %s (%v)", b.name, gameMode, dotaGameMode)
-	b.dota2Client.LeaveCreateLobby(b.ctx, &protocol.CMsgPracticeLobbySetDetails{
+	lobbyName := req.LobbyName
+	if lobbyName == "" {
+		lobbyName = fmt.Sprintf("Inhouse Match %s", req.MatchID[:8])
+	}
+	password := lobbyPassword()
+	dotaGameMode := gameModeFromString(req.GameMode)
+	b.logger.Infof("Creating lobby with game mode: %s (%v)", req.GameMode, dotaGameMode)
+	details := &protocol.CMsgPracticeLobbySetDetails{
 		AllowCheats:     proto.Bool(false),
 		AllowSpectating: proto.Bool(true),
 		GameName:        proto.String(lobbyName),
+		PassKey:         proto.String(password),
 		GameMode:        proto.Uint32(uint32(dotaGameMode)),
 		Visibility:      protocol.DOTALobbyVisibility_DOTALobbyVisibility_Public.Enum(),
 		DotaTvDelay:     protocol.LobbyDotaTVDelay_LobbyDotaTV_10.Enum(),
-	}, true)
+	}
+	if req.Tournament {
+		details.DotaTvDelay = tvDelayFromSeconds(req.SpectatorDelay).Enum()
+		b.logger.Infof("Tournament mode: %ds spectator delay", req.SpectatorDelay)
+	}
+	if regionID, ok := coordinator.ServerRegionIDs[req.ServerRegion]; ok {
+		details.ServerRegion = proto.Uint32(regionID)
+		b.logger.Infof("Using server region: %s (%d)", req.ServerRegion, regionID)
+	}
+	if len(req.BannedHeroes) > 0 {
+		details.RequestedHeroIds = allowedHeroes(req.BannedHeroes)
+		b.logger.Infof("Banning %d heroes", len(req.BannedHeroes))
+	}
+	b.dota2Client.LeaveCreateLobby(b.ctx, details, true)
 
-	log.Printf("[%s] Moving bot to unassigned pool", b.name)
+	b.logger.Infof("Moving bot to unassigned pool")
 	b.dota2Client.JoinLobbyTeam(protocol.DOTA_GC_TEAM_DOTA_GC_TEAM_PLAYER_POOL, 1)
 	time.Sleep(time.Second)
 
-	log.Printf("[%s] Inviting players", b.name)
-	for _, player := range players {
-		id, err := strconv.ParseUint(player.SteamID, 10, 64)
+	b.logger.Infof("Inviting players")
+	for _, player := range req.Players {
+		id, err := steamid.Parse(player.SteamID)
 		if err == nil {
-			b.dota2Client.InviteLobbyMember(steamid.SteamId(id))
-			log.Printf("[%s] Invited player: %s", b.name, player.Name)
+			b.dota2Client.InviteLobbyMember(gosteamid.SteamId(id))
+			b.logger.Infof("Invited player: %s", player.Name)
 		} else {
-			log.Printf("[%s] Invalid steam ID for player %s: %v", b.name, player.Name, err)
+			b.logger.Errorf("Invalid steam ID for player %s: %v", player.Name, err)
 		}
 	}
 
-	commands <- coordinator.BotLobbyReady{MatchID: matchID}
+	commands <- coordinator.BotLobbyReady{
+		MatchID:   req.MatchID,
+		LobbyName: lobbyName,
+		Password:  password,
+	}
+
+	joinTimeout := req.JoinTimeout
+	if joinTimeout <= 0 {
+		joinTimeout = LobbyJoinTimeout
+	}
 
-	b.monitorLobbyState(ctx, matchID, radiant, dire, commands)
+	b.monitorLobbyState(ctx, req.MatchID, req.Radiant, req.Dire, req.KickStrangers, joinTimeout, req.JoinWarning, commands)
 	return true
 }
 
-func (b *Bot) monitorLobbyState(ctx context.Context, matchID string, expectedRadiant []coordinator.Player, expectedDire []coordinator.Player, commands chan<- coordinator.Command) {
+// UpdateTeams changes the expected teams of the lobby currently being hosted.
+// Only the latest update is kept if the bot hasn't processed the previous one.
+func (b *Bot) UpdateTeams(radiant, dire []coordinator.Player) {
+	update := teamAssignment{radiant: radiant, dire: dire}
+	for {
+		select {
+		case b.teamUpdates <- update:
+			return
+		default:
+		}
+		select {
+		case <-b.teamUpdates:
+		default:
+		}
+	}
+}
+
+// ForceFree stops monitoring the current lobby, destroys it and marks the bot
+// as available again. It returns the ID of the match that was being hosted,
+// or "" if the bot was idle.
+func (b *Bot) ForceFree() string {
+	b.mu.Lock()
+	cancel := b.lobbyCancel
+	dota2Client := b.dota2Client
+	matchID := b.matchID
+	b.busy = false
+	b.matchID = ""
+	b.lobbyCancel = nil
+	b.lobbyGen++
+	b.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+	if dota2Client != nil && b.ctx != nil {
+		dota2Client.DestroyLobby(b.ctx)
+	}
+	return matchID
+}
+
+func (b *Bot) monitorLobbyState(ctx context.Context, matchID string, expectedRadiant []coordinator.Player, expectedDire []coordinator.Player, kickStrangers bool, joinTimeout, joinWarning time.Duration, commands chan<- coordinator.Command) {
 	eventCh, eventCancel, err := b.dota2Client.GetCache().SubscribeType(cso.Lobby)
 	if err != nil {
-		log.Printf("[%s] Failed to subscribe to lobby events: %v", b.name, err)
+		b.logger.Errorf("Failed to subscribe to lobby events: %v", err)
 		// Clean up the lobby we created
 		b.dota2Client.DestroyLobby(b.ctx)
 		// Notify coordinator that lobby failed (no players joined)
@@ -246,41 +415,64 @@ func (b *Bot) monitorLobbyState(ctx context.Context, matchID string, expectedRad
 	}
 	defer eventCancel()
 
-	// Build expected team maps (Steam ID -> expected team)
-	// Team 0 = Radiant (GOOD_GUYS), Team 1 = Dire (BAD_GUYS)
-	expectedTeam := make(map[uint64]int)
-	for _, p := range expectedRadiant {
-		if id, err := strconv.ParseUint(p.SteamID, 10, 64); err == nil {
-			expectedTeam[id] = 0
-		}
-	}
-	for _, p := range expectedDire {
-		if id, err := strconv.ParseUint(p.SteamID, 10, 64); err == nil {
-			expectedTeam[id] = 1
-		}
+	expectedTeam := buildExpectedTeams(expectedRadiant, expectedDire)
+
+	// Drop team updates left over from a previous lobby
+	select {
+	case <-b.teamUpdates:
+	default:
 	}
 
+	botSteamID := b.client.SteamId().ToUint64()
+	kicked := make(map[uint64]time.Time)
+
 	var lastState protocol.CSODOTALobby_State = protocol.CSODOTALobby_UI
 	var currentLobby *protocol.CSODOTALobby // Track latest lobby state
 	launched := false
+	relaunches := 0
 	gameEnded := false
 	var endGameOnce sync.Once
 
 	// Start lobby join timeout
-	timeoutTimer := time.NewTimer(LobbyJoinTimeout)
+	timeoutTimer := time.NewTimer(joinTimeout)
 	defer timeoutTimer.Stop()
 
-	log.Printf("[%s] Started monitoring lobby state (timeout: %v)", b.name, LobbyJoinTimeout)
+	// Hurry missing players shortly before the timeout
+	var warning <-chan time.Time
+	if joinWarning > 0 && joinWarning < joinTimeout {
+		warningTimer := time.NewTimer(joinTimeout - joinWarning)
+		defer warningTimer.Stop()
+		warning = warningTimer.C
+	}
+
+	// Watchdog for running games: if the bot stops receiving lobby events it
+	// has probably lost its connection and would never see POSTGAME.
+	staleTimeout := b.staleTimeout
+	if staleTimeout <= 0 {
+		staleTimeout = DefaultStaleLobbyTimeout
+	}
+	staleTimer := time.NewTimer(staleTimeout)
+	staleTimer.Stop()
+	defer staleTimer.Stop()
+
+	progressTicker := time.NewTicker(MatchProgressInterval)
+	defer progressTicker.Stop()
+
+	joinTicker := time.NewTicker(LobbyJoinProgressInterval)
+	defer joinTicker.Stop()
+	var lastJoined string
+
+	b.logger.Infof("Started monitoring lobby state (timeout: %v)", joinTimeout)
 
 	for {
 		select {
 		case <-ctx.Done():
-			log.Printf("[%s] Lobby monitoring cancelled", b.name)
+			b.logger.Infof("Lobby monitoring cancelled")
 			return
 
 		case <-timeoutTimer.C:
 			if !launched && !gameEnded {
-				log.Printf("[%s] Lobby join timeout reached", b.name)
+				b.logger.Infof("Lobby join timeout reached")
 				// Get list of players who joined correctly from last known state
 				joinedCorrectly := b.getCorrectlyJoinedPlayers(currentLobby, expectedTeam)
 				commands <- coordinator.BotLobbyTimeout{
@@ -291,9 +483,64 @@ func (b *Bot) monitorLobbyState(ctx context.Context, matchID string, expectedRad
 				return
 			}
 
+		case <-warning:
+			if !launched && !gameEnded {
+				b.logger.Infof("Lobby join timeout in %v, warning missing players", joinWarning)
+				commands <- coordinator.BotLobbyJoinWarning{
+					MatchID: matchID,
+					Joined:  b.getCorrectlyJoinedPlayers(currentLobby, expectedTeam),
+				}
+			}
+
+		case update := <-b.teamUpdates:
+			b.logger.Infof("Expected teams updated")
+			expectedTeam = buildExpectedTeams(update.radiant, update.dire)
+			if !launched && currentLobby != nil {
+				b.kickFromWrongTeam(currentLobby, expectedTeam)
+			}
+
+		case <-staleTimer.C:
+			if lastState == protocol.CSODOTALobby_RUN && !gameEnded {
+				b.logger.Infof("No lobby events for %v while game running, assuming connection lost", staleTimeout)
+				var dotaMatchID uint64
+				if currentLobby != nil {
+					dotaMatchID = currentLobby.GetMatchId()
+				}
+				endGameOnce.Do(func() {
+					gameEnded = true
+					commands <- coordinator.BotGameEnded{
+						MatchID:     matchID,
+						DotaMatchID: dotaMatchID,
+					}
+					b.dota2Client.DestroyLobby(b.ctx)
+				})
+				return
+			}
+
+		case <-progressTicker.C:
+			if lastState == protocol.CSODOTALobby_RUN && !gameEnded && currentLobby != nil {
+				commands <- coordinator.BotMatchProgress{
+					MatchID:  matchID,
+					Progress: gameProgress(currentLobby),
+				}
+			}
+
+		case <-joinTicker.C:
+			if lastState == protocol.CSODOTALobby_UI && !launched && !gameEnded && currentLobby != nil {
+				joined := b.getCorrectlyJoinedPlayers(currentLobby, expectedTeam)
+				sort.Strings(joined)
+				if key := strings.Join(joined, ","); key != lastJoined {
+					lastJoined = key
+					commands <- coordinator.BotLobbyJoinProgress{
+						MatchID: matchID,
+						Joined:  joined,
+					}
+				}
+			}
+
 		case lobbyEvent, ok := <-eventCh:
 			if !ok {
-				log.Printf("[%s] Lobby event channel closed", b.name)
+				b.logger.Infof("Lobby event channel closed")
 				return
 			}
 
@@ -301,59 +548,219 @@ func (b *Bot) monitorLobbyState(ctx context.Context, matchID string, expectedRad
 			currentLobby = dota2Lobby // Update tracked lobby state
 			currentState := dota2Lobby.GetState()
 
+			if currentState == protocol.CSODOTALobby_RUN {
+				staleTimer.Reset(staleTimeout)
+			} else {
+				staleTimer.Stop()
+			}
+
 			if currentState != lastState {
-				log.Printf("[%s] Lobby state changed: %v -> %v", b.name, lastState, currentState)
+				b.logger.Infof("Lobby state changed: %v -> %v", lastState, currentState)
+				previousState := lastState
 				lastState = currentState
 
 				switch currentState {
 				case protocol.CSODOTALobby_UI:
-					log.Printf("[%s] Lobby in UI state (setup)", b.name)
+					b.logger.Infof("Lobby in UI state (setup)")
+
+					// The game server failed to start or a player never connected,
+					// so the lobby dropped back to setup without reaching POSTGAME.
+					if launched && !gameEnded && (previousState == protocol.CSODOTALobby_RUN || previousState == protocol.CSODOTALobby_SERVERSETUP) {
+						if relaunches >= MaxLobbyRelaunches {
+							b.logger.Infof("Lobby returned to UI after launch %d times, giving up", relaunches+1)
+							commands <- coordinator.BotLobbyTimeout{
+								MatchID:            matchID,
+								PlayersJoinedRight: b.getCorrectlyJoinedPlayers(dota2Lobby, expectedTeam),
+							}
+							b.dota2Client.DestroyLobby(b.ctx)
+							return
+						}
+						relaunches++
+						b.logger.Infof("Lobby returned to UI after launch, waiting for teams to relaunch (attempt %d/%d)", relaunches, MaxLobbyRelaunches)
+						launched = false
+						timeoutTimer.Reset(joinTimeout)
+					}
 
 				case protocol.CSODOTALobby_READYUP:
-					log.Printf("[%s] Ready check phase", b.name)
+					b.logger.Infof("Ready check phase")
 
 				case protocol.CSODOTALobby_SERVERSETUP:
-					log.Printf("[%s] Server is being set up", b.name)
+					b.logger.Infof("Server is being set up")
 
 				case protocol.CSODOTALobby_RUN:
-					log.Printf("[%s] *** GAME IS NOW RUNNING ***", b.name)
+					b.logger.Infof("*** GAME IS NOW RUNNING ***")
 					commands <- coordinator.BotGameStarted{
 						MatchID:     matchID,
 						DotaMatchID: dota2Lobby.GetMatchId(),
 					}
 
 				case protocol.CSODOTALobby_POSTGAME:
-					log.Printf("[%s] *** GAME HAS ENDED ***", b.name)
+					b.logger.Infof("*** GAME HAS ENDED ***")
 					dotaMatchID := dota2Lobby.GetMatchId()
+					winner := winnerFromOutcome(dota2Lobby.GetMatchOutcome())
+					if winner != nil {
+						b.logger.Infof("Match outcome: %s victory", *winner)
+					} else {
+						b.logger.Infof("Match outcome unknown: %v", dota2Lobby.GetMatchOutcome())
+					}
 					endGameOnce.Do(func() {
 						gameEnded = true
 						commands <- coordinator.BotGameEnded{
 							MatchID:     matchID,
 							DotaMatchID: dotaMatchID,
+							Winner:      winner,
 						}
 						b.dota2Client.DestroyLobby(b.ctx)
 					})
 					return
 
 				case protocol.CSODOTALobby_NOTREADY:
-					log.Printf("[%s] Lobby not ready", b.name)
+					b.logger.Infof("Lobby not ready")
 				}
 			}
 
+			if kickStrangers && currentState == protocol.CSODOTALobby_UI {
+				b.kickStrangers(dota2Lobby, expectedTeam, botSteamID, kicked)
+			}
+
 			// Check if all players are on correct teams and launch
 			if currentState == protocol.CSODOTALobby_UI && !launched && !gameEnded {
 				if b.checkAllPlayersCorrect(dota2Lobby, expectedTeam) {
-					log.Printf("[%s] All players on correct teams! Starting game...", b.name)
+					b.logger.Infof("All players on correct teams! Starting game...")
 					launched = true
 					timeoutTimer.Stop() // Cancel timeout since we're launching
 					b.dota2Client.LaunchLobby()
-					log.Printf("[%s] Game launch command sent!", b.name)
+					b.logger.Infof("Game launch command sent!")
 				}
 			}
 		}
 	}
 }
 
+// lobbyPassword returns a short random password that players can type in
+// the lobby browser if their invite doesn't arrive.
+func lobbyPassword() string {
+	return rand.Text()[:8]
+}
+
+// gameProgress summarises a running lobby for the active matches list.
+func gameProgress(lobby *protocol.CSODOTALobby) coordinator.GameProgress {
+	var gameTime time.Duration
+	if start := lobby.GetGameStartTime(); start > 0 {
+		gameTime = time.Since(time.Unix(int64(start), 0)).Truncate(time.Second)
+	}
+	return coordinator.GameProgress{
+		GameTime:   max(gameTime, 0),
+		Phase:      gameStateName(lobby.GetGameState()),
+		Spectators: int(lobby.GetNumSpectators()),
+	}
+}
+
+func gameStateName(state protocol.DOTA_GameState) string {
+	switch state {
+	case protocol.DOTA_GameState_DOTA_GAMERULES_STATE_WAIT_FOR_PLAYERS_TO_LOAD,
+		protocol.DOTA_GameState_DOTA_GAMERULES_STATE_WAIT_FOR_MAP_TO_LOAD:
+		return "Loading"
+	case protocol.DOTA_GameState_DOTA_GAMERULES_STATE_HERO_SELECTION,
+		protocol.DOTA_GameState_DOTA_GAMERULES_STATE_PLAYER_DRAFT:
+		return "Hero selection"
+	case protocol.DOTA_GameState_DOTA_GAMERULES_STATE_STRATEGY_TIME,
+		protocol.DOTA_GameState_DOTA_GAMERULES_STATE_TEAM_SHOWCASE:
+		return "Strategy time"
+	case protocol.DOTA_GameState_DOTA_GAMERULES_STATE_PRE_GAME:
+		return "Pre-game"
+	case protocol.DOTA_GameState_DOTA_GAMERULES_STATE_GAME_IN_PROGRESS:
+		return "In progress"
+	case protocol.DOTA_GameState_DOTA_GAMERULES_STATE_POST_GAME:
+		return "Post-game"
+	default:
+		return ""
+	}
+}
+
+// winnerFromOutcome returns "radiant" or "dire" for a decided match, or nil if
+// the outcome is unknown or the match wasn't scored.
+func winnerFromOutcome(outcome protocol.EMatchOutcome) *string {
+	var winner string
+	switch outcome {
+	case protocol.EMatchOutcome_k_EMatchOutcome_RadVictory:
+		winner = "radiant"
+	case protocol.EMatchOutcome_k_EMatchOutcome_DireVictory:
+		winner = "dire"
+	default:
+		return nil
+	}
+	return &winner
+}
+
+// buildExpectedTeams maps Steam IDs to their expected team.
+// Team 0 = Radiant (GOOD_GUYS), Team 1 = Dire (BAD_GUYS)
+func buildExpectedTeams(radiant, dire []coordinator.Player) map[uint64]int {
+	expectedTeam := make(map[uint64]int)
+	for _, p := range radiant {
+		if id, err := steamid.Parse(p.SteamID); err == nil {
+			expectedTeam[id] = 0
+		}
+	}
+	for _, p := range dire {
+		if id, err := steamid.Parse(p.SteamID); err == nil {
+			expectedTeam[id] = 1
+		}
+	}
+	return expectedTeam
+}
+
+// kickFromWrongTeam moves players sitting on the wrong team back to the
+// unassigned pool so they can take their new slot.
+func (b *Bot) kickFromWrongTeam(dota2Lobby *protocol.CSODOTALobby, expectedTeam map[uint64]int) {
+	for _, member := range dota2Lobby.AllMembers {
+		expected, isExpected := expectedTeam[member.GetId()]
+		if !isExpected {
+			continue
+		}
+		team := member.GetTeam()
+		if (expected == 0 && team == protocol.DOTA_GC_TEAM_DOTA_GC_TEAM_BAD_GUYS) ||
+			(expected == 1 && team == protocol.DOTA_GC_TEAM_DOTA_GC_TEAM_GOOD_GUYS) {
+			accountID, err := steamid.To32(member.GetId())
+			if err != nil {
+				b.logger.Errorf("Cannot move lobby member: %v", err)
+				continue
+			}
+			b.logger.Infof("Moving player %d off the wrong team", member.GetId())
+			b.dota2Client.KickLobbyMemberFromTeam(accountID)
+		}
+	}
+}
+
+// kickStrangers kicks lobby members who aren't part of the match out of the
+// Radiant and Dire slots, leaving spectators and casters alone. A stranger
+// who is still there is kicked again after StrangerKickInterval, so repeated
+// lobby updates don't spam the GC.
+func (b *Bot) kickStrangers(dota2Lobby *protocol.CSODOTALobby, expectedTeam map[uint64]int, botSteamID uint64, kicked map[uint64]time.Time) {
+	for _, member := range dota2Lobby.AllMembers {
+		steamID := member.GetId()
+		if steamID == botSteamID || time.Since(kicked[steamID]) < StrangerKickInterval {
+			continue
+		}
+		if _, isExpected := expectedTeam[steamID]; isExpected {
+			continue
+		}
+		if team := member.GetTeam(); team != protocol.DOTA_GC_TEAM_DOTA_GC_TEAM_GOOD_GUYS &&
+			team != protocol.DOTA_GC_TEAM_DOTA_GC_TEAM_BAD_GUYS {
+			continue
+		}
+
+		kicked[steamID] = time.Now()
+		accountID, err := steamid.To32(steamID)
+		if err != nil {
+			b.logger.Errorf("Cannot kick lobby member: %v", err)
+			continue
+		}
+		b.logger.Infof("Kicking non-invited player %d from lobby", steamID)
+		b.dota2Client.KickLobbyMember(accountID)
+	}
+}
+
 // checkAllPlayersCorrect verifies all expected players are on their correct teams.
 func (b *Bot) checkAllPlayersCorrect(dota2Lobby *protocol.CSODOTALobby, expectedTeam map[uint64]int) bool {
 	if dota2Lobby == nil {
@@ -386,7 +793,7 @@ func (b *Bot) checkAllPlayersCorrect(dota2Lobby *protocol.CSODOTALobby, expected
 		}
 	}
 
-	log.Printf("[%s] Players on correct teams: %d/%d", b.name, correctCount, expectedCount)
+	b.logger.Infof("Players on correct teams: %d/%d", correctCount, expectedCount)
 	return correctCount == expectedCount
 }
 
@@ -432,7 +839,7 @@ func (b *Bot) Disconnect() {
 	}
 
 	if b.client != nil && b.loggedIn {
-		log.Printf("[%s] Disconnecting from Steam...", b.name)
+		b.logger.Infof("Disconnecting from Steam...")
 		b.client.Disconnect()
 		b.loggedIn = false
 	}
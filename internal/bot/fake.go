@@ -0,0 +1,233 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/edvart/dota-inhouse/internal/coordinator"
+)
+
+const (
+	// DefaultFakeStartDelay is how long a fake lobby waits for players to
+	// "join" before starting the game.
+	DefaultFakeStartDelay = 10 * time.Second
+
+	// DefaultFakeGameDuration is how long a fake game runs.
+	DefaultFakeGameDuration = time.Minute
+
+	fakeBotName = "fake"
+)
+
+// FakeConfig holds fake lobby timings.
+type FakeConfig struct {
+	StartDelay   time.Duration // Defaults to DefaultFakeStartDelay
+	GameDuration time.Duration // Defaults to DefaultFakeGameDuration
+}
+
+// FakeProvider hosts pretend lobbies so the whole match flow can run
+// locally without Steam accounts. Every lobby is ready at once, the game
+// starts after StartDelay and ends with a random winner after GameDuration.
+// Any number of lobbies can run at the same time.
+type FakeProvider struct {
+	cfg      FakeConfig
+	commands chan<- coordinator.Command
+	mu       sync.Mutex
+	lobbies  map[string]context.CancelFunc // Match ID -> cancel
+}
+
+// NewFakeProvider creates a fake lobby provider that reports to commands.
+func NewFakeProvider(cfg FakeConfig, commands chan<- coordinator.Command) *FakeProvider {
+	if cfg.StartDelay <= 0 {
+		cfg.StartDelay = DefaultFakeStartDelay
+	}
+	if cfg.GameDuration <= 0 {
+		cfg.GameDuration = DefaultFakeGameDuration
+	}
+	return &FakeProvider{
+		cfg:      cfg,
+		commands: commands,
+		lobbies:  make(map[string]context.CancelFunc),
+	}
+}
+
+// Run listens for events and hosts a fake lobby for each lobby request.
+func (p *FakeProvider) Run(ctx context.Context, events <-chan coordinator.Event) {
+	logger.Infof("Fake lobby provider started")
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Infof("Fake lobby provider shutting down")
+			return
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			switch e := event.(type) {
+			case coordinator.RequestBotLobby:
+				if !e.Manual {
+					p.startLobby(ctx, e)
+				}
+			case coordinator.MatchCancelled:
+				p.cancelLobby(e.MatchID)
+			case coordinator.MatchCancelledByAdmin:
+				p.cancelLobby(e.MatchID)
+			}
+		}
+	}
+}
+
+func (p *FakeProvider) startLobby(ctx context.Context, req coordinator.RequestBotLobby) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.lobbies[req.MatchID]; ok {
+		return
+	}
+	lobbyCtx, cancel := context.WithCancel(ctx)
+	p.lobbies[req.MatchID] = cancel
+
+	go func() {
+		defer p.cancelLobby(req.MatchID)
+		p.hostLobby(lobbyCtx, req)
+	}()
+}
+
+// hostLobby plays out a match's lobby and game, stopping early if ctx is
+// cancelled.
+func (p *FakeProvider) hostLobby(ctx context.Context, req coordinator.RequestBotLobby) {
+	log := logger.Match(req.MatchID)
+	log.Infof("Fake lobby %q ready for match %s", req.LobbyName, req.MatchID)
+	if !p.send(ctx, coordinator.BotLobbyReady{
+		MatchID:   req.MatchID,
+		LobbyName: req.LobbyName,
+		Password:  lobbyPassword(),
+	}) {
+		return
+	}
+
+	if !sleep(ctx, p.cfg.StartDelay) {
+		return
+	}
+	var joined []string
+	for _, team := range [][]coordinator.Player{req.Radiant, req.Dire} {
+		for _, player := range team {
+			joined = append(joined, player.SteamID)
+		}
+	}
+	if !p.send(ctx, coordinator.BotLobbyJoinProgress{MatchID: req.MatchID, Joined: joined}) {
+		return
+	}
+	log.Infof("Fake game started for match %s", req.MatchID)
+	if !p.send(ctx, coordinator.BotGameStarted{MatchID: req.MatchID}) {
+		return
+	}
+
+	started := time.Now()
+	progress := time.NewTicker(MatchProgressInterval)
+	defer progress.Stop()
+	end := time.NewTimer(p.cfg.GameDuration)
+	defer end.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-progress.C:
+			p.send(ctx, coordinator.BotMatchProgress{
+				MatchID: req.MatchID,
+				Progress: coordinator.GameProgress{
+					GameTime: time.Since(started).Round(time.Second),
+					Phase:    "In progress",
+				},
+			})
+		case <-end.C:
+			winner := "radiant"
+			if rand.IntN(2) == 1 {
+				winner = "dire"
+			}
+			log.Infof("Fake game for match %s ended, %s won", req.MatchID, winner)
+			p.send(ctx, coordinator.BotGameEnded{MatchID: req.MatchID, Winner: &winner})
+			return
+		}
+	}
+}
+
+func (p *FakeProvider) send(ctx context.Context, cmd coordinator.Command) bool {
+	select {
+	case p.commands <- cmd:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func sleep(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (p *FakeProvider) cancelLobby(matchID string) {
+	p.mu.Lock()
+	cancel, ok := p.lobbies[matchID]
+	delete(p.lobbies, matchID)
+	p.mu.Unlock()
+
+	if ok {
+		cancel()
+	}
+}
+
+// AvailableBotCount always returns 1, as a fake lobby can always be hosted.
+func (p *FakeProvider) AvailableBotCount() int {
+	return 1
+}
+
+// Status returns an idle fake bot, followed by one busy fake bot per
+// running lobby, named after its match.
+func (p *FakeProvider) Status() []Status {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	statuses := []Status{{Name: fakeBotName, LoggedIn: true}}
+	for matchID := range p.lobbies {
+		statuses = append(statuses, Status{
+			Name:           fakeBotName + "-" + matchID,
+			LoggedIn:       true,
+			Busy:           true,
+			CurrentMatchID: matchID,
+		})
+	}
+	return statuses
+}
+
+// ForceFreeBot stops the fake lobby of the named fake bot.
+func (p *FakeProvider) ForceFreeBot(name string) error {
+	matchID, ok := strings.CutPrefix(name, fakeBotName+"-")
+	p.mu.Lock()
+	_, running := p.lobbies[matchID]
+	p.mu.Unlock()
+	if !ok || !running {
+		return fmt.Errorf("bot %q not found", name)
+	}
+
+	logger.Infof("Force-freeing fake bot %s", name)
+	p.cancelLobby(matchID)
+	p.commands <- coordinator.BotLobbyAbandoned{MatchID: matchID}
+	return nil
+}
+
+// Shutdown stops all fake lobbies.
+func (p *FakeProvider) Shutdown() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for matchID, cancel := range p.lobbies {
+		cancel()
+		delete(p.lobbies, matchID)
+	}
+}
@@ -0,0 +1,168 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/edvart/dota-inhouse/internal/coordinator"
+)
+
+// startFakePipeline wires a running coordinator to a FakeProvider the way
+// the server does, with 4-player matches. It returns a subscription to the
+// coordinator's events.
+func startFakePipeline(t *testing.T, cfg FakeConfig) (*coordinator.Coordinator, LobbyProvider, <-chan coordinator.Event) {
+	t.Helper()
+	maxPlayers := coordinator.MaxPlayers
+	coordinator.MaxPlayers = 4
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	coord := coordinator.New()
+	botCommands := make(chan coordinator.Command, 100)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case cmd := <-botCommands:
+				coord.Send(cmd)
+			case <-coord.Events():
+			}
+		}
+	}()
+
+	var provider LobbyProvider = NewFakeProvider(cfg, botCommands)
+	go provider.Run(ctx, coord.Subscribe())
+
+	events := coord.Subscribe()
+	done := make(chan struct{})
+	go func() {
+		coord.Run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		provider.Shutdown()
+		<-done
+		coordinator.MaxPlayers = maxPlayers
+	})
+	return coord, provider, events
+}
+
+// waitFor returns the next event of type T, failing the test if none
+// arrives in time.
+func waitFor[T coordinator.Event](t *testing.T, events <-chan coordinator.Event) T {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case e := <-events:
+			if want, ok := e.(T); ok {
+				return want
+			}
+		case <-timeout:
+			var zero T
+			t.Fatalf("timed out waiting for %T", zero)
+			return zero
+		}
+	}
+}
+
+// request sends a command built around a response channel and fails the
+// test if it returns an error.
+func request(t *testing.T, coord *coordinator.Coordinator, build func(resp chan error) coordinator.Command) {
+	t.Helper()
+	resp := make(chan error, 1)
+	coord.Send(build(resp))
+	if err := <-resp; err != nil {
+		t.Fatalf("%T: %v", build(nil), err)
+	}
+}
+
+// draftMatch queues four players, accepts the match, and drafts it, leaving
+// it for the provider to host. It returns the match ID.
+func draftMatch(t *testing.T, coord *coordinator.Coordinator, events <-chan coordinator.Event) string {
+	t.Helper()
+	for i := 0; i < 4; i++ {
+		player := coordinator.Player{SteamID: fmt.Sprintf("7656119800000%04d", i), Name: fmt.Sprintf("player%d", i)}
+		request(t, coord, func(resp chan error) coordinator.Command {
+			return coordinator.JoinQueue{Player: player, Response: resp}
+		})
+	}
+
+	accept := waitFor[coordinator.MatchAcceptStarted](t, events)
+	for _, p := range accept.Players {
+		request(t, coord, func(resp chan error) coordinator.Command {
+			return coordinator.AcceptMatch{PlayerID: p.SteamID, MatchID: accept.MatchID, Response: resp}
+		})
+	}
+
+	// With four players Radiant picks once and the last player goes to Dire.
+	draft := waitFor[coordinator.DraftStarted](t, events)
+	request(t, coord, func(resp chan error) coordinator.Command {
+		return coordinator.PickPlayer{
+			CaptainID: draft.Captains[0].SteamID,
+			PickedID:  draft.Available[0].SteamID,
+			MatchID:   draft.MatchID,
+			Response:  resp,
+		}
+	})
+	return draft.MatchID
+}
+
+func TestFakeProviderLobbyLifecycle(t *testing.T) {
+	coord, provider, events := startFakePipeline(t, FakeConfig{
+		StartDelay:   10 * time.Millisecond,
+		GameDuration: 50 * time.Millisecond,
+	})
+	matchID := draftMatch(t, coord, events)
+
+	if lobby := waitFor[coordinator.RequestBotLobby](t, events); lobby.MatchID != matchID {
+		t.Fatalf("lobby requested for match %s, want %s", lobby.MatchID, matchID)
+	}
+	if ready := waitFor[coordinator.LobbyReady](t, events); ready.MatchID != matchID {
+		t.Fatalf("lobby ready for match %s, want %s", ready.MatchID, matchID)
+	}
+	started := waitFor[coordinator.MatchStarted](t, events)
+	if started.MatchID != matchID || len(started.Radiant) != 2 || len(started.Dire) != 2 {
+		t.Fatalf("match started: %s with %d v %d players, want %s with 2 v 2",
+			started.MatchID, len(started.Radiant), len(started.Dire), matchID)
+	}
+	if got := len(provider.Status()); got != 2 {
+		t.Errorf("provider reports %d bots during the game, want an idle and a busy one", got)
+	}
+
+	completed := waitFor[coordinator.MatchCompleted](t, events)
+	if completed.MatchID != matchID {
+		t.Fatalf("match %s completed, want %s", completed.MatchID, matchID)
+	}
+	if completed.Winner == nil || (*completed.Winner != "radiant" && *completed.Winner != "dire") {
+		t.Errorf("completed with winner %v, want radiant or dire", completed.Winner)
+	}
+	if coord.GetPlayerMatch(started.Radiant[0].SteamID) != nil {
+		t.Errorf("player is still in a match after it completed")
+	}
+}
+
+func TestFakeProviderForceFree(t *testing.T) {
+	coord, provider, events := startFakePipeline(t, FakeConfig{
+		StartDelay:   10 * time.Millisecond,
+		GameDuration: time.Hour,
+	})
+	matchID := draftMatch(t, coord, events)
+	waitFor[coordinator.MatchStarted](t, events)
+
+	if err := provider.ForceFreeBot(fakeBotName + "-" + matchID); err != nil {
+		t.Fatalf("ForceFreeBot: %v", err)
+	}
+
+	completed := waitFor[coordinator.MatchCompleted](t, events)
+	if completed.MatchID != matchID || completed.Winner != nil {
+		t.Errorf("match %s completed with winner %v, want %s with no winner", completed.MatchID, completed.Winner, matchID)
+	}
+	if got := len(provider.Status()); got != 1 {
+		t.Errorf("provider reports %d bots after force-free, want only the idle one", got)
+	}
+}
@@ -2,7 +2,7 @@ package bot
 
 import (
 	"context"
-	"log"
+	"fmt"
 	"sync"
 	"time"
 
@@ -12,6 +12,10 @@ import (
 const (
 	// BotRetryInterval is how often to check for an available bot
 	BotRetryInterval = 5 * time.Second
+
+	// DefaultStaleLobbyTimeout is how long a running lobby may go without
+	// events before the bot assumes it lost its connection and frees itself.
+	DefaultStaleLobbyTimeout = 10 * time.Minute
 )
 
 // Manager manages a pool of Steam bots.
@@ -20,12 +24,14 @@ type Manager struct {
 	commands     chan<- coordinator.Command
 	mu           sync.Mutex
 	matchToBotCtx map[string]context.CancelFunc
+	matchToBot    map[string]*Bot
 }
 
 // Config holds bot configuration.
 type Config struct {
-	Bots         []BotCredentials
-	AutoEndDelay time.Duration
+	Bots              []BotCredentials
+	AutoEndDelay      time.Duration
+	StaleLobbyTimeout time.Duration // Defaults to DefaultStaleLobbyTimeout
 }
 
 // BotCredentials holds login credentials for a single bot.
@@ -40,18 +46,25 @@ func NewManager(cfg Config, commands chan<- coordinator.Command) *Manager {
 		bots:          make([]*Bot, 0, len(cfg.Bots)),
 		commands:      commands,
 		matchToBotCtx: make(map[string]context.CancelFunc),
+		matchToBot:    make(map[string]*Bot),
+	}
+
+	staleTimeout := cfg.StaleLobbyTimeout
+	if staleTimeout <= 0 {
+		staleTimeout = DefaultStaleLobbyTimeout
 	}
 
 	for _, cred := range cfg.Bots {
 		if cred.Username != "" && cred.Password != "" {
 			bot := NewBot(cred.Username, cred.Password)
+			bot.staleTimeout = staleTimeout
 			m.bots = append(m.bots, bot)
-			log.Printf("Bot initialized: %s", cred.Username)
+			logger.Infof("Bot initialized: %s", cred.Username)
 		}
 	}
 
 	if len(m.bots) == 0 {
-		log.Println("Warning: No bots configured. Lobby creation will not work.")
+		logger.Warnf("No bots configured. Lobby creation will not work.")
 	}
 
 	return m
@@ -59,11 +72,11 @@ func NewManager(cfg Config, commands chan<- coordinator.Command) *Manager {
 
 // Run listens for events and handles lobby requests.
 func (m *Manager) Run(ctx context.Context, events <-chan coordinator.Event) {
-	log.Println("Bot manager started")
+	logger.Infof("Bot manager started")
 	for {
 		select {
 		case <-ctx.Done():
-			log.Println("Bot manager shutting down")
+			logger.Infof("Bot manager shutting down")
 			return
 		case event, ok := <-events:
 			if !ok {
@@ -76,6 +89,8 @@ func (m *Manager) Run(ctx context.Context, events <-chan coordinator.Event) {
 				m.cancelMatch(e.MatchID)
 			case coordinator.MatchCancelledByAdmin:
 				m.cancelMatch(e.MatchID)
+			case coordinator.TeamsUpdated:
+				m.updateTeams(e)
 			}
 		}
 	}
@@ -90,13 +105,25 @@ func (m *Manager) cancelMatch(matchID string) {
 	m.mu.Unlock()
 
 	if exists {
-		log.Printf("Cancelling bot for match %s", matchID)
+		logger.Match(matchID).Infof("Cancelling bot for match %s", matchID)
 		cancel()
 	}
 }
 
+func (m *Manager) updateTeams(e coordinator.TeamsUpdated) {
+	m.mu.Lock()
+	bot := m.matchToBot[e.MatchID]
+	m.mu.Unlock()
+
+	if bot == nil {
+		logger.Match(e.MatchID).Infof("No bot hosting match %s, ignoring team update", e.MatchID)
+		return
+	}
+	bot.UpdateTeams(e.Radiant, e.Dire)
+}
+
 func (m *Manager) handleLobbyRequest(ctx context.Context, req coordinator.RequestBotLobby) {
-	log.Printf("Looking for available bot for match %s", req.MatchID)
+	logger.Match(req.MatchID).Infof("Looking for available bot for match %s", req.MatchID)
 
 	matchCtx, cancel := context.WithCancel(ctx)
 	m.mu.Lock()
@@ -106,31 +133,57 @@ func (m *Manager) handleLobbyRequest(ctx context.Context, req coordinator.Reques
 	defer func() {
 		m.mu.Lock()
 		delete(m.matchToBotCtx, req.MatchID)
+		delete(m.matchToBot, req.MatchID)
 		m.mu.Unlock()
 	}()
 
 	for {
 		bot := m.getAvailableBot()
 		if bot != nil {
-			log.Printf("Assigning bot %s to match %s", bot.name, req.MatchID)
-			if bot.CreateLobby(matchCtx, req.MatchID, req.Players, req.Radiant, req.Dire, req.GameMode, m.commands) {
+			if !m.matchWaitingForLobby(matchCtx, req.MatchID) {
+				logger.Match(req.MatchID).Infof("Match %s no longer needs a lobby, not assigning a bot", req.MatchID)
+				return
+			}
+			logger.Match(req.MatchID).Infof("Assigning bot %s to match %s", bot.name, req.MatchID)
+			m.mu.Lock()
+			m.matchToBot[req.MatchID] = bot
+			m.mu.Unlock()
+			if bot.CreateLobby(matchCtx, req, m.commands) {
 				return
 			}
-			log.Printf("Bot %s failed to create lobby, trying another...", bot.name)
+			logger.Infof("Bot %s failed to create lobby, trying another...", bot.name)
 			continue
 		}
 
-		log.Printf("No available bot for match %s, retrying in %v...", req.MatchID, BotRetryInterval)
+		logger.Match(req.MatchID).Infof("No available bot for match %s, retrying in %v...", req.MatchID, BotRetryInterval)
 
 		select {
 		case <-matchCtx.Done():
-			log.Printf("Bot request cancelled for match %s", req.MatchID)
+			logger.Match(req.MatchID).Infof("Bot request cancelled for match %s", req.MatchID)
 			return
 		case <-time.After(BotRetryInterval):
 		}
 	}
 }
 
+// matchWaitingForLobby asks the coordinator whether the match still exists
+// and is waiting for a lobby. Players may have left or the match may have
+// been cancelled while no bot was free.
+func (m *Manager) matchWaitingForLobby(ctx context.Context, matchID string) bool {
+	resp := make(chan bool, 1)
+	select {
+	case m.commands <- coordinator.BotCheckMatch{MatchID: matchID, Response: resp}:
+	case <-ctx.Done():
+		return false
+	}
+	select {
+	case ok := <-resp:
+		return ok
+	case <-ctx.Done():
+		return false
+	}
+}
+
 func (m *Manager) getAvailableBot() *Bot {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -143,9 +196,60 @@ func (m *Manager) getAvailableBot() *Bot {
 	return nil
 }
 
+// AvailableBotCount returns how many bots are logged in and free to host a lobby.
+func (m *Manager) AvailableBotCount() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	count := 0
+	for _, bot := range m.bots {
+		if bot.IsAvailable() {
+			count++
+		}
+	}
+	return count
+}
+
+// Status returns the current state of every bot.
+func (m *Manager) Status() []Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	statuses := make([]Status, len(m.bots))
+	for i, bot := range m.bots {
+		statuses[i] = bot.Status()
+	}
+	return statuses
+}
+
+// ForceFreeBot releases a bot that is stuck in a lobby, abandoning whatever
+// match it was hosting.
+func (m *Manager) ForceFreeBot(name string) error {
+	m.mu.Lock()
+	var target *Bot
+	for _, bot := range m.bots {
+		if bot.name == name {
+			target = bot
+			break
+		}
+	}
+	m.mu.Unlock()
+
+	if target == nil {
+		return fmt.Errorf("bot %q not found", name)
+	}
+
+	logger.Infof("Force-freeing bot %s", name)
+	if matchID := target.ForceFree(); matchID != "" {
+		// Nothing else will report on the match now its lobby is gone
+		m.commands <- coordinator.BotLobbyAbandoned{MatchID: matchID}
+	}
+	return nil
+}
+
 // Shutdown disconnects all bots.
 func (m *Manager) Shutdown() {
-	log.Println("Shutting down all bots...")
+	logger.Infof("Shutting down all bots...")
 	for _, bot := range m.bots {
 		bot.Disconnect()
 	}
@@ -0,0 +1,26 @@
+package bot
+
+import (
+	"context"
+
+	"github.com/edvart/dota-inhouse/internal/coordinator"
+)
+
+// LobbyProvider hosts the Dota 2 lobbies for matches. It takes
+// RequestBotLobby events from the coordinator and reports back with
+// BotLobbyReady, BotGameStarted and BotGameEnded commands (or
+// BotLobbyTimeout if players never join).
+type LobbyProvider interface {
+	// Run handles coordinator events until ctx is done.
+	Run(ctx context.Context, events <-chan coordinator.Event)
+	// AvailableBotCount returns how many lobbies could be hosted right now.
+	AvailableBotCount() int
+	Status() []Status
+	ForceFreeBot(name string) error
+	Shutdown()
+}
+
+var (
+	_ LobbyProvider = (*Manager)(nil)
+	_ LobbyProvider = (*FakeProvider)(nil)
+)
@@ -8,17 +8,41 @@ type Command interface {
 
 type JoinQueue struct {
 	Player   Player
+	QueueID  string // Queue to join; empty means DefaultQueueID
 	Response chan error
+
+	// ExpectedVersion is the queue version the client last saw. A non-zero
+	// value that doesn't match the current version fails with ErrStaleQueue.
+	ExpectedVersion int
 }
 
 func (JoinQueue) command() {}
 
 type LeaveQueue struct {
+	PlayerID        string
+	QueueID         string // If set, the player must be in this queue
+	Response        chan error
+	ExpectedVersion int // See JoinQueue.ExpectedVersion
+}
+
+func (LeaveQueue) command() {}
+
+// RejoinQueue puts a player who failed to join a lobby back at their old
+// queue position, if their grace window hasn't expired.
+type RejoinQueue struct {
 	PlayerID string
 	Response chan error
 }
 
-func (LeaveQueue) command() {}
+func (RejoinQueue) command() {}
+
+// QueueHeartbeat tells the coordinator a queued player is still at their
+// screen. Players who stop sending it are removed after AFKTimeout.
+type QueueHeartbeat struct {
+	PlayerID string
+}
+
+func (QueueHeartbeat) command() {}
 
 type AcceptMatch struct {
 	PlayerID string
@@ -28,6 +52,16 @@ type AcceptMatch struct {
 
 func (AcceptMatch) command() {}
 
+// DeclineMatch removes a player from the queue and ends the accept phase
+// straight away instead of waiting for the timer.
+type DeclineMatch struct {
+	PlayerID string
+	MatchID  string
+	Response chan error
+}
+
+func (DeclineMatch) command() {}
+
 type PickPlayer struct {
 	CaptainID string
 	PickedID  string
@@ -37,15 +71,47 @@ type PickPlayer struct {
 
 func (PickPlayer) command() {}
 
-type MatchAcceptTimeout struct {
+// VoteCancel records a player's vote to scrap their match before it starts.
+type VoteCancel struct {
+	PlayerID string
+	MatchID  string
+	Response chan error
+}
+
+func (VoteCancel) command() {}
+
+// RequestRedraft asks to restart the draft from the first pick. The draft is
+// only restarted once both captains have asked.
+type RequestRedraft struct {
+	CaptainID string
 	MatchID   string
-	StartedAt time.Time
+	Response  chan error
+}
+
+func (RequestRedraft) command() {}
+
+// SendChatMessage posts a chat message to the other players of a match.
+type SendChatMessage struct {
+	PlayerID string
+	MatchID  string
+	Text     string
+	Response chan error
+}
+
+func (SendChatMessage) command() {}
+
+type MatchAcceptTimeout struct {
+	MatchID    string
+	StartedAt  time.Time
+	Generation int // Match.TimeoutGen when the timer was started
 }
 
 func (MatchAcceptTimeout) command() {}
 
 type BotLobbyReady struct {
-	MatchID string
+	MatchID   string
+	LobbyName string
+	Password  string // Lets players join from the lobby browser if the invite fails
 }
 
 func (BotLobbyReady) command() {}
@@ -57,6 +123,32 @@ type BotGameStarted struct {
 
 func (BotGameStarted) command() {}
 
+// BotMatchProgress is sent periodically by the bot while a game is running.
+type BotMatchProgress struct {
+	MatchID  string
+	Progress GameProgress
+}
+
+func (BotMatchProgress) command() {}
+
+// BotLobbyJoinProgress is sent by the bot while waiting for players, when
+// the set of players sitting on their assigned team changes.
+type BotLobbyJoinProgress struct {
+	MatchID string
+	Joined  []string // Steam IDs on their assigned team
+}
+
+func (BotLobbyJoinProgress) command() {}
+
+// BotLobbyJoinWarning is sent by the bot LobbyJoinWarningLead before the
+// lobby join timeout, with who is on their assigned team at that point.
+type BotLobbyJoinWarning struct {
+	MatchID string
+	Joined  []string // Steam IDs on their assigned team
+}
+
+func (BotLobbyJoinWarning) command() {}
+
 type BotGameEnded struct {
 	MatchID     string
 	DotaMatchID uint64
@@ -68,10 +160,21 @@ func (BotGameEnded) command() {}
 type DraftPickTimeout struct {
 	MatchID    string
 	PickNumber int // Which pick this timeout was for
+	Generation int // Match.TimeoutGen when the timer was started
 }
 
 func (DraftPickTimeout) command() {}
 
+// DraftPickWarningDue fires DraftPickWarningLead before a pick deadline. It
+// is stale-checked like DraftPickTimeout.
+type DraftPickWarningDue struct {
+	MatchID    string
+	PickNumber int
+	Generation int
+}
+
+func (DraftPickWarningDue) command() {}
+
 type BotLobbyTimeout struct {
 	MatchID            string
 	PlayersJoinedRight []string // Steam IDs of players who joined on correct team
@@ -79,6 +182,31 @@ type BotLobbyTimeout struct {
 
 func (BotLobbyTimeout) command() {}
 
+// BotLobbyAbandoned is sent when a bot stops hosting a match's lobby before
+// the game ended, such as when an admin force-frees it.
+type BotLobbyAbandoned struct {
+	MatchID string
+}
+
+func (BotLobbyAbandoned) command() {}
+
+// VoteCancelHoldExpired is sent VoteCancelHoldDur after a match is cancelled
+// by vote, letting its players be matched together again.
+type VoteCancelHoldExpired struct {
+	QueueID string
+}
+
+func (VoteCancelHoldExpired) command() {}
+
+// BotCheckMatch asks whether a match is still waiting for a lobby. Bots send
+// it before creating one so they don't host lobbies for cancelled matches.
+type BotCheckMatch struct {
+	MatchID  string
+	Response chan bool
+}
+
+func (BotCheckMatch) command() {}
+
 type AdminCancelMatch struct {
 	MatchID       string
 	ReturnToQueue bool // If true, return players to queue
@@ -95,6 +223,16 @@ type AdminSetMatchResult struct {
 
 func (AdminSetMatchResult) command() {}
 
+// AdminMarkGameStarted moves a match whose lobby an admin created by hand
+// into the in-progress state, as the bot would once the game starts.
+type AdminMarkGameStarted struct {
+	MatchID     string
+	DotaMatchID uint64 // 0 if not known yet
+	Response    chan error
+}
+
+func (AdminMarkGameStarted) command() {}
+
 type AdminKickFromQueue struct {
 	PlayerID string
 	Response chan error
@@ -102,6 +240,60 @@ type AdminKickFromQueue struct {
 
 func (AdminKickFromQueue) command() {}
 
+// AdminRequeueMatch adds a finished match's roster back to the queue so the
+// same players can run it back. Players already queued or in another match
+// are skipped.
+type AdminRequeueMatch struct {
+	Players  []Player
+	Response chan error
+}
+
+func (AdminRequeueMatch) command() {}
+
+// AdminShuffleTeams re-splits a match's players into the most even teams by
+// rating, keeping both captains. A draft in progress ends with those teams.
+type AdminShuffleTeams struct {
+	MatchID  string
+	Response chan error
+}
+
+func (AdminShuffleTeams) command() {}
+
+// AdminSwapPlayers moves two players of the same match to each other's team.
+type AdminSwapPlayers struct {
+	MatchID       string
+	PlayerA       string
+	PlayerB       string
+	AllowCaptains bool // Captains can only be swapped when set
+	Response      chan error
+}
+
+func (AdminSwapPlayers) command() {}
+
+// AdminForceStartMatch starts a match from the front of the queue without
+// waiting for it to fill. Count is how many players to take; 0 takes the
+// whole queue, up to its MaxPlayers.
+type AdminForceStartMatch struct {
+	QueueID    string // Empty means DefaultQueueID
+	Count      int
+	SkipAccept bool // Go straight to the draft, treating everyone as accepted
+	Response   chan error
+}
+
+func (AdminForceStartMatch) command() {}
+
+// AdminPauseQueue stops new matches from starting, for maintenance. Players
+// can still join and matches already started carry on.
+type AdminPauseQueue struct{}
+
+func (AdminPauseQueue) command() {}
+
+// AdminResumeQueue undoes AdminPauseQueue, starting a match right away if the
+// queue is full.
+type AdminResumeQueue struct{}
+
+func (AdminResumeQueue) command() {}
+
 type AdminSetLobbySettings struct {
 	Settings LobbySettings
 	Response chan error
@@ -1,32 +1,213 @@
 package coordinator
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
-	"log"
+	"fmt"
+	"maps"
+	"math/bits"
 	"math/rand"
 	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
+	"unicode"
 
+	"github.com/edvart/dota-inhouse/internal/logging"
 	"github.com/google/uuid"
 )
 
-// MaxPlayers can be overridden via MAX_PLAYERS env var.
+var logger = logging.New("coordinator")
+
+var (
+	// ErrNotInQueue is returned when leaving a queue the player isn't in.
+	ErrNotInQueue = errors.New("not in queue")
+
+	// ErrAlreadyInQueue is returned when joining a queue the player is in.
+	ErrAlreadyInQueue = errors.New("already in queue")
+
+	// ErrStaleQueue is returned when a queue change was based on an
+	// outdated view of the queue.
+	ErrStaleQueue = errors.New("queue has changed, please try again")
+
+	// ErrQueueFull is returned when joining a queue that has reached
+	// MaxQueueSize.
+	ErrQueueFull = errors.New("the queue is full, please try again later")
+)
+
+// MaxPlayers can be overridden via MAX_PLAYERS env var. It must pass
+// ValidateMaxPlayers so both teams are the same size.
 var MaxPlayers = 10
 
+// MaxQueueSize caps how many players may wait in the queue at once; further
+// joins are rejected with ErrQueueFull. 0 means no limit. Can be overridden
+// via MAX_QUEUE_SIZE env var and must be at least MaxPlayers.
+var MaxQueueSize = 0
+
+// MaxTeamSize is the most players a Dota lobby allows on one side.
+const MaxTeamSize = 5
+
+// ValidateMaxPlayers reports whether n players split into two equal teams
+// that fit in a Dota lobby.
+func ValidateMaxPlayers(n int) error {
+	if n < 2 || n > 2*MaxTeamSize {
+		return fmt.Errorf("max players must be between 2 and %d, got %d", 2*MaxTeamSize, n)
+	}
+	if n%2 != 0 {
+		return fmt.Errorf("max players must be even so teams are equal, got %d", n)
+	}
+	return nil
+}
+
+// TeamSize returns the number of players on each team in the default queue.
+func TeamSize() int {
+	return MaxPlayers / 2
+}
+
+// DraftPickWarningLead is how long before a pick deadline the picking
+// captain is warned. 0 disables the warning. Can be overridden via
+// DRAFT_PICK_WARNING_SECONDS env var.
+var DraftPickWarningLead = 5 * time.Second
+
+// LobbyJoinWarningLead is how long before the lobby join timeout players who
+// haven't joined yet are warned. 0 disables the warning. Can be overridden
+// via LOBBY_JOIN_WARNING_SECONDS env var.
+var LobbyJoinWarningLead = 15 * time.Second
+
+// QueueAlmostFullCooldown is the least time between two QueueAlmostFull
+// events for the same queue, so players joining and leaving one short of a
+// match aren't notified over and over. Can be overridden via
+// QUEUE_ALMOST_FULL_COOLDOWN_SECONDS env var.
+var QueueAlmostFullCooldown = 2 * time.Minute
+
+// Match chat limits.
+const (
+	MaxChatMessageLen = 300         // Runes; longer messages are truncated
+	MaxChatHistory    = 50          // Messages kept per match
+	chatCooldown      = time.Second // Minimum time between a player's messages
+)
+
+// MaxConcurrentMatches limits how many matches may be active at once, so a
+// busy queue doesn't pop more matches than there are bots to host them.
+// Every active match counts, since matches still accepting or drafting will
+// need a bot soon. 0 means no limit. Can be overridden via
+// MAX_CONCURRENT_MATCHES env var; defaults to the number of bots.
+var MaxConcurrentMatches = 0
+
+// ManualLobbies is set when no lobby bots are running. Drafted matches then
+// wait for an admin to create the Dota 2 lobby by hand and mark the game as
+// started, instead of requesting a bot lobby nobody would create.
+var ManualLobbies = false
+
+// Default phase timeouts. Admins can change them at runtime via LobbySettings.
 const (
 	MatchAcceptTimeoutDur = 30 * time.Second
 	DraftPickTimeoutDur   = 60 * time.Second
 	LobbyJoinTimeoutDur   = 5 * time.Minute
 )
 
+// VoteCancelThreshold is the fraction of a match's players that must be
+// exceeded for a cancel vote to pass; 0.5 is a simple majority and 1 requires
+// everyone. Can be overridden via VOTE_CANCEL_THRESHOLD env var.
+var VoteCancelThreshold = 0.5
+
+// CancelVotesNeeded returns how many votes cancel a match with this many players.
+func CancelVotesNeeded(players int) int {
+	return min(int(VoteCancelThreshold*float64(players))+1, players)
+}
+
+// VoteCancelHoldDur is how long the players of a match cancelled by vote are
+// kept from being matched together again. They keep their queue places, but
+// a new match only pops once one of them leaves or the hold runs out, so the
+// player who had to go isn't handed a match they can't accept.
+var VoteCancelHoldDur = 2 * time.Minute
+
+// RejoinGraceDur is how long players who failed to join a lobby may rejoin
+// the queue at their old position. Can be overridden via REJOIN_GRACE_SECONDS env var.
+var RejoinGraceDur = 60 * time.Second
+
+// CaptainDecayDur is how long a recent captain's effective priority takes to
+// recover fully when LobbySettings.CaptainDecay is on. Can be overridden via
+// CAPTAIN_DECAY_HOURS env var.
+var CaptainDecayDur = 24 * time.Hour
+
+// NewPlayerGames is how many completed games a player needs before their
+// captain priority counts in full. Until then it is capped at
+// NewPlayerCaptainPriority so rookies rarely captain. 0 disables the cap.
+// Can be overridden via NEW_PLAYER_GAMES and NEW_PLAYER_CAPTAIN_PRIORITY
+// env vars.
+var (
+	NewPlayerGames           = 3
+	NewPlayerCaptainPriority = 1
+)
+
+// QueuePriority returns the captain priority a player queues with, given
+// their stored priority and number of completed games.
+func QueuePriority(priority, games int) int {
+	if games < NewPlayerGames {
+		return min(priority, NewPlayerCaptainPriority)
+	}
+	return priority
+}
+
+// FailedAcceptLimit is how many matches a player may fail to accept within
+// FailedAcceptWindow before each further failure keeps them out of the
+// queue for FailedAcceptCooldown; 0 disables the penalty. Can be overridden
+// via FAILED_ACCEPT_LIMIT, FAILED_ACCEPT_WINDOW_HOURS and
+// FAILED_ACCEPT_COOLDOWN_MINUTES env vars.
+var (
+	FailedAcceptLimit    = 3
+	FailedAcceptWindow   = 24 * time.Hour
+	FailedAcceptCooldown = 30 * time.Minute
+)
+
+// AFKTimeout is how long a queued player may go without a heartbeat before
+// being removed from the queue; 0 disables the check. Can be overridden via
+// AFK_TIMEOUT_MINUTES env var.
+var AFKTimeout = 5 * time.Minute
+
+// MaxQueueTime is how long a player may wait in the queue without a match
+// popping before being removed, even with a live heartbeat; 0 disables it.
+// Can be overridden via MAX_QUEUE_MINUTES env var.
+var MaxQueueTime time.Duration
+
+// afkCheckInterval is how often queued players' heartbeats and queue times
+// are checked.
+const afkCheckInterval = 30 * time.Second
+
 // Coordinator owns all mutable state and processes commands sequentially.
 type Coordinator struct {
-	commands     chan Command
-	events       chan Event
-	subscribers  []chan Event
-	state        *State
-	persistQueue func([]Player)
+	commands       chan Command
+	events         chan Event
+	subscribersMu  sync.RWMutex
+	subscribers    []chan Event
+	state          *State
+	persistQueue   func([]Player)
+	persistMatches func([]*Match)
+	savedMatches   []byte // JSON of the matches last persisted
+	lobbyNumber    func(day string) (int, error)
+	rejoinGrace    map[string]rejoinSlot // Steam ID -> reserved queue slot
+	heartbeats     map[string]time.Time  // Steam ID -> last heartbeat while queued
+	queueVersion   int                   // Incremented on every QueueUpdated
+	lastChat       map[string]time.Time  // Steam ID -> last chat message, for rate limiting
+	almostFull     map[string]time.Time  // Queue ID -> last QueueAlmostFull
+	voteHolds      map[string]voteHold   // Queue ID -> roster held back after a vote cancel
+}
+
+// voteHold is the roster of a match cancelled by vote, see VoteCancelHoldDur.
+type voteHold struct {
+	Players map[string]bool
+	Expires time.Time
+}
+
+// rejoinSlot is a queue position held for a player after a failed lobby.
+type rejoinSlot struct {
+	Player   Player
+	Position int
+	Expires  time.Time
 }
 
 func New() *Coordinator {
@@ -35,6 +216,11 @@ func New() *Coordinator {
 		events:      make(chan Event, 100),
 		subscribers: make([]chan Event, 0),
 		state:       NewState(),
+		rejoinGrace: make(map[string]rejoinSlot),
+		heartbeats:  make(map[string]time.Time),
+		lastChat:    make(map[string]time.Time),
+		almostFull:  make(map[string]time.Time),
+		voteHolds:   make(map[string]voteHold),
 	}
 }
 
@@ -44,14 +230,76 @@ func (c *Coordinator) SetQueuePersistence(fn func([]Player)) {
 }
 
 // RestoreQueue sets the initial queue state. Must be called before Run.
+// Players whose queue no longer exists go to the default queue.
 func (c *Coordinator) RestoreQueue(players []Player) {
-	c.state.Queue = players
+	for _, p := range players {
+		p.QueueID = queueOf(p.QueueID)
+		c.state.Queues[p.QueueID] = append(c.state.Queues[p.QueueID], p)
+	}
 }
 
 func (c *Coordinator) saveQueue() {
 	if c.persistQueue != nil {
-		c.persistQueue(c.state.Queue)
+		c.persistQueue(c.state.QueuedPlayers())
+	}
+}
+
+// SetMatchPersistence sets a callback that is called whenever active matches may have changed.
+func (c *Coordinator) SetMatchPersistence(fn func([]*Match)) {
+	c.persistMatches = fn
+}
+
+// SetLobbyCounter sets the source of the per-day match numbers used by the
+// {n} lobby name placeholder. Without it {n} is always 1.
+func (c *Coordinator) SetLobbyCounter(fn func(day string) (int, error)) {
+	c.lobbyNumber = fn
+}
+
+// RestoreMatches restores active matches saved before a restart. Must be called
+// before Run. In-progress games are kept so their result can still be recorded;
+// matches that were accepting, drafting or waiting for a bot can't be resumed
+// (their timeouts and lobbies are gone), so their players are requeued instead.
+func (c *Coordinator) RestoreMatches(matches []*Match) {
+	for _, match := range matches {
+		match.QueueID = queueOf(match.QueueID)
+		if match.State == MatchStateInProgress {
+			if match.TeamLabels == [2]string{} {
+				match.TeamLabels = DefaultTeamLabels
+			}
+			c.state.Matches[match.ID] = match
+			logger.Match(match.ID).Infof("Restored in-progress match %s", match.ID)
+			continue
+		}
+
+		logger.Match(match.ID).Infof("Cancelling restored match %s (state: %v), requeueing players", match.ID, match.State)
+		for _, p := range match.Players {
+			if !c.state.IsPlayerInQueue(p.SteamID) && !c.state.IsPlayerInMatch(p.SteamID) {
+				c.state.Queues[match.QueueID] = append(c.state.Queues[match.QueueID], p)
+			}
+		}
+	}
+}
+
+// saveMatches persists the active matches if they changed since they were
+// last saved. Most commands, such as heartbeats, leave them as they were.
+func (c *Coordinator) saveMatches() {
+	if c.persistMatches == nil {
+		return
+	}
+	matches := make([]*Match, 0, len(c.state.Matches))
+	for _, m := range c.state.Matches {
+		matches = append(matches, m)
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].ID < matches[j].ID })
+
+	snapshot, err := json.Marshal(matches)
+	if err != nil {
+		logger.Errorf("Failed to snapshot matches: %v", err)
+	} else if bytes.Equal(snapshot, c.savedMatches) {
+		return
 	}
+	c.savedMatches = snapshot
+	c.persistMatches(matches)
 }
 
 func (c *Coordinator) Send(cmd Command) {
@@ -62,52 +310,85 @@ func (c *Coordinator) Events() <-chan Event {
 	return c.events
 }
 
+// Subscribe returns a channel that receives every emitted event. Safe to call
+// while the coordinator is running.
 func (c *Coordinator) Subscribe() <-chan Event {
 	ch := make(chan Event, 100)
+	c.subscribersMu.Lock()
 	c.subscribers = append(c.subscribers, ch)
+	c.subscribersMu.Unlock()
 	return ch
 }
 
 func (c *Coordinator) Run(ctx context.Context) {
-	log.Println("Coordinator started")
+	logger.Infof("Coordinator started")
+
+	var afkCheck <-chan time.Time
+	if AFKTimeout > 0 || MaxQueueTime > 0 {
+		ticker := time.NewTicker(afkCheckInterval)
+		defer ticker.Stop()
+		afkCheck = ticker.C
+	}
+
 	for {
 		select {
+		case <-afkCheck:
+			if AFKTimeout > 0 {
+				c.removeAwayPlayers()
+			}
+			if MaxQueueTime > 0 {
+				c.removeLongQueuedPlayers()
+			}
 		case <-ctx.Done():
-			log.Println("Coordinator shutting down")
+			logger.Infof("Coordinator shutting down")
 			// Return players from non-in-progress matches to queue before saving
 			for _, match := range c.state.Matches {
 				if match.State != MatchStateInProgress {
 					for _, p := range match.Players {
 						if !c.state.IsPlayerInQueue(p.SteamID) {
-							c.state.Queue = append(c.state.Queue, p)
+							c.state.Queues[match.QueueID] = append(c.state.Queues[match.QueueID], p)
 						}
 					}
 				}
 			}
 			c.saveQueue()
+			c.saveMatches()
 			return
 		case cmd := <-c.commands:
 			c.handleCommand(cmd)
+			switch cmd.(type) {
+			case getStateCmd, getPlayerMatchCmd, BotCheckMatch:
+				// Read-only
+			default:
+				c.saveMatches()
+			}
 		}
 	}
 }
 
 func (c *Coordinator) emit(e Event) {
-	if _, ok := e.(QueueUpdated); ok {
+	if qu, ok := e.(QueueUpdated); ok {
+		c.queueVersion++
+		qu.Queues = c.state.queueList()
+		qu.Version = c.queueVersion
+		qu.Paused = c.state.Paused
+		e = qu
 		c.saveQueue()
 	}
 
 	select {
 	case c.events <- e:
 	default:
-		log.Println("Warning: main event channel full, dropping event")
+		logger.Warnf("main event channel full, dropping event")
 	}
 
+	c.subscribersMu.RLock()
+	defer c.subscribersMu.RUnlock()
 	for _, ch := range c.subscribers {
 		select {
 		case ch <- e:
 		default:
-			log.Println("Warning: subscriber event channel full, dropping event")
+			logger.Warnf("subscriber event channel full, dropping event")
 		}
 	}
 }
@@ -129,59 +410,211 @@ func (c *Coordinator) handleCommand(cmd Command) {
 		if cmd.Response != nil {
 			cmd.Response <- err
 		}
+	case DeclineMatch:
+		err := c.handleDeclineMatch(cmd)
+		if cmd.Response != nil {
+			cmd.Response <- err
+		}
 	case PickPlayer:
 		err := c.handlePickPlayer(cmd)
 		if cmd.Response != nil {
 			cmd.Response <- err
 		}
+	case QueueHeartbeat:
+		c.handleQueueHeartbeat(cmd)
+	case VoteCancel:
+		err := c.handleVoteCancel(cmd)
+		if cmd.Response != nil {
+			cmd.Response <- err
+		}
+	case RequestRedraft:
+		err := c.handleRequestRedraft(cmd)
+		if cmd.Response != nil {
+			cmd.Response <- err
+		}
+	case SendChatMessage:
+		err := c.handleSendChatMessage(cmd)
+		if cmd.Response != nil {
+			cmd.Response <- err
+		}
 	case MatchAcceptTimeout:
 		c.handleMatchAcceptTimeout(cmd)
 	case BotLobbyReady:
 		c.handleBotLobbyReady(cmd)
 	case BotGameStarted:
 		c.handleBotGameStarted(cmd)
+	case BotMatchProgress:
+		c.handleBotMatchProgress(cmd)
+	case BotLobbyJoinProgress:
+		c.handleBotLobbyJoinProgress(cmd)
+	case BotLobbyJoinWarning:
+		c.handleBotLobbyJoinWarning(cmd)
 	case BotGameEnded:
 		c.handleBotGameEnded(cmd)
 	case DraftPickTimeout:
 		c.handleDraftPickTimeout(cmd)
+	case DraftPickWarningDue:
+		c.handleDraftPickWarningDue(cmd)
 	case BotLobbyTimeout:
 		c.handleBotLobbyTimeout(cmd)
+	case BotLobbyAbandoned:
+		c.handleBotLobbyAbandoned(cmd)
+	case VoteCancelHoldExpired:
+		c.handleVoteCancelHoldExpired(cmd)
+	case RejoinQueue:
+		err := c.handleRejoinQueue(cmd)
+		if cmd.Response != nil {
+			cmd.Response <- err
+		}
 	case AdminCancelMatch:
 		cmd.Response <- c.handleAdminCancelMatch(cmd)
 	case AdminSetMatchResult:
 		cmd.Response <- c.handleAdminSetMatchResult(cmd)
+	case AdminMarkGameStarted:
+		cmd.Response <- c.handleAdminMarkGameStarted(cmd)
 	case AdminKickFromQueue:
 		cmd.Response <- c.handleAdminKickFromQueue(cmd)
+	case AdminRequeueMatch:
+		cmd.Response <- c.handleAdminRequeueMatch(cmd)
 	case AdminSetLobbySettings:
 		cmd.Response <- c.handleAdminSetLobbySettings(cmd)
+	case AdminSwapPlayers:
+		cmd.Response <- c.handleAdminSwapPlayers(cmd)
+	case AdminShuffleTeams:
+		cmd.Response <- c.handleAdminShuffleTeams(cmd)
+	case AdminForceStartMatch:
+		cmd.Response <- c.handleAdminForceStartMatch(cmd)
+	case AdminPauseQueue:
+		c.handleAdminPauseQueue()
+	case AdminResumeQueue:
+		c.handleAdminResumeQueue()
 	case getStateCmd:
 		cmd.Response <- stateSnapshot{
-			Queue:         c.state.Queue,
+			Queue:         c.state.QueuedPlayers(),
+			Queues:        c.state.queueList(),
 			Matches:       c.state.Matches,
 			LobbySettings: c.state.LobbySettings,
+			QueueVersion:  c.queueVersion,
+			Paused:        c.state.Paused,
 		}
 	case getPlayerMatchCmd:
 		cmd.Response <- c.state.GetPlayerMatch(cmd.PlayerID)
+	case BotCheckMatch:
+		match := c.state.GetMatch(cmd.MatchID)
+		cmd.Response <- match != nil && match.State == MatchStateWaitingForBot
+	}
+}
+
+// checkQueueVersion rejects a change made against an outdated queue.
+// Version 0 means the client didn't send one.
+func (c *Coordinator) checkQueueVersion(expected int) error {
+	if expected != 0 && expected != c.queueVersion {
+		return ErrStaleQueue
 	}
+	return nil
 }
 
 func (c *Coordinator) handleJoinQueue(cmd JoinQueue) error {
 	if c.state.IsPlayerInQueue(cmd.Player.SteamID) {
-		return errors.New("already in queue")
+		return ErrAlreadyInQueue
 	}
 
 	if c.state.IsPlayerInMatch(cmd.Player.SteamID) {
 		return errors.New("already in a match")
 	}
 
-	c.state.Queue = append(c.state.Queue, cmd.Player)
-	log.Printf("Player %s joined queue (%d/%d)", cmd.Player.Name, len(c.state.Queue), MaxPlayers)
+	if err := c.checkQueueVersion(cmd.ExpectedVersion); err != nil {
+		return err
+	}
+
+	queueID := cmd.QueueID
+	if queueID == "" {
+		queueID = DefaultQueueID
+	}
+	cfg, ok := queueConfig(queueID)
+	if !ok {
+		return ErrUnknownQueue
+	}
+	queue := c.state.Queues[queueID]
+	if MaxQueueSize > 0 && len(queue) >= MaxQueueSize {
+		return fmt.Errorf("%w (%d players)", ErrQueueFull, MaxQueueSize)
+	}
+
+	// Joining normally gives up any reserved slot.
+	delete(c.rejoinGrace, cmd.Player.SteamID)
+	c.heartbeats[cmd.Player.SteamID] = time.Now()
+
+	player := cmd.Player
+	player.QueuedAt = time.Now()
+	player.QueueID = queueID
+	c.state.Queues[queueID] = append(queue, player)
+	logger.Infof("Player %s joined queue %s (%d/%d)", cmd.Player.Name, queueID, len(queue)+1, cfg.MaxPlayers)
+
+	c.emit(QueueUpdated{})
+	c.checkQueueAlmostFull(queueID)
+
+	c.maybeStartMatch()
+
+	return nil
+}
+
+// checkQueueAlmostFull tells the players in a queue that has just reached
+// one short of a match to get ready, at most once per
+// QueueAlmostFullCooldown.
+func (c *Coordinator) checkQueueAlmostFull(queueID string) {
+	cfg, ok := queueConfig(queueID)
+	if !ok || len(c.state.Queues[queueID]) != cfg.MaxPlayers-1 {
+		return
+	}
+	if last, ok := c.almostFull[queueID]; ok && time.Since(last) < QueueAlmostFullCooldown {
+		return
+	}
+	c.almostFull[queueID] = time.Now()
+
+	logger.Infof("Queue %s is one player short of a match", queueID)
+	c.emit(QueueAlmostFull{
+		QueueID:   queueID,
+		QueueName: cfg.Name,
+		Players:   append([]Player(nil), c.state.Queues[queueID]...),
+	})
+}
+
+func (c *Coordinator) handleRejoinQueue(cmd RejoinQueue) error {
+	slot, ok := c.rejoinGrace[cmd.PlayerID]
+	if !ok {
+		return errors.New("no rejoin available")
+	}
+
+	if time.Now().After(slot.Expires) {
+		delete(c.rejoinGrace, cmd.PlayerID)
+		return errors.New("rejoin window has expired")
+	}
+
+	if c.state.IsPlayerInQueue(cmd.PlayerID) {
+		return ErrAlreadyInQueue
+	}
 
-	c.emit(QueueUpdated{Queue: c.state.Queue})
+	if c.state.IsPlayerInMatch(cmd.PlayerID) {
+		return errors.New("already in a match")
+	}
 
-	if len(c.state.Queue) >= MaxPlayers {
-		c.startMatchAcceptance()
+	// A reserved slot keeps its place but not a place over the cap; the
+	// player can retry while the window lasts.
+	queueID := queueOf(slot.Player.QueueID)
+	queue := c.state.Queues[queueID]
+	if MaxQueueSize > 0 && len(queue) >= MaxQueueSize {
+		return fmt.Errorf("%w (%d players)", ErrQueueFull, MaxQueueSize)
 	}
+	delete(c.rejoinGrace, cmd.PlayerID)
+
+	pos := min(slot.Position, len(queue))
+	c.state.Queues[queueID] = append(queue[:pos], append([]Player{slot.Player}, queue[pos:]...)...)
+	logger.Infof("Player %s rejoined queue %s at position %d (%d players)", slot.Player.Name, queueID, pos+1, len(queue)+1)
+
+	c.emit(QueueUpdated{})
+	c.checkQueueAlmostFull(queueID)
+
+	c.maybeStartMatch()
 
 	return nil
 }
@@ -191,47 +624,190 @@ func (c *Coordinator) handleLeaveQueue(cmd LeaveQueue) error {
 		return errors.New("cannot leave queue while in a match")
 	}
 
-	if !c.state.RemoveFromQueue(cmd.PlayerID) {
-		return errors.New("not in queue")
+	queueID := c.state.PlayerQueue(cmd.PlayerID)
+	if queueID == "" || (cmd.QueueID != "" && cmd.QueueID != queueID) {
+		return ErrNotInQueue
+	}
+
+	if err := c.checkQueueVersion(cmd.ExpectedVersion); err != nil {
+		return err
 	}
 
-	log.Printf("Player %s left queue (%d/%d)", cmd.PlayerID, len(c.state.Queue), MaxPlayers)
-	c.emit(QueueUpdated{Queue: c.state.Queue})
+	c.state.RemoveFromQueue(cmd.PlayerID)
+
+	logger.Infof("Player %s left queue %s (%d players)", cmd.PlayerID, queueID, len(c.state.Queues[queueID]))
+	c.emit(QueueUpdated{})
 
 	return nil
 }
 
-func (c *Coordinator) startMatchAcceptance() {
-	players := make([]Player, MaxPlayers)
-	copy(players, c.state.Queue[:MaxPlayers])
-	c.state.Queue = c.state.Queue[MaxPlayers:]
+func (c *Coordinator) handleQueueHeartbeat(cmd QueueHeartbeat) {
+	if c.state.IsPlayerInQueue(cmd.PlayerID) {
+		c.heartbeats[cmd.PlayerID] = time.Now()
+	}
+}
+
+// removeAwayPlayers removes queued players who haven't sent a heartbeat
+// within AFKTimeout. Players without a heartbeat yet, e.g. after a restart or
+// being requeued from a match, start their timer now.
+func (c *Coordinator) removeAwayPlayers() {
+	now := time.Now()
+	players := c.state.QueuedPlayers()
+	queued := make(map[string]bool, len(players))
+	var away []Player
+	for _, p := range players {
+		queued[p.SteamID] = true
+		last, ok := c.heartbeats[p.SteamID]
+		if !ok {
+			c.heartbeats[p.SteamID] = now
+			continue
+		}
+		if now.Sub(last) > AFKTimeout {
+			away = append(away, p)
+		}
+	}
+	for id := range c.heartbeats {
+		if !queued[id] {
+			delete(c.heartbeats, id)
+		}
+	}
+
+	if len(away) == 0 {
+		return
+	}
+	for _, p := range away {
+		c.state.RemoveFromQueue(p.SteamID)
+		delete(c.heartbeats, p.SteamID)
+		logger.Infof("Player %s removed from queue after %v without a heartbeat", p.Name, AFKTimeout)
+		c.emit(PlayerAway{PlayerID: p.SteamID})
+	}
+	c.emit(QueueUpdated{})
+}
+
+// removeLongQueuedPlayers removes players who have waited longer than
+// MaxQueueTime. Players without a queue time, e.g. restored from an older
+// saved queue, start their timer now.
+func (c *Coordinator) removeLongQueuedPlayers() {
+	now := time.Now()
+	var expired []Player
+	for _, queue := range c.state.Queues {
+		for i, p := range queue {
+			if p.QueuedAt.IsZero() {
+				queue[i].QueuedAt = now
+				continue
+			}
+			if now.Sub(p.QueuedAt) > MaxQueueTime {
+				expired = append(expired, p)
+			}
+		}
+	}
+
+	if len(expired) == 0 {
+		return
+	}
+	for _, p := range expired {
+		c.state.RemoveFromQueue(p.SteamID)
+		delete(c.heartbeats, p.SteamID)
+		logger.Infof("Player %s removed from queue after waiting %v", p.Name, MaxQueueTime)
+		c.emit(PlayerAway{PlayerID: p.SteamID, QueueTime: true})
+	}
+	c.emit(QueueUpdated{})
+}
+
+// maybeStartMatch starts a match for each full queue while there is room
+// for another one. Call it whenever a queue grows or a match ends.
+func (c *Coordinator) maybeStartMatch() {
+	if c.state.Paused {
+		return
+	}
+	for _, q := range QueueConfigs() {
+		if len(c.state.Queues[q.ID]) < q.MaxPlayers || c.heldBack(q.ID, q.MaxPlayers) {
+			continue
+		}
+		if MaxConcurrentMatches > 0 && len(c.state.Matches) >= MaxConcurrentMatches {
+			logger.Infof("Queue %s is full but %d matches are active, holding players until one ends", q.ID, len(c.state.Matches))
+			return
+		}
+		c.startAcceptance(c.takeFromQueue(q.ID, q.MaxPlayers))
+	}
+}
+
+// heldBack reports whether the next n players of a queue are all from a
+// match just cancelled by vote, in which case they aren't matched again yet.
+func (c *Coordinator) heldBack(queueID string, n int) bool {
+	hold, ok := c.voteHolds[queueID]
+	if !ok {
+		return false
+	}
+	if time.Now().After(hold.Expires) {
+		delete(c.voteHolds, queueID)
+		return false
+	}
+	for _, p := range c.state.Queues[queueID][:n] {
+		if !hold.Players[p.SteamID] {
+			delete(c.voteHolds, queueID) // The roster changed
+			return false
+		}
+	}
+	return true
+}
+
+func (c *Coordinator) handleVoteCancelHoldExpired(cmd VoteCancelHoldExpired) {
+	if hold, ok := c.voteHolds[cmd.QueueID]; ok && !time.Now().Before(hold.Expires) {
+		delete(c.voteHolds, cmd.QueueID)
+		c.maybeStartMatch()
+	}
+}
 
-	matchID := uuid.New().String()
-	deadline := time.Now().Add(MatchAcceptTimeoutDur)
+// takeFromQueue moves the first n players of a queue into a new match in
+// the accepting state.
+func (c *Coordinator) takeFromQueue(queueID string, n int) *Match {
+	queue := c.state.Queues[queueID]
+	players := make([]Player, n)
+	copy(players, queue[:n])
+	c.state.Queues[queueID] = queue[n:]
+
+	// Heartbeats restart if the players are requeued from this match.
+	for _, p := range players {
+		delete(c.heartbeats, p.SteamID)
+	}
 
 	match := &Match{
-		ID:              matchID,
+		ID:              uuid.New().String(),
+		QueueID:         queueID,
 		State:           MatchStateAccepting,
 		Players:         players,
 		AcceptedPlayers: make(map[string]bool),
-		AcceptDeadline:  deadline,
+		TeamLabels:      c.state.LobbySettings.TeamLabels(),
 	}
-	c.state.Matches[matchID] = match
+	c.state.Matches[match.ID] = match
+
+	c.emit(QueueUpdated{})
+	return match
+}
+
+// startAcceptance asks a new match's players to accept it.
+func (c *Coordinator) startAcceptance(match *Match) {
+	matchID, players := match.ID, match.Players
+	timeout := c.state.LobbySettings.acceptTimeout()
+	deadline := time.Now().Add(timeout)
+	match.AcceptDeadline = deadline
 
-	log.Printf("Match %s started acceptance phase (%d active matches)", matchID, len(c.state.Matches))
+	logger.Match(matchID).Infof("Match %s started acceptance phase (%d active matches)", matchID, len(c.state.Matches))
 
-	c.emit(QueueUpdated{Queue: c.state.Queue})
 	c.emit(MatchAcceptStarted{
 		MatchID:  matchID,
 		Players:  players,
 		Deadline: deadline,
 	})
 
+	generation := match.nextTimeoutGen()
 	go func() {
-		time.Sleep(MatchAcceptTimeoutDur)
+		time.Sleep(timeout)
 		c.Send(MatchAcceptTimeout{
-			MatchID:   matchID,
-			StartedAt: deadline.Add(-MatchAcceptTimeoutDur),
+			MatchID:    matchID,
+			StartedAt:  deadline.Add(-timeout),
+			Generation: generation,
 		})
 	}()
 }
@@ -256,123 +832,479 @@ func (c *Coordinator) handleAcceptMatch(cmd AcceptMatch) error {
 	if !found {
 		return errors.New("player not in this match")
 	}
+	if match.DeclinedPlayers[cmd.PlayerID] {
+		return errors.New("match already declined")
+	}
 
 	match.AcceptedPlayers[cmd.PlayerID] = true
-	log.Printf("Player %s accepted match %s (%d/%d)", cmd.PlayerID, cmd.MatchID, len(match.AcceptedPlayers), MaxPlayers)
+	logger.Match(cmd.MatchID).Infof("Player %s accepted match %s (%d/%d)", cmd.PlayerID, cmd.MatchID, len(match.AcceptedPlayers), len(match.Players))
 
 	c.emit(MatchAcceptUpdated{
 		MatchID:  match.ID,
 		Accepted: match.AcceptedPlayers,
 	})
 
-	if len(match.AcceptedPlayers) >= MaxPlayers {
+	if len(match.AcceptedPlayers) >= len(match.Players) {
 		c.startDraft(match)
+	} else if len(match.AcceptedPlayers)+len(match.DeclinedPlayers) == len(match.Players) {
+		c.finishAcceptance(match)
 	}
 
 	return nil
 }
 
-func (c *Coordinator) handleMatchAcceptTimeout(cmd MatchAcceptTimeout) {
+func (c *Coordinator) handleSendChatMessage(cmd SendChatMessage) error {
 	match := c.state.GetMatch(cmd.MatchID)
 	if match == nil {
-		return // Match already ended
+		return errors.New("match not found")
 	}
 
-	if match.State != MatchStateAccepting {
-		return // Already moved past accepting
+	if match.State != MatchStateDrafting {
+		return errors.New("chat is only available during the draft")
 	}
 
-	log.Printf("Match %s accept timeout", cmd.MatchID)
+	var sender *Player
+	for i := range match.Players {
+		if match.Players[i].SteamID == cmd.PlayerID {
+			sender = &match.Players[i]
+			break
+		}
+	}
+	if sender == nil {
+		return errors.New("player not in this match")
+	}
 
-	var failedPlayers []Player
-	var acceptedPlayers []Player
+	text := sanitizeChatText(cmd.Text)
+	if text == "" {
+		return errors.New("message is empty")
+	}
 
-	for _, p := range match.Players {
-		if match.AcceptedPlayers[p.SteamID] {
-			acceptedPlayers = append(acceptedPlayers, p)
-		} else {
-			failedPlayers = append(failedPlayers, p)
-			c.emit(PlayerFailedAccept{PlayerID: p.SteamID})
-		}
+	now := time.Now()
+	if now.Sub(c.lastChat[cmd.PlayerID]) < chatCooldown {
+		return errors.New("you are sending messages too quickly")
 	}
+	c.lastChat[cmd.PlayerID] = now
 
-	c.state.Queue = append(acceptedPlayers, c.state.Queue...)
+	msg := ChatMessage{
+		SenderID:   sender.SteamID,
+		SenderName: sender.Name,
+		Text:       text,
+		SentAt:     now,
+	}
+	match.Chat = append(match.Chat, msg)
+	if len(match.Chat) > MaxChatHistory {
+		match.Chat = match.Chat[len(match.Chat)-MaxChatHistory:]
+	}
 
-	c.emit(MatchCancelled{
-		MatchID:       cmd.MatchID,
-		FailedPlayers: failedPlayers,
+	c.emit(ChatMessageSent{
+		MatchID: match.ID,
+		Players: match.Players,
+		Message: msg,
 	})
-	c.emit(QueueUpdated{Queue: c.state.Queue})
-
-	delete(c.state.Matches, cmd.MatchID)
+	return nil
+}
 
-	if len(c.state.Queue) >= MaxPlayers {
-		c.startMatchAcceptance()
+// sanitizeChatText strips control characters and surrounding whitespace and
+// truncates to MaxChatMessageLen. HTML escaping is left to the templates.
+func sanitizeChatText(text string) string {
+	text = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, text)
+	text = strings.TrimSpace(text)
+	if runes := []rune(text); len(runes) > MaxChatMessageLen {
+		text = string(runes[:MaxChatMessageLen])
 	}
+	return text
 }
 
-func (c *Coordinator) startDraft(match *Match) {
-	if match == nil || match.State != MatchStateAccepting {
-		return
+func (c *Coordinator) handleVoteCancel(cmd VoteCancel) error {
+	match := c.state.GetMatch(cmd.MatchID)
+	if match == nil {
+		return errors.New("match not found")
 	}
 
-	captains := selectCaptains(match.Players)
+	if match.State != MatchStateAccepting && match.State != MatchStateDrafting {
+		return errors.New("match can only be cancelled by vote before the lobby is created")
+	}
 
-	var available []Player
-	for _, p := range match.Players {
-		if p.SteamID != captains[0].SteamID && p.SteamID != captains[1].SteamID {
-			available = append(available, p)
-		}
+	if indexOfPlayer(match.Players, cmd.PlayerID) < 0 {
+		return errors.New("not in this match")
 	}
 
-	match.State = MatchStateDrafting
-	match.Captains = captains
-	match.Radiant = []Player{captains[0]}
-	match.Dire = []Player{captains[1]}
-	match.AvailablePlayers = available
-	match.CurrentPicker = 0 // Radiant picks first
-	match.PickCount = 0
-	match.PickDeadline = time.Now().Add(DraftPickTimeoutDur)
+	if match.CancelVotes == nil {
+		match.CancelVotes = make(map[string]bool)
+	}
+	if match.CancelVotes[cmd.PlayerID] {
+		return errors.New("already voted")
+	}
+	match.CancelVotes[cmd.PlayerID] = true
 
-	log.Printf("Match %s started draft phase. Captains: %s (priority %d, Radiant), %s (priority %d, Dire)",
-		match.ID, captains[0].Name, captains[0].CaptainPriority, captains[1].Name, captains[1].CaptainPriority)
+	needed := CancelVotesNeeded(len(match.Players))
+	logger.Match(cmd.MatchID).Infof("Match %s: cancel vote %d/%d", cmd.MatchID, len(match.CancelVotes), needed)
 
-	c.emit(DraftStarted{
-		MatchID:   match.ID,
-		Captains:  captains,
-		Radiant:   match.Radiant,
-		Dire:      match.Dire,
-		Available: available,
-		Deadline:  match.PickDeadline,
+	c.emit(VoteCancelUpdated{
+		MatchID: cmd.MatchID,
+		Players: match.Players,
+		Votes:   maps.Clone(match.CancelVotes),
+		Needed:  needed,
 	})
 
-	// If no players to pick (e.g. 2-player match), complete draft immediately
-	if len(available) == 0 {
-		c.completeDraft(match)
-		return
+	if len(match.CancelVotes) < needed {
+		return nil
 	}
 
-	c.scheduleDraftTimeout(match.ID, 0)
+	logger.Match(cmd.MatchID).Infof("Match %s cancelled by vote, requeueing all players", cmd.MatchID)
+
+	// Nobody is at fault, so everyone goes back to the front of the queue,
+	// held back from being matched together again straight away.
+	c.state.Queues[match.QueueID] = append(append([]Player{}, match.Players...), c.state.Queues[match.QueueID]...)
+	if holdDur := VoteCancelHoldDur; holdDur > 0 {
+		hold := voteHold{Players: make(map[string]bool), Expires: time.Now().Add(holdDur)}
+		for _, p := range match.Players {
+			hold.Players[p.SteamID] = true
+		}
+		c.voteHolds[match.QueueID] = hold
+		queueID := match.QueueID
+		go func() {
+			time.Sleep(holdDur)
+			c.Send(VoteCancelHoldExpired{QueueID: queueID})
+		}()
+	}
+
+	c.emit(MatchCancelled{
+		MatchID:         cmd.MatchID,
+		Players:         match.Players,
+		AcceptedPlayers: match.AcceptedPlayers,
+		Voted:           true,
+	})
+	c.emit(QueueUpdated{})
+
+	delete(c.state.Matches, cmd.MatchID)
+
+	c.maybeStartMatch()
+
+	return nil
 }
 
-func (c *Coordinator) handlePickPlayer(cmd PickPlayer) error {
+func (c *Coordinator) handleMatchAcceptTimeout(cmd MatchAcceptTimeout) {
 	match := c.state.GetMatch(cmd.MatchID)
 	if match == nil {
-		return errors.New("match not found")
+		return // Match already ended
 	}
 
-	if match.State != MatchStateDrafting {
-		return errors.New("match not in drafting state")
+	if match.State != MatchStateAccepting || match.TimeoutGen != cmd.Generation {
+		return // Already moved past accepting
 	}
 
-	currentCaptain := match.Captains[match.CurrentPicker]
-	if currentCaptain.SteamID != cmd.CaptainID {
-		return errors.New("not your turn to pick")
+	logger.Match(cmd.MatchID).Infof("Match %s accept timeout", cmd.MatchID)
+	c.finishAcceptance(match)
+}
+
+func (c *Coordinator) handleDeclineMatch(cmd DeclineMatch) error {
+	match := c.state.GetMatch(cmd.MatchID)
+	if match == nil {
+		return errors.New("match not found")
 	}
 
-	var pickedPlayer *Player
-	for i, p := range match.AvailablePlayers {
-		if p.SteamID == cmd.PickedID {
+	if match.State != MatchStateAccepting {
+		return errors.New("match not in accepting state")
+	}
+
+	if indexOfPlayer(match.Players, cmd.PlayerID) < 0 {
+		return errors.New("player not in this match")
+	}
+	if match.AcceptedPlayers[cmd.PlayerID] {
+		return errors.New("match already accepted")
+	}
+
+	if match.DeclinedPlayers == nil {
+		match.DeclinedPlayers = make(map[string]bool)
+	}
+	match.DeclinedPlayers[cmd.PlayerID] = true
+	logger.Match(cmd.MatchID).Infof("Player %s declined match %s", cmd.PlayerID, cmd.MatchID)
+
+	// Keep waiting only while the rest could still accept enough
+	remaining := len(match.Players) - len(match.DeclinedPlayers)
+	responded := len(match.AcceptedPlayers) + len(match.DeclinedPlayers)
+	if remaining < c.state.LobbySettings.minAccepts(len(match.Players)) || responded == len(match.Players) {
+		c.finishAcceptance(match)
+	}
+	return nil
+}
+
+// finishAcceptance ends an accept phase that not everyone accepted. If
+// enough players accepted and the queue can fill the empty places, the match
+// goes on to the draft with players from the queue; otherwise it's cancelled.
+func (c *Coordinator) finishAcceptance(match *Match) {
+	missing := len(match.Players) - len(match.AcceptedPlayers)
+	if len(match.AcceptedPlayers) < c.state.LobbySettings.minAccepts(len(match.Players)) || missing > len(c.state.Queues[match.QueueID]) {
+		c.cancelAcceptance(match)
+		return
+	}
+	c.backfill(match)
+	c.startDraft(match)
+}
+
+// backfill replaces the players who didn't accept a match with players from
+// the front of the queue, who count as having accepted. Players who timed
+// out go to the back of the queue if LobbySettings.RequeueTimedOut is set.
+func (c *Coordinator) backfill(match *Match) {
+	var kept, removed, declined, requeued []Player
+	for _, p := range match.Players {
+		if match.AcceptedPlayers[p.SteamID] {
+			kept = append(kept, p)
+			continue
+		}
+		removed = append(removed, p)
+		delete(match.CancelVotes, p.SteamID)
+		switch {
+		case match.DeclinedPlayers[p.SteamID]:
+			declined = append(declined, p)
+			c.emit(PlayerFailedAccept{PlayerID: p.SteamID, Declined: true})
+		case c.state.LobbySettings.RequeueTimedOut:
+			requeued = append(requeued, p)
+		default:
+			c.emit(PlayerFailedAccept{PlayerID: p.SteamID})
+		}
+	}
+
+	queue := c.state.Queues[match.QueueID]
+	added := make([]Player, len(removed))
+	copy(added, queue[:len(removed)])
+	c.state.Queues[match.QueueID] = append(queue[len(removed):], requeued...)
+	for _, p := range added {
+		delete(c.heartbeats, p.SteamID)
+		match.AcceptedPlayers[p.SteamID] = true
+	}
+	match.Players = append(kept, added...)
+	match.DeclinedPlayers = nil
+
+	logger.Match(match.ID).Infof("Match %s: replaced %d players who didn't accept with players from the queue", match.ID, len(added))
+
+	c.emit(MatchBackfilled{
+		MatchID:  match.ID,
+		Removed:  removed,
+		Added:    added,
+		Declined: declined,
+		Requeued: requeued,
+	})
+	c.emit(QueueUpdated{})
+}
+
+// cancelAcceptance ends a match that failed its accept phase. Accepted
+// players go back to the front of the queue. Players who timed out go to the
+// back if LobbySettings.RequeueTimedOut is set; everyone else is removed.
+func (c *Coordinator) cancelAcceptance(match *Match) {
+	var failedPlayers, acceptedPlayers, declinedPlayers, requeued []Player
+
+	for _, p := range match.Players {
+		switch {
+		case match.AcceptedPlayers[p.SteamID]:
+			acceptedPlayers = append(acceptedPlayers, p)
+		case match.DeclinedPlayers[p.SteamID]:
+			failedPlayers = append(failedPlayers, p)
+			declinedPlayers = append(declinedPlayers, p)
+			c.emit(PlayerFailedAccept{PlayerID: p.SteamID, Declined: true})
+		default:
+			failedPlayers = append(failedPlayers, p)
+			if c.state.LobbySettings.RequeueTimedOut {
+				requeued = append(requeued, p)
+			} else {
+				c.emit(PlayerFailedAccept{PlayerID: p.SteamID})
+			}
+		}
+	}
+
+	queue := append(acceptedPlayers, c.state.Queues[match.QueueID]...)
+	c.state.Queues[match.QueueID] = append(queue, requeued...)
+
+	c.emit(MatchCancelled{
+		MatchID:         match.ID,
+		FailedPlayers:   failedPlayers,
+		Players:         match.Players,
+		AcceptedPlayers: match.AcceptedPlayers,
+		DeclinedPlayers: declinedPlayers,
+		Requeued:        requeued,
+	})
+	c.emit(QueueUpdated{})
+
+	delete(c.state.Matches, match.ID)
+
+	c.maybeStartMatch()
+}
+
+func (c *Coordinator) startDraft(match *Match) {
+	if match == nil || match.State != MatchStateAccepting {
+		return
+	}
+
+	if c.state.LobbySettings.AutoBalance {
+		c.autoBalance(match)
+		return
+	}
+
+	captains := selectCaptains(match.Players, c.state.LobbySettings)
+
+	match.State = MatchStateDrafting
+	match.Captains = captains
+
+	logger.Match(match.ID).Infof("Match %s started draft phase. Captains: %s (priority %d, Radiant), %s (priority %d, Dire)",
+		match.ID, captains[0].Name, captains[0].CaptainPriority, captains[1].Name, captains[1].CaptainPriority)
+
+	c.startPicking(match)
+}
+
+// startPicking puts the captains alone on their teams and starts the draft
+// from the first pick.
+func (c *Coordinator) startPicking(match *Match) {
+	captains := match.Captains
+
+	var available []Player
+	for _, p := range match.Players {
+		if p.SteamID != captains[0].SteamID && p.SteamID != captains[1].SteamID {
+			available = append(available, p)
+		}
+	}
+
+	match.Radiant = []Player{captains[0]}
+	match.Dire = []Player{captains[1]}
+	match.AvailablePlayers = available
+	match.CurrentPicker = 0 // Radiant picks first
+	match.PickCount = 0
+	match.Picks = nil
+	match.PickDeadline = time.Now().Add(c.state.LobbySettings.draftPickTimeout())
+	bank := c.state.LobbySettings.draftBankTime()
+	match.BankTime = [2]time.Duration{bank, bank}
+	match.BankStartedAt = time.Time{}
+
+	c.emit(DraftStarted{
+		MatchID:    match.ID,
+		Captains:   captains,
+		Radiant:    match.Radiant,
+		Dire:       match.Dire,
+		Available:  available,
+		Deadline:   match.PickDeadline,
+		BankTime:   match.BankTime,
+		TeamLabels: match.TeamLabels,
+	})
+
+	// If no players to pick (e.g. 2-player match), complete draft immediately
+	if len(available) == 0 {
+		c.completeDraft(match)
+		return
+	}
+
+	c.scheduleDraftTimeout(match, c.state.LobbySettings.draftPickTimeout())
+}
+
+// handleRequestRedraft records a captain's request to redraft, restarting
+// the draft once both captains agree. Each match may be redrafted once, and
+// only while drafting, before a bot lobby has been requested.
+func (c *Coordinator) handleRequestRedraft(cmd RequestRedraft) error {
+	match := c.state.GetMatch(cmd.MatchID)
+	if match == nil {
+		return errors.New("match not found")
+	}
+
+	if match.State != MatchStateDrafting {
+		return errors.New("match not in drafting state")
+	}
+
+	if match.Captains[0].SteamID != cmd.CaptainID && match.Captains[1].SteamID != cmd.CaptainID {
+		return errors.New("only captains can request a redraft")
+	}
+
+	if match.Redrafted {
+		return errors.New("this match has already been redrafted")
+	}
+
+	if match.RedraftVotes == nil {
+		match.RedraftVotes = make(map[string]bool)
+	}
+	if match.RedraftVotes[cmd.CaptainID] {
+		return errors.New("already requested a redraft")
+	}
+	match.RedraftVotes[cmd.CaptainID] = true
+
+	if len(match.RedraftVotes) < 2 {
+		logger.Match(cmd.MatchID).Infof("Match %s: redraft requested by %s", cmd.MatchID, cmd.CaptainID)
+		c.emit(RedraftRequested{
+			MatchID:  match.ID,
+			Captains: match.Captains,
+			Votes:    maps.Clone(match.RedraftVotes),
+		})
+		return nil
+	}
+
+	logger.Match(cmd.MatchID).Infof("Match %s: both captains agreed, restarting the draft", cmd.MatchID)
+
+	match.RedraftVotes = nil
+	match.Redrafted = true
+	c.startPicking(match)
+
+	return nil
+}
+
+// autoBalance skips the captain draft, splitting the players into the most
+// even teams by rating. The draft events are still emitted with the final
+// teams so clients follow the usual flow straight to the lobby.
+func (c *Coordinator) autoBalance(match *Match) {
+	radiant, dire := balanceTeams(match.Players)
+	captains := [2]Player{highestRated(radiant), highestRated(dire)}
+
+	match.State = MatchStateDrafting
+	match.Captains = captains
+	match.Radiant = radiant
+	match.Dire = dire
+	match.AvailablePlayers = nil
+	match.CurrentPicker = 0
+	match.PickCount = len(match.Players) - 2
+	match.PickDeadline = time.Now()
+
+	logger.Match(match.ID).Infof("Match %s auto-balanced: Radiant rating %d, Dire rating %d",
+		match.ID, teamRating(radiant), teamRating(dire))
+
+	c.emit(DraftStarted{
+		MatchID:    match.ID,
+		Captains:   captains,
+		Radiant:    radiant,
+		Dire:       dire,
+		Deadline:   match.PickDeadline,
+		TeamLabels: match.TeamLabels,
+	})
+	c.emit(DraftUpdated{
+		MatchID:    match.ID,
+		Captains:   captains,
+		Radiant:    radiant,
+		Dire:       dire,
+		Deadline:   match.PickDeadline,
+		TeamLabels: match.TeamLabels,
+	})
+
+	c.completeDraft(match)
+}
+
+func (c *Coordinator) handlePickPlayer(cmd PickPlayer) error {
+	match := c.state.GetMatch(cmd.MatchID)
+	if match == nil {
+		return errors.New("match not found")
+	}
+
+	if match.State != MatchStateDrafting {
+		return errors.New("match not in drafting state")
+	}
+
+	currentCaptain := match.Captains[match.CurrentPicker]
+	if currentCaptain.SteamID != cmd.CaptainID {
+		return errors.New("not your turn to pick")
+	}
+
+	var pickedPlayer *Player
+	for i, p := range match.AvailablePlayers {
+		if p.SteamID == cmd.PickedID {
 			pickedPlayer = &p
 			match.AvailablePlayers = append(
 				match.AvailablePlayers[:i],
@@ -383,7 +1315,21 @@ func (c *Coordinator) handlePickPlayer(cmd PickPlayer) error {
 	}
 
 	if pickedPlayer == nil {
-		return errors.New("player not available for picking")
+		// Say why, so a stale or tampered pick gets a precise message.
+		switch {
+		case indexOfPlayer(match.Captains[:], cmd.PickedID) >= 0:
+			return errors.New("cannot pick a captain")
+		case indexOfPlayer(match.Radiant, cmd.PickedID) >= 0, indexOfPlayer(match.Dire, cmd.PickedID) >= 0:
+			return errors.New("player already drafted")
+		default:
+			return errors.New("player not in this match")
+		}
+	}
+
+	if !match.BankStartedAt.IsZero() {
+		used := time.Since(match.BankStartedAt)
+		match.BankTime[match.CurrentPicker] = max(0, match.BankTime[match.CurrentPicker]-used)
+		match.BankStartedAt = time.Time{}
 	}
 
 	if match.CurrentPicker == 0 {
@@ -391,14 +1337,15 @@ func (c *Coordinator) handlePickPlayer(cmd PickPlayer) error {
 	} else {
 		match.Dire = append(match.Dire, *pickedPlayer)
 	}
+	match.recordPick(pickedPlayer.SteamID)
 
-	log.Printf("Captain %s picked %s for %s (pick %d)",
+	logger.Infof("Captain %s picked %s for %s (pick %d)",
 		currentCaptain.Name, pickedPlayer.Name,
 		map[int]string{0: "Radiant", 1: "Dire"}[match.CurrentPicker], match.PickCount+1)
 
 	match.PickCount++
-	match.CurrentPicker = getPickerForPickCount(match.PickCount)
-	match.PickDeadline = time.Now().Add(DraftPickTimeoutDur)
+	match.CurrentPicker = nextPicker(match)
+	match.PickDeadline = time.Now().Add(c.state.LobbySettings.draftPickTimeout())
 
 	c.emit(DraftUpdated{
 		MatchID:          match.ID,
@@ -408,6 +1355,9 @@ func (c *Coordinator) handlePickPlayer(cmd PickPlayer) error {
 		Dire:             match.Dire,
 		CurrentPicker:    match.CurrentPicker,
 		Deadline:         match.PickDeadline,
+		Picks:            match.Picks,
+		BankTime:         match.BankTime,
+		TeamLabels:       match.TeamLabels,
 	})
 
 	// Auto-assign last remaining player
@@ -419,10 +1369,11 @@ func (c *Coordinator) handlePickPlayer(cmd PickPlayer) error {
 		} else {
 			match.Dire = append(match.Dire, last)
 		}
-		log.Printf("Auto-assigned last player %s to %s",
+		match.recordPick(last.SteamID)
+		logger.Infof("Auto-assigned last player %s to %s",
 			last.Name, map[int]string{0: "Radiant", 1: "Dire"}[match.CurrentPicker])
 		match.PickCount++
-		match.CurrentPicker = getPickerForPickCount(match.PickCount)
+		match.CurrentPicker = nextPicker(match)
 
 		c.emit(DraftUpdated{
 			MatchID:          match.ID,
@@ -432,13 +1383,16 @@ func (c *Coordinator) handlePickPlayer(cmd PickPlayer) error {
 			Dire:             match.Dire,
 			CurrentPicker:    match.CurrentPicker,
 			Deadline:         match.PickDeadline,
+			Picks:            match.Picks,
+			BankTime:         match.BankTime,
+			TeamLabels:       match.TeamLabels,
 		})
 	}
 
 	if len(match.AvailablePlayers) == 0 {
 		c.completeDraft(match)
 	} else {
-		c.scheduleDraftTimeout(match.ID, match.PickCount)
+		c.scheduleDraftTimeout(match, c.state.LobbySettings.draftPickTimeout())
 	}
 
 	return nil
@@ -449,31 +1403,103 @@ func (c *Coordinator) completeDraft(match *Match) {
 		return
 	}
 
+	settings := c.matchLobbySettings(match)
 	match.State = MatchStateWaitingForBot
-	match.LobbyDeadline = time.Now().Add(LobbyJoinTimeoutDur)
+	match.GameMode = settings.GameMode
+	match.LobbyDeadline = time.Now().Add(settings.lobbyJoinTimeout())
+	match.LobbyName = c.lobbyName(match)
+	match.ManualLobby = ManualLobbies
 
-	log.Printf("Match %s draft complete, requesting bot lobby", match.ID)
+	logger.Match(match.ID).Infof("Match %s draft complete, requesting bot lobby", match.ID)
 
 	c.emit(RequestBotLobby{
-		MatchID:  match.ID,
-		Players:  match.Players,
-		Radiant:  match.Radiant,
-		Dire:     match.Dire,
-		GameMode: c.state.LobbySettings.GameMode,
-		Deadline: match.LobbyDeadline,
+		MatchID:        match.ID,
+		LobbyName:      match.LobbyName,
+		Players:        match.Players,
+		Radiant:        match.Radiant,
+		Dire:           match.Dire,
+		GameMode:       match.GameMode,
+		ServerRegion:   settings.ServerRegion,
+		KickStrangers:  settings.KickStrangers,
+		Tournament:     settings.Tournament,
+		SpectatorDelay: settings.SpectatorDelay,
+		BannedHeroes:   settings.BannedHeroes,
+		JoinTimeout:    settings.lobbyJoinTimeout(),
+		JoinWarning:    LobbyJoinWarningLead,
+		Deadline:       match.LobbyDeadline,
+		Manual:         match.ManualLobby,
 	})
 }
 
-func (c *Coordinator) scheduleDraftTimeout(matchID string, pickNumber int) {
+// lobbyName fills in the lobby name template for a match. The day's match
+// number is only drawn when the template uses it, so numbers aren't skipped.
+func (c *Coordinator) lobbyName(match *Match) string {
+	settings := c.state.LobbySettings
+	tmpl := settings.LobbyNameTemplate
+	if tmpl == "" {
+		tmpl = DefaultLobbyNameTemplate
+	}
+
+	now := time.Now()
+	day := now.Format("2006-01-02")
+	n := 1
+	if strings.Contains(tmpl, "{n}") && c.lobbyNumber != nil {
+		if next, err := c.lobbyNumber(day); err != nil {
+			logger.Match(match.ID).Errorf("Failed to get lobby number: %v", err)
+		} else {
+			n = next
+		}
+	}
+
+	return strings.NewReplacer(
+		"{community}", settings.CommunityName,
+		"{n}", strconv.Itoa(n),
+		"{date}", day,
+		"{id}", match.ID[:min(8, len(match.ID))],
+	).Replace(tmpl)
+}
+
+// scheduleDraftTimeout times out the current pick after timeout, with a
+// warning to the captain DraftPickWarningLead before.
+func (c *Coordinator) scheduleDraftTimeout(match *Match, timeout time.Duration) {
+	matchID, pickNumber := match.ID, match.PickCount
+	generation := match.nextTimeoutGen()
+	if lead := DraftPickWarningLead; lead > 0 && lead < timeout {
+		go func() {
+			time.Sleep(timeout - lead)
+			c.Send(DraftPickWarningDue{
+				MatchID:    matchID,
+				PickNumber: pickNumber,
+				Generation: generation,
+			})
+		}()
+	}
 	go func() {
-		time.Sleep(DraftPickTimeoutDur)
+		time.Sleep(timeout)
 		c.Send(DraftPickTimeout{
 			MatchID:    matchID,
 			PickNumber: pickNumber,
+			Generation: generation,
 		})
 	}()
 }
 
+func (c *Coordinator) handleDraftPickWarningDue(cmd DraftPickWarningDue) {
+	match := c.state.GetMatch(cmd.MatchID)
+	if match == nil || match.State != MatchStateDrafting {
+		return
+	}
+	if match.PickCount != cmd.PickNumber || match.TimeoutGen != cmd.Generation {
+		return // Pick already made or timer replaced
+	}
+
+	c.emit(DraftPickWarning{
+		MatchID:  match.ID,
+		Captain:  match.Captains[match.CurrentPicker],
+		Deadline: match.PickDeadline,
+	})
+}
+
 func (c *Coordinator) handleDraftPickTimeout(cmd DraftPickTimeout) {
 	match := c.state.GetMatch(cmd.MatchID)
 	if match == nil {
@@ -484,13 +1510,37 @@ func (c *Coordinator) handleDraftPickTimeout(cmd DraftPickTimeout) {
 		return // No longer in drafting phase
 	}
 
-	// Stale timeout — pick was already made
-	if match.PickCount != cmd.PickNumber {
+	// Stale timeout — pick was already made or a newer timer replaced it
+	if match.PickCount != cmd.PickNumber || match.TimeoutGen != cmd.Generation {
 		return
 	}
 
-	failedCaptain := match.Captains[match.CurrentPicker]
-	log.Printf("Match %s: Captain %s failed to pick in time", cmd.MatchID, failedCaptain.Name)
+	// Run down the captain's bank before giving up on them
+	picker := match.CurrentPicker
+	if match.BankStartedAt.IsZero() && match.BankTime[picker] > 0 {
+		logger.Match(cmd.MatchID).Infof("Match %s: Captain %s is using their bank time (%v)",
+			cmd.MatchID, match.Captains[picker].Name, match.BankTime[picker])
+		match.BankStartedAt = time.Now()
+		match.PickDeadline = match.BankStartedAt.Add(match.BankTime[picker])
+		c.emit(DraftUpdated{
+			MatchID:          match.ID,
+			Captains:         match.Captains,
+			AvailablePlayers: match.AvailablePlayers,
+			Radiant:          match.Radiant,
+			Dire:             match.Dire,
+			CurrentPicker:    picker,
+			Deadline:         match.PickDeadline,
+			Picks:            match.Picks,
+			BankTime:         match.BankTime,
+			UsingBank:        true,
+			TeamLabels:       match.TeamLabels,
+		})
+		c.scheduleDraftTimeout(match, match.BankTime[picker])
+		return
+	}
+
+	failedCaptain := match.Captains[picker]
+	logger.Match(cmd.MatchID).Infof("Match %s: Captain %s failed to pick in time", cmd.MatchID, failedCaptain.Name)
 
 	var returnToQueue []Player
 	for _, p := range match.Players {
@@ -499,28 +1549,91 @@ func (c *Coordinator) handleDraftPickTimeout(cmd DraftPickTimeout) {
 		}
 	}
 
-	c.state.Queue = append(returnToQueue, c.state.Queue...)
+	c.state.Queues[match.QueueID] = append(returnToQueue, c.state.Queues[match.QueueID]...)
 
 	c.emit(DraftCancelled{
 		MatchID:         cmd.MatchID,
 		FailedCaptain:   failedCaptain,
 		ReturnedToQueue: returnToQueue,
 	})
-	c.emit(QueueUpdated{Queue: c.state.Queue})
+	c.emit(QueueUpdated{})
 
 	delete(c.state.Matches, cmd.MatchID)
 
-	if len(c.state.Queue) >= MaxPlayers {
-		c.startMatchAcceptance()
-	}
+	c.maybeStartMatch()
 }
 
 func (c *Coordinator) handleBotLobbyReady(cmd BotLobbyReady) {
 	match := c.state.GetMatch(cmd.MatchID)
-	if match == nil {
+	if match == nil || match.State != MatchStateWaitingForBot {
+		return
+	}
+	logger.Match(cmd.MatchID).Infof("Match %s: bot lobby ready", cmd.MatchID)
+
+	match.LobbyName = cmd.LobbyName
+	match.LobbyPassword = cmd.Password
+
+	c.emit(LobbyReady{
+		MatchID:   match.ID,
+		Players:   match.Players,
+		LobbyName: match.LobbyName,
+		Password:  match.LobbyPassword,
+		Deadline:  match.LobbyDeadline,
+	})
+}
+
+func (c *Coordinator) handleBotLobbyJoinProgress(cmd BotLobbyJoinProgress) {
+	match := c.state.GetMatch(cmd.MatchID)
+	if match == nil || match.State != MatchStateWaitingForBot {
+		return
+	}
+
+	match.LobbyJoined = cmd.Joined
+	joined, missing := LobbyJoinStatus(match)
+	c.emit(LobbyJoinProgress{
+		MatchID: match.ID,
+		Players: match.Players,
+		Joined:  joined,
+		Missing: missing,
+	})
+}
+
+func (c *Coordinator) handleBotLobbyJoinWarning(cmd BotLobbyJoinWarning) {
+	match := c.state.GetMatch(cmd.MatchID)
+	if match == nil || match.State != MatchStateWaitingForBot {
+		return
+	}
+
+	match.LobbyJoined = cmd.Joined
+	_, missing := LobbyJoinStatus(match)
+	if len(missing) == 0 {
 		return
 	}
-	log.Printf("Match %s: bot lobby ready", cmd.MatchID)
+
+	logger.Match(cmd.MatchID).Infof("Match %s: warning %d players who haven't joined the lobby", cmd.MatchID, len(missing))
+	c.emit(LobbyJoinWarning{
+		MatchID:  match.ID,
+		Missing:  missing,
+		Deadline: match.LobbyDeadline,
+	})
+}
+
+// handleBotLobbyAbandoned ends a match whose bot gave up its lobby. A game
+// that was running is completed without a known winner, so an admin can set
+// the result from history; otherwise the players go back to the queue.
+func (c *Coordinator) handleBotLobbyAbandoned(cmd BotLobbyAbandoned) {
+	match := c.state.GetMatch(cmd.MatchID)
+	if match == nil {
+		return // Match already ended
+	}
+
+	logger.Match(cmd.MatchID).Infof("Bot abandoned the lobby for match %s (state: %v)", cmd.MatchID, match.State)
+	switch match.State {
+	case MatchStateInProgress:
+		c.handleBotGameEnded(BotGameEnded{MatchID: cmd.MatchID, DotaMatchID: match.DotaMatchID})
+	case MatchStateWaitingForBot:
+		c.handleAdminCancelMatch(AdminCancelMatch{MatchID: cmd.MatchID, ReturnToQueue: true})
+	}
 }
 
 func (c *Coordinator) handleBotLobbyTimeout(cmd BotLobbyTimeout) {
@@ -529,11 +1642,13 @@ func (c *Coordinator) handleBotLobbyTimeout(cmd BotLobbyTimeout) {
 		return // Match already ended
 	}
 
-	if match.State != MatchStateWaitingForBot {
-		return // Game already started
+	// InProgress is allowed because a launched lobby can fall back to setup
+	// when a player never connects, and the bot gives up after relaunching.
+	if match.State != MatchStateWaitingForBot && match.State != MatchStateInProgress {
+		return
 	}
 
-	log.Printf("Match %s: lobby join timeout", cmd.MatchID)
+	logger.Match(cmd.MatchID).Infof("Match %s: lobby join timeout", cmd.MatchID)
 
 	joinedCorrectly := make(map[string]bool)
 	for _, steamID := range cmd.PlayersJoinedRight {
@@ -550,23 +1665,39 @@ func (c *Coordinator) handleBotLobbyTimeout(cmd BotLobbyTimeout) {
 		}
 	}
 
-	log.Printf("Match %s: %d players joined correctly, %d failed",
+	logger.Match(cmd.MatchID).Infof("Match %s: %d players joined correctly, %d failed",
 		cmd.MatchID, len(returnToQueue), len(failedPlayers))
 
-	c.state.Queue = append(returnToQueue, c.state.Queue...)
+	c.state.Queues[match.QueueID] = append(returnToQueue, c.state.Queues[match.QueueID]...)
+
+	// Failed players keep their slot behind the returned players for a short
+	// while, in case they were just slow or had a client issue.
+	deadline := time.Now().Add(RejoinGraceDur)
+	for i, p := range failedPlayers {
+		c.rejoinGrace[p.SteamID] = rejoinSlot{
+			Player:   p,
+			Position: len(returnToQueue) + i,
+			Expires:  deadline,
+		}
+	}
 
 	c.emit(LobbyCancelled{
 		MatchID:         cmd.MatchID,
 		FailedPlayers:   failedPlayers,
 		ReturnedToQueue: returnToQueue,
 	})
-	c.emit(QueueUpdated{Queue: c.state.Queue})
+	for _, p := range failedPlayers {
+		c.emit(QueueRejoinAvailable{
+			MatchID:  cmd.MatchID,
+			PlayerID: p.SteamID,
+			Deadline: deadline,
+		})
+	}
+	c.emit(QueueUpdated{})
 
 	delete(c.state.Matches, cmd.MatchID)
 
-	if len(c.state.Queue) >= MaxPlayers {
-		c.startMatchAcceptance()
-	}
+	c.maybeStartMatch()
 }
 
 func (c *Coordinator) handleBotGameStarted(cmd BotGameStarted) {
@@ -575,18 +1706,45 @@ func (c *Coordinator) handleBotGameStarted(cmd BotGameStarted) {
 		return
 	}
 
+	// A lobby that fell back to setup and was relaunched starts again with a
+	// new Dota match ID, but it's still the same match.
+	if match.State == MatchStateInProgress {
+		logger.Match(cmd.MatchID).Infof("Match %s relaunched (Dota Match ID: %d)", cmd.MatchID, cmd.DotaMatchID)
+		match.DotaMatchID = cmd.DotaMatchID
+		return
+	}
+
 	match.State = MatchStateInProgress
 	match.DotaMatchID = cmd.DotaMatchID
+	match.LobbyPassword = ""
 
-	log.Printf("Match %s started (Dota Match ID: %d)", cmd.MatchID, cmd.DotaMatchID)
+	logger.Match(cmd.MatchID).Infof("Match %s started (Dota Match ID: %d)", cmd.MatchID, cmd.DotaMatchID)
 
 	c.emit(MatchStarted{
-		MatchID:     cmd.MatchID,
-		DotaMatchID: cmd.DotaMatchID,
-		Players:     match.Players,
-		Radiant:     match.Radiant,
-		Dire:        match.Dire,
-		Captains:    match.Captains,
+		MatchID:         cmd.MatchID,
+		DotaMatchID:     cmd.DotaMatchID,
+		Players:         match.Players,
+		Radiant:         match.Radiant,
+		Dire:            match.Dire,
+		Captains:        match.Captains,
+		AcceptedPlayers: match.AcceptedPlayers,
+		GameMode:        match.GameMode,
+		Picks:           match.Picks,
+	})
+}
+
+func (c *Coordinator) handleBotMatchProgress(cmd BotMatchProgress) {
+	match := c.state.GetMatch(cmd.MatchID)
+	if match == nil || match.State != MatchStateInProgress {
+		return
+	}
+
+	progress := cmd.Progress
+	match.Progress = &progress
+
+	c.emit(MatchProgress{
+		MatchID:  cmd.MatchID,
+		Progress: progress,
 	})
 }
 
@@ -596,28 +1754,33 @@ func (c *Coordinator) handleBotGameEnded(cmd BotGameEnded) {
 		return
 	}
 
-	log.Printf("Match %s ended (Dota Match ID: %d)", cmd.MatchID, cmd.DotaMatchID)
+	logger.Match(cmd.MatchID).Infof("Match %s ended (Dota Match ID: %d)", cmd.MatchID, cmd.DotaMatchID)
+
+	delete(c.state.Matches, cmd.MatchID)
 
 	c.emit(MatchCompleted{
-		MatchID:     cmd.MatchID,
-		DotaMatchID: cmd.DotaMatchID,
-		Players:     match.Players,
-		Radiant:     match.Radiant,
-		Dire:        match.Dire,
-		Winner:      cmd.Winner,
+		MatchID:         cmd.MatchID,
+		QueueID:         match.QueueID,
+		DotaMatchID:     cmd.DotaMatchID,
+		Players:         match.Players,
+		Radiant:         match.Radiant,
+		Dire:            match.Dire,
+		Winner:          cmd.Winner,
+		AcceptedPlayers: match.AcceptedPlayers,
+		GameMode:        match.GameMode,
+		TeamLabels:      match.TeamLabels,
 	})
 
-	delete(c.state.Matches, cmd.MatchID)
-
-	if len(c.state.Queue) >= MaxPlayers {
-		c.startMatchAcceptance()
-	}
+	c.maybeStartMatch()
 }
 
 type stateSnapshot struct {
-	Queue         []Player
+	Queue         []Player // Players in every queue, see State.QueuedPlayers
+	Queues        []Queue
 	Matches       map[string]*Match
 	LobbySettings LobbySettings
+	QueueVersion  int
+	Paused        bool
 }
 
 func (c *Coordinator) GetState() ([]Player, map[string]*Match, LobbySettings) {
@@ -627,6 +1790,37 @@ func (c *Coordinator) GetState() ([]Player, map[string]*Match, LobbySettings) {
 	return resp.Queue, resp.Matches, resp.LobbySettings
 }
 
+// Ping reports whether the coordinator loop answers before ctx is done.
+func (c *Coordinator) Ping(ctx context.Context) error {
+	respCh := make(chan stateSnapshot, 1)
+	select {
+	case c.commands <- getStateCmd{Response: respCh}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-respCh:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// QueueStatus is a snapshot of the queues for rendering. Version is sent
+// back by clients with queue changes.
+type QueueStatus struct {
+	Queues  []Queue
+	Version int
+	Paused  bool
+}
+
+func (c *Coordinator) QueueStatus() QueueStatus {
+	respCh := make(chan stateSnapshot, 1)
+	c.commands <- getStateCmd{Response: respCh}
+	resp := <-respCh
+	return QueueStatus{Queues: resp.Queues, Version: resp.QueueVersion, Paused: resp.Paused}
+}
+
 func (c *Coordinator) GetPlayerMatch(playerID string) *Match {
 	respCh := make(chan *Match, 1)
 	c.commands <- getPlayerMatchCmd{PlayerID: playerID, Response: respCh}
@@ -646,27 +1840,207 @@ type getPlayerMatchCmd struct {
 
 func (getPlayerMatchCmd) command() {}
 
-// selectCaptains picks two captains weighted by CaptainPriority.
-// Equal priorities are broken randomly.
-func selectCaptains(players []Player) [2]Player {
+// selectCaptains picks two distinct captains according to the lobby's
+// CaptainSelectionMode. By default they are drawn at random, each player's
+// chance proportional to their effective captain priority.
+func selectCaptains(players []Player, settings LobbySettings) [2]Player {
 	if len(players) < 2 {
 		return [2]Player{}
 	}
 
-	sorted := make([]Player, len(players))
-	copy(sorted, players)
+	now := time.Now()
+	remaining := make([]Player, len(players))
+	copy(remaining, players)
+
+	if settings.CaptainSelectionMode == CaptainModeLongestWait {
+		// Stable so players who queued at the same moment keep queue order
+		sort.SliceStable(remaining, func(i, j int) bool {
+			return remaining[i].QueuedAt.Before(remaining[j].QueuedAt)
+		})
+		return [2]Player{remaining[0], remaining[1]}
+	}
+
+	// Zero weights make weightedIndex pick uniformly
+	weights := make([]float64, len(remaining))
+	if settings.CaptainSelectionMode != CaptainModeRandom {
+		for i, p := range remaining {
+			weights[i] = effectiveCaptainPriority(p, settings, now)
+		}
+	}
+
+	var captains [2]Player
+	for n := range captains {
+		i := weightedIndex(weights)
+		captains[n] = remaining[i]
+		remaining = append(remaining[:i], remaining[i+1:]...)
+		weights = append(weights[:i], weights[i+1:]...)
+	}
+	return captains
+}
+
+// weightedIndex returns a random index into weights with probability
+// proportional to its weight, or a uniform pick if every weight is zero.
+func weightedIndex(weights []float64) int {
+	var total float64
+	for _, w := range weights {
+		total += w
+	}
+	if total <= 0 {
+		return rand.Intn(len(weights))
+	}
+
+	r := rand.Float64() * total
+	for i, w := range weights {
+		if r < w {
+			return i
+		}
+		r -= w
+	}
+	return len(weights) - 1
+}
+
+// effectiveCaptainPriority scales a player's priority down if they captained
+// within CaptainDecayDur, recovering linearly, and never returns less than
+// the MinCaptainPriority floor.
+func effectiveCaptainPriority(p Player, settings LobbySettings, now time.Time) float64 {
+	priority := float64(p.CaptainPriority)
+	if settings.CaptainDecay && p.LastCaptainedAt != nil && CaptainDecayDur > 0 {
+		if elapsed := now.Sub(*p.LastCaptainedAt); elapsed < CaptainDecayDur {
+			priority *= float64(max(elapsed, 0)) / float64(CaptainDecayDur)
+		}
+	}
+	return max(priority, float64(settings.MinCaptainPriority))
+}
+
+// DefaultRating is the Elo of a player with no rating, such as one who has
+// never played. It matches the store's starting Elo.
+const DefaultRating = 1000
+
+// playerRating is the skill estimate used for auto-balancing: the player's
+// Elo from their match history.
+func playerRating(p Player) int {
+	if p.Rating == 0 {
+		return DefaultRating
+	}
+	return p.Rating
+}
+
+func teamRating(team []Player) int {
+	total := 0
+	for _, p := range team {
+		total += playerRating(p)
+	}
+	return total
+}
+
+func highestRated(team []Player) Player {
+	best := team[0]
+	for _, p := range team[1:] {
+		if playerRating(p) > playerRating(best) {
+			best = p
+		}
+	}
+	return best
+}
+
+// maxBruteForcePlayers bounds the exhaustive search in balanceTeams; larger
+// matches fall back to a greedy split.
+const maxBruteForcePlayers = 16
 
-	// Shuffle to randomize equal-priority players
-	rand.Shuffle(len(sorted), func(i, j int) {
-		sorted[i], sorted[j] = sorted[j], sorted[i]
+// balanceTeams splits players into two teams of (nearly) equal size with
+// the smallest difference in total rating. Ties are broken randomly.
+func balanceTeams(players []Player) (radiant, dire []Player) {
+	return balanceAround(nil, nil, players)
+}
+
+// balanceAround adds players to teams that already hold radiant and dire,
+// such as the captains, like balanceTeams.
+func balanceAround(radiant, dire, players []Player) ([]Player, []Player) {
+	radiant = append([]Player(nil), radiant...)
+	dire = append([]Player(nil), dire...)
+
+	shuffled := make([]Player, len(players))
+	copy(shuffled, players)
+	rand.Shuffle(len(shuffled), func(i, j int) {
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
 	})
 
-	// Stable sort keeps random order within same priority
-	sort.SliceStable(sorted, func(i, j int) bool {
-		return sorted[i].CaptainPriority > sorted[j].CaptainPriority
+	n := len(shuffled)
+	if n > maxBruteForcePlayers {
+		return greedyBalance(radiant, dire, shuffled)
+	}
+
+	// Radiant takes the smaller half when the total is odd
+	need := (len(radiant)+len(dire)+n)/2 - len(radiant)
+	if need < 0 || need > n {
+		return greedyBalance(radiant, dire, shuffled)
+	}
+
+	total := teamRating(shuffled)
+	lead := teamRating(radiant) - teamRating(dire)
+	bestMask, bestDiff := 0, -1
+	for mask := 0; mask < 1<<n; mask++ {
+		if bits.OnesCount(uint(mask)) != need {
+			continue
+		}
+		rating := 0
+		for i := 0; i < n; i++ {
+			if mask&(1<<i) != 0 {
+				rating += playerRating(shuffled[i])
+			}
+		}
+		diff := lead + 2*rating - total
+		if diff < 0 {
+			diff = -diff
+		}
+		if bestDiff < 0 || diff < bestDiff {
+			bestMask, bestDiff = mask, diff
+		}
+	}
+
+	for i, p := range shuffled {
+		if bestMask&(1<<i) != 0 {
+			radiant = append(radiant, p)
+		} else {
+			dire = append(dire, p)
+		}
+	}
+	return radiant, dire
+}
+
+// greedyBalance assigns players from strongest to weakest to whichever team
+// is currently weaker, keeping team sizes within one of each other.
+func greedyBalance(radiant, dire, players []Player) ([]Player, []Player) {
+	sort.SliceStable(players, func(i, j int) bool {
+		return playerRating(players[i]) > playerRating(players[j])
 	})
 
-	return [2]Player{sorted[0], sorted[1]}
+	half := (len(radiant) + len(dire) + len(players) + 1) / 2
+	for _, p := range players {
+		switch {
+		case len(radiant) >= half:
+			dire = append(dire, p)
+		case len(dire) >= half:
+			radiant = append(radiant, p)
+		case teamRating(radiant) <= teamRating(dire):
+			radiant = append(radiant, p)
+		default:
+			dire = append(dire, p)
+		}
+	}
+	return radiant, dire
+}
+
+// nextPicker returns which captain picks next. It follows the draft order
+// unless that captain's team is already full, which only happens for team
+// sizes the order wasn't written for.
+func nextPicker(match *Match) int {
+	picker := getPickerForPickCount(match.PickCount)
+	teams := [2][]Player{match.Radiant, match.Dire}
+	if len(teams[picker]) >= match.TeamSize() {
+		return 1 - picker
+	}
+	return picker
 }
 
 // getPickerForPickCount returns which captain (0=Radiant, 1=Dire) picks
@@ -691,18 +2065,76 @@ func getPickerForPickCount(pickCount int) int {
 	}
 }
 
+func (c *Coordinator) handleAdminPauseQueue() {
+	if c.state.Paused {
+		return
+	}
+	c.state.Paused = true
+	logger.Infof("Admin paused the queue")
+	c.emit(QueueUpdated{})
+}
+
+func (c *Coordinator) handleAdminResumeQueue() {
+	if !c.state.Paused {
+		return
+	}
+	c.state.Paused = false
+	logger.Infof("Admin resumed the queue")
+	c.emit(QueueUpdated{})
+	c.maybeStartMatch()
+}
+
+func (c *Coordinator) handleAdminForceStartMatch(cmd AdminForceStartMatch) error {
+	queueID := cmd.QueueID
+	if queueID == "" {
+		queueID = DefaultQueueID
+	}
+	cfg, ok := queueConfig(queueID)
+	if !ok {
+		return ErrUnknownQueue
+	}
+	queue := c.state.Queues[queueID]
+
+	count := cmd.Count
+	if count == 0 {
+		count = min(len(queue), cfg.MaxPlayers)
+		count -= count % 2 // Leave the odd player out so teams are equal
+	}
+	if err := ValidateMaxPlayers(count); err != nil {
+		return fmt.Errorf("cannot start a match with %d players: %w", count, err)
+	}
+	if count > len(queue) {
+		return fmt.Errorf("only %d players in queue", len(queue))
+	}
+
+	// Queued players are never in a match, so taking them can't double-book.
+	match := c.takeFromQueue(queueID, count)
+	logger.Match(match.ID).Infof("Admin force-started match %s with %d players (skip accept: %v)", match.ID, count, cmd.SkipAccept)
+
+	if !cmd.SkipAccept {
+		c.startAcceptance(match)
+		return nil
+	}
+
+	for _, p := range match.Players {
+		match.AcceptedPlayers[p.SteamID] = true
+	}
+	c.startDraft(match)
+	return nil
+}
+
 func (c *Coordinator) handleAdminCancelMatch(cmd AdminCancelMatch) error {
 	match := c.state.GetMatch(cmd.MatchID)
 	if match == nil {
 		return errors.New("match not found")
 	}
 
-	log.Printf("Admin cancelled match %s (state: %v, return to queue: %v)", cmd.MatchID, match.State, cmd.ReturnToQueue)
+	logger.Match(cmd.MatchID).Infof("Admin cancelled match %s (state: %v, return to queue: %v)", cmd.MatchID, match.State, cmd.ReturnToQueue)
 
 	if cmd.ReturnToQueue {
 		for _, p := range match.Players {
 			if !c.state.IsPlayerInQueue(p.SteamID) {
-				c.state.Queue = append(c.state.Queue, p)
+				c.state.Queues[match.QueueID] = append(c.state.Queues[match.QueueID], p)
 			}
 		}
 	}
@@ -712,14 +2144,31 @@ func (c *Coordinator) handleAdminCancelMatch(cmd AdminCancelMatch) error {
 		ReturnedToQueue: cmd.ReturnToQueue,
 		Players:         match.Players,
 	})
-	c.emit(QueueUpdated{Queue: c.state.Queue})
+	c.emit(QueueUpdated{})
 
 	delete(c.state.Matches, cmd.MatchID)
 
-	if len(c.state.Queue) >= MaxPlayers {
-		c.startMatchAcceptance()
+	c.maybeStartMatch()
+
+	return nil
+}
+
+// handleAdminMarkGameStarted stands in for the bot when an admin has hosted
+// the lobby by hand.
+func (c *Coordinator) handleAdminMarkGameStarted(cmd AdminMarkGameStarted) error {
+	match := c.state.GetMatch(cmd.MatchID)
+	if match == nil {
+		return errors.New("match not found")
+	}
+	if match.State != MatchStateWaitingForBot {
+		return errors.New("match is not waiting for a lobby")
 	}
 
+	logger.Match(cmd.MatchID).Infof("Admin marked match %s as started", cmd.MatchID)
+	c.handleBotGameStarted(BotGameStarted{
+		MatchID:     cmd.MatchID,
+		DotaMatchID: cmd.DotaMatchID,
+	})
 	return nil
 }
 
@@ -733,34 +2182,40 @@ func (c *Coordinator) handleAdminSetMatchResult(cmd AdminSetMatchResult) error {
 		return errors.New("winner must be 'radiant' or 'dire'")
 	}
 
-	log.Printf("Admin set match %s result: %s wins", cmd.MatchID, cmd.Winner)
+	logger.Match(cmd.MatchID).Infof("Admin set match %s result: %s wins", cmd.MatchID, cmd.Winner)
+
+	// Remove the match before emitting, so a repeated result for it (say, a
+	// double-clicked button) finds no match instead of completing it again.
+	delete(c.state.Matches, cmd.MatchID)
 
 	winner := cmd.Winner
 	c.emit(MatchCompleted{
-		MatchID:     cmd.MatchID,
-		DotaMatchID: match.DotaMatchID,
-		Players:     match.Players,
-		Radiant:     match.Radiant,
-		Dire:        match.Dire,
-		Winner:      &winner,
+		MatchID:         cmd.MatchID,
+		QueueID:         match.QueueID,
+		DotaMatchID:     match.DotaMatchID,
+		Players:         match.Players,
+		Radiant:         match.Radiant,
+		Dire:            match.Dire,
+		Winner:          &winner,
+		AcceptedPlayers: match.AcceptedPlayers,
+		GameMode:        match.GameMode,
+		TeamLabels:      match.TeamLabels,
 	})
 
-	delete(c.state.Matches, cmd.MatchID)
-
-	if len(c.state.Queue) >= MaxPlayers {
-		c.startMatchAcceptance()
-	}
+	c.maybeStartMatch()
 
 	return nil
 }
 
 func (c *Coordinator) handleAdminKickFromQueue(cmd AdminKickFromQueue) error {
+	queueID := c.state.PlayerQueue(cmd.PlayerID)
+	queue := c.state.Queues[queueID]
 	found := false
-	newQueue := make([]Player, 0, len(c.state.Queue))
-	for _, p := range c.state.Queue {
+	newQueue := make([]Player, 0, len(queue))
+	for _, p := range queue {
 		if p.SteamID == cmd.PlayerID {
 			found = true
-			log.Printf("Admin kicked player %s from queue", p.Name)
+			logger.Infof("Admin kicked player %s from queue", p.Name)
 		} else {
 			newQueue = append(newQueue, p)
 		}
@@ -770,19 +2225,233 @@ func (c *Coordinator) handleAdminKickFromQueue(cmd AdminKickFromQueue) error {
 		return errors.New("player not in queue")
 	}
 
-	c.state.Queue = newQueue
-	c.emit(QueueUpdated{Queue: c.state.Queue})
+	c.state.Queues[queueID] = newQueue
+	c.emit(QueueUpdated{})
+
+	return nil
+}
+
+func (c *Coordinator) handleAdminRequeueMatch(cmd AdminRequeueMatch) error {
+	now := time.Now()
+	added := 0
+	for _, p := range cmd.Players {
+		if c.state.IsPlayerInQueue(p.SteamID) || c.state.IsPlayerInMatch(p.SteamID) {
+			continue
+		}
+		delete(c.rejoinGrace, p.SteamID)
+		// Give players who aren't on the site time to notice before AFK removal
+		c.heartbeats[p.SteamID] = now
+		p.QueuedAt = now
+		p.QueueID = queueOf(p.QueueID)
+		c.state.Queues[p.QueueID] = append(c.state.Queues[p.QueueID], p)
+		added++
+	}
+
+	if added == 0 {
+		return errors.New("every player is already queued or in a match")
+	}
+
+	logger.Infof("Admin requeued %d/%d players from a finished match", added, len(cmd.Players))
+	c.emit(QueueUpdated{})
+
+	c.maybeStartMatch()
+
+	return nil
+}
+
+func (c *Coordinator) handleAdminSwapPlayers(cmd AdminSwapPlayers) error {
+	match := c.state.GetMatch(cmd.MatchID)
+	if match == nil {
+		return errors.New("match not found")
+	}
+
+	if match.State != MatchStateDrafting && match.State != MatchStateWaitingForBot {
+		return errors.New("players can only be swapped during the draft or before the game starts")
+	}
+
+	// Normalize so PlayerA is on Radiant and PlayerB is on Dire
+	radiantIdx, direIdx := indexOfPlayer(match.Radiant, cmd.PlayerA), indexOfPlayer(match.Dire, cmd.PlayerB)
+	if radiantIdx < 0 || direIdx < 0 {
+		radiantIdx, direIdx = indexOfPlayer(match.Radiant, cmd.PlayerB), indexOfPlayer(match.Dire, cmd.PlayerA)
+	}
+	if radiantIdx < 0 || direIdx < 0 {
+		return errors.New("players must be on opposite teams in this match")
+	}
+
+	radiantPlayer := match.Radiant[radiantIdx]
+	direPlayer := match.Dire[direIdx]
+	radiantIsCaptain := radiantPlayer.SteamID == match.Captains[0].SteamID
+	direIsCaptain := direPlayer.SteamID == match.Captains[1].SteamID
+	if (radiantIsCaptain || direIsCaptain) && !cmd.AllowCaptains {
+		return errors.New("cannot swap a captain")
+	}
+
+	// Copy before modifying: earlier events may still reference these slices
+	radiant := append([]Player(nil), match.Radiant...)
+	dire := append([]Player(nil), match.Dire...)
+	radiant[radiantIdx] = direPlayer
+	dire[direIdx] = radiantPlayer
+	match.Radiant = radiant
+	match.Dire = dire
+	match.dropPicks(radiantPlayer.SteamID, direPlayer.SteamID)
+
+	// A swapped captain hands the captaincy to whoever took their place
+	if radiantIsCaptain {
+		match.Captains[0] = direPlayer
+	}
+	if direIsCaptain {
+		match.Captains[1] = radiantPlayer
+	}
+
+	logger.Match(match.ID).Infof("Admin swapped %s (now Dire) and %s (now Radiant) in match %s",
+		radiantPlayer.Name, direPlayer.Name, match.ID)
+
+	if match.State == MatchStateDrafting {
+		c.emit(DraftUpdated{
+			MatchID:          match.ID,
+			Captains:         match.Captains,
+			AvailablePlayers: match.AvailablePlayers,
+			Radiant:          match.Radiant,
+			Dire:             match.Dire,
+			CurrentPicker:    match.CurrentPicker,
+			Deadline:         match.PickDeadline,
+			Picks:            match.Picks,
+			BankTime:         match.BankTime,
+			UsingBank:        !match.BankStartedAt.IsZero(),
+			TeamLabels:       match.TeamLabels,
+		})
+	} else {
+		c.emit(TeamsUpdated{
+			MatchID: match.ID,
+			Radiant: match.Radiant,
+			Dire:    match.Dire,
+		})
+	}
+
+	return nil
+}
+
+func (c *Coordinator) handleAdminShuffleTeams(cmd AdminShuffleTeams) error {
+	match := c.state.GetMatch(cmd.MatchID)
+	if match == nil {
+		return errors.New("match not found")
+	}
+
+	if match.State != MatchStateDrafting && match.State != MatchStateWaitingForBot {
+		return errors.New("teams can only be shuffled during the draft or before the game starts")
+	}
+
+	captains := match.Captains
+	var others []Player
+	for _, p := range match.Players {
+		if p.SteamID != captains[0].SteamID && p.SteamID != captains[1].SteamID {
+			others = append(others, p)
+		}
+	}
+	radiant, dire := balanceAround([]Player{captains[0]}, []Player{captains[1]}, others)
+	match.Radiant = radiant
+	match.Dire = dire
+	// The teams no longer come from the draft, so its picks would be
+	// recorded against players the captains didn't get.
+	match.Picks = nil
+
+	logger.Match(match.ID).Infof("Admin shuffled teams in match %s: Radiant rating %d, Dire rating %d",
+		match.ID, teamRating(radiant), teamRating(dire))
+
+	if match.State == MatchStateWaitingForBot {
+		c.emit(TeamsUpdated{
+			MatchID: match.ID,
+			Radiant: match.Radiant,
+			Dire:    match.Dire,
+		})
+		return nil
+	}
+
+	// Everyone has a team now, so the draft is over
+	match.AvailablePlayers = nil
+	match.PickCount = len(match.Players) - 2
+	match.BankStartedAt = time.Time{}
+	c.emit(DraftUpdated{
+		MatchID:          match.ID,
+		Captains:         match.Captains,
+		AvailablePlayers: match.AvailablePlayers,
+		Radiant:          match.Radiant,
+		Dire:             match.Dire,
+		CurrentPicker:    match.CurrentPicker,
+		Deadline:         match.PickDeadline,
+		Picks:            match.Picks,
+		BankTime:         match.BankTime,
+		TeamLabels:       match.TeamLabels,
+	})
+	c.completeDraft(match)
 
 	return nil
 }
 
+func indexOfPlayer(players []Player, steamID string) int {
+	for i, p := range players {
+		if p.SteamID == steamID {
+			return i
+		}
+	}
+	return -1
+}
+
 func (c *Coordinator) handleAdminSetLobbySettings(cmd AdminSetLobbySettings) error {
 	if _, ok := ValidGameModes[cmd.Settings.GameMode]; !ok {
 		return errors.New("invalid game mode")
 	}
+	if cmd.Settings.ServerRegion != "" {
+		if _, ok := ValidServerRegions[cmd.Settings.ServerRegion]; !ok {
+			return errors.New("invalid server region")
+		}
+	}
+	validDelay := false
+	for _, d := range ValidSpectatorDelays {
+		if cmd.Settings.SpectatorDelay == d {
+			validDelay = true
+			break
+		}
+	}
+	if !validDelay {
+		return errors.New("invalid spectator delay")
+	}
+	if !AcceptTimeoutLimit.contains(cmd.Settings.AcceptTimeout) {
+		return fmt.Errorf("accept timeout must be between %d and %d seconds", AcceptTimeoutLimit.Min, AcceptTimeoutLimit.Max)
+	}
+	if !DraftPickTimeoutLimit.contains(cmd.Settings.DraftPickTimeout) {
+		return fmt.Errorf("draft pick timeout must be between %d and %d seconds", DraftPickTimeoutLimit.Min, DraftPickTimeoutLimit.Max)
+	}
+	if !LobbyJoinTimeoutLimit.contains(cmd.Settings.LobbyJoinTimeout) {
+		return fmt.Errorf("lobby join timeout must be between %d and %d seconds", LobbyJoinTimeoutLimit.Min, LobbyJoinTimeoutLimit.Max)
+	}
+	if !DraftBankTimeLimit.contains(cmd.Settings.DraftBankTime) {
+		return fmt.Errorf("draft bank time must be between %d and %d seconds", DraftBankTimeLimit.Min, DraftBankTimeLimit.Max)
+	}
+	if cmd.Settings.MinCaptainPriority < 1 || cmd.Settings.MinCaptainPriority > 10 {
+		return errors.New("minimum captain priority must be 1-10")
+	}
+	if p := cmd.Settings.MinAcceptPercent; p != 0 && (p < 50 || p > 100) {
+		return errors.New("minimum accept percentage must be 50-100")
+	}
+	if len(cmd.Settings.LobbyNameTemplate) > MaxLobbyNameLen {
+		return fmt.Errorf("lobby name template must be at most %d characters", MaxLobbyNameLen)
+	}
+	if len(cmd.Settings.CommunityName) > MaxLobbyNameLen {
+		return fmt.Errorf("community name must be at most %d characters", MaxLobbyNameLen)
+	}
+	if len(cmd.Settings.RadiantLabel) > MaxTeamLabelLen || len(cmd.Settings.DireLabel) > MaxTeamLabelLen {
+		return fmt.Errorf("team labels must be at most %d characters", MaxTeamLabelLen)
+	}
+	if cmd.Settings.CaptainSelectionMode != "" {
+		if _, ok := ValidCaptainSelectionModes[cmd.Settings.CaptainSelectionMode]; !ok {
+			return errors.New("invalid captain selection mode")
+		}
+	}
 
 	c.state.LobbySettings = cmd.Settings
-	log.Printf("Admin updated lobby settings: game mode = %s", cmd.Settings.GameMode)
+	logger.Infof("Admin updated lobby settings: game mode = %s, server region = %q", cmd.Settings.GameMode, cmd.Settings.ServerRegion)
+	c.emit(LobbySettingsUpdated{Settings: cmd.Settings})
 
 	return nil
 }
@@ -0,0 +1,595 @@
+package coordinator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testPlayers returns n distinct players.
+func testPlayers(n int) []Player {
+	players := make([]Player, n)
+	for i := range players {
+		id := fmt.Sprintf("7656119800000%04d", i)
+		players[i] = Player{SteamID: id, Name: "player" + id[len(id)-4:], CaptainPriority: 5}
+	}
+	return players
+}
+
+// newDraftingMatch queues n players and force-starts them straight into the
+// draft, returning the coordinator and the drafting match.
+func newDraftingMatch(t *testing.T, n int) (*Coordinator, *Match) {
+	t.Helper()
+	c := New()
+	c.state.Queues[DefaultQueueID] = testPlayers(n)
+	if err := c.handleAdminForceStartMatch(AdminForceStartMatch{Count: n, SkipAccept: true}); err != nil {
+		t.Fatalf("force start: %v", err)
+	}
+	if len(c.state.Matches) != 1 {
+		t.Fatalf("got %d matches, want 1", len(c.state.Matches))
+	}
+	for _, m := range c.state.Matches {
+		return c, m
+	}
+	return nil, nil
+}
+
+// drain returns the events already waiting on ch.
+func drain(ch <-chan Event) []Event {
+	var events []Event
+	for {
+		select {
+		case e := <-ch:
+			events = append(events, e)
+		default:
+			return events
+		}
+	}
+}
+
+// TestSubscribeWhileEmitting registers subscribers, as the SSE hub and
+// notifiers do, while the coordinator is busy emitting events. Run with -race.
+func TestSubscribeWhileEmitting(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c := New()
+	done := make(chan struct{})
+	go func() {
+		c.Run(ctx)
+		close(done)
+	}()
+
+	// Keep the main event channel drained so emits never stall on it.
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-c.Events():
+			}
+		}
+	}()
+
+	// Flow events: players joining and leaving the queue each emit QueueUpdated.
+	var senders sync.WaitGroup
+	senders.Add(1)
+	go func() {
+		defer senders.Done()
+		for i := 0; i < 200; i++ {
+			id := fmt.Sprintf("7656119800000%04d", i)
+			resp := make(chan error, 1)
+			c.Send(JoinQueue{
+				Player:   Player{SteamID: id, Name: id},
+				Response: resp,
+			})
+			<-resp
+			c.Send(LeaveQueue{PlayerID: id, Response: resp})
+			<-resp
+		}
+	}()
+
+	var subscribers sync.WaitGroup
+	received := make(chan struct{}, 50)
+	for i := 0; i < 50; i++ {
+		subscribers.Add(1)
+		go func() {
+			defer subscribers.Done()
+			events := c.Subscribe()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-events:
+					select {
+					case received <- struct{}{}:
+					default:
+					}
+				}
+			}
+		}()
+	}
+
+	senders.Wait()
+
+	// A subscriber registered after the others must still see new events.
+	late := c.Subscribe()
+	resp := make(chan error, 1)
+	c.Send(JoinQueue{
+		Player:   Player{SteamID: "76561198000009999", Name: "late"},
+		Response: resp,
+	})
+	if err := <-resp; err != nil {
+		t.Fatalf("JoinQueue: %v", err)
+	}
+	select {
+	case e := <-late:
+		if _, ok := e.(QueueUpdated); !ok {
+			t.Errorf("late subscriber got %T, want QueueUpdated", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("late subscriber received no event")
+	}
+
+	if len(received) == 0 {
+		t.Error("no subscriber received any event")
+	}
+
+	cancel()
+	subscribers.Wait()
+	<-done
+}
+
+func TestStaleDraftTimeoutAfterCancel(t *testing.T) {
+	c, old := newDraftingMatch(t, 4)
+	stale := DraftPickTimeout{MatchID: old.ID, PickNumber: old.PickCount, Generation: old.TimeoutGen}
+
+	if err := c.handleAdminCancelMatch(AdminCancelMatch{MatchID: old.ID, ReturnToQueue: true}); err != nil {
+		t.Fatalf("cancel: %v", err)
+	}
+
+	// The same players go straight into a new draft.
+	if err := c.handleAdminForceStartMatch(AdminForceStartMatch{Count: 4, SkipAccept: true}); err != nil {
+		t.Fatalf("force start: %v", err)
+	}
+	var match *Match
+	for _, m := range c.state.Matches {
+		match = m
+	}
+	before := *match
+
+	events := c.Subscribe()
+	c.handleCommand(stale)
+
+	if got := drain(events); len(got) != 0 {
+		t.Errorf("stale timeout emitted %d events, want none: %v", len(got), got)
+	}
+	if len(c.state.Matches) != 1 || c.state.Matches[match.ID] != match {
+		t.Fatalf("stale timeout changed the active matches")
+	}
+	if match.State != MatchStateDrafting || match.PickCount != before.PickCount ||
+		match.CurrentPicker != before.CurrentPicker || !match.BankStartedAt.Equal(before.BankStartedAt) {
+		t.Errorf("stale timeout changed the new draft")
+	}
+}
+
+func TestStaleDraftTimeoutAfterPick(t *testing.T) {
+	c, match := newDraftingMatch(t, 6)
+	stale := DraftPickTimeout{MatchID: match.ID, PickNumber: match.PickCount, Generation: match.TimeoutGen}
+
+	err := c.handlePickPlayer(PickPlayer{
+		MatchID:   match.ID,
+		CaptainID: match.Captains[match.CurrentPicker].SteamID,
+		PickedID:  match.AvailablePlayers[0].SteamID,
+	})
+	if err != nil {
+		t.Fatalf("pick: %v", err)
+	}
+	picker := match.CurrentPicker
+
+	events := c.Subscribe()
+	c.handleCommand(stale)
+
+	if got := drain(events); len(got) != 0 {
+		t.Errorf("stale timeout emitted %d events, want none: %v", len(got), got)
+	}
+	if match.State != MatchStateDrafting || match.CurrentPicker != picker || !match.BankStartedAt.IsZero() {
+		t.Errorf("stale timeout changed the draft")
+	}
+}
+
+// TestStaleDraftTimeoutAfterBankTime delivers a pick timeout again after it
+// started the captain's bank time and was replaced by a newer timer for the
+// same pick, so only the generation tells them apart.
+func TestStaleDraftTimeoutAfterBankTime(t *testing.T) {
+	c, match := newDraftingMatch(t, 6)
+	first := DraftPickTimeout{MatchID: match.ID, PickNumber: match.PickCount, Generation: match.TimeoutGen}
+
+	c.handleCommand(first)
+	if match.BankStartedAt.IsZero() || match.TimeoutGen == first.Generation {
+		t.Fatalf("first timeout didn't start bank time with a new timer")
+	}
+	bankStarted := match.BankStartedAt
+
+	events := c.Subscribe()
+	c.handleCommand(first)
+
+	if got := drain(events); len(got) != 0 {
+		t.Errorf("stale timeout emitted %d events, want none: %v", len(got), got)
+	}
+	if c.state.GetMatch(match.ID) != match || match.State != MatchStateDrafting || !match.BankStartedAt.Equal(bankStarted) {
+		t.Errorf("stale timeout changed the draft")
+	}
+}
+
+func TestStaleAcceptTimeout(t *testing.T) {
+	c := New()
+	c.state.Queues[DefaultQueueID] = testPlayers(4)
+	match := c.takeFromQueue(DefaultQueueID, 4)
+	c.startAcceptance(match)
+
+	events := c.Subscribe()
+	c.handleCommand(MatchAcceptTimeout{MatchID: match.ID, Generation: match.TimeoutGen - 1})
+	if got := drain(events); len(got) != 0 {
+		t.Errorf("stale accept timeout emitted %d events, want none: %v", len(got), got)
+	}
+	if c.state.GetMatch(match.ID) != match || match.State != MatchStateAccepting {
+		t.Fatalf("stale accept timeout ended the accept phase")
+	}
+
+	c.handleCommand(MatchAcceptTimeout{MatchID: match.ID, Generation: match.TimeoutGen})
+	if c.state.GetMatch(match.ID) != nil {
+		t.Errorf("current accept timeout didn't cancel the unaccepted match")
+	}
+}
+
+func TestDraftTeamSizes(t *testing.T) {
+	const r, d = 0, 1
+	tests := []struct {
+		players int
+		order   []int // Team of each pick, including the auto-assigned last one
+	}{
+		{2, nil},
+		{4, []int{r, d}},
+		{6, []int{r, d, d, r}},
+		{10, []int{r, d, d, r, r, d, d, r}},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d players", tt.players), func(t *testing.T) {
+			if err := ValidateMaxPlayers(tt.players); err != nil {
+				t.Fatalf("ValidateMaxPlayers(%d): %v", tt.players, err)
+			}
+			c, match := newDraftingMatch(t, tt.players)
+			if got, want := match.TeamSize(), tt.players/2; got != want {
+				t.Errorf("TeamSize() = %d, want %d", got, want)
+			}
+
+			for match.State == MatchStateDrafting {
+				err := c.handlePickPlayer(PickPlayer{
+					MatchID:   match.ID,
+					CaptainID: match.Captains[match.CurrentPicker].SteamID,
+					PickedID:  match.AvailablePlayers[0].SteamID,
+				})
+				if err != nil {
+					t.Fatalf("pick %d: %v", match.PickCount+1, err)
+				}
+			}
+
+			if match.State != MatchStateWaitingForBot {
+				t.Errorf("state after draft = %v, want waiting for bot", match.State)
+			}
+			if len(match.Radiant) != tt.players/2 || len(match.Dire) != tt.players/2 {
+				t.Errorf("teams are %d v %d, want %d v %d", len(match.Radiant), len(match.Dire), tt.players/2, tt.players/2)
+			}
+			var order []int
+			for i, pick := range match.Picks {
+				order = append(order, pick.Team)
+				if pick.PickNumber != i+1 {
+					t.Errorf("pick %d has PickNumber %d", i+1, pick.PickNumber)
+				}
+			}
+			if fmt.Sprint(order) != fmt.Sprint(tt.order) {
+				t.Errorf("draft order = %v, want %v", order, tt.order)
+			}
+		})
+	}
+}
+
+func TestValidateMaxPlayers(t *testing.T) {
+	for n := 0; n <= 12; n++ {
+		wantOK := n >= 2 && n <= 10 && n%2 == 0
+		if err := ValidateMaxPlayers(n); (err == nil) != wantOK {
+			t.Errorf("ValidateMaxPlayers(%d) = %v, want ok %v", n, err, wantOK)
+		}
+	}
+}
+
+func TestPickPlayerErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		// pick returns the pick to try on a fresh 6-player draft, after any setup.
+		pick    func(t *testing.T, c *Coordinator, m *Match) PickPlayer
+		wantErr string
+	}{
+		{
+			name: "match not found",
+			pick: func(t *testing.T, c *Coordinator, m *Match) PickPlayer {
+				return PickPlayer{MatchID: "no-such-match", CaptainID: m.Captains[0].SteamID, PickedID: m.AvailablePlayers[0].SteamID}
+			},
+			wantErr: "match not found",
+		},
+		{
+			name: "wrong phase",
+			pick: func(t *testing.T, c *Coordinator, m *Match) PickPlayer {
+				m.State = MatchStateAccepting
+				return PickPlayer{MatchID: m.ID, CaptainID: m.Captains[0].SteamID, PickedID: m.AvailablePlayers[0].SteamID}
+			},
+			wantErr: "match not in drafting state",
+		},
+		{
+			name: "not your turn",
+			pick: func(t *testing.T, c *Coordinator, m *Match) PickPlayer {
+				return PickPlayer{MatchID: m.ID, CaptainID: m.Captains[1].SteamID, PickedID: m.AvailablePlayers[0].SteamID}
+			},
+			wantErr: "not your turn to pick",
+		},
+		{
+			name: "not a captain",
+			pick: func(t *testing.T, c *Coordinator, m *Match) PickPlayer {
+				return PickPlayer{MatchID: m.ID, CaptainID: m.AvailablePlayers[0].SteamID, PickedID: m.AvailablePlayers[1].SteamID}
+			},
+			wantErr: "not your turn to pick",
+		},
+		{
+			name: "captain",
+			pick: func(t *testing.T, c *Coordinator, m *Match) PickPlayer {
+				return PickPlayer{MatchID: m.ID, CaptainID: m.Captains[0].SteamID, PickedID: m.Captains[1].SteamID}
+			},
+			wantErr: "cannot pick a captain",
+		},
+		{
+			name: "already picked",
+			pick: func(t *testing.T, c *Coordinator, m *Match) PickPlayer {
+				picked := m.AvailablePlayers[0].SteamID
+				if err := c.handlePickPlayer(PickPlayer{MatchID: m.ID, CaptainID: m.Captains[0].SteamID, PickedID: picked}); err != nil {
+					t.Fatalf("first pick: %v", err)
+				}
+				return PickPlayer{MatchID: m.ID, CaptainID: m.Captains[1].SteamID, PickedID: picked}
+			},
+			wantErr: "player already drafted",
+		},
+		{
+			name: "not in pool",
+			pick: func(t *testing.T, c *Coordinator, m *Match) PickPlayer {
+				return PickPlayer{MatchID: m.ID, CaptainID: m.Captains[0].SteamID, PickedID: "76561198099999999"}
+			},
+			wantErr: "player not in this match",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, match := newDraftingMatch(t, 6)
+			cmd := tt.pick(t, c, match)
+			available := len(match.AvailablePlayers)
+
+			err := c.handlePickPlayer(cmd)
+			if err == nil || err.Error() != tt.wantErr {
+				t.Fatalf("handlePickPlayer() error = %v, want %q", err, tt.wantErr)
+			}
+			if len(match.AvailablePlayers) != available {
+				t.Errorf("rejected pick changed the available players")
+			}
+		})
+	}
+}
+
+func TestAdminSetMatchResultTwice(t *testing.T) {
+	c, match := newDraftingMatch(t, 4)
+	for match.State == MatchStateDrafting {
+		err := c.handlePickPlayer(PickPlayer{
+			MatchID:   match.ID,
+			CaptainID: match.Captains[match.CurrentPicker].SteamID,
+			PickedID:  match.AvailablePlayers[0].SteamID,
+		})
+		if err != nil {
+			t.Fatalf("pick: %v", err)
+		}
+	}
+	c.handleCommand(BotGameStarted{MatchID: match.ID, DotaMatchID: 1234})
+
+	events := c.Subscribe()
+	var errs []error
+	for i := 0; i < 2; i++ {
+		resp := make(chan error, 1)
+		c.handleCommand(AdminSetMatchResult{MatchID: match.ID, Winner: "radiant", Response: resp})
+		errs = append(errs, <-resp)
+	}
+
+	if errs[0] != nil {
+		t.Errorf("first result: %v", errs[0])
+	}
+	if errs[1] == nil {
+		t.Errorf("second result succeeded, want match not found")
+	}
+	completed := 0
+	for _, e := range drain(events) {
+		if _, ok := e.(MatchCompleted); ok {
+			completed++
+		}
+	}
+	if completed != 1 {
+		t.Errorf("emitted %d MatchCompleted events, want 1", completed)
+	}
+}
+
+func TestVoteCancelDoesNotRepopRoster(t *testing.T) {
+	maxPlayers := MaxPlayers
+	MaxPlayers = 4
+	t.Cleanup(func() { MaxPlayers = maxPlayers })
+
+	c, match := newDraftingMatch(t, 4)
+	roster := match.Players
+	events := c.Subscribe()
+
+	for _, p := range roster {
+		if err := c.handleVoteCancel(VoteCancel{PlayerID: p.SteamID, MatchID: match.ID}); err != nil {
+			break // The vote passed before everyone voted
+		}
+	}
+	if c.state.GetMatch(match.ID) != nil {
+		t.Fatal("match not cancelled by vote")
+	}
+	for _, e := range drain(events) {
+		if _, ok := e.(MatchAcceptStarted); ok {
+			t.Fatal("the cancelled roster was matched again straight away")
+		}
+	}
+	if got := len(c.state.Queues[DefaultQueueID]); got != len(roster) {
+		t.Fatalf("queue has %d players after the vote, want the %d requeued", got, len(roster))
+	}
+
+	// Once one of them leaves and someone else joins, a match pops.
+	if err := c.handleLeaveQueue(LeaveQueue{PlayerID: roster[0].SteamID}); err != nil {
+		t.Fatalf("leave: %v", err)
+	}
+	newcomer := testPlayers(5)[4]
+	if err := c.handleJoinQueue(JoinQueue{Player: newcomer}); err != nil {
+		t.Fatalf("join: %v", err)
+	}
+	var started *MatchAcceptStarted
+	for _, e := range drain(events) {
+		if e, ok := e.(MatchAcceptStarted); ok {
+			started = &e
+		}
+	}
+	if started == nil || indexOfPlayer(started.Players, newcomer.SteamID) < 0 {
+		t.Errorf("no match popped with the changed roster")
+	}
+}
+
+func TestVoteCancelHoldExpires(t *testing.T) {
+	maxPlayers := MaxPlayers
+	MaxPlayers = 4
+	t.Cleanup(func() { MaxPlayers = maxPlayers })
+
+	c, match := newDraftingMatch(t, 4)
+	for _, p := range match.Players {
+		if err := c.handleVoteCancel(VoteCancel{PlayerID: p.SteamID, MatchID: match.ID}); err != nil {
+			break
+		}
+	}
+	events := c.Subscribe()
+
+	hold := c.voteHolds[DefaultQueueID]
+	hold.Expires = time.Now().Add(-time.Second)
+	c.voteHolds[DefaultQueueID] = hold
+	c.handleCommand(VoteCancelHoldExpired{QueueID: DefaultQueueID})
+
+	popped := false
+	for _, e := range drain(events) {
+		if _, ok := e.(MatchAcceptStarted); ok {
+			popped = true
+		}
+	}
+	if !popped {
+		t.Error("no match popped after the hold expired")
+	}
+}
+
+// TestRedraftVotesNotShared has a subscriber read the votes of the first
+// redraft request while the second captain votes. Run with -race.
+func TestRedraftVotesNotShared(t *testing.T) {
+	c, match := newDraftingMatch(t, 4)
+	captains := match.Captains
+	events := c.Subscribe()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		c.Run(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	read := make(chan int)
+	go func() {
+		for e := range events {
+			if e, ok := e.(RedraftRequested); ok {
+				votes := 0
+				for range e.Votes {
+					votes++
+				}
+				read <- votes
+				return
+			}
+		}
+	}()
+
+	for _, captain := range captains {
+		resp := make(chan error, 1)
+		c.Send(RequestRedraft{CaptainID: captain.SteamID, MatchID: match.ID, Response: resp})
+		if err := <-resp; err != nil {
+			t.Fatalf("redraft request: %v", err)
+		}
+	}
+	if votes := <-read; votes != 1 {
+		t.Errorf("first RedraftRequested had %d votes, want 1", votes)
+	}
+}
+
+func TestBotGameStartedAfterRelaunch(t *testing.T) {
+	c, match := newDraftingMatch(t, 2)
+	events := c.Subscribe()
+
+	c.handleCommand(BotGameStarted{MatchID: match.ID, DotaMatchID: 1})
+	c.handleCommand(BotGameStarted{MatchID: match.ID, DotaMatchID: 2})
+
+	started := 0
+	for _, e := range drain(events) {
+		if _, ok := e.(MatchStarted); ok {
+			started++
+		}
+	}
+	if started != 1 {
+		t.Errorf("emitted %d MatchStarted events, want 1", started)
+	}
+	if match.State != MatchStateInProgress || match.DotaMatchID != 2 {
+		t.Errorf("match state %v, Dota match ID %d; want in progress with the relaunched ID 2", match.State, match.DotaMatchID)
+	}
+}
+
+func TestRejoinQueueFull(t *testing.T) {
+	maxQueueSize := MaxQueueSize
+	MaxQueueSize = 2
+	t.Cleanup(func() { MaxQueueSize = maxQueueSize })
+
+	c := New()
+	players := testPlayers(3)
+	c.state.Queues[DefaultQueueID] = players[1:]
+	c.rejoinGrace[players[0].SteamID] = rejoinSlot{Player: players[0], Expires: time.Now().Add(time.Minute)}
+
+	err := c.handleRejoinQueue(RejoinQueue{PlayerID: players[0].SteamID})
+	if !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("rejoin into a full queue: err = %v, want ErrQueueFull", err)
+	}
+	if _, ok := c.rejoinGrace[players[0].SteamID]; !ok {
+		t.Fatalf("failed rejoin gave up the reserved slot")
+	}
+
+	c.state.RemoveFromQueue(players[2].SteamID)
+	if err := c.handleRejoinQueue(RejoinQueue{PlayerID: players[0].SteamID}); err != nil {
+		t.Fatalf("rejoin after a slot freed up: %v", err)
+	}
+	if queue := c.state.Queues[DefaultQueueID]; len(queue) != 2 || queue[0].SteamID != players[0].SteamID {
+		t.Errorf("rejoined player isn't back at the front of the queue")
+	}
+	if _, ok := c.rejoinGrace[players[0].SteamID]; ok {
+		t.Errorf("reserved slot kept after rejoining")
+	}
+}
@@ -6,12 +6,34 @@ type Event interface {
 	event() // marker method
 }
 
+// QueueUpdated carries every queue whenever any of them changes.
 type QueueUpdated struct {
-	Queue []Player
+	Queues  []Queue // Set by the coordinator when emitted
+	Version int     // Set by the coordinator when emitted
+	Paused  bool    // Set by the coordinator when emitted
 }
 
 func (QueueUpdated) event() {}
 
+// PlayerAway is emitted when a player is removed from the queue for missing
+// heartbeats, or for queueing longer than MaxQueueTime.
+type PlayerAway struct {
+	PlayerID  string
+	QueueTime bool // Removed for MaxQueueTime rather than missing heartbeats
+}
+
+func (PlayerAway) event() {}
+
+// QueueAlmostFull is emitted when a queue is one player short of a match,
+// so the players in it can get ready to accept.
+type QueueAlmostFull struct {
+	QueueID   string
+	QueueName string
+	Players   []Player // Everyone in the queue
+}
+
+func (QueueAlmostFull) event() {}
+
 type MatchAcceptStarted struct {
 	MatchID  string
 	Players  []Player
@@ -28,12 +50,14 @@ type MatchAcceptUpdated struct {
 func (MatchAcceptUpdated) event() {}
 
 type DraftStarted struct {
-	MatchID   string
-	Captains  [2]Player
-	Radiant   []Player
-	Dire      []Player
-	Available []Player
-	Deadline  time.Time
+	MatchID    string
+	Captains   [2]Player
+	Radiant    []Player
+	Dire       []Player
+	Available  []Player
+	Deadline   time.Time
+	BankTime   [2]time.Duration // Reserve pick time per captain
+	TeamLabels [2]string
 }
 
 func (DraftStarted) event() {}
@@ -46,56 +70,185 @@ type DraftUpdated struct {
 	Dire             []Player
 	CurrentPicker    int
 	Deadline         time.Time
+	Picks            []PickRecord
+	BankTime         [2]time.Duration // Reserve pick time left per captain
+	UsingBank        bool             // The current picker is past the pick timeout, on bank time
+	TeamLabels       [2]string
 }
 
 func (DraftUpdated) event() {}
 
 type PlayerFailedAccept struct {
 	PlayerID string
+	Declined bool // Declined explicitly rather than timing out
 }
 
 func (PlayerFailedAccept) event() {}
 
 type MatchCancelled struct {
-	MatchID       string
-	FailedPlayers []Player
+	MatchID         string
+	FailedPlayers   []Player
+	Players         []Player
+	AcceptedPlayers map[string]bool
+	Voted           bool     // Cancelled by player vote rather than an accept timeout
+	DeclinedPlayers []Player // Subset of FailedPlayers who explicitly declined
+	Requeued        []Player // Subset of FailedPlayers sent to the back of the queue
 }
 
 func (MatchCancelled) event() {}
 
+// MatchBackfilled is emitted when players who didn't accept a match are
+// replaced from the queue, just before the draft starts.
+type MatchBackfilled struct {
+	MatchID  string
+	Removed  []Player // Players who didn't accept
+	Added    []Player // Players taken from the queue
+	Declined []Player // Subset of Removed who explicitly declined
+	Requeued []Player // Subset of Removed sent to the back of the queue
+}
+
+func (MatchBackfilled) event() {}
+
+// VoteCancelUpdated is emitted when a player votes to cancel their match.
+type VoteCancelUpdated struct {
+	MatchID string
+	Players []Player
+	Votes   map[string]bool
+	Needed  int
+}
+
+func (VoteCancelUpdated) event() {}
+
+// RedraftRequested is emitted when one captain asks to restart the draft and
+// the other has yet to agree.
+type RedraftRequested struct {
+	MatchID  string
+	Captains [2]Player
+	Votes    map[string]bool
+}
+
+func (RedraftRequested) event() {}
+
+// ChatMessageSent is emitted for each chat message, for delivery to the
+// match's players.
+type ChatMessageSent struct {
+	MatchID string
+	Players []Player
+	Message ChatMessage
+}
+
+func (ChatMessageSent) event() {}
+
 type RequestBotLobby struct {
+	MatchID        string
+	LobbyName      string
+	Players        []Player
+	Radiant        []Player
+	Dire           []Player
+	GameMode       string // "cm", "ap", "cd", "rd", "ar"
+	ServerRegion   string // Key of ValidServerRegions; "" means unset
+	KickStrangers  bool
+	Tournament     bool
+	SpectatorDelay int           // Seconds
+	BannedHeroes   []int         // Hero IDs
+	JoinTimeout    time.Duration // How long players have to join before the lobby is abandoned
+	JoinWarning    time.Duration // How long before the join timeout missing players are warned; 0 disables
+	Deadline       time.Time
+	Manual         bool // No bot is running; an admin creates the lobby
+}
+
+func (RequestBotLobby) event() {}
+
+// LobbyReady is emitted when the bot has created the lobby and invited the
+// players. The name and password let players join manually.
+type LobbyReady struct {
+	MatchID   string
+	Players   []Player
+	LobbyName string
+	Password  string
+	Deadline  time.Time
+}
+
+func (LobbyReady) event() {}
+
+// LobbyJoinProgress is emitted while waiting for players to join the bot
+// lobby, so they can see who is still missing.
+type LobbyJoinProgress struct {
+	MatchID string
+	Players []Player
+	Joined  []Player // On their assigned team
+	Missing []Player // Not in the lobby or on the wrong team
+}
+
+func (LobbyJoinProgress) event() {}
+
+// LobbyJoinWarning is emitted shortly before the lobby join timeout, to
+// hurry the players who still haven't joined.
+type LobbyJoinWarning struct {
 	MatchID  string
-	Players  []Player
-	Radiant  []Player
-	Dire     []Player
-	GameMode string // "cm", "ap", "cd", "rd", "ar"
+	Missing  []Player
 	Deadline time.Time
 }
 
-func (RequestBotLobby) event() {}
+func (LobbyJoinWarning) event() {}
+
+// TeamsUpdated is emitted when teams change after the lobby was requested,
+// so the bot hosting the lobby can update its expected teams.
+type TeamsUpdated struct {
+	MatchID string
+	Radiant []Player
+	Dire    []Player
+}
+
+func (TeamsUpdated) event() {}
 
 type MatchStarted struct {
-	MatchID     string
-	DotaMatchID uint64
-	Players     []Player
-	Radiant     []Player
-	Dire        []Player
-	Captains    [2]Player
+	MatchID         string
+	DotaMatchID     uint64
+	Players         []Player
+	Radiant         []Player
+	Dire            []Player
+	Captains        [2]Player
+	AcceptedPlayers map[string]bool
+	GameMode        string
+	Picks           []PickRecord
 }
 
 func (MatchStarted) event() {}
 
+// MatchProgress carries the latest live status of a running game.
+type MatchProgress struct {
+	MatchID  string
+	Progress GameProgress
+}
+
+func (MatchProgress) event() {}
+
 type MatchCompleted struct {
-	MatchID     string
-	DotaMatchID uint64
-	Players     []Player
-	Radiant     []Player
-	Dire        []Player
-	Winner      *string // "radiant", "dire", or nil if unknown
+	MatchID         string
+	QueueID         string
+	DotaMatchID     uint64
+	Players         []Player
+	Radiant         []Player
+	Dire            []Player
+	Winner          *string // "radiant", "dire", or nil if unknown
+	AcceptedPlayers map[string]bool
+	GameMode        string
+	TeamLabels      [2]string // Display names of Radiant and Dire
 }
 
 func (MatchCompleted) event() {}
 
+// DraftPickWarning tells the captain whose turn it is that their pick time
+// is nearly up.
+type DraftPickWarning struct {
+	MatchID  string
+	Captain  Player
+	Deadline time.Time
+}
+
+func (DraftPickWarning) event() {}
+
 type DraftCancelled struct {
 	MatchID         string
 	FailedCaptain   Player
@@ -112,6 +265,16 @@ type LobbyCancelled struct {
 
 func (LobbyCancelled) event() {}
 
+// QueueRejoinAvailable tells a player who failed to join a lobby that they
+// can rejoin the queue at their old position until Deadline.
+type QueueRejoinAvailable struct {
+	MatchID  string
+	PlayerID string
+	Deadline time.Time
+}
+
+func (QueueRejoinAvailable) event() {}
+
 type MatchCancelledByAdmin struct {
 	MatchID         string
 	ReturnedToQueue bool
@@ -119,3 +282,10 @@ type MatchCancelledByAdmin struct {
 }
 
 func (MatchCancelledByAdmin) event() {}
+
+// LobbySettingsUpdated is emitted when an admin changes the lobby settings.
+type LobbySettingsUpdated struct {
+	Settings LobbySettings
+}
+
+func (LobbySettingsUpdated) event() {}
@@ -0,0 +1,184 @@
+package coordinator
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DefaultQueueID is the queue players join when they don't pick one. It
+// always exists, so setups with a single queue never need to name it.
+const DefaultQueueID = "default"
+
+// DefaultQueueName is the display name of the default queue.
+const DefaultQueueName = "Main"
+
+// ErrUnknownQueue is returned when joining a queue that doesn't exist.
+var ErrUnknownQueue = errors.New("unknown queue")
+
+// QueueConfig describes one of the queues players can pick from, such as a
+// region or an unranked pool. Each queue fills and pops matches on its own.
+type QueueConfig struct {
+	ID         string
+	Name       string
+	MaxPlayers int // Players per match; passes ValidateMaxPlayers
+
+	// GameMode and ServerRegion override the lobby settings for the queue's
+	// matches, e.g. for a Captain's Mode or a regional queue. "" keeps the
+	// admin's setting.
+	GameMode     string
+	ServerRegion string
+}
+
+// lobbySettings returns settings with the queue's overrides applied.
+func (q QueueConfig) lobbySettings(settings LobbySettings) LobbySettings {
+	if q.GameMode != "" {
+		settings.GameMode = q.GameMode
+	}
+	if q.ServerRegion != "" {
+		settings.ServerRegion = q.ServerRegion
+	}
+	return settings
+}
+
+// Queue is a snapshot of one queue and the players waiting in it, in order.
+type Queue struct {
+	QueueConfig
+	Players []Player
+}
+
+// ExtraQueues are the queues offered alongside the default one. Can be set
+// via QUEUES env var, see ParseQueueConfigs.
+var ExtraQueues []QueueConfig
+
+// QueueConfigs returns every queue, the default one first. The default queue
+// uses MaxPlayers.
+func QueueConfigs() []QueueConfig {
+	queues := []QueueConfig{{ID: DefaultQueueID, Name: DefaultQueueName, MaxPlayers: MaxPlayers}}
+	return append(queues, ExtraQueues...)
+}
+
+// queueConfig looks up a queue by ID.
+func queueConfig(id string) (QueueConfig, bool) {
+	for _, q := range QueueConfigs() {
+		if q.ID == id {
+			return q, true
+		}
+	}
+	return QueueConfig{}, false
+}
+
+// queueOf returns the queue a player or match with the given queue ID goes
+// back to. Empty IDs, from before queues were named, and queues that have
+// since been removed map to the default queue.
+func queueOf(id string) string {
+	if _, ok := queueConfig(id); ok {
+		return id
+	}
+	return DefaultQueueID
+}
+
+var queueIDPattern = regexp.MustCompile(`^[a-z0-9-]+$`)
+
+// ParseQueueConfigs parses a comma-separated list of extra queues, each
+// written "id:Name[:maxPlayers[:gameMode[:serverRegion]]]", e.g.
+// "eu:Europe::ap:euwest,cm:Captains:6:cm". Queues without a size use
+// MaxPlayers, so set that first.
+func ParseQueueConfigs(s string) ([]QueueConfig, error) {
+	var queues []QueueConfig
+	seen := map[string]bool{DefaultQueueID: true}
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.Split(entry, ":")
+		if len(parts) < 2 || len(parts) > 5 {
+			return nil, fmt.Errorf("queue %q must be written id:Name[:maxPlayers[:gameMode[:serverRegion]]]", entry)
+		}
+		for len(parts) < 5 {
+			parts = append(parts, "")
+		}
+
+		q := QueueConfig{
+			ID:           strings.TrimSpace(parts[0]),
+			Name:         strings.TrimSpace(parts[1]),
+			MaxPlayers:   MaxPlayers,
+			GameMode:     strings.TrimSpace(parts[3]),
+			ServerRegion: strings.TrimSpace(parts[4]),
+		}
+		if !queueIDPattern.MatchString(q.ID) {
+			return nil, fmt.Errorf("queue ID %q may only contain lowercase letters, digits and dashes", q.ID)
+		}
+		if seen[q.ID] {
+			return nil, fmt.Errorf("queue ID %q is used more than once", q.ID)
+		}
+		seen[q.ID] = true
+		if q.Name == "" {
+			return nil, fmt.Errorf("queue %q needs a name", q.ID)
+		}
+		if size := strings.TrimSpace(parts[2]); size != "" {
+			n, err := strconv.Atoi(size)
+			if err != nil {
+				return nil, fmt.Errorf("queue %q: max players must be an integer", q.ID)
+			}
+			q.MaxPlayers = n
+		}
+		if err := ValidateMaxPlayers(q.MaxPlayers); err != nil {
+			return nil, fmt.Errorf("queue %q: %w", q.ID, err)
+		}
+		if _, ok := ValidGameModes[q.GameMode]; q.GameMode != "" && !ok {
+			return nil, fmt.Errorf("queue %q: unknown game mode %q", q.ID, q.GameMode)
+		}
+		if _, ok := ValidServerRegions[q.ServerRegion]; q.ServerRegion != "" && !ok {
+			return nil, fmt.Errorf("queue %q: unknown server region %q", q.ID, q.ServerRegion)
+		}
+		if MaxQueueSize > 0 && q.MaxPlayers > MaxQueueSize {
+			return nil, fmt.Errorf("queue %q: max players %d is more than the max queue size %d", q.ID, q.MaxPlayers, MaxQueueSize)
+		}
+		queues = append(queues, q)
+	}
+	return queues, nil
+}
+
+// matchLobbySettings returns the lobby settings for a match, with the
+// overrides of the queue it came from.
+func (c *Coordinator) matchLobbySettings(match *Match) LobbySettings {
+	cfg, _ := queueConfig(queueOf(match.QueueID))
+	return cfg.lobbySettings(c.state.LobbySettings)
+}
+
+// queueList returns a snapshot of every queue, in QueueConfigs order.
+func (s *State) queueList() []Queue {
+	configs := QueueConfigs()
+	queues := make([]Queue, len(configs))
+	for i, q := range configs {
+		queues[i] = Queue{QueueConfig: q, Players: s.Queues[q.ID]}
+	}
+	return queues
+}
+
+// QueuedPlayers returns the players waiting in every queue, the default
+// queue first.
+func (s *State) QueuedPlayers() []Player {
+	var players []Player
+	for _, q := range QueueConfigs() {
+		players = append(players, s.Queues[q.ID]...)
+	}
+	return players
+}
+
+// PlayerQueue returns the ID of the queue a player is waiting in, or "" if
+// they aren't queued.
+func (s *State) PlayerQueue(steamID string) string {
+	for id, queue := range s.Queues {
+		for _, p := range queue {
+			if p.SteamID == steamID {
+				return id
+			}
+		}
+	}
+	return ""
+}
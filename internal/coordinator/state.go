@@ -1,12 +1,32 @@
 package coordinator
 
-import "time"
+import (
+	"slices"
+	"time"
+)
 
 type Player struct {
 	SteamID         string `json:"steamId"`
 	Name            string `json:"name"`
 	AvatarURL       string `json:"avatarUrl"`
 	CaptainPriority int    `json:"captainPriority"`
+	Rating          int    `json:"rating,omitempty"` // Elo, used to balance teams; 0 if unknown
+
+	// LastCaptainedAt is when the player last captained a started match.
+	LastCaptainedAt *time.Time `json:"lastCaptainedAt,omitempty"`
+
+	// QueuedAt is when the player joined the queue. Players returned to the
+	// queue by a cancelled match keep their original time.
+	QueuedAt time.Time `json:"queuedAt,omitempty"`
+
+	// PreferredRoles (positions 1-5) and PreferredHeroes are shown to
+	// captains during the draft. They are informational only.
+	PreferredRoles  []int `json:"preferredRoles,omitempty"`
+	PreferredHeroes []int `json:"preferredHeroes,omitempty"`
+
+	// QueueID is the queue the player joined. Players returned to the queue
+	// by a cancelled match go back to it.
+	QueueID string `json:"queueId,omitempty"`
 }
 
 type MatchState int
@@ -34,32 +54,246 @@ func (s MatchState) String() string {
 }
 
 type Match struct {
-	ID               string
-	State            MatchState
-	Players          []Player        // All 10 players in this match
-	AcceptedPlayers  map[string]bool // SteamID -> accepted
-	AcceptDeadline   time.Time
-	PickDeadline     time.Time
-	LobbyDeadline    time.Time
-	Captains         [2]Player
-	Radiant          []Player
-	Dire             []Player
-	AvailablePlayers []Player // Players not yet drafted
-	CurrentPicker    int      // 0 = radiant captain, 1 = dire captain
-	PickCount        int      // Number of picks made (used for timeout validation)
-	DotaMatchID      uint64
+	ID               string           `json:"id"`
+	QueueID          string           `json:"queueId,omitempty"` // Queue the players were taken from
+	State            MatchState       `json:"state"`
+	Players          []Player         `json:"players"`                   // All 10 players in this match
+	AcceptedPlayers  map[string]bool  `json:"acceptedPlayers"`           // SteamID -> accepted
+	DeclinedPlayers  map[string]bool  `json:"declinedPlayers,omitempty"` // SteamID -> explicitly declined
+	AcceptDeadline   time.Time        `json:"acceptDeadline"`
+	PickDeadline     time.Time        `json:"pickDeadline"`
+	LobbyDeadline    time.Time        `json:"lobbyDeadline"`
+	Captains         [2]Player        `json:"captains"`
+	Radiant          []Player         `json:"radiant"`
+	Dire             []Player         `json:"dire"`
+	AvailablePlayers []Player         `json:"availablePlayers"` // Players not yet drafted
+	CurrentPicker    int              `json:"currentPicker"`    // 0 = radiant captain, 1 = dire captain
+	PickCount        int              `json:"pickCount"`        // Number of picks made (used for timeout validation)
+	DotaMatchID      uint64           `json:"dotaMatchId"`
+	GameMode         string           `json:"gameMode"`                // Set when the lobby is requested
+	CancelVotes      map[string]bool  `json:"cancelVotes,omitempty"`   // SteamID -> voted to cancel
+	TimeoutGen       int              `json:"timeoutGen"`              // Incremented for each phase timer; older timers are stale
+	Picks            []PickRecord     `json:"picks,omitempty"`         // Draft picks in order
+	LobbyName        string           `json:"lobbyName,omitempty"`     // Set when the lobby is requested
+	LobbyPassword    string           `json:"lobbyPassword,omitempty"` // Cleared when the game starts
+	LobbyJoined      []string         `json:"lobbyJoined,omitempty"`   // SteamIDs on their team in the bot lobby
+	TeamLabels       [2]string        `json:"teamLabels"`              // Radiant and Dire display names when the match was made
+	Chat             []ChatMessage    `json:"chat,omitempty"`          // Most recent MaxChatHistory messages
+	Progress         *GameProgress    `json:"progress,omitempty"`      // Latest bot report while in game
+	RedraftVotes     map[string]bool  `json:"redraftVotes,omitempty"`  // Captain SteamID -> asked to redraft
+	Redrafted        bool             `json:"redrafted,omitempty"`     // Only one redraft is allowed per match
+	ManualLobby      bool             `json:"manualLobby,omitempty"`   // An admin hosts the lobby instead of a bot
+	BankTime         [2]time.Duration `json:"bankTime"`                // Reserve pick time left per captain, by CurrentPicker
+	BankStartedAt    time.Time        `json:"bankStartedAt,omitempty"` // When the current picker started using their bank; zero if not
+}
+
+// GameProgress is the live status of a running game as last reported by its
+// bot. The lobby doesn't carry kill scores, so only the game clock, phase and
+// spectator count are known.
+type GameProgress struct {
+	GameTime   time.Duration `json:"gameTime"`
+	Phase      string        `json:"phase"` // e.g. "Hero selection", "In progress"
+	Spectators int           `json:"spectators"`
+}
+
+// ChatMessage is a message sent to the other players of a match.
+type ChatMessage struct {
+	SenderID   string    `json:"senderId"`
+	SenderName string    `json:"senderName"`
+	Text       string    `json:"text"`
+	SentAt     time.Time `json:"sentAt"`
+}
+
+// PickRecord is a single draft pick. Team is 0 for Radiant and 1 for Dire,
+// matching CurrentPicker. The auto-assigned last player is recorded as a
+// pick by the captain whose turn it was.
+type PickRecord struct {
+	CaptainID  string    `json:"captainId"`
+	PickedID   string    `json:"pickedId"`
+	Team       int       `json:"team"`
+	PickNumber int       `json:"pickNumber"` // 1-based
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// TeamSize returns the number of players on each of the match's teams. It
+// can differ from TeamSize for matches from other queues or force-started
+// with fewer players.
+func (m *Match) TeamSize() int {
+	return len(m.Players) / 2
+}
+
+// recordPick appends a pick by the current picker to the match history.
+// Call it before PickCount is incremented for the pick.
+func (m *Match) recordPick(pickedID string) {
+	m.Picks = append(m.Picks, PickRecord{
+		CaptainID:  m.Captains[m.CurrentPicker].SteamID,
+		PickedID:   pickedID,
+		Team:       m.CurrentPicker,
+		PickNumber: m.PickCount + 1,
+		Timestamp:  time.Now(),
+	})
+}
+
+// dropPicks removes the picks of players who have been moved off the team
+// that picked them. The remaining picks keep their numbers.
+func (m *Match) dropPicks(steamIDs ...string) {
+	picks := make([]PickRecord, 0, len(m.Picks))
+	for _, pick := range m.Picks {
+		if !slices.Contains(steamIDs, pick.PickedID) {
+			picks = append(picks, pick)
+		}
+	}
+	m.Picks = picks
+}
+
+// nextTimeoutGen starts a new timeout generation, making any pending
+// timers for this match stale.
+func (m *Match) nextTimeoutGen() int {
+	m.TimeoutGen++
+	return m.TimeoutGen
 }
 
 type LobbySettings struct {
-	GameMode string `json:"gameMode"` // "cm", "ap", "cd", "rd", "ar"
+	GameMode      string `json:"gameMode"`      // "cm", "ap", "cd", "rd", "ar"
+	ServerRegion  string `json:"serverRegion"`  // Key of ValidServerRegions; "" lets Dota pick
+	KickStrangers bool   `json:"kickStrangers"` // Kick players who aren't in the match off the teams
+
+	// Tournament lobbies have a broadcast delay for spectators; other
+	// lobbies use the shortest delay.
+	Tournament     bool `json:"tournament"`
+	SpectatorDelay int  `json:"spectatorDelay"` // Seconds; one of ValidSpectatorDelays
+
+	// Phase timeouts in seconds, each limited to its TimeoutLimits range.
+	AcceptTimeout    int `json:"acceptTimeout"`
+	DraftPickTimeout int `json:"draftPickTimeout"`
+	LobbyJoinTimeout int `json:"lobbyJoinTimeout"`
+
+	// DraftBankTime is reserve time in seconds each captain gets per draft,
+	// used up by picks that run past the draft pick timeout.
+	DraftBankTime int `json:"draftBankTime"`
+
+	// CaptainDecay lowers the effective priority of recent captains so the
+	// role rotates; off by default. MinCaptainPriority (1-10) is the floor
+	// effective priority never drops below, letting low-priority players
+	// captain occasionally.
+	CaptainDecay       bool `json:"captainDecay"`
+	MinCaptainPriority int  `json:"minCaptainPriority"`
+
+	// CaptainSelectionMode is a key of ValidCaptainSelectionModes. Empty
+	// means CaptainModePriority.
+	CaptainSelectionMode string `json:"captainSelectionMode,omitempty"`
+
+	// RequeueTimedOut sends players who let the accept timer run out to the
+	// back of the queue instead of removing them. Players who explicitly
+	// decline are always removed.
+	RequeueTimedOut bool `json:"requeueTimedOut"`
+
+	// MinAcceptPercent is the share of players (50-100) who must accept for
+	// a match to go ahead. When the accept phase ends, players who didn't
+	// accept are replaced from the front of the queue. 0 means 100.
+	MinAcceptPercent int `json:"minAcceptPercent,omitempty"`
+
+	// AutoBalance skips the captain draft and splits players into teams of
+	// equal Elo instead.
+	AutoBalance bool `json:"autoBalance"`
+
+	// LobbyNameTemplate names Dota lobbies. It may use the placeholders
+	// {community}, {n} (the day's match number), {date} and {id} (the
+	// start of the match ID). Empty means DefaultLobbyNameTemplate.
+	LobbyNameTemplate string `json:"lobbyNameTemplate,omitempty"`
+	CommunityName     string `json:"communityName,omitempty"`
+
+	// BannedHeroes are hero IDs that can't be picked in the lobby.
+	BannedHeroes []int `json:"bannedHeroes,omitempty"`
+
+	// RadiantLabel and DireLabel rename the teams on the site, e.g. after
+	// sponsors. Players still join the Radiant and Dire sides in Dota.
+	// Empty means DefaultTeamLabels.
+	RadiantLabel string `json:"radiantLabel,omitempty"`
+	DireLabel    string `json:"direLabel,omitempty"`
 }
 
+// DefaultTeamLabels are the team names shown when no labels are set.
+var DefaultTeamLabels = [2]string{"Radiant", "Dire"}
+
+// MaxTeamLabelLen is the longest team label admins may set.
+const MaxTeamLabelLen = 20
+
+// TeamLabels returns the display names of Radiant and Dire, in that order.
+func (s LobbySettings) TeamLabels() [2]string {
+	labels := DefaultTeamLabels
+	if s.RadiantLabel != "" {
+		labels[0] = s.RadiantLabel
+	}
+	if s.DireLabel != "" {
+		labels[1] = s.DireLabel
+	}
+	return labels
+}
+
+// DefaultLobbyNameTemplate is used when no lobby name template is set.
+const DefaultLobbyNameTemplate = "Inhouse Match {id}"
+
+// MaxLobbyNameLen is the longest lobby name template admins may set.
+const MaxLobbyNameLen = 60
+
 func DefaultLobbySettings() LobbySettings {
 	return LobbySettings{
-		GameMode: "cd",
+		GameMode:             "cd",
+		KickStrangers:        true,
+		SpectatorDelay:       120,
+		AcceptTimeout:        int(MatchAcceptTimeoutDur / time.Second),
+		DraftPickTimeout:     int(DraftPickTimeoutDur / time.Second),
+		LobbyJoinTimeout:     int(LobbyJoinTimeoutDur / time.Second),
+		DraftBankTime:        30,
+		MinCaptainPriority:   1,
+		CaptainSelectionMode: CaptainModePriority,
+	}
+}
+
+// TimeoutLimit is the allowed range, in seconds, for a configurable timeout.
+type TimeoutLimit struct {
+	Min, Max int
+}
+
+var (
+	AcceptTimeoutLimit    = TimeoutLimit{Min: 10, Max: 300}
+	DraftPickTimeoutLimit = TimeoutLimit{Min: 10, Max: 600}
+	LobbyJoinTimeoutLimit = TimeoutLimit{Min: 60, Max: 1800}
+	DraftBankTimeLimit    = TimeoutLimit{Min: 0, Max: 300}
+)
+
+func (l TimeoutLimit) contains(seconds int) bool {
+	return seconds >= l.Min && seconds <= l.Max
+}
+
+// minAccepts returns how many of a match's players must accept it.
+func (s LobbySettings) minAccepts(players int) int {
+	if s.MinAcceptPercent <= 0 || s.MinAcceptPercent >= 100 {
+		return players
 	}
+	return (players*s.MinAcceptPercent + 99) / 100
 }
 
+func (s LobbySettings) acceptTimeout() time.Duration {
+	return time.Duration(s.AcceptTimeout) * time.Second
+}
+
+func (s LobbySettings) draftPickTimeout() time.Duration {
+	return time.Duration(s.DraftPickTimeout) * time.Second
+}
+
+func (s LobbySettings) draftBankTime() time.Duration {
+	return time.Duration(s.DraftBankTime) * time.Second
+}
+
+func (s LobbySettings) lobbyJoinTimeout() time.Duration {
+	return time.Duration(s.LobbyJoinTimeout) * time.Second
+}
+
+// ValidSpectatorDelays are the broadcast delays (in seconds) Dota supports.
+var ValidSpectatorDelays = []int{10, 120, 300, 900}
+
 var ValidGameModes = map[string]string{
 	"ap": "All Pick",
 	"cm": "Captain's Mode",
@@ -68,27 +302,75 @@ var ValidGameModes = map[string]string{
 	"ar": "All Random",
 }
 
+// Captain selection modes.
+const (
+	CaptainModePriority    = "priority"     // Weighted random by captain priority
+	CaptainModeLongestWait = "longest_wait" // The two players who queued first
+	CaptainModeRandom      = "random"       // Uniformly random
+)
+
+var ValidCaptainSelectionModes = map[string]string{
+	CaptainModePriority:    "By captain priority",
+	CaptainModeLongestWait: "Longest in queue",
+	CaptainModeRandom:      "Random",
+}
+
+var ValidServerRegions = map[string]string{
+	"uswest":      "US West",
+	"useast":      "US East",
+	"euwest":      "Europe West",
+	"eueast":      "Europe East",
+	"stockholm":   "Stockholm",
+	"russia":      "Russia",
+	"seasia":      "SE Asia",
+	"japan":       "Japan",
+	"india":       "India",
+	"dubai":       "Dubai",
+	"australia":   "Australia",
+	"southafrica": "South Africa",
+	"brazil":      "Brazil",
+	"chile":       "Chile",
+	"peru":        "Peru",
+	"argentina":   "Argentina",
+}
+
+// ServerRegionIDs maps ValidServerRegions keys to Dota server region IDs.
+var ServerRegionIDs = map[string]uint32{
+	"uswest":      1,
+	"useast":      2,
+	"euwest":      3,
+	"seasia":      5,
+	"dubai":       6,
+	"australia":   7,
+	"stockholm":   8,
+	"eueast":      9,
+	"brazil":      10,
+	"southafrica": 11,
+	"chile":       14,
+	"peru":        15,
+	"india":       16,
+	"japan":       19,
+	"argentina":   38,
+	"russia":      40,
+}
+
 type State struct {
-	Queue         []Player          // Players waiting for a match
-	Matches       map[string]*Match // Active matches keyed by match ID
-	LobbySettings LobbySettings     // Configurable lobby settings
+	Queues        map[string][]Player // Players waiting for a match, by queue ID
+	Matches       map[string]*Match   // Active matches keyed by match ID
+	LobbySettings LobbySettings       // Configurable lobby settings
+	Paused        bool                // No new matches start while set; not persisted
 }
 
 func NewState() *State {
 	return &State{
-		Queue:         []Player{},
+		Queues:        make(map[string][]Player),
 		Matches:       make(map[string]*Match),
 		LobbySettings: DefaultLobbySettings(),
 	}
 }
 
 func (s *State) IsPlayerInQueue(steamID string) bool {
-	for _, p := range s.Queue {
-		if p.SteamID == steamID {
-			return true
-		}
-	}
-	return false
+	return s.PlayerQueue(steamID) != ""
 }
 
 func (s *State) IsPlayerInMatch(steamID string) bool {
@@ -111,11 +393,32 @@ func (s *State) GetMatch(matchID string) *Match {
 }
 
 func (s *State) RemoveFromQueue(steamID string) bool {
-	for i, p := range s.Queue {
-		if p.SteamID == steamID {
-			s.Queue = append(s.Queue[:i], s.Queue[i+1:]...)
-			return true
+	for id, queue := range s.Queues {
+		for i, p := range queue {
+			if p.SteamID == steamID {
+				s.Queues[id] = append(queue[:i], queue[i+1:]...)
+				return true
+			}
 		}
 	}
 	return false
 }
+
+// LobbyJoinStatus splits a match's players into those the bot last saw on
+// their assigned lobby team and everyone else, Radiant first.
+func LobbyJoinStatus(m *Match) (joined, missing []Player) {
+	inLobby := make(map[string]bool, len(m.LobbyJoined))
+	for _, id := range m.LobbyJoined {
+		inLobby[id] = true
+	}
+	for _, team := range [][]Player{m.Radiant, m.Dire} {
+		for _, p := range team {
+			if inLobby[p.SteamID] {
+				joined = append(joined, p)
+			} else {
+				missing = append(missing, p)
+			}
+		}
+	}
+	return joined, missing
+}
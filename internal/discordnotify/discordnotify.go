@@ -0,0 +1,280 @@
+// Package discordnotify posts match results to a Discord channel through a
+// Discord webhook, as an embed with both team rosters and the winner.
+package discordnotify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/edvart/dota-inhouse/internal/coordinator"
+)
+
+const (
+	requestTimeout = 5 * time.Second
+	maxAttempts    = 3
+	initialBackoff = 1 * time.Second
+	maxRetryAfter  = time.Minute // Longer rate limit waits give up instead
+	queueSize      = 100
+
+	colorRadiant = 0x92A525
+	colorDire    = 0xC23C2A
+	colorUnknown = 0x808080
+)
+
+// Embed is a Discord message embed.
+type Embed struct {
+	Title     string       `json:"title"`
+	URL       string       `json:"url,omitempty"`
+	Color     int          `json:"color"`
+	Fields    []EmbedField `json:"fields"`
+	Footer    *EmbedFooter `json:"footer,omitempty"`
+	Timestamp string       `json:"timestamp"`
+}
+
+type EmbedField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+type EmbedFooter struct {
+	Text string `json:"text"`
+}
+
+// Message is the JSON body POSTed to the Discord webhook.
+type Message struct {
+	Embeds []Embed `json:"embeds"`
+}
+
+// Notifier listens to coordinator events and posts completed matches to a
+// Discord webhook.
+type Notifier struct {
+	url        string
+	httpClient *http.Client
+	queue      chan Message
+	startedAt  map[string]time.Time // Match ID -> game start, for the duration
+}
+
+func New(url string) *Notifier {
+	return &Notifier{
+		url: url,
+		httpClient: &http.Client{
+			Timeout: requestTimeout,
+		},
+		queue:     make(chan Message, queueSize),
+		startedAt: make(map[string]time.Time),
+	}
+}
+
+// Run consumes events and hands messages to a background worker so Discord
+// rate limits never block the event loop.
+func (n *Notifier) Run(ctx context.Context, events <-chan coordinator.Event) {
+	log.Println("Discord notifier started")
+	go n.worker(ctx)
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("Discord notifier shutting down")
+			return
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			n.handleEvent(event)
+		}
+	}
+}
+
+func (n *Notifier) handleEvent(event coordinator.Event) {
+	switch e := event.(type) {
+	case coordinator.MatchStarted:
+		n.startedAt[e.MatchID] = time.Now()
+	case coordinator.MatchCancelled:
+		delete(n.startedAt, e.MatchID)
+	case coordinator.MatchCompleted:
+		var duration time.Duration
+		if started, ok := n.startedAt[e.MatchID]; ok {
+			duration = time.Since(started)
+			delete(n.startedAt, e.MatchID)
+		}
+		n.enqueue(resultMessage(e, duration))
+	}
+}
+
+func (n *Notifier) enqueue(m Message) {
+	select {
+	case n.queue <- m:
+	default:
+		log.Printf("Discord notifier: queue full, dropping message")
+	}
+}
+
+func (n *Notifier) worker(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case m := <-n.queue:
+			if err := n.sendWithRetry(ctx, m); err != nil {
+				log.Printf("Discord notifier: failed to post match result: %v", err)
+			}
+		}
+	}
+}
+
+// resultMessage builds the embed for a completed match. duration is 0 when
+// the game's start wasn't seen, e.g. after a restart.
+func resultMessage(e coordinator.MatchCompleted, duration time.Duration) Message {
+	embed := Embed{
+		Title:     "Match completed",
+		Color:     colorUnknown,
+		Footer:    &EmbedFooter{Text: "Match " + e.MatchID[:min(8, len(e.MatchID))]},
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+	}
+
+	labels := e.TeamLabels
+	if labels == [2]string{} {
+		labels = coordinator.DefaultTeamLabels
+	}
+	radiantName, direName := labels[0], labels[1]
+	if e.Winner != nil {
+		switch *e.Winner {
+		case "radiant":
+			embed.Title = labels[0] + " Victory"
+			embed.Color = colorRadiant
+			radiantName = "🏆 " + labels[0]
+		case "dire":
+			embed.Title = labels[1] + " Victory"
+			embed.Color = colorDire
+			direName = "🏆 " + labels[1]
+		}
+	}
+
+	embed.Fields = []EmbedField{
+		{Name: radiantName, Value: roster(e.Radiant), Inline: true},
+		{Name: direName, Value: roster(e.Dire), Inline: true},
+	}
+	if duration > 0 {
+		embed.Fields = append(embed.Fields, EmbedField{Name: "Duration", Value: formatDuration(duration)})
+	}
+	if e.DotaMatchID != 0 {
+		embed.URL = fmt.Sprintf("https://www.dotabuff.com/matches/%d", e.DotaMatchID)
+		embed.Fields = append(embed.Fields, EmbedField{
+			Name:  "Dota 2 Match",
+			Value: fmt.Sprintf("[%d](%s)", e.DotaMatchID, embed.URL),
+		})
+	}
+
+	return Message{Embeds: []Embed{embed}}
+}
+
+// markdownEscaper stops player names from being read as Discord markdown.
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "*", `\*`, "_", `\_`, "~", `\~`, "`", "\\`", "|", `\|`, ">", `\>`,
+)
+
+func roster(players []coordinator.Player) string {
+	if len(players) == 0 {
+		return "-"
+	}
+	names := make([]string, len(players))
+	for i, p := range players {
+		names[i] = markdownEscaper.Replace(p.Name)
+	}
+	return strings.Join(names, "\n")
+}
+
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Second)
+	return fmt.Sprintf("%d:%02d", int(d.Minutes()), int(d.Seconds())%60)
+}
+
+// sendWithRetry POSTs the message, retrying with exponential backoff, or
+// after the wait Discord asks for when rate limited.
+func (n *Notifier) sendWithRetry(ctx context.Context, m Message) error {
+	body, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	backoff := initialBackoff
+	var lastErr error
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		var retryAfter time.Duration
+		retryAfter, lastErr = n.send(ctx, body)
+		if lastErr == nil {
+			return nil
+		}
+		log.Printf("Discord notifier: attempt %d/%d failed: %v", attempt, maxAttempts, lastErr)
+		if attempt == maxAttempts {
+			break
+		}
+
+		wait := backoff
+		if retryAfter > 0 {
+			if retryAfter > maxRetryAfter {
+				return lastErr
+			}
+			wait = retryAfter
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+		backoff *= 2
+	}
+	return lastErr
+}
+
+// send POSTs the body once. When rate limited it returns how long Discord
+// asked to wait before retrying.
+func (n *Notifier) send(ctx context.Context, body []byte) (time.Duration, error) {
+	reqCtx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(reqCtx, "POST", n.url, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return retryAfter(resp), fmt.Errorf("rate limited by Discord")
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return 0, fmt.Errorf("Discord returned status %d", resp.StatusCode)
+	}
+	return 0, nil
+}
+
+// retryAfter reads the wait from a 429 response: the JSON body's
+// retry_after, or else the Retry-After header, both in seconds.
+func retryAfter(resp *http.Response) time.Duration {
+	var body struct {
+		RetryAfter float64 `json:"retry_after"`
+	}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if json.Unmarshal(data, &body) == nil && body.RetryAfter > 0 {
+		return time.Duration(body.RetryAfter * float64(time.Second))
+	}
+	if secs, err := strconv.ParseFloat(resp.Header.Get("Retry-After"), 64); err == nil && secs > 0 {
+		return time.Duration(secs * float64(time.Second))
+	}
+	return initialBackoff
+}
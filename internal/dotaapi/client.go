@@ -3,19 +3,35 @@ package dotaapi
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
+	"strconv"
 	"time"
+
+	"github.com/edvart/dota-inhouse/internal/steamid"
 )
 
 const (
 	baseURL = "https://api.steampowered.com/IDOTA2Match_570/GetMatchDetails/v1"
+
+	// DefaultRateLimit is the default number of requests per second.
+	DefaultRateLimit = 1.0
+
+	// max429Retries is how many times a rate-limited request is retried
+	// after waiting for Retry-After.
+	max429Retries = 3
+
+	// defaultRetryAfter is used when a 429 has no usable Retry-After header.
+	defaultRetryAfter = 10 * time.Second
 )
 
 // Client handles Dota 2 Web API requests.
 type Client struct {
 	apiKey     string
 	httpClient *http.Client
+	limiter    *rateLimiter
 }
 
 // NewClient creates a new Dota 2 API client.
@@ -25,9 +41,16 @@ func NewClient(apiKey string) *Client {
 		httpClient: &http.Client{
 			Timeout: 30 * time.Second,
 		},
+		limiter: newRateLimiter(DefaultRateLimit, 1),
 	}
 }
 
+// SetRateLimit changes how many requests per second the client may make.
+// Must be called before the client is used.
+func (c *Client) SetRateLimit(perSecond float64) {
+	c.limiter = newRateLimiter(perSecond, 1)
+}
+
 // MatchDetails contains the relevant match information from the API.
 type MatchDetails struct {
 	MatchID       uint64 `json:"match_id"`
@@ -37,6 +60,37 @@ type MatchDetails struct {
 	GameMode      int    `json:"game_mode"`
 	RadiantScore  int    `json:"radiant_score"`
 	DireScore     int    `json:"dire_score"`
+
+	Players []PlayerDetails `json:"players"`
+}
+
+// PlayerDetails contains one player's performance in a match.
+type PlayerDetails struct {
+	AccountID  uint32 `json:"account_id"` // 32-bit Steam account ID
+	PlayerSlot int    `json:"player_slot"`
+	HeroID     int    `json:"hero_id"`
+	Kills      int    `json:"kills"`
+	Deaths     int    `json:"deaths"`
+	Assists    int    `json:"assists"`
+	GoldPerMin int    `json:"gold_per_min"`
+	XPPerMin   int    `json:"xp_per_min"`
+}
+
+// IsRadiant reports whether the player was on Radiant. Dire slots have the
+// high bit of the 8-bit slot set.
+func (p PlayerDetails) IsRadiant() bool {
+	return p.PlayerSlot < 128
+}
+
+// anonymousAccountID is reported for players who hide their match data.
+const anonymousAccountID = 4294967295
+
+// SteamID returns the player's 64-bit Steam ID, or "" if the player is anonymous.
+func (p PlayerDetails) SteamID() string {
+	if p.AccountID == 0 || p.AccountID == anonymousAccountID {
+		return ""
+	}
+	return strconv.FormatUint(steamid.To64(p.AccountID), 10)
 }
 
 // apiResponse wraps the API response.
@@ -44,27 +98,51 @@ type apiResponse struct {
 	Result MatchDetails `json:"result"`
 }
 
+// ErrMatchNotFound is returned when the API doesn't know the match yet. This
+// is normal for a minute or two after a game ends.
+var ErrMatchNotFound = errors.New("match not found")
+
+// StatusError is returned when the API responds with a non-200 status.
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("API returned status %d", e.StatusCode)
+}
+
+// IsRetryable reports whether a failed request may succeed if tried again
+// later: the match isn't available yet, the API had a server error, or the
+// request never got a response.
+func IsRetryable(err error) bool {
+	if errors.Is(err, ErrMatchNotFound) {
+		return true
+	}
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= 500
+	}
+	return err != nil && !errors.Is(err, errNoAPIKey)
+}
+
+var errNoAPIKey = errors.New("no API key configured")
+
 // GetMatchDetails fetches match details from the Dota 2 API.
 func (c *Client) GetMatchDetails(ctx context.Context, matchID uint64) (*MatchDetails, error) {
 	if c.apiKey == "" {
-		return nil, fmt.Errorf("no API key configured")
+		return nil, errNoAPIKey
 	}
 
 	url := fmt.Sprintf("%s?key=%s&match_id=%d", baseURL, c.apiKey, matchID)
 
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	resp, err := c.get(ctx, url)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch match details: %w", err)
+		return nil, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API returned status %d", resp.StatusCode)
+		return nil, &StatusError{StatusCode: resp.StatusCode}
 	}
 
 	var result apiResponse
@@ -74,12 +152,54 @@ func (c *Client) GetMatchDetails(ctx context.Context, matchID uint64) (*MatchDet
 
 	// Check if match was found (match_id will be 0 if not found)
 	if result.Result.MatchID == 0 {
-		return nil, fmt.Errorf("match not found")
+		return nil, ErrMatchNotFound
 	}
 
 	return &result.Result, nil
 }
 
+// get performs a rate-limited GET request. Responses with status 429 are
+// retried after the delay the API asks for.
+func (c *Client) get(ctx context.Context, url string) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		if err := c.limiter.Wait(ctx); err != nil {
+			return nil, err
+		}
+
+		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch match details: %w", err)
+		}
+
+		if resp.StatusCode != http.StatusTooManyRequests || attempt >= max429Retries {
+			return resp, nil
+		}
+		resp.Body.Close()
+
+		wait := parseRetryAfter(resp.Header.Get("Retry-After"))
+		log.Printf("Dota API rate limited, waiting %s", wait)
+		c.limiter.Pause(wait)
+	}
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as an HTTP date.
+func parseRetryAfter(header string) time.Duration {
+	if secs, err := strconv.Atoi(header); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(header); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return defaultRetryAfter
+}
+
 // Winner returns "radiant" or "dire" based on the match result.
 func (m *MatchDetails) Winner() string {
 	if m.RadiantWin {
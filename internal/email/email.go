@@ -0,0 +1,154 @@
+package email
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/edvart/dota-inhouse/internal/coordinator"
+	"github.com/edvart/dota-inhouse/internal/store"
+)
+
+const (
+	// sendTimeout bounds a whole SMTP conversation so a slow server can't
+	// pile up goroutines.
+	sendTimeout   = 15 * time.Second
+	lookupTimeout = 5 * time.Second
+)
+
+// Config holds the SMTP server settings.
+type Config struct {
+	Host     string
+	Port     int
+	Username string // Optional; no AUTH is attempted when empty
+	Password string
+	From     string
+	BaseURL  string // Linked from emails
+}
+
+// Notifier listens to coordinator events and emails players who opted in.
+type Notifier struct {
+	cfg   Config
+	store store.Store
+}
+
+func New(cfg Config, st store.Store) *Notifier {
+	return &Notifier{cfg: cfg, store: st}
+}
+
+// Run starts listening to coordinator events
+func (n *Notifier) Run(ctx context.Context, events <-chan coordinator.Event) {
+	log.Println("Email notifier started")
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("Email notifier stopped")
+			return
+
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			n.handleEvent(ctx, event)
+		}
+	}
+}
+
+func (n *Notifier) handleEvent(ctx context.Context, event coordinator.Event) {
+	switch e := event.(type) {
+	case coordinator.MatchAcceptStarted:
+		subject := "Match found!"
+		body := fmt.Sprintf("Your inhouse match is ready. Accept it before %s at %s",
+			e.Deadline.Format("15:04:05 MST"), n.cfg.BaseURL)
+		for _, p := range e.Players {
+			go n.notify(ctx, p.SteamID, subject, body)
+		}
+	}
+}
+
+// notify emails a user if they have email notifications enabled.
+func (n *Notifier) notify(ctx context.Context, steamID, subject, body string) {
+	lookupCtx, cancel := context.WithTimeout(ctx, lookupTimeout)
+	settings, err := n.store.GetEmailSettings(lookupCtx, steamID)
+	cancel()
+	if err != nil {
+		log.Printf("Failed to get email settings for %s: %v", steamID, err)
+		return
+	}
+	if settings == nil || !settings.Enabled || settings.Email == "" {
+		return
+	}
+
+	if err := n.send(settings.Email, subject, body); err != nil {
+		log.Printf("Failed to email %s: %v", steamID, err)
+	}
+}
+
+// send delivers one plain-text message, upgrading to TLS when the server
+// offers STARTTLS. The whole exchange shares a single deadline.
+func (n *Notifier) send(to, subject, body string) error {
+	addr := net.JoinHostPort(n.cfg.Host, strconv.Itoa(n.cfg.Port))
+	conn, err := net.DialTimeout("tcp", addr, sendTimeout)
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(sendTimeout))
+
+	c, err := smtp.NewClient(conn, n.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: n.cfg.Host}); err != nil {
+			return err
+		}
+	}
+	if n.cfg.Username != "" {
+		auth := smtp.PlainAuth("", n.cfg.Username, n.cfg.Password, n.cfg.Host)
+		if err := c.Auth(auth); err != nil {
+			return err
+		}
+	}
+
+	if err := c.Mail(n.cfg.From); err != nil {
+		return err
+	}
+	if err := c.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(buildMessage(n.cfg.From, to, subject, body)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+func buildMessage(from, to, subject, body string) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", to)
+	fmt.Fprintf(&b, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	b.WriteString("\r\n")
+	return []byte(b.String())
+}
@@ -0,0 +1,104 @@
+// Package logging wraps the standard logger with optional structured JSON
+// output. In the default text format lines look exactly like log.Printf
+// output; with LOG_FORMAT=json every line, including plain log.Printf calls
+// from packages that don't use this wrapper, becomes a JSON object with
+// level and msg fields, plus component and match_id where known.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+var jsonOutput atomic.Bool
+
+// Setup directs all logging to w, as JSON lines if format is "json" and as
+// the standard text format otherwise.
+func Setup(format string, w io.Writer) error {
+	switch format {
+	case "", "text":
+		log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
+		log.SetOutput(w)
+		jsonOutput.Store(false)
+	case "json":
+		handler := slog.NewJSONHandler(w, &slog.HandlerOptions{AddSource: true})
+		// Also routes the standard log package through the handler
+		slog.SetDefault(slog.New(handler))
+		jsonOutput.Store(true)
+	default:
+		return fmt.Errorf("unknown log format %q (must be text or json)", format)
+	}
+	return nil
+}
+
+// Logger logs for one component of the server.
+type Logger struct {
+	attrs  []slog.Attr
+	prefix string // Prepended to text lines only
+}
+
+// New returns a Logger for the named component, e.g. "coordinator".
+func New(component string) *Logger {
+	return &Logger{attrs: []slog.Attr{slog.String("component", component)}}
+}
+
+// With returns a Logger that adds key=value to every JSON line.
+func (l *Logger) With(key, value string) *Logger {
+	attrs := make([]slog.Attr, len(l.attrs), len(l.attrs)+1)
+	copy(attrs, l.attrs)
+	return &Logger{attrs: append(attrs, slog.String(key, value)), prefix: l.prefix}
+}
+
+// Named is like With but also prefixes text lines with "[value] ", the way
+// bots have always tagged their output.
+func (l *Logger) Named(key, value string) *Logger {
+	nl := l.With(key, value)
+	nl.prefix = l.prefix + "[" + value + "] "
+	return nl
+}
+
+// Match returns a Logger that tags lines with a match ID.
+func (l *Logger) Match(matchID string) *Logger {
+	return l.With("match_id", matchID)
+}
+
+// Infof logs routine events.
+func (l *Logger) Infof(format string, args ...interface{}) {
+	l.log(slog.LevelInfo, "", format, args)
+}
+
+// Warnf logs unexpected but recoverable conditions. Text lines are prefixed
+// with "Warning: " as they were before structured logging.
+func (l *Logger) Warnf(format string, args ...interface{}) {
+	l.log(slog.LevelWarn, "Warning: ", format, args)
+}
+
+// Errorf logs failed operations.
+func (l *Logger) Errorf(format string, args ...interface{}) {
+	l.log(slog.LevelError, "", format, args)
+}
+
+func (l *Logger) log(level slog.Level, textPrefix, format string, args []interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	if !jsonOutput.Load() {
+		log.Output(3, l.prefix+textPrefix+msg) // Report the caller of Infof etc.
+		return
+	}
+
+	ctx := context.Background()
+	handler := slog.Default().Handler()
+	if !handler.Enabled(ctx, level) {
+		return
+	}
+	var pcs [1]uintptr
+	runtime.Callers(3, pcs[:]) // Skip Callers, log, and Infof etc.
+	r := slog.NewRecord(time.Now(), level, msg, pcs[0])
+	r.AddAttrs(l.attrs...)
+	handler.Handle(ctx, r)
+}
@@ -0,0 +1,163 @@
+package matchrecorder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/edvart/dota-inhouse/internal/dotaapi"
+	"github.com/edvart/dota-inhouse/internal/steamid"
+	"github.com/edvart/dota-inhouse/internal/store"
+	"github.com/google/uuid"
+)
+
+// ImportResult describes a match imported from the Dota API.
+type ImportResult struct {
+	MatchID string
+	Players int      // Players recorded on the match
+	Skipped []string // Steam IDs of players with no account here, "" if anonymous
+}
+
+// ImportMatch records a finished Dota 2 match from before this system was
+// used, so it counts towards the leaderboard. Players are matched to users
+// by Steam ID; aliases maps a Steam ID seen in the match to a different
+// user's Steam ID, both in 64-bit form. Players who can't be matched to a
+// user are skipped.
+func (r *Recorder) ImportMatch(ctx context.Context, dotaMatchID uint64, aliases map[string]string) (*ImportResult, error) {
+	if r.dotaAPI == nil {
+		return nil, errors.New("the Dota API is not configured")
+	}
+
+	existing, err := r.store.GetMatchByDotaID(ctx, dotaMatchID)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, fmt.Errorf("Dota match %d is already recorded", dotaMatchID)
+	}
+
+	details, err := r.dotaAPI.GetMatchDetails(ctx, dotaMatchID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch Dota match %d: %w", dotaMatchID, err)
+	}
+
+	result := &ImportResult{MatchID: uuid.New().String()}
+	var players []*store.MatchPlayer
+	for i, p := range details.Players {
+		steamID := p.SteamID()
+		if alias, ok := aliases[steamID]; ok && alias != "" {
+			id, err := steamid.Parse(alias)
+			if err != nil {
+				return nil, err
+			}
+			accountID, err := steamid.To32(id)
+			if err != nil {
+				return nil, err
+			}
+			// So the player's stats are saved under the alias too
+			details.Players[i].AccountID = accountID
+			steamID = details.Players[i].SteamID()
+		}
+		if steamID == "" {
+			result.Skipped = append(result.Skipped, "")
+			continue
+		}
+		user, err := r.store.GetUser(ctx, steamID)
+		if err != nil {
+			return nil, err
+		}
+		if user == nil {
+			result.Skipped = append(result.Skipped, steamID)
+			continue
+		}
+
+		team := "dire"
+		if p.IsRadiant() {
+			team = "radiant"
+		}
+		players = append(players, &store.MatchPlayer{
+			MatchID:  result.MatchID,
+			SteamID:  steamID,
+			Team:     team,
+			Accepted: true,
+		})
+	}
+	if len(players) == 0 {
+		return nil, fmt.Errorf("no players in Dota match %d have an account here", dotaMatchID)
+	}
+	result.Players = len(players)
+
+	started := time.Unix(details.StartTime, 0)
+	ended := started.Add(time.Duration(details.Duration) * time.Second)
+	winner := details.Winner()
+	match := &store.Match{
+		ID:          result.MatchID,
+		DotaMatchID: dotaMatchID,
+		State:       "completed",
+		StartedAt:   started,
+		EndedAt:     &ended,
+		Winner:      &winner,
+		Duration:    &details.Duration,
+	}
+	if err := r.store.RecordCompletedMatch(ctx, match, players); err != nil {
+		return nil, err
+	}
+	r.recordPlayerStats(ctx, result.MatchID, details)
+
+	log.Printf("Match recorder: imported Dota match %d as %s with %d players", dotaMatchID, result.MatchID[:8], len(players))
+	return result, nil
+}
+
+// RefreshMatchDetails fetches a recorded match's details from the Dota API
+// again and updates its Dota match ID, winner, duration and player stats,
+// for matches that completed while the API was down. dotaMatchID may be 0
+// to reuse the ID already recorded.
+func (r *Recorder) RefreshMatchDetails(ctx context.Context, matchID string, dotaMatchID uint64) (*dotaapi.MatchDetails, error) {
+	if r.dotaAPI == nil {
+		return nil, errors.New("the Dota API is not configured")
+	}
+
+	match, err := r.store.GetMatch(ctx, matchID)
+	if err != nil {
+		return nil, err
+	}
+	if match == nil {
+		return nil, store.ErrMatchNotFound
+	}
+	if match.State != "completed" {
+		return nil, fmt.Errorf("match %s is %s, not completed", matchID, match.State)
+	}
+	if dotaMatchID == 0 {
+		dotaMatchID = match.DotaMatchID
+	}
+	if dotaMatchID == 0 {
+		return nil, errors.New("the match has no Dota match ID, so one must be given")
+	}
+
+	other, err := r.store.GetMatchByDotaID(ctx, dotaMatchID)
+	if err != nil {
+		return nil, err
+	}
+	if other != nil && other.ID != matchID {
+		return nil, fmt.Errorf("Dota match %d is already recorded as match %s", dotaMatchID, other.ID)
+	}
+
+	details, err := r.dotaAPI.GetMatchDetails(ctx, dotaMatchID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch Dota match %d: %w", dotaMatchID, err)
+	}
+
+	winner := details.Winner()
+	match.DotaMatchID = dotaMatchID
+	match.Winner = &winner
+	match.Duration = &details.Duration
+	if err := r.store.UpdateMatch(ctx, match); err != nil {
+		return nil, err
+	}
+	r.recordPlayerStats(ctx, matchID, details)
+
+	log.Printf("Match recorder: refreshed match %s from Dota match %d (%s won, %s)", matchID[:8], dotaMatchID, winner, details.DurationFormatted())
+	return details, nil
+}
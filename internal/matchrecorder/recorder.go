@@ -3,6 +3,7 @@ package matchrecorder
 import (
 	"context"
 	"log"
+	"sync"
 	"time"
 
 	"github.com/edvart/dota-inhouse/internal/coordinator"
@@ -13,10 +14,13 @@ import (
 type Recorder struct {
 	store     store.Store
 	dotaAPI   *dotaapi.Client
+
+	mu         sync.Mutex
+	completing map[string]bool // Match IDs whose completion is being recorded
 }
 
 func New(s store.Store, dotaAPI *dotaapi.Client) *Recorder {
-	return &Recorder{store: s, dotaAPI: dotaAPI}
+	return &Recorder{store: s, dotaAPI: dotaAPI, completing: make(map[string]bool)}
 }
 
 func (r *Recorder) Run(ctx context.Context, events <-chan coordinator.Event) {
@@ -40,8 +44,74 @@ func (r *Recorder) handleEvent(ctx context.Context, event coordinator.Event) {
 	case coordinator.MatchStarted:
 		r.recordMatchStarted(ctx, e)
 	case coordinator.MatchCompleted:
-		r.recordMatchCompleted(ctx, e)
+		// Fetching details can take minutes while the Dota API catches up,
+		// so don't hold up other events.
+		go r.recordMatchCompleted(ctx, e)
+	case coordinator.LobbyCancelled:
+		r.recordLobbyCancelled(ctx, e)
+	case coordinator.MatchCancelled:
+		if !e.Voted {
+			r.recordAcceptFailed(ctx, e)
+		}
+	case coordinator.PlayerFailedAccept:
+		if err := r.store.RecordFailedAccept(ctx, e.PlayerID, e.Declined); err != nil {
+			log.Printf("Match recorder: failed to record failed accept for %s: %v", e.PlayerID, err)
+		}
+	}
+}
+
+// recordAcceptFailed records a match whose accept phase timed out, so that
+// players' accept rates include the matches they failed to accept.
+func (r *Recorder) recordAcceptFailed(ctx context.Context, e coordinator.MatchCancelled) {
+	now := time.Now()
+	match := &store.Match{
+		ID:        e.MatchID,
+		State:     "accept_failed",
+		StartedAt: now,
+		EndedAt:   &now,
+	}
+
+	if err := r.store.CreateMatch(ctx, match); err != nil {
+		log.Printf("Match recorder: failed to create accept-failed match %s: %v", e.MatchID, err)
+		return
+	}
+
+	for _, p := range e.Players {
+		mp := &store.MatchPlayer{
+			MatchID:  e.MatchID,
+			SteamID:  p.SteamID,
+			Team:     "",
+			Accepted: e.AcceptedPlayers[p.SteamID],
+		}
+		if err := r.store.AddMatchPlayer(ctx, mp); err != nil {
+			log.Printf("Match recorder: failed to add player %s to match %s: %v", p.SteamID, e.MatchID[:8], err)
+		}
+	}
+
+	log.Printf("Match recorder: recorded failed accept for match %s (%d failed)", e.MatchID[:8], len(e.FailedPlayers))
+}
+
+// recordLobbyCancelled marks a match as cancelled if its lobby was abandoned
+// after the game had already been recorded as started.
+func (r *Recorder) recordLobbyCancelled(ctx context.Context, e coordinator.LobbyCancelled) {
+	match, err := r.store.GetMatch(ctx, e.MatchID)
+	if err != nil {
+		log.Printf("Match recorder: failed to get match %s: %v", e.MatchID, err)
+		return
+	}
+	if match == nil || match.State != "in_progress" {
+		return
+	}
+
+	now := time.Now()
+	match.State = "cancelled"
+	match.EndedAt = &now
+	if err := r.store.UpdateMatch(ctx, match); err != nil {
+		log.Printf("Match recorder: failed to mark match %s cancelled: %v", e.MatchID, err)
+		return
 	}
+
+	log.Printf("Match recorder: match %s cancelled after lobby failed", e.MatchID[:8])
 }
 
 func (r *Recorder) recordMatchStarted(ctx context.Context, e coordinator.MatchStarted) {
@@ -50,6 +120,7 @@ func (r *Recorder) recordMatchStarted(ctx context.Context, e coordinator.MatchSt
 		DotaMatchID: e.DotaMatchID,
 		State:       "in_progress",
 		StartedAt:   time.Now(),
+		GameMode:    e.GameMode,
 	}
 
 	if err := r.store.CreateMatch(ctx, match); err != nil {
@@ -57,6 +128,12 @@ func (r *Recorder) recordMatchStarted(ctx context.Context, e coordinator.MatchSt
 		return
 	}
 
+	for _, c := range e.Captains {
+		if err := r.store.SetLastCaptained(ctx, c.SteamID, match.StartedAt); err != nil {
+			log.Printf("Match recorder: failed to record captaincy for %s: %v", c.SteamID, err)
+		}
+	}
+
 	for _, p := range e.Radiant {
 		isCaptain := e.Captains[0].SteamID == p.SteamID
 		mp := &store.MatchPlayer{
@@ -64,7 +141,7 @@ func (r *Recorder) recordMatchStarted(ctx context.Context, e coordinator.MatchSt
 			SteamID:    p.SteamID,
 			Team:       "radiant",
 			WasCaptain: isCaptain,
-			Accepted:   true,
+			Accepted:   e.AcceptedPlayers[p.SteamID],
 		}
 		if err := r.store.AddMatchPlayer(ctx, mp); err != nil {
 			log.Printf("Match recorder: failed to add player %s to match %s: %v", p.SteamID, e.MatchID[:8], err)
@@ -78,23 +155,59 @@ func (r *Recorder) recordMatchStarted(ctx context.Context, e coordinator.MatchSt
 			SteamID:    p.SteamID,
 			Team:       "dire",
 			WasCaptain: isCaptain,
-			Accepted:   true,
+			Accepted:   e.AcceptedPlayers[p.SteamID],
 		}
 		if err := r.store.AddMatchPlayer(ctx, mp); err != nil {
 			log.Printf("Match recorder: failed to add player %s to match %s: %v", p.SteamID, e.MatchID[:8], err)
 		}
 	}
 
+	for _, pick := range e.Picks {
+		team := "radiant"
+		if pick.Team == 1 {
+			team = "dire"
+		}
+		mp := &store.MatchPick{
+			MatchID:    e.MatchID,
+			PickNumber: pick.PickNumber,
+			CaptainID:  pick.CaptainID,
+			PickedID:   pick.PickedID,
+			Team:       team,
+			PickedAt:   pick.Timestamp,
+		}
+		if err := r.store.AddMatchPick(ctx, mp); err != nil {
+			log.Printf("Match recorder: failed to add pick %d to match %s: %v", pick.PickNumber, e.MatchID[:8], err)
+		}
+	}
+
 	log.Printf("Match recorder: recorded match start %s with %d players", e.MatchID[:8], len(e.Radiant)+len(e.Dire))
 }
 
 func (r *Recorder) recordMatchCompleted(ctx context.Context, e coordinator.MatchCompleted) {
+	// Completions run concurrently, so one for a match that is still being
+	// recorded would race it. Drop it; the first recording wins.
+	r.mu.Lock()
+	if r.completing[e.MatchID] {
+		r.mu.Unlock()
+		log.Printf("Match recorder: match %s is already being recorded, skipping", e.MatchID[:8])
+		return
+	}
+	r.completing[e.MatchID] = true
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		delete(r.completing, e.MatchID)
+		r.mu.Unlock()
+	}()
+
 	now := time.Now()
 
 	var winner *string
 	var duration *int
+	var details *dotaapi.MatchDetails
 	if e.DotaMatchID != 0 && r.dotaAPI != nil {
-		details, err := r.fetchWithRetry(ctx, e.DotaMatchID)
+		var err error
+		details, err = r.fetchWithRetry(ctx, e.DotaMatchID)
 		if err != nil {
 			log.Printf("Match recorder: failed to fetch Dota API details for match %d after retries: %v", e.DotaMatchID, err)
 			winner = e.Winner
@@ -114,80 +227,144 @@ func (r *Recorder) recordMatchCompleted(ctx context.Context, e coordinator.Match
 		return
 	}
 
-	if existing == nil {
+	match := existing
+	if match == nil {
 		// Match wasn't recorded at start (maybe server restarted), create it now
-		match := &store.Match{
-			ID:          e.MatchID,
-			DotaMatchID: e.DotaMatchID,
-			State:       "completed",
-			StartedAt:   now, // Unknown actual start time
-			EndedAt:     &now,
-			Winner:      winner,
-			Duration:    duration,
-		}
-		if err := r.store.CreateMatch(ctx, match); err != nil {
-			log.Printf("Match recorder: failed to create completed match %s: %v", e.MatchID, err)
-			return
+		match = &store.Match{
+			ID:        e.MatchID,
+			StartedAt: now, // Unknown actual start time
 		}
-		// Players weren't recorded at start either, add them now
-		r.addMatchPlayers(ctx, e.MatchID, e.Radiant, e.Dire)
-	} else {
-		existing.State = "completed"
-		existing.EndedAt = &now
-		existing.Winner = winner
-		existing.Duration = duration
-		existing.DotaMatchID = e.DotaMatchID
-		if err := r.store.UpdateMatch(ctx, existing); err != nil {
-			log.Printf("Match recorder: failed to update match %s: %v", e.MatchID, err)
-			return
+	}
+	if match.State == "completed" && sameResult(match, winner, e.DotaMatchID) && details == nil {
+		log.Printf("Match recorder: match %s already recorded with this result, skipping", e.MatchID[:8])
+		return
+	}
+	if match.State == "completed" {
+		// Completed twice, e.g. by the bot and then an admin setting the
+		// result. Keep what the first recording knew that this one doesn't.
+		log.Printf("Match recorder: match %s already completed, updating it", e.MatchID[:8])
+		if match.EndedAt != nil {
+			now = *match.EndedAt
+		}
+		if winner == nil {
+			winner = match.Winner
+		}
+		if duration == nil {
+			duration = match.Duration
+		}
+		if e.DotaMatchID == 0 && match.DotaMatchID != 0 {
+			e.DotaMatchID = match.DotaMatchID
 		}
 	}
+	match.State = "completed"
+	match.EndedAt = &now
+	match.Winner = winner
+	match.Duration = duration
+	match.DotaMatchID = e.DotaMatchID
+	if e.GameMode != "" {
+		match.GameMode = e.GameMode
+	}
+
+	// Players missing from the start record are added in the same transaction
+	players := matchPlayers(e.MatchID, e.Radiant, e.Dire, e.AcceptedPlayers)
+	if err := r.store.RecordCompletedMatch(ctx, match, players); err != nil {
+		log.Printf("Match recorder: failed to record completed match %s: %v", e.MatchID, err)
+		return
+	}
+
+	if details != nil {
+		r.recordPlayerStats(ctx, e.MatchID, details)
+	}
 
 	log.Printf("Match recorder: recorded completed match %s", e.MatchID[:8])
 }
 
-func (r *Recorder) addMatchPlayers(ctx context.Context, matchID string, radiant, dire []coordinator.Player) {
+// sameResult reports whether a completed match already records the given
+// winner and Dota match ID, so recording it again would change nothing.
+func sameResult(match *store.Match, winner *string, dotaMatchID uint64) bool {
+	if dotaMatchID != 0 && dotaMatchID != match.DotaMatchID {
+		return false
+	}
+	if winner == nil || match.Winner == nil {
+		return winner == nil && match.Winner == nil
+	}
+	return *winner == *match.Winner
+}
+
+// recordPlayerStats stores each player's hero and performance from the Dota API.
+func (r *Recorder) recordPlayerStats(ctx context.Context, matchID string, details *dotaapi.MatchDetails) {
+	saved := 0
+	for _, p := range details.Players {
+		steamID := p.SteamID()
+		if steamID == "" {
+			continue
+		}
+		stats := &store.MatchPlayerStats{
+			MatchID:    matchID,
+			SteamID:    steamID,
+			HeroID:     p.HeroID,
+			Kills:      p.Kills,
+			Deaths:     p.Deaths,
+			Assists:    p.Assists,
+			GoldPerMin: p.GoldPerMin,
+			XPPerMin:   p.XPPerMin,
+		}
+		if err := r.store.SaveMatchPlayerStats(ctx, stats); err != nil {
+			log.Printf("Match recorder: failed to save stats for player %s in match %s: %v", steamID, matchID[:8], err)
+			continue
+		}
+		saved++
+	}
+	log.Printf("Match recorder: saved stats for %d players in match %s", saved, matchID[:8])
+}
+
+func matchPlayers(matchID string, radiant, dire []coordinator.Player, accepted map[string]bool) []*store.MatchPlayer {
+	players := make([]*store.MatchPlayer, 0, len(radiant)+len(dire))
 	for _, p := range radiant {
-		mp := &store.MatchPlayer{
+		players = append(players, &store.MatchPlayer{
 			MatchID:  matchID,
 			SteamID:  p.SteamID,
 			Team:     "radiant",
-			Accepted: true,
-		}
-		if err := r.store.AddMatchPlayer(ctx, mp); err != nil {
-			log.Printf("Match recorder: failed to add player %s to match %s: %v", p.SteamID, matchID[:8], err)
-		}
+			Accepted: accepted[p.SteamID],
+		})
 	}
 	for _, p := range dire {
-		mp := &store.MatchPlayer{
+		players = append(players, &store.MatchPlayer{
 			MatchID:  matchID,
 			SteamID:  p.SteamID,
 			Team:     "dire",
-			Accepted: true,
-		}
-		if err := r.store.AddMatchPlayer(ctx, mp); err != nil {
-			log.Printf("Match recorder: failed to add player %s to match %s: %v", p.SteamID, matchID[:8], err)
-		}
+			Accepted: accepted[p.SteamID],
+		})
 	}
+	return players
 }
 
+// Backoff for fetching match details. Right after a game ends the API usually
+// reports the match as not found, so keep trying for about five minutes.
+const (
+	fetchInitialDelay = 10 * time.Second
+	fetchMaxDelay     = 2 * time.Minute
+	fetchGiveUpAfter  = 5 * time.Minute
+)
+
 func (r *Recorder) fetchWithRetry(ctx context.Context, matchID uint64) (*dotaapi.MatchDetails, error) {
-	delays := []time.Duration{0, 30 * time.Second, 60 * time.Second, 120 * time.Second}
-	var lastErr error
-	for i, delay := range delays {
-		if delay > 0 {
-			log.Printf("Match recorder: retrying Dota API fetch for match %d (attempt %d/%d) in %s", matchID, i+1, len(delays), delay)
-			select {
-			case <-ctx.Done():
-				return nil, ctx.Err()
-			case <-time.After(delay):
-			}
-		}
+	deadline := time.Now().Add(fetchGiveUpAfter)
+	delay := fetchInitialDelay
+	for attempt := 1; ; attempt++ {
 		details, err := r.dotaAPI.GetMatchDetails(ctx, matchID)
 		if err == nil {
 			return details, nil
 		}
-		lastErr = err
+		if !dotaapi.IsRetryable(err) || time.Now().Add(delay).After(deadline) {
+			return nil, err
+		}
+
+		log.Printf("Match recorder: Dota API fetch for match %d failed (attempt %d): %v; retrying in %s", matchID, attempt, err, delay)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, fetchMaxDelay)
 	}
-	return nil, lastErr
 }
@@ -0,0 +1,78 @@
+package matchrecorder
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/edvart/dota-inhouse/internal/coordinator"
+	"github.com/edvart/dota-inhouse/internal/store"
+)
+
+// createTestPlayers adds n users to the store and returns them as players.
+func createTestPlayers(t *testing.T, st store.Store, n int) []coordinator.Player {
+	t.Helper()
+	var players []coordinator.Player
+	for i := 0; i < n; i++ {
+		id := fmt.Sprintf("7656119800000%04d", i)
+		now := time.Now()
+		if err := st.UpsertUser(context.Background(), &store.User{SteamID: id, Name: id, CreatedAt: now, UpdatedAt: now}); err != nil {
+			t.Fatalf("create user: %v", err)
+		}
+		players = append(players, coordinator.Player{SteamID: id, Name: id})
+	}
+	return players
+}
+
+func TestRecordMatchCompletedTwice(t *testing.T) {
+	ctx := context.Background()
+	st, err := store.NewSQLiteStore(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	defer st.Close()
+
+	players := createTestPlayers(t, st, 4)
+	radiant, dire := players[:2], players[2:]
+
+	winner := "radiant"
+	e := coordinator.MatchCompleted{
+		MatchID: "8c0f3e0a-double-submit",
+		Players: players,
+		Radiant: radiant,
+		Dire:    dire,
+		Winner:  &winner,
+	}
+
+	// A double-clicked result records the same completion twice, concurrently
+	// as the recorder handles MatchCompleted.
+	r := New(st, nil)
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.recordMatchCompleted(ctx, e)
+		}()
+	}
+	wg.Wait()
+	r.recordMatchCompleted(ctx, e)
+
+	matches, err := st.ListMatchesWithPlayers(ctx, 10)
+	if err != nil {
+		t.Fatalf("list matches: %v", err)
+	}
+	if len(matches) != 1 {
+		t.Fatalf("got %d recorded matches, want 1", len(matches))
+	}
+	m := matches[0]
+	if m.State != "completed" || m.Winner == nil || *m.Winner != "radiant" {
+		t.Errorf("recorded match state %q winner %v, want completed radiant", m.State, m.Winner)
+	}
+	if len(m.Radiant) != 2 || len(m.Dire) != 2 {
+		t.Errorf("recorded %d v %d players, want 2 v 2", len(m.Radiant), len(m.Dire))
+	}
+}
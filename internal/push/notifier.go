@@ -9,12 +9,14 @@ import (
 
 // Notifier listens to coordinator events and sends push notifications
 type Notifier struct {
-	service *Service
+	service    *Service
+	lastPicker map[string]int // matchID -> picker index last notified
 }
 
 func NewNotifier(service *Service) *Notifier {
 	return &Notifier{
-		service: service,
+		service:    service,
+		lastPicker: make(map[string]int),
 	}
 }
 
@@ -39,9 +41,31 @@ func (n *Notifier) handleEvent(ctx context.Context, event coordinator.Event) {
 	case coordinator.MatchAcceptStarted:
 		n.handleMatchAcceptStarted(ctx, e)
 	case coordinator.MatchCancelled:
+		delete(n.lastPicker, e.MatchID)
 		n.handleMatchCancelled(ctx, e)
+	case coordinator.PlayerFailedAccept:
+		n.handlePlayerFailedAccept(ctx, e)
+	case coordinator.PlayerAway:
+		n.handlePlayerAway(ctx, e)
+	case coordinator.QueueAlmostFull:
+		n.handleQueueAlmostFull(ctx, e)
 	case coordinator.DraftStarted:
 		n.handleDraftStarted(ctx, e)
+	case coordinator.DraftUpdated:
+		n.handleDraftUpdated(ctx, e)
+	case coordinator.DraftPickWarning:
+		n.handleDraftPickWarning(ctx, e)
+	case coordinator.LobbyJoinWarning:
+		n.handleLobbyJoinWarning(ctx, e)
+	case coordinator.DraftCancelled:
+		delete(n.lastPicker, e.MatchID)
+	case coordinator.LobbyCancelled:
+		delete(n.lastPicker, e.MatchID)
+	case coordinator.MatchCancelledByAdmin:
+		delete(n.lastPicker, e.MatchID)
+	case coordinator.MatchCompleted:
+		delete(n.lastPicker, e.MatchID)
+		n.handleMatchCompleted(ctx, e)
 	// Add more event types as needed
 	}
 }
@@ -55,6 +79,7 @@ func (n *Notifier) handleMatchAcceptStarted(ctx context.Context, event coordinat
 		Icon:  "/static/favicon.ico",
 		Badge: "/static/favicon.ico",
 		Tag:   "match-found",
+		Kind:  KindMatchFound,
 		Data: map[string]interface{}{
 			"matchID": event.MatchID,
 			"url":     "/",
@@ -70,12 +95,111 @@ func (n *Notifier) handleMatchAcceptStarted(ctx context.Context, event coordinat
 }
 
 func (n *Notifier) handleMatchCancelled(ctx context.Context, event coordinator.MatchCancelled) {
-	log.Printf("Match %s cancelled, could send notification if needed", event.MatchID)
-	// Optional: send cancellation notification
+	if event.Voted {
+		// Everyone in the match took part in the vote
+		return
+	}
+
+	log.Printf("Match %s cancelled, notifying players who accepted", event.MatchID)
+
+	payload := NotificationPayload{
+		Title: "Match cancelled",
+		Body:  "Someone didn't accept. You're back in the queue.",
+		Icon:  "/static/favicon.ico",
+		Badge: "/static/favicon.ico",
+		Tag:   "match-found",
+		Kind:  KindMatchFound,
+		Data: map[string]interface{}{
+			"matchID": event.MatchID,
+			"url":     "/",
+		},
+	}
+
+	var steamIDs []string
+	for _, p := range event.Players {
+		if event.AcceptedPlayers[p.SteamID] {
+			steamIDs = append(steamIDs, p.SteamID)
+		}
+	}
+	n.service.SendToMultipleUsers(ctx, steamIDs, payload)
+
+	// Timed-out players who were requeued get no PlayerFailedAccept
+	if len(event.Requeued) > 0 {
+		payload.Title = "You missed the match"
+		payload.Body = "You didn't accept in time and were moved to the back of the queue."
+		requeued := make([]string, len(event.Requeued))
+		for i, p := range event.Requeued {
+			requeued[i] = p.SteamID
+		}
+		n.service.SendToMultipleUsers(ctx, requeued, payload)
+	}
+}
+
+func (n *Notifier) handlePlayerFailedAccept(ctx context.Context, event coordinator.PlayerFailedAccept) {
+	if event.Declined {
+		return
+	}
+
+	payload := NotificationPayload{
+		Title: "You missed the match",
+		Body:  "You didn't accept in time and were removed from the queue.",
+		Icon:  "/static/favicon.ico",
+		Badge: "/static/favicon.ico",
+		Tag:   "match-found",
+		Kind:  KindMatchFound,
+		Data: map[string]interface{}{
+			"url": "/",
+		},
+	}
+
+	n.service.SendToMultipleUsers(ctx, []string{event.PlayerID}, payload)
+}
+
+func (n *Notifier) handlePlayerAway(ctx context.Context, event coordinator.PlayerAway) {
+	if !event.QueueTime {
+		// Missed heartbeats mean the page is closed or asleep anyway
+		return
+	}
+
+	payload := NotificationPayload{
+		Title: "Removed from queue",
+		Body:  "You were removed from the queue for inactivity. Rejoin if you're still around.",
+		Icon:  "/static/favicon.ico",
+		Badge: "/static/favicon.ico",
+		Tag:   "queue-expired",
+		Kind:  KindMatchFound,
+		Data: map[string]interface{}{
+			"url": "/",
+		},
+	}
+
+	n.service.SendToMultipleUsers(ctx, []string{event.PlayerID}, payload)
+}
+
+func (n *Notifier) handleQueueAlmostFull(ctx context.Context, event coordinator.QueueAlmostFull) {
+	payload := NotificationPayload{
+		Title: "Queue almost full — get ready!",
+		Body:  "One more player and your match pops. Be ready to accept.",
+		Icon:  "/static/favicon.ico",
+		Badge: "/static/favicon.ico",
+		Tag:   "queue-almost-full",
+		Kind:  KindMatchFound,
+		Data: map[string]interface{}{
+			"queueID": event.QueueID,
+			"url":     "/",
+		},
+	}
+
+	steamIDs := make([]string, len(event.Players))
+	for i, p := range event.Players {
+		steamIDs[i] = p.SteamID
+	}
+	n.service.SendToMultipleUsers(ctx, steamIDs, payload)
 }
 
 func (n *Notifier) handleDraftStarted(ctx context.Context, event coordinator.DraftStarted) {
 	log.Printf("Draft started for match %s", event.MatchID)
+	n.lastPicker[event.MatchID] = 0
 
 	// Notify captains
 	payload := NotificationPayload{
@@ -84,6 +208,7 @@ func (n *Notifier) handleDraftStarted(ctx context.Context, event coordinator.Dra
 		Icon:  "/static/favicon.ico",
 		Badge: "/static/favicon.ico",
 		Tag:   "draft-started",
+		Kind:  KindDraftTurn,
 		Data: map[string]interface{}{
 			"matchID": event.MatchID,
 			"url":     "/",
@@ -94,3 +219,113 @@ func (n *Notifier) handleDraftStarted(ctx context.Context, event coordinator.Dra
 	captainIDs := []string{event.Captains[0].SteamID, event.Captains[1].SteamID}
 	n.service.SendToMultipleUsers(ctx, captainIDs, payload)
 }
+
+func (n *Notifier) handleDraftUpdated(ctx context.Context, event coordinator.DraftUpdated) {
+	if len(event.AvailablePlayers) == 0 {
+		// Draft is complete
+		delete(n.lastPicker, event.MatchID)
+		return
+	}
+
+	// Swaps and repeated picks (e.g. the second of a double pick) don't change
+	// whose turn it is, so only notify when the picker actually changes.
+	if last, ok := n.lastPicker[event.MatchID]; ok && last == event.CurrentPicker {
+		return
+	}
+	n.lastPicker[event.MatchID] = event.CurrentPicker
+
+	if event.CurrentPicker < 0 || event.CurrentPicker > 1 {
+		return
+	}
+	captain := event.Captains[event.CurrentPicker]
+
+	payload := NotificationPayload{
+		Title: "Your pick! 🎯",
+		Body:  "It's your turn to pick a player.",
+		Icon:  "/static/favicon.ico",
+		Badge: "/static/favicon.ico",
+		Tag:   "draft-turn",
+		Kind:  KindDraftTurn,
+		Data: map[string]interface{}{
+			"matchID": event.MatchID,
+			"url":     "/",
+		},
+	}
+
+	n.service.SendToMultipleUsers(ctx, []string{captain.SteamID}, payload)
+}
+
+func (n *Notifier) handleDraftPickWarning(ctx context.Context, event coordinator.DraftPickWarning) {
+	payload := NotificationPayload{
+		Title: "Pick now! ⏰",
+		Body:  "Your pick time is almost up.",
+		Icon:  "/static/favicon.ico",
+		Badge: "/static/favicon.ico",
+		Tag:   "draft-turn",
+		Kind:  KindDraftTurn,
+		Data: map[string]interface{}{
+			"matchID": event.MatchID,
+			"url":     "/",
+		},
+	}
+
+	n.service.SendToMultipleUsers(ctx, []string{event.Captain.SteamID}, payload)
+}
+
+func (n *Notifier) handleLobbyJoinWarning(ctx context.Context, event coordinator.LobbyJoinWarning) {
+	payload := NotificationPayload{
+		Title: "Join the lobby now! ⏰",
+		Body:  "The lobby closes soon and you will lose your spot.",
+		Icon:  "/static/favicon.ico",
+		Badge: "/static/favicon.ico",
+		Tag:   "lobby-join",
+		Kind:  KindMatchFound,
+		Data: map[string]interface{}{
+			"matchID": event.MatchID,
+			"url":     "/",
+		},
+	}
+
+	steamIDs := make([]string, len(event.Missing))
+	for i, p := range event.Missing {
+		steamIDs[i] = p.SteamID
+	}
+	n.service.SendToMultipleUsers(ctx, steamIDs, payload)
+}
+
+func (n *Notifier) handleMatchCompleted(ctx context.Context, event coordinator.MatchCompleted) {
+	if event.Winner == nil {
+		log.Printf("Match %s completed without a known winner, skipping result notification", event.MatchID)
+		return
+	}
+
+	winners, losers := event.Radiant, event.Dire
+	if *event.Winner == "dire" {
+		winners, losers = event.Dire, event.Radiant
+	}
+
+	send := func(players []coordinator.Player, title string) {
+		payload := NotificationPayload{
+			Title: title,
+			Body:  "Your match has been recorded.",
+			Icon:  "/static/favicon.ico",
+			Badge: "/static/favicon.ico",
+			Tag:   "match-result",
+			Kind:  KindMatchResult,
+			Data: map[string]interface{}{
+				"matchID":     event.MatchID,
+				"dotaMatchID": event.DotaMatchID,
+				"url":         "/history",
+			},
+		}
+
+		steamIDs := make([]string, len(players))
+		for i, p := range players {
+			steamIDs[i] = p.SteamID
+		}
+		n.service.SendToMultipleUsers(ctx, steamIDs, payload)
+	}
+
+	send(winners, "Your team won! 🏆")
+	send(losers, "Your team lost.")
+}
@@ -39,6 +39,43 @@ type NotificationPayload struct {
 	Badge string                 `json:"badge,omitempty"`
 	Data  map[string]interface{} `json:"data,omitempty"`
 	Tag   string                 `json:"tag,omitempty"`
+	Kind  NotificationKind       `json:"-"` // Used to apply user preferences; not sent
+}
+
+// NotificationKind identifies which user preference a notification falls under.
+type NotificationKind string
+
+const (
+	KindMatchFound  NotificationKind = "match_found"
+	KindDraftTurn   NotificationKind = "draft_turn"
+	KindMatchResult NotificationKind = "match_result"
+)
+
+// wantsNotification reports whether the user has this kind of notification
+// enabled. Users without saved preferences get everything.
+func (s *Service) wantsNotification(ctx context.Context, steamID string, kind NotificationKind) bool {
+	if kind == "" {
+		return true
+	}
+
+	prefs, err := s.store.GetPushPreferences(ctx, steamID)
+	if err != nil {
+		log.Printf("Failed to get push preferences for %s: %v", steamID, err)
+		return true
+	}
+	if prefs == nil {
+		return true
+	}
+
+	switch kind {
+	case KindMatchFound:
+		return prefs.MatchFound
+	case KindDraftTurn:
+		return prefs.DraftTurn
+	case KindMatchResult:
+		return prefs.MatchResult
+	}
+	return true
 }
 
 // SendToUser sends a push notification to all subscriptions for a specific user
@@ -113,6 +150,10 @@ func (s *Service) SendToUser(ctx context.Context, steamID string, payload Notifi
 // SendToMultipleUsers sends a push notification to multiple users
 func (s *Service) SendToMultipleUsers(ctx context.Context, steamIDs []string, payload NotificationPayload) {
 	for _, steamID := range steamIDs {
+		if !s.wantsNotification(ctx, steamID, payload.Kind) {
+			continue
+		}
+
 		// Send in background, don't block
 		go func(id string) {
 			if err := s.SendToUser(ctx, id, payload); err != nil {
@@ -0,0 +1,55 @@
+// Package steamid converts between the 64-bit Steam IDs used for logins and
+// stored on users, and the 32-bit account IDs used by the Dota 2 API and
+// game coordinator.
+package steamid
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// base is the 64-bit Steam ID of account ID 0 for an individual account in
+// the public universe.
+const base = 76561197960265728
+
+// To64 returns the 64-bit Steam ID for a 32-bit account ID.
+func To64(accountID uint32) uint64 {
+	return uint64(accountID) + base
+}
+
+// To32 returns the 32-bit account ID for a 64-bit Steam ID.
+func To32(steamID uint64) (uint32, error) {
+	if steamID < base || steamID-base > 0xFFFFFFFF {
+		return 0, fmt.Errorf("%d is not an individual 64-bit Steam ID", steamID)
+	}
+	return uint32(steamID - base), nil
+}
+
+// Parse reads a Steam ID in either its 64-bit or 32-bit form and returns
+// the 64-bit ID.
+func Parse(s string) (uint64, error) {
+	id, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid Steam ID %q", s)
+	}
+	if id <= 0xFFFFFFFF {
+		if id == 0 {
+			return 0, fmt.Errorf("invalid Steam ID %q", s)
+		}
+		return To64(uint32(id)), nil
+	}
+	if _, err := To32(id); err != nil {
+		return 0, fmt.Errorf("invalid Steam ID %q", s)
+	}
+	return id, nil
+}
+
+// Normalize returns the 64-bit string form of a Steam ID given in either
+// form, as used for users and players throughout the app.
+func Normalize(s string) (string, error) {
+	id, err := Parse(s)
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatUint(id, 10), nil
+}
@@ -0,0 +1,95 @@
+package steamid
+
+import "testing"
+
+var knownIDs = []struct {
+	accountID uint32
+	steamID   uint64
+}{
+	{0, 76561197960265728},
+	{1, 76561197960265729},
+	{22202, 76561197960287930},
+	{86745912, 76561198047011640},
+	{0xFFFFFFFF, 76561202255233023},
+}
+
+func TestTo64(t *testing.T) {
+	for _, tt := range knownIDs {
+		if got := To64(tt.accountID); got != tt.steamID {
+			t.Errorf("To64(%d) = %d, want %d", tt.accountID, got, tt.steamID)
+		}
+	}
+}
+
+func TestTo32(t *testing.T) {
+	for _, tt := range knownIDs {
+		got, err := To32(tt.steamID)
+		if err != nil {
+			t.Errorf("To32(%d) returned error: %v", tt.steamID, err)
+			continue
+		}
+		if got != tt.accountID {
+			t.Errorf("To32(%d) = %d, want %d", tt.steamID, got, tt.accountID)
+		}
+	}
+
+	for _, id := range []uint64{0, 22202, 76561197960265727, 76561202255233024} {
+		if _, err := To32(id); err == nil {
+			t.Errorf("To32(%d) should fail", id)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    uint64
+		wantErr bool
+	}{
+		{"76561197960287930", 76561197960287930, false},
+		{"22202", 76561197960287930, false},
+		{"86745912", 76561198047011640, false},
+		{"4294967295", 76561202255233023, false},
+		{"0", 0, true},
+		{"", 0, true},
+		{"abc", 0, true},
+		{"-1", 0, true},
+		{"STEAM_0:0:11101", 0, true},
+		{"76561197960265727", 0, true},
+		{"18446744073709551616", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Parse(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Parse(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"76561197960287930", "76561197960287930", false},
+		{"22202", "76561197960287930", false},
+		{"1", "76561197960265729", false},
+		{"0", "", true},
+		{"not-an-id", "", true},
+	}
+	for _, tt := range tests {
+		got, err := Normalize(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Normalize(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -4,6 +4,11 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	_ "modernc.org/sqlite"
@@ -11,6 +16,11 @@ import (
 
 type SQLiteStore struct {
 	db *sql.DB
+
+	// elo caches every player's all-time rating for GetPlayerElo, which runs
+	// on each queue join. Any write to matches or match_players clears it.
+	eloMu sync.Mutex
+	elo   map[string]int
 }
 
 func NewSQLiteStore(dbPath string) (*SQLiteStore, error) {
@@ -49,6 +59,7 @@ func (s *SQLiteStore) migrate() error {
 			expires_at TIMESTAMP NOT NULL
 		)`,
 		`CREATE INDEX IF NOT EXISTS idx_sessions_expires ON sessions(expires_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_sessions_steam_id ON sessions(steam_id)`,
 		`CREATE TABLE IF NOT EXISTS matches (
 			id TEXT PRIMARY KEY,
 			dota_match_id INTEGER,
@@ -66,6 +77,26 @@ func (s *SQLiteStore) migrate() error {
 			accepted INTEGER DEFAULT 0,
 			PRIMARY KEY (match_id, steam_id)
 		)`,
+		`CREATE TABLE IF NOT EXISTS match_player_stats (
+			match_id TEXT NOT NULL REFERENCES matches(id),
+			steam_id TEXT NOT NULL,
+			hero_id INTEGER NOT NULL,
+			kills INTEGER NOT NULL DEFAULT 0,
+			deaths INTEGER NOT NULL DEFAULT 0,
+			assists INTEGER NOT NULL DEFAULT 0,
+			gold_per_min INTEGER NOT NULL DEFAULT 0,
+			xp_per_min INTEGER NOT NULL DEFAULT 0,
+			PRIMARY KEY (match_id, steam_id)
+		)`,
+		`CREATE TABLE IF NOT EXISTS match_picks (
+			match_id TEXT NOT NULL REFERENCES matches(id),
+			pick_number INTEGER NOT NULL,
+			captain_id TEXT NOT NULL,
+			picked_id TEXT NOT NULL,
+			team TEXT NOT NULL,
+			picked_at TIMESTAMP NOT NULL,
+			PRIMARY KEY (match_id, pick_number)
+		)`,
 		`CREATE TABLE IF NOT EXISTS push_subscriptions (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
 			steam_id TEXT NOT NULL REFERENCES users(steam_id),
@@ -75,6 +106,55 @@ func (s *SQLiteStore) migrate() error {
 			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 		)`,
 		`CREATE INDEX IF NOT EXISTS idx_push_subs_steam_id ON push_subscriptions(steam_id)`,
+		`CREATE TABLE IF NOT EXISTS push_preferences (
+			steam_id TEXT PRIMARY KEY REFERENCES users(steam_id),
+			match_found INTEGER NOT NULL DEFAULT 1,
+			draft_turn INTEGER NOT NULL DEFAULT 1,
+			match_result INTEGER NOT NULL DEFAULT 1
+		)`,
+		`CREATE TABLE IF NOT EXISTS admin_actions (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			admin_steam_id TEXT NOT NULL,
+			action TEXT NOT NULL,
+			target TEXT NOT NULL DEFAULT '',
+			detail TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_admin_actions_created ON admin_actions(created_at)`,
+		`CREATE TABLE IF NOT EXISTS banned_users (
+			steam_id TEXT PRIMARY KEY,
+			reason TEXT NOT NULL DEFAULT '',
+			banned_by TEXT NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			expires_at TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS allowed_users (
+			steam_id TEXT PRIMARY KEY,
+			added_by TEXT NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS discord_links (
+			discord_id TEXT PRIMARY KEY,
+			steam_id TEXT NOT NULL REFERENCES users(steam_id),
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS lobby_counters (
+			day TEXT PRIMARY KEY,
+			count INTEGER NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS player_accept_stats (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			steam_id TEXT NOT NULL,
+			declined INTEGER NOT NULL DEFAULT 0,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_player_accept_stats_steam_id ON player_accept_stats(steam_id, created_at)`,
+		`CREATE TABLE IF NOT EXISTS player_preferences (
+			steam_id TEXT PRIMARY KEY,
+			roles TEXT NOT NULL DEFAULT '',
+			heroes TEXT NOT NULL DEFAULT '',
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
 	}
 
 	for _, m := range migrations {
@@ -86,6 +166,11 @@ func (s *SQLiteStore) migrate() error {
 	// Run optional migrations that may fail (e.g., adding columns that might already exist)
 	optionalMigrations := []string{
 		`ALTER TABLE matches ADD COLUMN duration INTEGER`,
+		`ALTER TABLE matches ADD COLUMN game_mode TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE users ADD COLUMN last_captained_at TIMESTAMP`,
+		`ALTER TABLE users ADD COLUMN email TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE users ADD COLUMN email_notifications INTEGER NOT NULL DEFAULT 0`,
+		`ALTER TABLE users ADD COLUMN avatar_hash TEXT NOT NULL DEFAULT ''`,
 	}
 	for _, m := range optionalMigrations {
 		s.db.Exec(m) // Ignore errors - column may already exist
@@ -94,6 +179,22 @@ func (s *SQLiteStore) migrate() error {
 	return nil
 }
 
+func (s *SQLiteStore) NextLobbyNumber(ctx context.Context, day string) (int, error) {
+	var n int
+	err := s.db.QueryRowContext(ctx,
+		`INSERT INTO lobby_counters (day, count) VALUES (?, 1)
+		 ON CONFLICT(day) DO UPDATE SET count = count + 1
+		 RETURNING count`,
+		day,
+	).Scan(&n)
+	return n, err
+}
+
+func (s *SQLiteStore) Ping(ctx context.Context) error {
+	var one int
+	return s.db.QueryRowContext(ctx, `SELECT 1`).Scan(&one)
+}
+
 func (s *SQLiteStore) Close() error {
 	return s.db.Close()
 }
@@ -101,10 +202,10 @@ func (s *SQLiteStore) Close() error {
 func (s *SQLiteStore) GetUser(ctx context.Context, steamID string) (*User, error) {
 	var user User
 	err := s.db.QueryRowContext(ctx,
-		`SELECT steam_id, name, avatar_url, captain_priority, created_at, updated_at
+		`SELECT steam_id, name, avatar_url, captain_priority, last_captained_at, created_at, updated_at
 		 FROM users WHERE steam_id = ?`, steamID).Scan(
 		&user.SteamID, &user.Name, &user.AvatarURL,
-		&user.CaptainPriority, &user.CreatedAt, &user.UpdatedAt,
+		&user.CaptainPriority, &user.LastCaptainedAt, &user.CreatedAt, &user.UpdatedAt,
 	)
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -117,21 +218,46 @@ func (s *SQLiteStore) GetUser(ctx context.Context, steamID string) (*User, error
 
 func (s *SQLiteStore) UpsertUser(ctx context.Context, user *User) error {
 	_, err := s.db.ExecContext(ctx,
-		`INSERT INTO users (steam_id, name, avatar_url, captain_priority, created_at, updated_at)
-		 VALUES (?, ?, ?, ?, ?, ?)
+		`INSERT INTO users (steam_id, name, avatar_url, avatar_hash, captain_priority, created_at, updated_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?)
 		 ON CONFLICT(steam_id) DO UPDATE SET
 		 	name = excluded.name,
 		 	avatar_url = excluded.avatar_url,
+		 	avatar_hash = excluded.avatar_hash,
 		 	updated_at = excluded.updated_at`,
-		user.SteamID, user.Name, user.AvatarURL,
+		user.SteamID, user.Name, user.AvatarURL, user.AvatarHash,
 		user.CaptainPriority, user.CreatedAt, user.UpdatedAt,
 	)
 	return err
 }
 
+func (s *SQLiteStore) GetStaleUsers(ctx context.Context, olderThan time.Time) ([]User, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT u.steam_id, u.name, u.avatar_url, u.avatar_hash, u.captain_priority, u.last_captained_at, u.created_at, u.updated_at
+		 FROM users u
+		 WHERE u.updated_at < ?
+		   AND EXISTS (SELECT 1 FROM sessions s WHERE s.steam_id = u.steam_id AND s.expires_at > ?)
+		 ORDER BY u.updated_at`, olderThan, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		var u User
+		if err := rows.Scan(&u.SteamID, &u.Name, &u.AvatarURL, &u.AvatarHash,
+			&u.CaptainPriority, &u.LastCaptainedAt, &u.CreatedAt, &u.UpdatedAt); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
 func (s *SQLiteStore) ListUsers(ctx context.Context) ([]User, error) {
 	rows, err := s.db.QueryContext(ctx,
-		`SELECT steam_id, name, avatar_url, captain_priority, created_at, updated_at
+		`SELECT steam_id, name, avatar_url, captain_priority, last_captained_at, created_at, updated_at
 		 FROM users ORDER BY name`)
 	if err != nil {
 		return nil, err
@@ -141,7 +267,7 @@ func (s *SQLiteStore) ListUsers(ctx context.Context) ([]User, error) {
 	var users []User
 	for rows.Next() {
 		var u User
-		if err := rows.Scan(&u.SteamID, &u.Name, &u.AvatarURL, &u.CaptainPriority, &u.CreatedAt, &u.UpdatedAt); err != nil {
+		if err := rows.Scan(&u.SteamID, &u.Name, &u.AvatarURL, &u.CaptainPriority, &u.LastCaptainedAt, &u.CreatedAt, &u.UpdatedAt); err != nil {
 			return nil, err
 		}
 		users = append(users, u)
@@ -166,6 +292,12 @@ func (s *SQLiteStore) UpdateCaptainPriority(ctx context.Context, steamID string,
 	return nil
 }
 
+func (s *SQLiteStore) SetLastCaptained(ctx context.Context, steamID string, at time.Time) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE users SET last_captained_at = ? WHERE steam_id = ?`, at, steamID)
+	return err
+}
+
 func (s *SQLiteStore) CreateSession(ctx context.Context, session *Session) error {
 	_, err := s.db.ExecContext(ctx,
 		`INSERT INTO sessions (id, steam_id, created_at, expires_at)
@@ -197,25 +329,58 @@ func (s *SQLiteStore) DeleteSession(ctx context.Context, sessionID string) error
 	return err
 }
 
+func (s *SQLiteStore) DeleteSessionsForUser(ctx context.Context, steamID string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM sessions WHERE steam_id = ?`, steamID)
+	return err
+}
+
 func (s *SQLiteStore) DeleteExpiredSessions(ctx context.Context) error {
 	_, err := s.db.ExecContext(ctx, `DELETE FROM sessions WHERE expires_at < ?`, time.Now())
 	return err
 }
 
+// GetDiscordLink returns the Steam ID linked to a Discord account, or "" if none.
+func (s *SQLiteStore) GetDiscordLink(ctx context.Context, discordID string) (string, error) {
+	var steamID string
+	err := s.db.QueryRowContext(ctx,
+		`SELECT steam_id FROM discord_links WHERE discord_id = ?`, discordID).Scan(&steamID)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return steamID, nil
+}
+
+func (s *SQLiteStore) LinkDiscord(ctx context.Context, discordID, steamID string) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO discord_links (discord_id, steam_id)
+		 VALUES (?, ?)
+		 ON CONFLICT(discord_id) DO UPDATE SET steam_id = excluded.steam_id`,
+		discordID, steamID,
+	)
+	return err
+}
+
 func (s *SQLiteStore) CreateMatch(ctx context.Context, match *Match) error {
+	defer s.invalidateElo()
+
 	_, err := s.db.ExecContext(ctx,
-		`INSERT INTO matches (id, dota_match_id, state, started_at, ended_at, winner, duration)
-		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
-		match.ID, match.DotaMatchID, match.State, match.StartedAt, match.EndedAt, match.Winner, match.Duration,
+		`INSERT INTO matches (id, dota_match_id, state, started_at, ended_at, winner, duration, game_mode)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		match.ID, match.DotaMatchID, match.State, match.StartedAt, match.EndedAt, match.Winner, match.Duration, match.GameMode,
 	)
 	return err
 }
 
 func (s *SQLiteStore) UpdateMatch(ctx context.Context, match *Match) error {
+	defer s.invalidateElo()
+
 	_, err := s.db.ExecContext(ctx,
-		`UPDATE matches SET dota_match_id = ?, state = ?, ended_at = ?, winner = ?, duration = ?
+		`UPDATE matches SET dota_match_id = ?, state = ?, ended_at = ?, winner = ?, duration = ?, game_mode = ?
 		 WHERE id = ?`,
-		match.DotaMatchID, match.State, match.EndedAt, match.Winner, match.Duration, match.ID,
+		match.DotaMatchID, match.State, match.EndedAt, match.Winner, match.Duration, match.GameMode, match.ID,
 	)
 	return err
 }
@@ -223,10 +388,27 @@ func (s *SQLiteStore) UpdateMatch(ctx context.Context, match *Match) error {
 func (s *SQLiteStore) GetMatch(ctx context.Context, matchID string) (*Match, error) {
 	var match Match
 	err := s.db.QueryRowContext(ctx,
-		`SELECT id, dota_match_id, state, started_at, ended_at, winner, duration
+		`SELECT id, dota_match_id, state, started_at, ended_at, winner, duration, game_mode
 		 FROM matches WHERE id = ?`, matchID).Scan(
 		&match.ID, &match.DotaMatchID, &match.State,
-		&match.StartedAt, &match.EndedAt, &match.Winner, &match.Duration,
+		&match.StartedAt, &match.EndedAt, &match.Winner, &match.Duration, &match.GameMode,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &match, nil
+}
+
+func (s *SQLiteStore) GetMatchByDotaID(ctx context.Context, dotaMatchID uint64) (*Match, error) {
+	var match Match
+	err := s.db.QueryRowContext(ctx,
+		`SELECT id, dota_match_id, state, started_at, ended_at, winner, duration, game_mode
+		 FROM matches WHERE dota_match_id = ? LIMIT 1`, dotaMatchID).Scan(
+		&match.ID, &match.DotaMatchID, &match.State,
+		&match.StartedAt, &match.EndedAt, &match.Winner, &match.Duration, &match.GameMode,
 	)
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -238,6 +420,8 @@ func (s *SQLiteStore) GetMatch(ctx context.Context, matchID string) (*Match, err
 }
 
 func (s *SQLiteStore) SetMatchWinner(ctx context.Context, matchID string, winner string) error {
+	defer s.invalidateElo()
+
 	result, err := s.db.ExecContext(ctx,
 		`UPDATE matches SET winner = ? WHERE id = ?`,
 		winner, matchID)
@@ -254,10 +438,86 @@ func (s *SQLiteStore) SetMatchWinner(ctx context.Context, matchID string, winner
 	return nil
 }
 
+func (s *SQLiteStore) RecordCompletedMatch(ctx context.Context, match *Match, players []*MatchPlayer) error {
+	defer s.invalidateElo()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO matches (id, dota_match_id, state, started_at, ended_at, winner, duration, game_mode)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		 ON CONFLICT(id) DO UPDATE SET
+		 dota_match_id = excluded.dota_match_id,
+		 state = excluded.state,
+		 ended_at = excluded.ended_at,
+		 winner = excluded.winner,
+		 duration = excluded.duration,
+		 game_mode = excluded.game_mode`,
+		match.ID, match.DotaMatchID, match.State, match.StartedAt, match.EndedAt, match.Winner, match.Duration, match.GameMode,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save match: %w", err)
+	}
+
+	// Players recorded when the match started keep their captain flags
+	for _, mp := range players {
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO match_players (match_id, steam_id, team, was_captain, accepted)
+			 VALUES (?, ?, ?, ?, ?)
+			 ON CONFLICT(match_id, steam_id) DO NOTHING`,
+			mp.MatchID, mp.SteamID, mp.Team, mp.WasCaptain, mp.Accepted,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to add player %s: %w", mp.SteamID, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) DeleteMatch(ctx context.Context, matchID string) error {
+	defer s.invalidateElo()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range []string{"match_picks", "match_player_stats", "match_players"} {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM `+table+` WHERE match_id = ?`, matchID); err != nil {
+			return fmt.Errorf("failed to delete from %s: %w", table, err)
+		}
+	}
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM matches WHERE id = ?`, matchID)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrMatchNotFound
+	}
+	return tx.Commit()
+}
+
 func (s *SQLiteStore) AddMatchPlayer(ctx context.Context, mp *MatchPlayer) error {
+	defer s.invalidateElo()
+
 	_, err := s.db.ExecContext(ctx,
 		`INSERT INTO match_players (match_id, steam_id, team, was_captain, accepted)
-		 VALUES (?, ?, ?, ?, ?)`,
+		 VALUES (?, ?, ?, ?, ?)
+		 ON CONFLICT(match_id, steam_id) DO UPDATE SET
+		 team = excluded.team,
+		 was_captain = excluded.was_captain,
+		 accepted = excluded.accepted`,
 		mp.MatchID, mp.SteamID, mp.Team, mp.WasCaptain, mp.Accepted,
 	)
 	return err
@@ -283,13 +543,52 @@ func (s *SQLiteStore) GetMatchPlayers(ctx context.Context, matchID string) ([]Ma
 	return players, rows.Err()
 }
 
+func (s *SQLiteStore) AddMatchPick(ctx context.Context, pick *MatchPick) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO match_picks (match_id, pick_number, captain_id, picked_id, team, picked_at)
+		 VALUES (?, ?, ?, ?, ?, ?)`,
+		pick.MatchID, pick.PickNumber, pick.CaptainID, pick.PickedID, pick.Team, pick.PickedAt,
+	)
+	return err
+}
+
+func (s *SQLiteStore) GetMatchPicks(ctx context.Context, matchID string) ([]MatchPick, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT mp.match_id, mp.pick_number, mp.captain_id, mp.picked_id, mp.team, mp.picked_at,
+		        COALESCE(c.name, mp.captain_id), COALESCE(p.name, mp.picked_id)
+		 FROM match_picks mp
+		 LEFT JOIN users c ON c.steam_id = mp.captain_id
+		 LEFT JOIN users p ON p.steam_id = mp.picked_id
+		 WHERE mp.match_id = ?
+		 ORDER BY mp.pick_number`, matchID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var picks []MatchPick
+	for rows.Next() {
+		var pick MatchPick
+		if err := rows.Scan(&pick.MatchID, &pick.PickNumber, &pick.CaptainID, &pick.PickedID, &pick.Team,
+			&pick.PickedAt, &pick.CaptainName, &pick.PickedName); err != nil {
+			return nil, err
+		}
+		picks = append(picks, pick)
+	}
+	return picks, rows.Err()
+}
+
 func (s *SQLiteStore) ListMatches(ctx context.Context, limit int) ([]Match, error) {
+	return s.listMatches(ctx, limit, 0)
+}
+
+func (s *SQLiteStore) listMatches(ctx context.Context, limit, offset int) ([]Match, error) {
 	rows, err := s.db.QueryContext(ctx,
-		`SELECT id, dota_match_id, state, started_at, ended_at, winner, duration
+		`SELECT id, dota_match_id, state, started_at, ended_at, winner, duration, game_mode
 		 FROM matches
 		 WHERE state = 'completed'
 		 ORDER BY ended_at DESC
-		 LIMIT ?`, limit)
+		 LIMIT ? OFFSET ?`, limit, offset)
 	if err != nil {
 		return nil, err
 	}
@@ -298,7 +597,7 @@ func (s *SQLiteStore) ListMatches(ctx context.Context, limit int) ([]Match, erro
 	var matches []Match
 	for rows.Next() {
 		var m Match
-		if err := rows.Scan(&m.ID, &m.DotaMatchID, &m.State, &m.StartedAt, &m.EndedAt, &m.Winner, &m.Duration); err != nil {
+		if err := rows.Scan(&m.ID, &m.DotaMatchID, &m.State, &m.StartedAt, &m.EndedAt, &m.Winner, &m.Duration, &m.GameMode); err != nil {
 			return nil, err
 		}
 		matches = append(matches, m)
@@ -306,7 +605,25 @@ func (s *SQLiteStore) ListMatches(ctx context.Context, limit int) ([]Match, erro
 	return matches, rows.Err()
 }
 
-func (s *SQLiteStore) GetLeaderboard(ctx context.Context, startDate, endDate *time.Time) ([]LeaderboardEntry, error) {
+// leaderboardOrders maps each sort to a fixed ORDER BY clause, so the sort
+// never reaches the query as text. Elo and streaks are computed after the
+// query, so those sorts are redone in Go and the clause only breaks ties.
+var leaderboardOrders = map[LeaderboardSort]string{
+	SortNetWins: "(wins - losses) DESC, total DESC",
+	SortWinRate: "CAST(wins AS REAL) / total DESC, total DESC",
+	SortElo:     "(wins - losses) DESC, total DESC",
+	SortStreak:  "(wins - losses) DESC, total DESC",
+}
+
+// GetLeaderboard returns player standings for completed matches. gameMode
+// restricts results to one game mode; "" includes all modes.
+func (s *SQLiteStore) GetLeaderboard(ctx context.Context, startDate, endDate *time.Time, gameMode string, minGames int, sortBy LeaderboardSort) ([]LeaderboardEntry, error) {
+	order, ok := leaderboardOrders[sortBy]
+	if !ok {
+		sortBy = SortNetWins
+		order = leaderboardOrders[sortBy]
+	}
+
 	query := `
 		SELECT
 			mp.steam_id,
@@ -330,11 +647,16 @@ func (s *SQLiteStore) GetLeaderboard(ctx context.Context, startDate, endDate *ti
 		query += " AND m.ended_at <= ?"
 		args = append(args, *endDate)
 	}
+	if gameMode != "" {
+		query += " AND m.game_mode = ?"
+		args = append(args, gameMode)
+	}
 
 	query += `
 		GROUP BY mp.steam_id
-		ORDER BY (wins - losses) DESC, total DESC
-	`
+		HAVING COUNT(*) >= ?
+		ORDER BY ` + order
+	args = append(args, minGames)
 
 	rows, err := s.db.QueryContext(ctx, query, args...)
 	if err != nil {
@@ -364,22 +686,68 @@ func (s *SQLiteStore) GetLeaderboard(ctx context.Context, startDate, endDate *ti
 		return nil, err
 	}
 
+	elo, err := s.calculateElo(ctx, startDate, endDate, gameMode)
+	if err != nil {
+		return nil, err
+	}
 	for i := range entries {
-		entries[i].Streak = s.calculateStreak(ctx, entries[i].SteamID, startDate, endDate)
+		entries[i].Streak = s.calculateStreak(ctx, entries[i].SteamID, startDate, endDate, gameMode)
+		entries[i].Elo = elo[entries[i].SteamID]
+	}
+
+	switch sortBy {
+	case SortElo:
+		sort.SliceStable(entries, func(i, j int) bool { return entries[i].Elo > entries[j].Elo })
+	case SortStreak:
+		sort.SliceStable(entries, func(i, j int) bool { return entries[i].Streak > entries[j].Streak })
 	}
 
 	return entries, nil
 }
 
-func (s *SQLiteStore) calculateStreak(ctx context.Context, steamID string, startDate, endDate *time.Time) int {
+func (s *SQLiteStore) GetPlayerElo(ctx context.Context, steamID string) (int, error) {
+	s.eloMu.Lock()
+	defer s.eloMu.Unlock()
+	if s.elo == nil {
+		elo, err := s.calculateElo(ctx, nil, nil, "")
+		if err != nil {
+			return 0, err
+		}
+		s.elo = elo
+	}
+	if r, ok := s.elo[steamID]; ok {
+		return r, nil
+	}
+	return eloStart, nil
+}
+
+// invalidateElo drops the cached ratings so the next GetPlayerElo replays
+// the match history again.
+func (s *SQLiteStore) invalidateElo() {
+	s.eloMu.Lock()
+	s.elo = nil
+	s.eloMu.Unlock()
+}
+
+const (
+	// eloStart is every player's rating before their first match.
+	eloStart = 1000
+	// eloK is the most a rating can move in one match.
+	eloK = 32
+)
+
+// calculateElo replays the completed matches in the period, oldest first,
+// and returns each player's Elo rating. A team's strength is its players'
+// average rating, and every player on a team gains or loses the same amount.
+func (s *SQLiteStore) calculateElo(ctx context.Context, startDate, endDate *time.Time, gameMode string) (map[string]int, error) {
 	query := `
-		SELECT
-			CASE WHEN m.winner = mp.team THEN 1 ELSE -1 END as result
-		FROM match_players mp
-		JOIN matches m ON mp.match_id = m.id
-		WHERE mp.steam_id = ? AND m.state = 'completed' AND m.winner IS NOT NULL
+		SELECT m.id, m.winner, mp.steam_id, mp.team
+		FROM matches m
+		JOIN match_players mp ON mp.match_id = m.id
+		WHERE m.state = 'completed' AND m.winner IS NOT NULL
+			AND mp.team IN ('radiant', 'dire')
 	`
-	args := []interface{}{steamID}
+	args := []interface{}{}
 
 	if startDate != nil {
 		query += " AND m.ended_at >= ?"
@@ -389,101 +757,689 @@ func (s *SQLiteStore) calculateStreak(ctx context.Context, steamID string, start
 		query += " AND m.ended_at <= ?"
 		args = append(args, *endDate)
 	}
+	if gameMode != "" {
+		query += " AND m.game_mode = ?"
+		args = append(args, gameMode)
+	}
 
-	query += " ORDER BY m.ended_at DESC"
+	query += " ORDER BY m.ended_at, m.id"
 
 	rows, err := s.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return 0
+		return nil, err
 	}
 	defer rows.Close()
 
-	streak := 0
-	var firstResult int
-	first := true
-
+	ratings := make(map[string]float64)
+	var matchID, winner string
+	teams := map[string][]string{}
 	for rows.Next() {
-		var result int
-		if err := rows.Scan(&result); err != nil {
-			return 0
+		var id, w, steamID, team string
+		if err := rows.Scan(&id, &w, &steamID, &team); err != nil {
+			return nil, err
+		}
+		if id != matchID {
+			applyElo(ratings, teams, winner)
+			matchID, winner = id, w
+			teams = map[string][]string{}
 		}
+		teams[team] = append(teams[team], steamID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	applyElo(ratings, teams, winner)
 
-		if first {
-			firstResult = result
-			streak = result
-			first = false
-		} else if result == firstResult {
-			streak += result
-		} else {
-			break // Streak ended
+	elo := make(map[string]int, len(ratings))
+	for steamID, r := range ratings {
+		elo[steamID] = int(math.Round(r))
+	}
+	return elo, nil
+}
+
+// applyElo updates the ratings of both teams after one match.
+func applyElo(ratings map[string]float64, teams map[string][]string, winner string) {
+	radiant, dire := teams["radiant"], teams["dire"]
+	if len(radiant) == 0 || len(dire) == 0 {
+		return
+	}
+
+	average := func(team []string) float64 {
+		total := 0.0
+		for _, steamID := range team {
+			r, ok := ratings[steamID]
+			if !ok {
+				r = eloStart
+			}
+			total += r
 		}
+		return total / float64(len(team))
 	}
+	expected := 1 / (1 + math.Pow(10, (average(dire)-average(radiant))/400))
+	score := 0.0
+	if winner == "radiant" {
+		score = 1
+	}
+	delta := eloK * (score - expected)
 
-	return streak
+	for _, steamID := range radiant {
+		if _, ok := ratings[steamID]; !ok {
+			ratings[steamID] = eloStart
+		}
+		ratings[steamID] += delta
+	}
+	for _, steamID := range dire {
+		if _, ok := ratings[steamID]; !ok {
+			ratings[steamID] = eloStart
+		}
+		ratings[steamID] -= delta
+	}
 }
 
-func (s *SQLiteStore) ListMatchesWithPlayers(ctx context.Context, limit int) ([]MatchWithPlayers, error) {
-	matches, err := s.ListMatches(ctx, limit)
+func (s *SQLiteStore) GetPlayerStats(ctx context.Context, steamID string) (*LeaderboardEntry, error) {
+	e := LeaderboardEntry{SteamID: steamID}
+	err := s.db.QueryRowContext(ctx, `
+		SELECT
+			COUNT(*) as total,
+			COALESCE(SUM(CASE WHEN m.winner = mp.team THEN 1 ELSE 0 END), 0) as wins,
+			COALESCE(SUM(CASE WHEN m.winner != mp.team THEN 1 ELSE 0 END), 0) as losses
+		FROM match_players mp
+		JOIN matches m ON mp.match_id = m.id
+		WHERE mp.steam_id = ? AND m.state = 'completed' AND m.winner IS NOT NULL`,
+		steamID).Scan(&e.Total, &e.Wins, &e.Losses)
 	if err != nil {
 		return nil, err
 	}
 
-	result := make([]MatchWithPlayers, 0, len(matches))
-	for _, m := range matches {
-		mwp := MatchWithPlayers{Match: m}
+	if e.Total > 0 {
+		e.WinRate = float64(e.Wins) / float64(e.Total) * 100
+	}
+	e.Streak = s.calculateStreak(ctx, steamID, nil, nil, "")
+	return &e, nil
+}
 
-		rows, err := s.db.QueryContext(ctx,
-			`SELECT mp.steam_id, u.name, u.avatar_url, mp.team, mp.was_captain
-			 FROM match_players mp
-			 LEFT JOIN users u ON mp.steam_id = u.steam_id
-			 WHERE mp.match_id = ?`, m.ID)
-		if err != nil {
+func (s *SQLiteStore) GetPlayerMatches(ctx context.Context, steamID string, limit int) ([]PlayerMatch, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT m.id, m.dota_match_id, m.state, m.started_at, m.ended_at, m.winner, m.duration, m.game_mode,
+		       mp.team, mp.was_captain,
+		       ps.hero_id, ps.kills, ps.deaths, ps.assists, ps.gold_per_min, ps.xp_per_min
+		FROM match_players mp
+		JOIN matches m ON mp.match_id = m.id
+		LEFT JOIN match_player_stats ps ON ps.match_id = mp.match_id AND ps.steam_id = mp.steam_id
+		WHERE mp.steam_id = ? AND m.state = 'completed'
+		ORDER BY m.ended_at DESC
+		LIMIT ?`, steamID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var matches []PlayerMatch
+	for rows.Next() {
+		var pm PlayerMatch
+		var stats nullStats
+		if err := rows.Scan(&pm.ID, &pm.DotaMatchID, &pm.State, &pm.StartedAt, &pm.EndedAt, &pm.Winner, &pm.Duration, &pm.GameMode,
+			&pm.Team, &pm.WasCaptain,
+			&stats.HeroID, &stats.Kills, &stats.Deaths, &stats.Assists, &stats.GoldPerMin, &stats.XPPerMin); err != nil {
 			return nil, err
 		}
+		pm.Stats = stats.toStats(pm.ID, steamID)
+		matches = append(matches, pm)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
 
-		for rows.Next() {
-			var p MatchPlayerInfo
-			var name, avatar sql.NullString
-			if err := rows.Scan(&p.SteamID, &name, &avatar, &p.Team, &p.WasCaptain); err != nil {
-				rows.Close()
-				return nil, err
-			}
-			p.Name = name.String
-			p.AvatarURL = avatar.String
-			if p.Name == "" {
-				p.Name = p.SteamID // Fallback to Steam ID if no name
-			}
-
+	for i := range matches {
+		players, err := s.getMatchPlayerInfos(ctx, matches[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range players {
 			if p.Team == "radiant" {
-				mwp.Radiant = append(mwp.Radiant, p)
-				if p.WasCaptain {
-					captain := p
-					mwp.RadiantCaptain = &captain
-				}
+				matches[i].Radiant = append(matches[i].Radiant, p)
 			} else {
-				mwp.Dire = append(mwp.Dire, p)
-				if p.WasCaptain {
-					captain := p
-					mwp.DireCaptain = &captain
-				}
+				matches[i].Dire = append(matches[i].Dire, p)
 			}
 		}
-		rows.Close()
-
-		result = append(result, mwp)
 	}
+	return matches, nil
+}
 
-	return result, nil
+// nullStats scans the columns of a LEFT JOINed match_player_stats row.
+type nullStats struct {
+	HeroID, Kills, Deaths, Assists, GoldPerMin, XPPerMin sql.NullInt64
 }
 
-// Push Subscription methods
+func (n nullStats) toStats(matchID, steamID string) *MatchPlayerStats {
+	if !n.HeroID.Valid {
+		return nil
+	}
+	return &MatchPlayerStats{
+		MatchID:    matchID,
+		SteamID:    steamID,
+		HeroID:     int(n.HeroID.Int64),
+		Kills:      int(n.Kills.Int64),
+		Deaths:     int(n.Deaths.Int64),
+		Assists:    int(n.Assists.Int64),
+		GoldPerMin: int(n.GoldPerMin.Int64),
+		XPPerMin:   int(n.XPPerMin.Int64),
+	}
+}
 
-func (s *SQLiteStore) SavePushSubscription(ctx context.Context, sub *PushSubscription) error {
+func (s *SQLiteStore) SaveMatchPlayerStats(ctx context.Context, stats *MatchPlayerStats) error {
 	_, err := s.db.ExecContext(ctx,
-		`INSERT INTO push_subscriptions (steam_id, endpoint, p256dh, auth)
-		 VALUES (?, ?, ?, ?)
-		 ON CONFLICT(endpoint) DO UPDATE SET
-		 steam_id = excluded.steam_id,
+		`INSERT INTO match_player_stats (match_id, steam_id, hero_id, kills, deaths, assists, gold_per_min, xp_per_min)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		 ON CONFLICT(match_id, steam_id) DO UPDATE SET
+		 hero_id = excluded.hero_id,
+		 kills = excluded.kills,
+		 deaths = excluded.deaths,
+		 assists = excluded.assists,
+		 gold_per_min = excluded.gold_per_min,
+		 xp_per_min = excluded.xp_per_min`,
+		stats.MatchID, stats.SteamID, stats.HeroID, stats.Kills, stats.Deaths, stats.Assists, stats.GoldPerMin, stats.XPPerMin,
+	)
+	return err
+}
+
+func (s *SQLiteStore) GetAggregateStats(ctx context.Context, startDate, endDate *time.Time) (*AggregateStats, error) {
+	query := `
+		SELECT
+			COUNT(*),
+			COUNT(duration),
+			AVG(duration),
+			MAX(duration),
+			MIN(duration)
+		FROM matches
+		WHERE state = 'completed'
+	`
+	args := []interface{}{}
+
+	if startDate != nil {
+		query += " AND ended_at >= ?"
+		args = append(args, *startDate)
+	}
+	if endDate != nil {
+		query += " AND ended_at <= ?"
+		args = append(args, *endDate)
+	}
+
+	var stats AggregateStats
+	var avg sql.NullFloat64
+	var longest, shortest sql.NullInt64
+	err := s.db.QueryRowContext(ctx, query, args...).Scan(
+		&stats.TotalMatches, &stats.TimedMatches, &avg, &longest, &shortest,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if avg.Valid {
+		v := int(avg.Float64)
+		stats.AvgDuration = &v
+	}
+	if longest.Valid {
+		v := int(longest.Int64)
+		stats.LongestDuration = &v
+	}
+	if shortest.Valid {
+		v := int(shortest.Int64)
+		stats.ShortestDuration = &v
+	}
+	return &stats, nil
+}
+
+func (s *SQLiteStore) GetSideWinRates(ctx context.Context, startDate, endDate *time.Time) (*SideWinRates, error) {
+	query := `
+		SELECT
+			COALESCE(SUM(CASE WHEN winner = 'radiant' THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN winner = 'dire' THEN 1 ELSE 0 END), 0)
+		FROM matches
+		WHERE state = 'completed' AND winner IS NOT NULL
+	`
+	args := []interface{}{}
+
+	if startDate != nil {
+		query += " AND ended_at >= ?"
+		args = append(args, *startDate)
+	}
+	if endDate != nil {
+		query += " AND ended_at <= ?"
+		args = append(args, *endDate)
+	}
+
+	var rates SideWinRates
+	if err := s.db.QueryRowContext(ctx, query, args...).Scan(&rates.RadiantWins, &rates.DireWins); err != nil {
+		return nil, err
+	}
+	return &rates, nil
+}
+
+func (s *SQLiteStore) GetPlayerReliability(ctx context.Context, steamID string, lastN int) (*PlayerReliability, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT mp.accepted
+		FROM match_players mp
+		JOIN matches m ON mp.match_id = m.id
+		WHERE mp.steam_id = ?
+		ORDER BY m.started_at DESC
+		LIMIT ?`, steamID, lastN)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rel PlayerReliability
+	for rows.Next() {
+		var accepted bool
+		if err := rows.Scan(&accepted); err != nil {
+			return nil, err
+		}
+		rel.Matches++
+		if accepted {
+			rel.Accepted++
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if rel.Matches > 0 {
+		rel.Rate = float64(rel.Accepted) / float64(rel.Matches) * 100
+	}
+	return &rel, nil
+}
+
+func (s *SQLiteStore) calculateStreak(ctx context.Context, steamID string, startDate, endDate *time.Time, gameMode string) int {
+	query := `
+		SELECT
+			CASE WHEN m.winner = mp.team THEN 1 ELSE -1 END as result
+		FROM match_players mp
+		JOIN matches m ON mp.match_id = m.id
+		WHERE mp.steam_id = ? AND m.state = 'completed' AND m.winner IS NOT NULL
+	`
+	args := []interface{}{steamID}
+
+	if startDate != nil {
+		query += " AND m.ended_at >= ?"
+		args = append(args, *startDate)
+	}
+	if endDate != nil {
+		query += " AND m.ended_at <= ?"
+		args = append(args, *endDate)
+	}
+	if gameMode != "" {
+		query += " AND m.game_mode = ?"
+		args = append(args, gameMode)
+	}
+
+	query += " ORDER BY m.ended_at DESC"
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return 0
+	}
+	defer rows.Close()
+
+	streak := 0
+	var firstResult int
+	first := true
+
+	for rows.Next() {
+		var result int
+		if err := rows.Scan(&result); err != nil {
+			return 0
+		}
+
+		if first {
+			firstResult = result
+			streak = result
+			first = false
+		} else if result == firstResult {
+			streak += result
+		} else {
+			break // Streak ended
+		}
+	}
+
+	return streak
+}
+
+func (s *SQLiteStore) CountCompletedMatches(ctx context.Context) (int, error) {
+	var count int
+	err := s.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM matches WHERE state = 'completed'`).Scan(&count)
+	return count, err
+}
+
+func (s *SQLiteStore) ListMatchesWithPlayers(ctx context.Context, limit int) ([]MatchWithPlayers, error) {
+	return s.ListMatchesWithPlayersPaged(ctx, limit, 0)
+}
+
+func (s *SQLiteStore) ListMatchesWithPlayersPaged(ctx context.Context, limit, offset int) ([]MatchWithPlayers, error) {
+	matches, err := s.listMatches(ctx, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]MatchWithPlayers, 0, len(matches))
+	for _, m := range matches {
+		mwp := MatchWithPlayers{Match: m}
+
+		players, err := s.getMatchPlayerInfos(ctx, m.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range players {
+			if p.Team == "radiant" {
+				mwp.Radiant = append(mwp.Radiant, p)
+				if p.WasCaptain {
+					captain := p
+					mwp.RadiantCaptain = &captain
+				}
+			} else {
+				mwp.Dire = append(mwp.Dire, p)
+				if p.WasCaptain {
+					captain := p
+					mwp.DireCaptain = &captain
+				}
+			}
+		}
+
+		picks, err := s.GetMatchPicks(ctx, m.ID)
+		if err != nil {
+			return nil, err
+		}
+		mwp.Picks = picks
+
+		result = append(result, mwp)
+	}
+
+	return result, nil
+}
+
+// getMatchPlayerInfos returns a match's players with their names, avatars,
+// and stats where fetched.
+func (s *SQLiteStore) getMatchPlayerInfos(ctx context.Context, matchID string) ([]MatchPlayerInfo, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT mp.steam_id, u.name, u.avatar_url, mp.team, mp.was_captain,
+		        ps.hero_id, ps.kills, ps.deaths, ps.assists, ps.gold_per_min, ps.xp_per_min
+		 FROM match_players mp
+		 LEFT JOIN users u ON mp.steam_id = u.steam_id
+		 LEFT JOIN match_player_stats ps ON ps.match_id = mp.match_id AND ps.steam_id = mp.steam_id
+		 WHERE mp.match_id = ?`, matchID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var players []MatchPlayerInfo
+	for rows.Next() {
+		var p MatchPlayerInfo
+		var name, avatar sql.NullString
+		var stats nullStats
+		if err := rows.Scan(&p.SteamID, &name, &avatar, &p.Team, &p.WasCaptain,
+			&stats.HeroID, &stats.Kills, &stats.Deaths, &stats.Assists, &stats.GoldPerMin, &stats.XPPerMin); err != nil {
+			return nil, err
+		}
+		p.Stats = stats.toStats(matchID, p.SteamID)
+		p.Name = name.String
+		p.AvatarURL = avatar.String
+		if p.Name == "" {
+			p.Name = p.SteamID // Fallback to Steam ID if no name
+		}
+		players = append(players, p)
+	}
+	return players, rows.Err()
+}
+
+// Admin audit log methods
+
+func (s *SQLiteStore) CreateAdminAction(ctx context.Context, action *AdminAction) error {
+	if action.CreatedAt.IsZero() {
+		action.CreatedAt = time.Now()
+	}
+	result, err := s.db.ExecContext(ctx,
+		`INSERT INTO admin_actions (admin_steam_id, action, target, detail, created_at)
+		 VALUES (?, ?, ?, ?, ?)`,
+		action.AdminSteamID, action.Action, action.Target, action.Detail, action.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+	action.ID, _ = result.LastInsertId()
+	return nil
+}
+
+func (s *SQLiteStore) ListAdminActions(ctx context.Context, limit, offset int) ([]AdminAction, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT a.id, a.admin_steam_id, u.name, a.action, a.target, a.detail, a.created_at
+		 FROM admin_actions a
+		 LEFT JOIN users u ON a.admin_steam_id = u.steam_id
+		 ORDER BY a.created_at DESC, a.id DESC
+		 LIMIT ? OFFSET ?`, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var actions []AdminAction
+	for rows.Next() {
+		var a AdminAction
+		var name sql.NullString
+		if err := rows.Scan(&a.ID, &a.AdminSteamID, &name, &a.Action, &a.Target, &a.Detail, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		a.AdminName = name.String
+		if a.AdminName == "" {
+			a.AdminName = a.AdminSteamID
+		}
+		actions = append(actions, a)
+	}
+	return actions, rows.Err()
+}
+
+func (s *SQLiteStore) CountAdminActions(ctx context.Context) (int, error) {
+	var count int
+	err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM admin_actions`).Scan(&count)
+	return count, err
+}
+
+// Ban and allowlist methods
+
+func (s *SQLiteStore) BanUser(ctx context.Context, ban *Ban) error {
+	if ban.CreatedAt.IsZero() {
+		ban.CreatedAt = time.Now()
+	}
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO banned_users (steam_id, reason, banned_by, created_at, expires_at)
+		 VALUES (?, ?, ?, ?, ?)
+		 ON CONFLICT(steam_id) DO UPDATE SET
+		 reason = excluded.reason,
+		 banned_by = excluded.banned_by,
+		 created_at = excluded.created_at,
+		 expires_at = excluded.expires_at`,
+		ban.SteamID, ban.Reason, ban.BannedBy, ban.CreatedAt, ban.ExpiresAt,
+	)
+	return err
+}
+
+func (s *SQLiteStore) UnbanUser(ctx context.Context, steamID string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM banned_users WHERE steam_id = ?`, steamID)
+	return err
+}
+
+func (s *SQLiteStore) GetActiveBan(ctx context.Context, steamID string) (*Ban, error) {
+	var ban Ban
+	err := s.db.QueryRowContext(ctx,
+		`SELECT steam_id, reason, banned_by, created_at, expires_at
+		 FROM banned_users
+		 WHERE steam_id = ? AND (expires_at IS NULL OR expires_at > ?)`,
+		steamID, time.Now()).Scan(
+		&ban.SteamID, &ban.Reason, &ban.BannedBy, &ban.CreatedAt, &ban.ExpiresAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &ban, nil
+}
+
+func (s *SQLiteStore) ListActiveBans(ctx context.Context) ([]Ban, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT b.steam_id, u.name, b.reason, b.banned_by, b.created_at, b.expires_at
+		 FROM banned_users b
+		 LEFT JOIN users u ON b.steam_id = u.steam_id
+		 WHERE b.expires_at IS NULL OR b.expires_at > ?
+		 ORDER BY b.created_at DESC`, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var bans []Ban
+	for rows.Next() {
+		var b Ban
+		var name sql.NullString
+		if err := rows.Scan(&b.SteamID, &name, &b.Reason, &b.BannedBy, &b.CreatedAt, &b.ExpiresAt); err != nil {
+			return nil, err
+		}
+		b.Name = name.String
+		if b.Name == "" {
+			b.Name = b.SteamID
+		}
+		bans = append(bans, b)
+	}
+	return bans, rows.Err()
+}
+
+func (s *SQLiteStore) AllowUser(ctx context.Context, steamID, addedBy string) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO allowed_users (steam_id, added_by, created_at)
+		 VALUES (?, ?, ?)
+		 ON CONFLICT(steam_id) DO NOTHING`,
+		steamID, addedBy, time.Now(),
+	)
+	return err
+}
+
+func (s *SQLiteStore) DisallowUser(ctx context.Context, steamID string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM allowed_users WHERE steam_id = ?`, steamID)
+	return err
+}
+
+func (s *SQLiteStore) IsUserAllowed(ctx context.Context, steamID string) (bool, error) {
+	var count int
+	err := s.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM allowed_users WHERE steam_id = ?`, steamID).Scan(&count)
+	return count > 0, err
+}
+
+func (s *SQLiteStore) ListAllowedUsers(ctx context.Context) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT steam_id FROM allowed_users`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (s *SQLiteStore) RecordFailedAccept(ctx context.Context, steamID string, declined bool) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO player_accept_stats (steam_id, declined, created_at) VALUES (?, ?, ?)`,
+		steamID, declined, time.Now(),
+	)
+	return err
+}
+
+func (s *SQLiteStore) GetAcceptStats(ctx context.Context, steamID string, since time.Time) (*AcceptStats, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT declined, created_at FROM player_accept_stats
+		 WHERE steam_id = ? AND created_at > ?`, steamID, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := &AcceptStats{SteamID: steamID}
+	for rows.Next() {
+		var declined bool
+		var at time.Time
+		if err := rows.Scan(&declined, &at); err != nil {
+			return nil, err
+		}
+		stats.add(declined, at)
+	}
+	return stats, rows.Err()
+}
+
+func (s *SQLiteStore) ListAcceptStats(ctx context.Context, since time.Time) ([]AcceptStats, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT a.steam_id, u.name, a.declined, a.created_at
+		 FROM player_accept_stats a
+		 LEFT JOIN users u ON a.steam_id = u.steam_id
+		 WHERE a.created_at > ?`, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byPlayer := make(map[string]*AcceptStats)
+	for rows.Next() {
+		var steamID string
+		var name sql.NullString
+		var declined bool
+		var at time.Time
+		if err := rows.Scan(&steamID, &name, &declined, &at); err != nil {
+			return nil, err
+		}
+		stats, ok := byPlayer[steamID]
+		if !ok {
+			stats = &AcceptStats{SteamID: steamID, Name: name.String}
+			if stats.Name == "" {
+				stats.Name = steamID
+			}
+			byPlayer[steamID] = stats
+		}
+		stats.add(declined, at)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	list := make([]AcceptStats, 0, len(byPlayer))
+	for _, stats := range byPlayer {
+		list = append(list, *stats)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Failed != list[j].Failed {
+			return list[i].Failed > list[j].Failed
+		}
+		return list[i].LastFailedAt.After(list[j].LastFailedAt)
+	})
+	return list, nil
+}
+
+// Push Subscription methods
+
+func (s *SQLiteStore) SavePushSubscription(ctx context.Context, sub *PushSubscription) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO push_subscriptions (steam_id, endpoint, p256dh, auth)
+		 VALUES (?, ?, ?, ?)
+		 ON CONFLICT(endpoint) DO UPDATE SET
+		 steam_id = excluded.steam_id,
 		 p256dh = excluded.p256dh,
 		 auth = excluded.auth`,
 		sub.SteamID, sub.Endpoint, sub.P256dh, sub.Auth,
@@ -540,3 +1496,109 @@ func (s *SQLiteStore) DeletePushSubscription(ctx context.Context, endpoint strin
 	_, err := s.db.ExecContext(ctx, `DELETE FROM push_subscriptions WHERE endpoint = ?`, endpoint)
 	return err
 }
+
+// Push preference methods
+
+func (s *SQLiteStore) GetPushPreferences(ctx context.Context, steamID string) (*PushPreferences, error) {
+	prefs := &PushPreferences{SteamID: steamID}
+	err := s.db.QueryRowContext(ctx,
+		`SELECT match_found, draft_turn, match_result FROM push_preferences WHERE steam_id = ?`,
+		steamID,
+	).Scan(&prefs.MatchFound, &prefs.DraftTurn, &prefs.MatchResult)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return prefs, nil
+}
+
+func (s *SQLiteStore) SavePushPreferences(ctx context.Context, prefs *PushPreferences) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO push_preferences (steam_id, match_found, draft_turn, match_result)
+		 VALUES (?, ?, ?, ?)
+		 ON CONFLICT(steam_id) DO UPDATE SET
+		 match_found = excluded.match_found,
+		 draft_turn = excluded.draft_turn,
+		 match_result = excluded.match_result`,
+		prefs.SteamID, prefs.MatchFound, prefs.DraftTurn, prefs.MatchResult,
+	)
+	return err
+}
+
+func (s *SQLiteStore) GetEmailSettings(ctx context.Context, steamID string) (*EmailSettings, error) {
+	settings := &EmailSettings{SteamID: steamID}
+	err := s.db.QueryRowContext(ctx,
+		`SELECT email, email_notifications FROM users WHERE steam_id = ?`,
+		steamID,
+	).Scan(&settings.Email, &settings.Enabled)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+func (s *SQLiteStore) SaveEmailSettings(ctx context.Context, settings *EmailSettings) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE users SET email = ?, email_notifications = ?, updated_at = ? WHERE steam_id = ?`,
+		settings.Email, settings.Enabled, time.Now(), settings.SteamID,
+	)
+	return err
+}
+
+func (s *SQLiteStore) GetPreferences(ctx context.Context, steamID string) (*PlayerPreferences, error) {
+	var roles, heroes string
+	err := s.db.QueryRowContext(ctx,
+		`SELECT roles, heroes FROM player_preferences WHERE steam_id = ?`,
+		steamID,
+	).Scan(&roles, &heroes)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &PlayerPreferences{
+		SteamID: steamID,
+		Roles:   parseIntList(roles),
+		Heroes:  parseIntList(heroes),
+	}, nil
+}
+
+func (s *SQLiteStore) SetPreferences(ctx context.Context, prefs *PlayerPreferences) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO player_preferences (steam_id, roles, heroes, updated_at)
+		 VALUES (?, ?, ?, ?)
+		 ON CONFLICT(steam_id) DO UPDATE SET
+		 roles = excluded.roles,
+		 heroes = excluded.heroes,
+		 updated_at = excluded.updated_at`,
+		prefs.SteamID, formatIntList(prefs.Roles), formatIntList(prefs.Heroes), time.Now(),
+	)
+	return err
+}
+
+// formatIntList stores a list of IDs as comma-separated text.
+func formatIntList(ids []int) string {
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = strconv.Itoa(id)
+	}
+	return strings.Join(parts, ",")
+}
+
+// parseIntList reads a list written by formatIntList, skipping anything
+// that isn't a number.
+func parseIntList(s string) []int {
+	var ids []int
+	for _, part := range strings.Split(s, ",") {
+		if id, err := strconv.Atoi(part); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
@@ -0,0 +1,137 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestStore(t *testing.T) *SQLiteStore {
+	t.Helper()
+	s, err := NewSQLiteStore(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// createTestUsers adds n users to the store and returns their Steam IDs.
+func createTestUsers(t *testing.T, s *SQLiteStore, n int) []string {
+	t.Helper()
+	var ids []string
+	for i := 0; i < n; i++ {
+		id := fmt.Sprintf("7656119800000%04d", i)
+		now := time.Now()
+		if err := s.UpsertUser(context.Background(), &User{SteamID: id, Name: id, CreatedAt: now, UpdatedAt: now}); err != nil {
+			t.Fatalf("create user: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func TestRecordCompletedMatchTwice(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t)
+
+	var players []*MatchPlayer
+	for i, id := range createTestUsers(t, s, 4) {
+		team := "radiant"
+		if i%2 == 1 {
+			team = "dire"
+		}
+		players = append(players, &MatchPlayer{MatchID: "match-1", SteamID: id, Team: team, WasCaptain: i < 2, Accepted: true})
+	}
+
+	ended := time.Now()
+	winner := "dire"
+	duration := 1800
+	match := &Match{
+		ID:        "match-1",
+		State:     "completed",
+		StartedAt: ended.Add(-30 * time.Minute),
+		EndedAt:   &ended,
+		Winner:    &winner,
+		Duration:  &duration,
+		GameMode:  "cd",
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := s.RecordCompletedMatch(ctx, match, players); err != nil {
+			t.Fatalf("record %d: %v", i+1, err)
+		}
+	}
+
+	count, err := s.CountCompletedMatches(ctx)
+	if err != nil {
+		t.Fatalf("count matches: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("CountCompletedMatches() = %d, want 1", count)
+	}
+
+	got, err := s.GetMatchPlayers(ctx, "match-1")
+	if err != nil {
+		t.Fatalf("get players: %v", err)
+	}
+	if len(got) != len(players) {
+		t.Errorf("got %d match players, want %d", len(got), len(players))
+	}
+
+	stats, err := s.GetPlayerStats(ctx, players[1].SteamID)
+	if err != nil {
+		t.Fatalf("get stats: %v", err)
+	}
+	if stats.Total != 1 || stats.Wins != 1 {
+		t.Errorf("player stats = %d games, %d wins; want 1 game, 1 win", stats.Total, stats.Wins)
+	}
+}
+
+func TestPlayerEloFollowsMatchChanges(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t)
+	ids := createTestUsers(t, s, 2)
+
+	elo := func() int {
+		t.Helper()
+		r, err := s.GetPlayerElo(ctx, ids[0])
+		if err != nil {
+			t.Fatalf("get elo: %v", err)
+		}
+		return r
+	}
+	if got := elo(); got != eloStart {
+		t.Fatalf("Elo before any match = %d, want %d", got, eloStart)
+	}
+
+	ended := time.Now()
+	winner := "radiant"
+	match := &Match{ID: "match-1", State: "completed", StartedAt: ended.Add(-time.Hour), EndedAt: &ended, Winner: &winner, GameMode: "cd"}
+	players := []*MatchPlayer{
+		{MatchID: "match-1", SteamID: ids[0], Team: "radiant", Accepted: true},
+		{MatchID: "match-1", SteamID: ids[1], Team: "dire", Accepted: true},
+	}
+	if err := s.RecordCompletedMatch(ctx, match, players); err != nil {
+		t.Fatalf("record: %v", err)
+	}
+	if got := elo(); got <= eloStart {
+		t.Errorf("Elo after a win = %d, want above %d", got, eloStart)
+	}
+
+	if err := s.SetMatchWinner(ctx, "match-1", "dire"); err != nil {
+		t.Fatalf("set winner: %v", err)
+	}
+	if got := elo(); got >= eloStart {
+		t.Errorf("Elo after the result flipped to a loss = %d, want below %d", got, eloStart)
+	}
+
+	if err := s.DeleteMatch(ctx, "match-1"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if got := elo(); got != eloStart {
+		t.Errorf("Elo after the match was deleted = %d, want %d", got, eloStart)
+	}
+}
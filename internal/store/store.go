@@ -2,14 +2,20 @@ package store
 
 import (
 	"context"
+	"errors"
 	"time"
 )
 
+// ErrMatchNotFound is returned when deleting a match that isn't recorded.
+var ErrMatchNotFound = errors.New("match not found")
+
 type User struct {
 	SteamID         string
 	Name            string
 	AvatarURL       string
+	AvatarHash      string // Steam's hash of the avatar image; only set by GetStaleUsers
 	CaptainPriority int
+	LastCaptainedAt *time.Time
 	CreatedAt       time.Time
 	UpdatedAt       time.Time
 }
@@ -28,7 +34,8 @@ type Match struct {
 	StartedAt   time.Time
 	EndedAt     *time.Time
 	Winner      *string
-	Duration    *int // Duration in seconds
+	Duration    *int   // Duration in seconds
+	GameMode    string // "cm", "ap", "cd", "rd", "ar", or "" if unknown
 }
 
 type MatchPlayer struct {
@@ -45,31 +52,114 @@ type MatchPlayerInfo struct {
 	AvatarURL  string
 	Team       string
 	WasCaptain bool
+	Stats      *MatchPlayerStats // Nil if details weren't fetched from the Dota API
+}
+
+// MatchPick is one draft pick. Team is "radiant" or "dire"; the names are
+// filled in when reading.
+type MatchPick struct {
+	MatchID     string
+	PickNumber  int
+	CaptainID   string
+	CaptainName string
+	PickedID    string
+	PickedName  string
+	Team        string
+	PickedAt    time.Time
+}
+
+// MatchPlayerStats is a player's in-game performance, from the Dota API.
+type MatchPlayerStats struct {
+	MatchID    string
+	SteamID    string
+	HeroID     int
+	Kills      int
+	Deaths     int
+	Assists    int
+	GoldPerMin int
+	XPPerMin   int
 }
 
 type Store interface {
 	GetUser(ctx context.Context, steamID string) (*User, error)
 	UpsertUser(ctx context.Context, user *User) error
 	ListUsers(ctx context.Context) ([]User, error)
+	// GetStaleUsers returns users with an unexpired session whose profile
+	// was last updated before olderThan, least recently updated first.
+	GetStaleUsers(ctx context.Context, olderThan time.Time) ([]User, error)
 	UpdateCaptainPriority(ctx context.Context, steamID string, priority int) error
+	SetLastCaptained(ctx context.Context, steamID string, at time.Time) error
 
 	CreateSession(ctx context.Context, session *Session) error
 	GetSession(ctx context.Context, sessionID string) (*Session, error)
 	DeleteSession(ctx context.Context, sessionID string) error
+	DeleteSessionsForUser(ctx context.Context, steamID string) error
 	DeleteExpiredSessions(ctx context.Context) error
 
+	// Discord account links
+	GetDiscordLink(ctx context.Context, discordID string) (string, error)
+	LinkDiscord(ctx context.Context, discordID, steamID string) error
+
 	CreateMatch(ctx context.Context, match *Match) error
 	UpdateMatch(ctx context.Context, match *Match) error
 	GetMatch(ctx context.Context, matchID string) (*Match, error)
+	GetMatchByDotaID(ctx context.Context, dotaMatchID uint64) (*Match, error)
 	SetMatchWinner(ctx context.Context, matchID string, winner string) error
+	// DeleteMatch removes a match and everything recorded for it, or
+	// returns ErrMatchNotFound.
+	DeleteMatch(ctx context.Context, matchID string) error
 
+	// AddMatchPlayer adds a player to a match, or updates them if already
+	// added, so recording a match twice is harmless.
 	AddMatchPlayer(ctx context.Context, mp *MatchPlayer) error
+	// RecordCompletedMatch creates or updates a finished match and adds any
+	// of its players not yet recorded, all in one transaction. The start
+	// time of an existing match is kept.
+	RecordCompletedMatch(ctx context.Context, match *Match, players []*MatchPlayer) error
 	GetMatchPlayers(ctx context.Context, matchID string) ([]MatchPlayer, error)
+	AddMatchPick(ctx context.Context, pick *MatchPick) error
+	GetMatchPicks(ctx context.Context, matchID string) ([]MatchPick, error)
 
 	ListMatches(ctx context.Context, limit int) ([]Match, error)
 	ListMatchesWithPlayers(ctx context.Context, limit int) ([]MatchWithPlayers, error)
+	ListMatchesWithPlayersPaged(ctx context.Context, limit, offset int) ([]MatchWithPlayers, error)
+	CountCompletedMatches(ctx context.Context) (int, error)
+
+	GetLeaderboard(ctx context.Context, startDate, endDate *time.Time, gameMode string, minGames int, sortBy LeaderboardSort) ([]LeaderboardEntry, error)
+	GetAggregateStats(ctx context.Context, startDate, endDate *time.Time) (*AggregateStats, error)
+	GetSideWinRates(ctx context.Context, startDate, endDate *time.Time) (*SideWinRates, error)
+	GetPlayerReliability(ctx context.Context, steamID string, lastN int) (*PlayerReliability, error)
+	GetPlayerStats(ctx context.Context, steamID string) (*LeaderboardEntry, error)
+	// GetPlayerElo returns a player's Elo over all completed matches, or the
+	// starting Elo if they haven't played.
+	GetPlayerElo(ctx context.Context, steamID string) (int, error)
+	GetPlayerMatches(ctx context.Context, steamID string, limit int) ([]PlayerMatch, error)
+
+	// Per-player match stats
+	SaveMatchPlayerStats(ctx context.Context, stats *MatchPlayerStats) error
+
+	// Admin audit log
+	CreateAdminAction(ctx context.Context, action *AdminAction) error
+	ListAdminActions(ctx context.Context, limit, offset int) ([]AdminAction, error)
+	CountAdminActions(ctx context.Context) (int, error)
 
-	GetLeaderboard(ctx context.Context, startDate, endDate *time.Time) ([]LeaderboardEntry, error)
+	// Queue bans and allowlist
+	BanUser(ctx context.Context, ban *Ban) error
+	UnbanUser(ctx context.Context, steamID string) error
+	GetActiveBan(ctx context.Context, steamID string) (*Ban, error)
+	ListActiveBans(ctx context.Context) ([]Ban, error)
+	AllowUser(ctx context.Context, steamID, addedBy string) error
+	DisallowUser(ctx context.Context, steamID string) error
+	IsUserAllowed(ctx context.Context, steamID string) (bool, error)
+	ListAllowedUsers(ctx context.Context) ([]string, error)
+
+	// Failed accepts
+	RecordFailedAccept(ctx context.Context, steamID string, declined bool) error
+	// GetAcceptStats counts a player's failed accepts after since.
+	GetAcceptStats(ctx context.Context, steamID string, since time.Time) (*AcceptStats, error)
+	// ListAcceptStats returns every player with a failed accept after since,
+	// most failures first.
+	ListAcceptStats(ctx context.Context, since time.Time) ([]AcceptStats, error)
 
 	// Push subscriptions
 	SavePushSubscription(ctx context.Context, sub *PushSubscription) error
@@ -77,6 +167,25 @@ type Store interface {
 	GetAllPushSubscriptions(ctx context.Context) ([]PushSubscription, error)
 	DeletePushSubscription(ctx context.Context, endpoint string) error
 
+	// Push preferences
+	GetPushPreferences(ctx context.Context, steamID string) (*PushPreferences, error)
+	SavePushPreferences(ctx context.Context, prefs *PushPreferences) error
+
+	// Email notifications
+	GetEmailSettings(ctx context.Context, steamID string) (*EmailSettings, error)
+	SaveEmailSettings(ctx context.Context, settings *EmailSettings) error
+
+	// Role and hero preferences shown to captains
+	GetPreferences(ctx context.Context, steamID string) (*PlayerPreferences, error)
+	SetPreferences(ctx context.Context, prefs *PlayerPreferences) error
+
+	// NextLobbyNumber increments and returns the lobby counter for a day
+	// ("2006-01-02"), starting at 1.
+	NextLobbyNumber(ctx context.Context, day string) (int, error)
+
+	// Ping checks that the database answers queries.
+	Ping(ctx context.Context) error
+
 	Close() error
 }
 
@@ -86,6 +195,7 @@ type MatchWithPlayers struct {
 	Dire           []MatchPlayerInfo
 	RadiantCaptain *MatchPlayerInfo
 	DireCaptain    *MatchPlayerInfo
+	Picks          []MatchPick // Draft order; empty for matches before picks were recorded
 }
 
 type LeaderboardEntry struct {
@@ -97,6 +207,115 @@ type LeaderboardEntry struct {
 	Total     int
 	WinRate   float64
 	Streak    int // Positive = win streak, negative = loss streak
+	Elo       int // Rating from the matches in the leaderboard's period
+}
+
+// LeaderboardSort is the order of the leaderboard.
+type LeaderboardSort string
+
+const (
+	SortNetWins LeaderboardSort = "net" // Wins minus losses, the default
+	SortWinRate LeaderboardSort = "winrate"
+	SortElo     LeaderboardSort = "elo"
+	SortStreak  LeaderboardSort = "streak"
+)
+
+// LeaderboardSorts maps each sort to its display name.
+var LeaderboardSorts = map[LeaderboardSort]string{
+	SortNetWins: "Wins - Losses",
+	SortWinRate: "Win Rate",
+	SortElo:     "Elo",
+	SortStreak:  "Streak",
+}
+
+// AggregateStats summarises the completed matches in a period. Duration
+// figures only cover matches whose duration is known.
+type AggregateStats struct {
+	TotalMatches     int
+	TimedMatches     int  // Matches with a known duration
+	AvgDuration      *int // Seconds; nil if no match has a duration
+	LongestDuration  *int
+	ShortestDuration *int
+}
+
+// SideWinRates counts wins per side over a period.
+type SideWinRates struct {
+	RadiantWins int
+	DireWins    int
+}
+
+// Total is the number of matches with a known winner.
+func (r SideWinRates) Total() int {
+	return r.RadiantWins + r.DireWins
+}
+
+// PlayerMatch is a completed match from one player's point of view.
+type PlayerMatch struct {
+	Match
+	Team       string
+	WasCaptain bool
+	Stats      *MatchPlayerStats
+	Radiant    []MatchPlayerInfo
+	Dire       []MatchPlayerInfo
+}
+
+// Result returns "win", "loss", or "" if the match has no recorded winner.
+func (pm PlayerMatch) Result() string {
+	if pm.Winner == nil {
+		return ""
+	}
+	if *pm.Winner == pm.Team {
+		return "win"
+	}
+	return "loss"
+}
+
+// PlayerReliability is how often a player accepted the matches they were popped into.
+type PlayerReliability struct {
+	Matches  int
+	Accepted int
+	Rate     float64 // Accepted / Matches as a percentage; 0 if no matches
+}
+
+// AdminAction is an audit log entry for an action taken in the admin panel.
+type AdminAction struct {
+	ID           int64
+	AdminSteamID string
+	AdminName    string // Joined from users; not stored
+	Action       string // e.g. "cancel_match", "set_result", "kick_player"
+	Target       string // Match ID, Steam ID, bot name, etc.
+	Detail       string
+	CreatedAt    time.Time
+}
+
+// Ban stops a player from joining the queue until it expires.
+type Ban struct {
+	SteamID   string
+	Name      string // Joined from users; not stored
+	Reason    string
+	BannedBy  string
+	CreatedAt time.Time
+	ExpiresAt *time.Time // Nil for a permanent ban
+}
+
+// AcceptStats counts the matches a player failed to accept, by declining or
+// timing out, within some window.
+type AcceptStats struct {
+	SteamID      string
+	Name         string // Joined from users; not stored
+	Failed       int    // Including declines
+	Declined     int
+	LastFailedAt time.Time
+}
+
+func (a *AcceptStats) add(declined bool, at time.Time) {
+	a.Failed++
+	if declined {
+		a.Declined++
+	}
+	if at.After(a.LastFailedAt) {
+		a.LastFailedAt = at
+	}
 }
 
 type PushSubscription struct {
@@ -107,3 +326,36 @@ type PushSubscription struct {
 	Auth      string
 	CreatedAt time.Time
 }
+
+// PushPreferences controls which push notifications a user receives.
+type PushPreferences struct {
+	SteamID     string `json:"-"`
+	MatchFound  bool   `json:"matchFound"`
+	DraftTurn   bool   `json:"draftTurn"`
+	MatchResult bool   `json:"matchResult"`
+}
+
+// EmailSettings is a user's opt-in to match notifications by email.
+type EmailSettings struct {
+	SteamID string
+	Email   string
+	Enabled bool
+}
+
+// PlayerPreferences are the positions (1-5) and heroes a player would like
+// to play, shown to captains during the draft.
+type PlayerPreferences struct {
+	SteamID string
+	Roles   []int
+	Heroes  []int
+}
+
+// DefaultPushPreferences returns preferences with every notification enabled.
+func DefaultPushPreferences(steamID string) *PushPreferences {
+	return &PushPreferences{
+		SteamID:     steamID,
+		MatchFound:  true,
+		DraftTurn:   true,
+		MatchResult: true,
+	}
+}
@@ -3,13 +3,22 @@ package web
 import (
 	"bufio"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/edvart/dota-inhouse/internal/auth"
+	"github.com/edvart/dota-inhouse/internal/bot"
 	"github.com/edvart/dota-inhouse/internal/coordinator"
+	"github.com/edvart/dota-inhouse/internal/dotaapi"
+	"github.com/edvart/dota-inhouse/internal/steamid"
+	"github.com/edvart/dota-inhouse/internal/store"
 	"github.com/go-chi/chi/v5"
 )
 
@@ -23,15 +32,49 @@ func (s *Server) handleAdminPage(w http.ResponseWriter, r *http.Request) {
 		log.Printf("Failed to list users: %v", err)
 	}
 
+	bans, err := s.store.ListActiveBans(r.Context())
+	if err != nil {
+		log.Printf("Failed to list bans: %v", err)
+	}
+	allowedIDs, err := s.store.ListAllowedUsers(r.Context())
+	if err != nil {
+		log.Printf("Failed to list allowlist: %v", err)
+	}
+	allowed := make(map[string]bool, len(allowedIDs))
+	for _, id := range allowedIDs {
+		allowed[id] = true
+	}
+	acceptStats, err := s.store.ListAcceptStats(r.Context(), time.Now().Add(-coordinator.FailedAcceptWindow))
+	if err != nil {
+		log.Printf("Failed to list failed accepts: %v", err)
+	}
+	failedAccepts := make(map[string]store.AcceptStats, len(acceptStats))
+	for _, a := range acceptStats {
+		failedAccepts[a.SteamID] = a
+	}
+
 	data := map[string]interface{}{
-		"User":           user,
-		"Queue":          queue,
-		"Matches":        matches,
-		"Users":          users,
-		"LobbySettings":  lobbySettings,
-		"ValidGameModes": coordinator.ValidGameModes,
-		"IsAdmin":        true,
-		"LogLines":       s.readLogTail(50),
+		"User":          user,
+		"Queue":         queue,
+		"Queues":        coordinator.QueueConfigs(),
+		"Matches":       matches,
+		"Users":         users,
+		"IsAdmin":       true,
+		"LogLines":      s.readLogTail(50),
+		"Bots":          s.botStatus(),
+		"CSRFToken":     s.sessions.CSRFToken(r),
+		"Bans":          bans,
+		"Allowed":       allowed,
+		"FailedAccepts": failedAccepts,
+		"FailedLimit":   coordinator.FailedAcceptLimit,
+		"FailedWindow":  int(coordinator.FailedAcceptWindow.Hours()),
+		"Allowlist":     s.allowlist.Load(),
+		"QueuePaused":   s.coordinator.QueueStatus().Paused,
+		"CanImport":     s.importer != nil,
+	}
+
+	for k, v := range lobbySettingsData(lobbySettings) {
+		data[k] = v
 	}
 
 	if err := s.templates.ExecuteTemplate(w, "admin.html", data); err != nil {
@@ -39,6 +82,30 @@ func (s *Server) handleAdminPage(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// lobbySettingsData returns what the "lobby-settings-fields" template needs
+// to render settings, on the admin page and over SSE.
+func lobbySettingsData(settings coordinator.LobbySettings) map[string]interface{} {
+	bannedHeroes := make(map[int]bool, len(settings.BannedHeroes))
+	for _, id := range settings.BannedHeroes {
+		bannedHeroes[id] = true
+	}
+	return map[string]interface{}{
+		"LobbySettings":   settings,
+		"ValidGameModes":  coordinator.ValidGameModes,
+		"ValidRegions":    coordinator.ValidServerRegions,
+		"CaptainModes":    coordinator.ValidCaptainSelectionModes,
+		"MaxLobbyNameLen": coordinator.MaxLobbyNameLen,
+		"MaxTeamLabelLen": coordinator.MaxTeamLabelLen,
+		"ValidDelays":     coordinator.ValidSpectatorDelays,
+		"Heroes":          dotaapi.Heroes(),
+		"BannedHeroes":    bannedHeroes,
+		"AcceptLimit":     coordinator.AcceptTimeoutLimit,
+		"DraftPickLimit":  coordinator.DraftPickTimeoutLimit,
+		"LobbyJoinLimit":  coordinator.LobbyJoinTimeoutLimit,
+		"DraftBankLimit":  coordinator.DraftBankTimeLimit,
+	}
+}
+
 // handleAdminCancelMatch cancels a match.
 func (s *Server) handleAdminCancelMatch(w http.ResponseWriter, r *http.Request) {
 	matchID := chi.URLParam(r, "matchID")
@@ -62,6 +129,7 @@ func (s *Server) handleAdminCancelMatch(w http.ResponseWriter, r *http.Request)
 	}
 
 	log.Printf("Admin cancelled match %s (requeue=%v)", matchID[:8], returnToQueue)
+	s.recordAdminAction(r, "cancel_match", matchID, fmt.Sprintf("requeue=%v", returnToQueue))
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -92,6 +160,93 @@ func (s *Server) handleAdminSetResult(w http.ResponseWriter, r *http.Request) {
 	}
 
 	log.Printf("Admin set active match %s result: %s wins", matchID[:8], winner)
+	s.recordAdminAction(r, "set_result", matchID, winner+" wins")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleAdminGameStarted marks a manually hosted match as in progress. The
+// optional dota_match_id form value links it to the Dota 2 match.
+func (s *Server) handleAdminGameStarted(w http.ResponseWriter, r *http.Request) {
+	matchID := chi.URLParam(r, "matchID")
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	var dotaMatchID uint64
+	if v := strings.TrimSpace(r.FormValue("dota_match_id")); v != "" {
+		id, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			http.Error(w, "invalid dota_match_id", http.StatusBadRequest)
+			return
+		}
+		dotaMatchID = id
+	}
+
+	resp := make(chan error, 1)
+	s.coordinator.Send(coordinator.AdminMarkGameStarted{
+		MatchID:     matchID,
+		DotaMatchID: dotaMatchID,
+		Response:    resp,
+	})
+	if err := waitForResponse(resp); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.recordAdminAction(r, "mark_game_started", matchID, strconv.FormatUint(dotaMatchID, 10))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleAdminSwapPlayers swaps two players between teams in an active match.
+func (s *Server) handleAdminSwapPlayers(w http.ResponseWriter, r *http.Request) {
+	matchID := chi.URLParam(r, "matchID")
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	playerA := r.FormValue("player_a")
+	playerB := r.FormValue("player_b")
+	if playerA == "" || playerB == "" {
+		http.Error(w, "player_a and player_b required", http.StatusBadRequest)
+		return
+	}
+
+	resp := make(chan error, 1)
+	s.coordinator.Send(coordinator.AdminSwapPlayers{
+		MatchID:       matchID,
+		PlayerA:       playerA,
+		PlayerB:       playerB,
+		AllowCaptains: r.FormValue("allow_captains") == "on",
+		Response:      resp,
+	})
+
+	if err := waitForResponse(resp); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.recordAdminAction(r, "swap_players", matchID, playerA+" <-> "+playerB)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleAdminShuffleTeams re-splits a match into balanced teams.
+func (s *Server) handleAdminShuffleTeams(w http.ResponseWriter, r *http.Request) {
+	matchID := chi.URLParam(r, "matchID")
+
+	resp := make(chan error, 1)
+	s.coordinator.Send(coordinator.AdminShuffleTeams{
+		MatchID:  matchID,
+		Response: resp,
+	})
+
+	if err := waitForResponse(resp); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.recordAdminAction(r, "shuffle_teams", matchID, "")
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -115,6 +270,122 @@ func (s *Server) handleAdminSetHistoryResult(w http.ResponseWriter, r *http.Requ
 	}
 
 	log.Printf("Admin set history match %s result: %s wins", matchID[:8], winner)
+	s.recordAdminAction(r, "set_history_result", matchID, winner+" wins")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleAdminRefreshMatchDetails fetches a recorded match's details from the
+// Dota API again, updating its winner, duration and player stats, and
+// returns the details as JSON. The dota_match_id form value (or the
+// HX-Prompt header) sets the Dota match ID; without it the recorded one is
+// used.
+func (s *Server) handleAdminRefreshMatchDetails(w http.ResponseWriter, r *http.Request) {
+	if s.importer == nil {
+		http.Error(w, "fetching match details requires a Steam API key", http.StatusNotFound)
+		return
+	}
+	matchID := chi.URLParam(r, "matchID")
+	if matchID == "" {
+		http.Error(w, "match ID required", http.StatusBadRequest)
+		return
+	}
+
+	value := strings.TrimSpace(r.FormValue("dota_match_id"))
+	if value == "" {
+		value = strings.TrimSpace(r.Header.Get("HX-Prompt"))
+	}
+	var dotaMatchID uint64
+	if value != "" {
+		id, err := strconv.ParseUint(value, 10, 64)
+		if err != nil || id == 0 {
+			http.Error(w, "invalid dota_match_id", http.StatusBadRequest)
+			return
+		}
+		dotaMatchID = id
+	}
+
+	details, err := s.importer.RefreshMatchDetails(r.Context(), matchID, dotaMatchID)
+	if err != nil {
+		if errors.Is(err, store.ErrMatchNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.recordAdminAction(r, "refresh_match_details", matchID, fmt.Sprintf("Dota match %d", details.MatchID))
+	writeJSON(w, http.StatusOK, details)
+}
+
+// handleAdminDeleteMatch purges a finished match from history, e.g. a test
+// match. Leaderboard and stats are computed from the remaining matches.
+func (s *Server) handleAdminDeleteMatch(w http.ResponseWriter, r *http.Request) {
+	matchID := chi.URLParam(r, "matchID")
+	if matchID == "" {
+		http.Error(w, "match ID required", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.store.DeleteMatch(r.Context(), matchID); err != nil {
+		if errors.Is(err, store.ErrMatchNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		log.Printf("Failed to delete match %s: %v", matchID, err)
+		http.Error(w, "failed to delete match", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Admin deleted history match %s", matchID)
+	s.recordAdminAction(r, "delete_match", matchID, "")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleAdminRequeueMatch adds every player of a finished match back to the
+// queue, skipping anyone who may not queue.
+func (s *Server) handleAdminRequeueMatch(w http.ResponseWriter, r *http.Request) {
+	matchID := chi.URLParam(r, "matchID")
+	if matchID == "" {
+		http.Error(w, "match ID required", http.StatusBadRequest)
+		return
+	}
+
+	matchPlayers, err := s.store.GetMatchPlayers(r.Context(), matchID)
+	if err != nil {
+		log.Printf("Failed to load players for match %s: %v", matchID, err)
+		http.Error(w, "failed to load match players", http.StatusInternalServerError)
+		return
+	}
+	if len(matchPlayers) == 0 {
+		http.Error(w, "match not found", http.StatusNotFound)
+		return
+	}
+
+	var players []coordinator.Player
+	for _, mp := range matchPlayers {
+		if err := s.checkQueueAccess(r.Context(), mp.SteamID); err != nil {
+			continue
+		}
+		user, err := s.store.GetUser(r.Context(), mp.SteamID)
+		if err != nil || user == nil {
+			continue
+		}
+		players = append(players, s.queuePlayer(r.Context(), user))
+	}
+
+	resp := make(chan error, 1)
+	s.coordinator.Send(coordinator.AdminRequeueMatch{
+		Players:  players,
+		Response: resp,
+	})
+
+	if err := waitForResponse(resp); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.recordAdminAction(r, "requeue_match", matchID, "")
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -138,9 +409,118 @@ func (s *Server) handleAdminKickPlayer(w http.ResponseWriter, r *http.Request) {
 	}
 
 	log.Printf("Admin kicked player %s from queue", playerID)
+	s.recordAdminAction(r, "kick_player", playerID, "")
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// handleAdminForceStart starts a match from the front of the queue before
+// it is full. The optional count form value limits how many players are
+// taken, and skip_accept goes straight to the draft.
+func (s *Server) handleAdminForceStart(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	count := 0
+	if v := r.FormValue("count"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 2 {
+			http.Error(w, "count must be at least 2", http.StatusBadRequest)
+			return
+		}
+		count = n
+	}
+	skipAccept := r.FormValue("skip_accept") == "on"
+	queueID := r.FormValue("queue_id")
+
+	resp := make(chan error, 1)
+	s.coordinator.Send(coordinator.AdminForceStartMatch{
+		QueueID:    queueID,
+		Count:      count,
+		SkipAccept: skipAccept,
+		Response:   resp,
+	})
+
+	if err := waitForResponse(resp); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("Admin force-started a match (queue %q, count %d, skip accept %v)", queueID, count, skipAccept)
+	s.recordAdminAction(r, "force_start", queueID, fmt.Sprintf("count=%d skip_accept=%v", count, skipAccept))
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
+
+// handleAdminImportMatch records a past Dota match for the leaderboard. The
+// optional aliases form value maps Steam IDs seen in the match to the Steam
+// IDs of users here, one "from=to" pair per line; either form of ID works.
+func (s *Server) handleAdminImportMatch(w http.ResponseWriter, r *http.Request) {
+	if s.importer == nil {
+		http.Error(w, "importing requires a Steam API key", http.StatusNotFound)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	dotaMatchID, err := strconv.ParseUint(strings.TrimSpace(r.FormValue("dota_match_id")), 10, 64)
+	if err != nil || dotaMatchID == 0 {
+		http.Error(w, "invalid dota_match_id", http.StatusBadRequest)
+		return
+	}
+
+	aliases := make(map[string]string)
+	for _, line := range strings.Split(r.FormValue("aliases"), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		from, to, ok := strings.Cut(line, "=")
+		if !ok {
+			http.Error(w, fmt.Sprintf("invalid alias %q (must be from=to)", line), http.StatusBadRequest)
+			return
+		}
+		fromID, err := steamid.Normalize(strings.TrimSpace(from))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		toID, err := steamid.Normalize(strings.TrimSpace(to))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		aliases[fromID] = toID
+	}
+
+	result, err := s.importer.ImportMatch(r.Context(), dotaMatchID, aliases)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	detail := fmt.Sprintf("Dota match %d, %d players, %d skipped", dotaMatchID, result.Players, len(result.Skipped))
+	log.Printf("Admin imported %s", detail)
+	s.recordAdminAction(r, "import_match", result.MatchID, detail)
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
+
+// handleAdminPauseQueue stops new matches from starting.
+func (s *Server) handleAdminPauseQueue(w http.ResponseWriter, r *http.Request) {
+	s.coordinator.Send(coordinator.AdminPauseQueue{})
+	s.recordAdminAction(r, "pause_queue", "", "")
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
+
+// handleAdminResumeQueue lets matches start again.
+func (s *Server) handleAdminResumeQueue(w http.ResponseWriter, r *http.Request) {
+	s.coordinator.Send(coordinator.AdminResumeQueue{})
+	s.recordAdminAction(r, "resume_queue", "", "")
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
+
 // handleAdminSetCaptainPriority updates a player's captain priority.
 func (s *Server) handleAdminSetCaptainPriority(w http.ResponseWriter, r *http.Request) {
 	playerID := chi.URLParam(r, "playerID")
@@ -160,6 +540,7 @@ func (s *Server) handleAdminSetCaptainPriority(w http.ResponseWriter, r *http.Re
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	s.recordAdminAction(r, "set_captain_priority", playerID, strconv.Itoa(priority))
 
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -177,11 +558,77 @@ func (s *Server) handleAdminSetLobbySettings(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	spectatorDelay, err := strconv.Atoi(r.FormValue("spectator_delay"))
+	if err != nil {
+		http.Error(w, "invalid spectator_delay", http.StatusBadRequest)
+		return
+	}
+
+	var timeouts [4]int
+	for i, field := range []string{"accept_timeout", "draft_pick_timeout", "lobby_join_timeout", "draft_bank_time"} {
+		timeouts[i], err = strconv.Atoi(r.FormValue(field))
+		if err != nil {
+			http.Error(w, "invalid "+field, http.StatusBadRequest)
+			return
+		}
+	}
+
+	minCaptainPriority, err := strconv.Atoi(r.FormValue("min_captain_priority"))
+	if err != nil {
+		http.Error(w, "invalid min_captain_priority", http.StatusBadRequest)
+		return
+	}
+
+	minAcceptPercent := 100
+	if v := r.FormValue("min_accept_percent"); v != "" {
+		minAcceptPercent, err = strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "invalid min_accept_percent", http.StatusBadRequest)
+			return
+		}
+	}
+
+	var bannedHeroes []int
+	seen := make(map[int]bool)
+	for _, v := range r.Form["banned_heroes"] {
+		id, err := strconv.Atoi(v)
+		if err != nil || !dotaapi.IsHero(id) {
+			http.Error(w, "unknown hero ID "+v, http.StatusBadRequest)
+			return
+		}
+		if !seen[id] {
+			seen[id] = true
+			bannedHeroes = append(bannedHeroes, id)
+		}
+	}
+	sort.Ints(bannedHeroes)
+
+	settings := coordinator.LobbySettings{
+		GameMode:             gameMode,
+		ServerRegion:         r.FormValue("server_region"),
+		KickStrangers:        r.FormValue("kick_strangers") == "on",
+		Tournament:           r.FormValue("tournament") == "on",
+		SpectatorDelay:       spectatorDelay,
+		AcceptTimeout:        timeouts[0],
+		DraftPickTimeout:     timeouts[1],
+		LobbyJoinTimeout:     timeouts[2],
+		DraftBankTime:        timeouts[3],
+		CaptainDecay:         r.FormValue("captain_decay") == "on",
+		MinCaptainPriority:   minCaptainPriority,
+		CaptainSelectionMode: r.FormValue("captain_selection_mode"),
+		RequeueTimedOut:      r.FormValue("requeue_timed_out") == "on",
+		MinAcceptPercent:     minAcceptPercent,
+		AutoBalance:          r.FormValue("auto_balance") == "on",
+		LobbyNameTemplate:    strings.TrimSpace(r.FormValue("lobby_name_template")),
+		CommunityName:        strings.TrimSpace(r.FormValue("community_name")),
+		RadiantLabel:         strings.TrimSpace(r.FormValue("radiant_label")),
+		DireLabel:            strings.TrimSpace(r.FormValue("dire_label")),
+		BannedHeroes:         bannedHeroes,
+	}
+
 	resp := make(chan error, 1)
 	s.coordinator.Send(coordinator.AdminSetLobbySettings{
-		Settings: coordinator.LobbySettings{
-			GameMode: gameMode,
-		},
+		Settings: settings,
 		Response: resp,
 	})
 
@@ -189,10 +636,67 @@ func (s *Server) handleAdminSetLobbySettings(w http.ResponseWriter, r *http.Requ
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	s.recordAdminAction(r, "update_settings", "", fmt.Sprintf("%+v", settings))
 
 	http.Redirect(w, r, "/admin", http.StatusSeeOther)
 }
 
+// handleAdminBroadcast shows an announcement banner to every connected client.
+func (s *Server) handleAdminBroadcast(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	message := strings.TrimSpace(r.FormValue("message"))
+	if message == "" {
+		http.Error(w, "message required", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.sse.Announce(message); err != nil {
+		log.Printf("Failed to broadcast announcement: %v", err)
+		http.Error(w, "failed to broadcast", http.StatusInternalServerError)
+		return
+	}
+	s.recordAdminAction(r, "broadcast", "", message)
+
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
+
+func (s *Server) botStatus() []bot.Status {
+	if s.bots == nil {
+		return nil
+	}
+	return s.bots.Status()
+}
+
+// handleAdminBots returns the status of every bot as JSON.
+func (s *Server) handleAdminBots(w http.ResponseWriter, r *http.Request) {
+	statuses := s.botStatus()
+	if statuses == nil {
+		statuses = []bot.Status{}
+	}
+	writeJSON(w, http.StatusOK, statuses)
+}
+
+// handleAdminForceFreeBot releases a bot stuck in a lobby.
+func (s *Server) handleAdminForceFreeBot(w http.ResponseWriter, r *http.Request) {
+	if s.bots == nil {
+		http.Error(w, "no bots configured", http.StatusBadRequest)
+		return
+	}
+
+	name := chi.URLParam(r, "name")
+	if err := s.bots.ForceFreeBot(name); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.recordAdminAction(r, "force_free_bot", name, "")
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
 // handleAdminLogs renders the last N lines of the log file.
 func (s *Server) handleAdminLogs(w http.ResponseWriter, r *http.Request) {
 	user := auth.UserFromContext(r.Context())
@@ -216,6 +720,65 @@ func (s *Server) handleAdminLogs(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// recordAdminAction writes an entry to the admin audit log. Failures are
+// logged but don't fail the request, since the action has already happened.
+func (s *Server) recordAdminAction(r *http.Request, action, target, detail string) {
+	user := auth.UserFromContext(r.Context())
+	if user == nil {
+		return
+	}
+
+	err := s.store.CreateAdminAction(r.Context(), &store.AdminAction{
+		AdminSteamID: user.SteamID,
+		Action:       action,
+		Target:       target,
+		Detail:       detail,
+	})
+	if err != nil {
+		log.Printf("Failed to record admin action %s: %v", action, err)
+	}
+}
+
+const auditPerPage = 50
+
+// handleAdminAudit renders the admin audit log.
+func (s *Server) handleAdminAudit(w http.ResponseWriter, r *http.Request) {
+	user := auth.UserFromContext(r.Context())
+
+	page := 1
+	if n, err := strconv.Atoi(r.URL.Query().Get("page")); err == nil && n > 0 {
+		page = n
+	}
+
+	total, err := s.store.CountAdminActions(r.Context())
+	if err != nil {
+		log.Printf("Failed to count admin actions: %v", err)
+		http.Error(w, "Failed to load audit log", http.StatusInternalServerError)
+		return
+	}
+	totalPages := max((total+auditPerPage-1)/auditPerPage, 1)
+	page = min(page, totalPages)
+
+	actions, err := s.store.ListAdminActions(r.Context(), auditPerPage, (page-1)*auditPerPage)
+	if err != nil {
+		log.Printf("Failed to list admin actions: %v", err)
+		http.Error(w, "Failed to load audit log", http.StatusInternalServerError)
+		return
+	}
+
+	data := map[string]interface{}{
+		"User":       user,
+		"Actions":    actions,
+		"Page":       page,
+		"TotalPages": totalPages,
+	}
+
+	if err := s.templates.ExecuteTemplate(w, "admin-audit.html", data); err != nil {
+		log.Printf("Template error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
 // readLogTail returns the last n lines from the log file.
 func (s *Server) readLogTail(n int) []string {
 	if s.logPath == "" {
@@ -246,6 +809,7 @@ func (s *Server) handleAdminState(w http.ResponseWriter, r *http.Request) {
 	for id, m := range matches {
 		matchList = append(matchList, map[string]interface{}{
 			"id":          id,
+			"queueId":     m.QueueID,
 			"state":       m.State.String(),
 			"players":     m.Players,
 			"radiant":     m.Radiant,
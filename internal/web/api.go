@@ -0,0 +1,198 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/edvart/dota-inhouse/internal/coordinator"
+	"github.com/edvart/dota-inhouse/internal/steamid"
+	"github.com/go-chi/chi/v5"
+)
+
+// apiPlayer is the public view of a player. It only exposes what is already
+// visible on the index page (no captain priority).
+type apiPlayer struct {
+	SteamID   string `json:"steamId"`
+	Name      string `json:"name"`
+	AvatarURL string `json:"avatarUrl"`
+}
+
+// apiQueue is the public view of one named queue.
+type apiQueue struct {
+	ID         string      `json:"id"`
+	Name       string      `json:"name"`
+	MaxPlayers int         `json:"maxPlayers"`
+	Players    []apiPlayer `json:"players"`
+}
+
+// apiMatch is the public view of an active match.
+type apiMatch struct {
+	ID            string      `json:"id"`
+	State         string      `json:"state"`
+	Players       []apiPlayer `json:"players"`
+	Captains      []apiPlayer `json:"captains,omitempty"`
+	Radiant       []apiPlayer `json:"radiant"`
+	Dire          []apiPlayer `json:"dire"`
+	Available     []apiPlayer `json:"available"`
+	CurrentPicker int         `json:"currentPicker"`
+	AcceptedCount int         `json:"acceptedCount"`
+	Deadline      *time.Time  `json:"deadline,omitempty"`
+	DotaMatchID   uint64      `json:"dotaMatchId,omitempty"`
+}
+
+func toAPIPlayer(p coordinator.Player) apiPlayer {
+	return apiPlayer{
+		SteamID:   p.SteamID,
+		Name:      p.Name,
+		AvatarURL: p.AvatarURL,
+	}
+}
+
+func toAPIPlayers(players []coordinator.Player) []apiPlayer {
+	result := make([]apiPlayer, 0, len(players))
+	for _, p := range players {
+		result = append(result, toAPIPlayer(p))
+	}
+	return result
+}
+
+func toAPIMatch(m *coordinator.Match) apiMatch {
+	am := apiMatch{
+		ID:            m.ID,
+		State:         m.State.String(),
+		Players:       toAPIPlayers(m.Players),
+		Radiant:       toAPIPlayers(m.Radiant),
+		Dire:          toAPIPlayers(m.Dire),
+		Available:     toAPIPlayers(m.AvailablePlayers),
+		CurrentPicker: m.CurrentPicker,
+		AcceptedCount: len(m.AcceptedPlayers),
+		DotaMatchID:   m.DotaMatchID,
+	}
+
+	if m.State != coordinator.MatchStateAccepting {
+		am.Captains = toAPIPlayers(m.Captains[:])
+	}
+
+	var deadline time.Time
+	switch m.State {
+	case coordinator.MatchStateAccepting:
+		deadline = m.AcceptDeadline
+	case coordinator.MatchStateDrafting:
+		deadline = m.PickDeadline
+	case coordinator.MatchStateWaitingForBot:
+		deadline = m.LobbyDeadline
+	}
+	if !deadline.IsZero() {
+		am.Deadline = &deadline
+	}
+
+	return am
+}
+
+// writeJSON writes v as a JSON response with the given status code.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// handleAPIQueue returns the current queues as JSON. The top-level players
+// and size cover every queue, for clients from before queues were named.
+func (s *Server) handleAPIQueue(w http.ResponseWriter, r *http.Request) {
+	status := s.coordinator.QueueStatus()
+
+	var queue []coordinator.Player
+	queues := make([]apiQueue, 0, len(status.Queues))
+	for _, q := range status.Queues {
+		queue = append(queue, q.Players...)
+		queues = append(queues, apiQueue{
+			ID:         q.ID,
+			Name:       q.Name,
+			MaxPlayers: q.MaxPlayers,
+			Players:    toAPIPlayers(q.Players),
+		})
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"players":      toAPIPlayers(queue),
+		"size":         len(queue),
+		"maxPlayers":   coordinator.MaxPlayers,
+		"maxQueueSize": coordinator.MaxQueueSize,
+		"queues":       queues,
+	})
+}
+
+// handleAPIMatches returns all active matches as JSON.
+func (s *Server) handleAPIMatches(w http.ResponseWriter, r *http.Request) {
+	_, matches, _ := s.coordinator.GetState()
+
+	result := make([]apiMatch, 0, len(matches))
+	for _, m := range matches {
+		result = append(result, toAPIMatch(m))
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID < result[j].ID
+	})
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+// handleAPIMatch returns a single active match as JSON.
+func (s *Server) handleAPIMatch(w http.ResponseWriter, r *http.Request) {
+	matchID := chi.URLParam(r, "matchID")
+
+	_, matches, _ := s.coordinator.GetState()
+	match, ok := matches[matchID]
+	if !ok || match == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "match not found"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, toAPIMatch(match))
+}
+
+// apiPlayerStatus is what a player is currently doing: "in_match",
+// "in_queue" or "idle".
+type apiPlayerStatus struct {
+	State      string `json:"state"`
+	MatchID    string `json:"matchId,omitempty"`
+	MatchState string `json:"matchState,omitempty"`
+	QueueID    string `json:"queueId,omitempty"`
+}
+
+// handleAPIPlayerStatus returns whether a player is in a match, in the queue
+// or idle as JSON.
+func (s *Server) handleAPIPlayerStatus(w http.ResponseWriter, r *http.Request) {
+	steamID, err := steamid.Normalize(chi.URLParam(r, "steamID"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	if match := s.coordinator.GetPlayerMatch(steamID); match != nil {
+		writeJSON(w, http.StatusOK, apiPlayerStatus{
+			State:      "in_match",
+			MatchID:    match.ID,
+			MatchState: match.State.String(),
+		})
+		return
+	}
+
+	queue, _, _ := s.coordinator.GetState()
+	for _, p := range queue {
+		if p.SteamID == steamID {
+			writeJSON(w, http.StatusOK, apiPlayerStatus{State: "in_queue", QueueID: p.QueueID})
+			return
+		}
+	}
+
+	writeJSON(w, http.StatusOK, apiPlayerStatus{State: "idle"})
+}
+
+// handleCSRFToken returns the caller's CSRF token for scripts that can't read
+// it from the page, such as the service worker.
+func (s *Server) handleCSRFToken(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"token": s.sessions.CSRFToken(r)})
+}
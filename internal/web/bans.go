@@ -0,0 +1,225 @@
+package web
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/edvart/dota-inhouse/internal/auth"
+	"github.com/edvart/dota-inhouse/internal/coordinator"
+	"github.com/edvart/dota-inhouse/internal/steamid"
+	"github.com/edvart/dota-inhouse/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+// checkQueueAccess returns an error explaining why a player may not queue,
+// or nil if they may.
+func (s *Server) checkQueueAccess(ctx context.Context, steamID string) error {
+	ban, err := s.store.GetActiveBan(ctx, steamID)
+	if err != nil {
+		log.Printf("Failed to check ban for %s: %v", steamID, err)
+		return fmt.Errorf("failed to check queue access")
+	}
+	if ban != nil {
+		msg := "you are banned from the queue"
+		if ban.ExpiresAt != nil {
+			msg += " until " + ban.ExpiresAt.Format("2006-01-02 15:04")
+		}
+		if ban.Reason != "" {
+			msg += ": " + ban.Reason
+		}
+		return fmt.Errorf("%s", msg)
+	}
+
+	if coordinator.FailedAcceptLimit > 0 {
+		stats, err := s.store.GetAcceptStats(ctx, steamID, time.Now().Add(-coordinator.FailedAcceptWindow))
+		if err != nil {
+			log.Printf("Failed to check failed accepts for %s: %v", steamID, err)
+			return fmt.Errorf("failed to check queue access")
+		}
+		if stats.Failed >= coordinator.FailedAcceptLimit {
+			until := stats.LastFailedAt.Add(coordinator.FailedAcceptCooldown)
+			if time.Now().Before(until) {
+				return fmt.Errorf("you failed to accept %d matches recently and can queue again at %s",
+					stats.Failed, until.Format("15:04"))
+			}
+		}
+	}
+
+	if !s.allowlist.Load() || s.adminConfig.IsAdmin(steamID) {
+		return nil
+	}
+	allowed, err := s.store.IsUserAllowed(ctx, steamID)
+	if err != nil {
+		log.Printf("Failed to check allowlist for %s: %v", steamID, err)
+		return fmt.Errorf("failed to check queue access")
+	}
+	if !allowed {
+		return fmt.Errorf("the queue is restricted to approved players")
+	}
+	return nil
+}
+
+// queuePriority returns the captain priority a user queues with, capped for
+// players who haven't played many games yet.
+func (s *Server) queuePriority(ctx context.Context, user *store.User) int {
+	if coordinator.NewPlayerGames <= 0 {
+		return user.CaptainPriority
+	}
+	stats, err := s.store.GetPlayerStats(ctx, user.SteamID)
+	if err != nil {
+		log.Printf("Failed to get games played for %s: %v", user.SteamID, err)
+		return user.CaptainPriority
+	}
+	games := 0
+	if stats != nil {
+		games = stats.Total
+	}
+	return coordinator.QueuePriority(user.CaptainPriority, games)
+}
+
+// handleAdminBan bans a player from queueing and kicks them from the queue.
+// The optional expires_hours form value makes the ban temporary.
+func (s *Server) handleAdminBan(w http.ResponseWriter, r *http.Request) {
+	steamID, err := steamid.Normalize(chi.URLParam(r, "steamID"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	admin := auth.UserFromContext(r.Context())
+	ban := &store.Ban{
+		SteamID:  steamID,
+		Reason:   strings.TrimSpace(r.FormValue("reason")),
+		BannedBy: admin.SteamID,
+	}
+	if v := r.FormValue("expires_hours"); v != "" {
+		hours, err := strconv.Atoi(v)
+		if err != nil || hours <= 0 {
+			http.Error(w, "expires_hours must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		expires := time.Now().Add(time.Duration(hours) * time.Hour)
+		ban.ExpiresAt = &expires
+	}
+
+	if err := s.store.BanUser(r.Context(), ban); err != nil {
+		log.Printf("Failed to ban %s: %v", steamID, err)
+		http.Error(w, "failed to ban player", http.StatusInternalServerError)
+		return
+	}
+
+	// Not being in the queue is fine; the ban still stops them rejoining.
+	resp := make(chan error, 1)
+	s.coordinator.Send(coordinator.AdminKickFromQueue{
+		PlayerID: steamID,
+		Response: resp,
+	})
+	waitForResponse(resp)
+
+	log.Printf("Admin banned player %s", steamID)
+	s.recordAdminAction(r, "ban_player", steamID, ban.Reason)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleAdminUnban lifts a player's ban.
+func (s *Server) handleAdminUnban(w http.ResponseWriter, r *http.Request) {
+	steamID, err := steamid.Normalize(chi.URLParam(r, "steamID"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := s.store.UnbanUser(r.Context(), steamID); err != nil {
+		log.Printf("Failed to unban %s: %v", steamID, err)
+		http.Error(w, "failed to unban player", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Admin unbanned player %s", steamID)
+	s.recordAdminAction(r, "unban_player", steamID, "")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleAdminAllow adds a player to the queue allowlist.
+func (s *Server) handleAdminAllow(w http.ResponseWriter, r *http.Request) {
+	steamID, err := steamid.Normalize(chi.URLParam(r, "steamID"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	admin := auth.UserFromContext(r.Context())
+	if err := s.store.AllowUser(r.Context(), steamID, admin.SteamID); err != nil {
+		log.Printf("Failed to allowlist %s: %v", steamID, err)
+		http.Error(w, "failed to allow player", http.StatusInternalServerError)
+		return
+	}
+
+	s.recordAdminAction(r, "allow_player", steamID, "")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleAdminDisallow removes a player from the queue allowlist.
+func (s *Server) handleAdminDisallow(w http.ResponseWriter, r *http.Request) {
+	steamID, err := steamid.Normalize(chi.URLParam(r, "steamID"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := s.store.DisallowUser(r.Context(), steamID); err != nil {
+		log.Printf("Failed to remove %s from allowlist: %v", steamID, err)
+		http.Error(w, "failed to disallow player", http.StatusInternalServerError)
+		return
+	}
+
+	s.recordAdminAction(r, "disallow_player", steamID, "")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleAdminSetAllowlist turns allowlist mode on or off.
+func (s *Server) handleAdminSetAllowlist(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	enabled := r.FormValue("enabled") == "on"
+	s.allowlist.Store(enabled)
+	log.Printf("Admin set queue allowlist mode to %v", enabled)
+	s.recordAdminAction(r, "set_allowlist", "", strconv.FormatBool(enabled))
+
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
+
+// queuePlayer builds the queue entry for a user, with their captain priority,
+// Elo and draft preferences.
+func (s *Server) queuePlayer(ctx context.Context, user *store.User) coordinator.Player {
+	player := coordinator.Player{
+		SteamID:         user.SteamID,
+		Name:            user.Name,
+		AvatarURL:       user.AvatarURL,
+		CaptainPriority: s.queuePriority(ctx, user),
+		LastCaptainedAt: user.LastCaptainedAt,
+	}
+	if elo, err := s.store.GetPlayerElo(ctx, user.SteamID); err != nil {
+		log.Printf("Failed to get Elo for %s: %v", user.SteamID, err)
+	} else {
+		player.Rating = elo
+	}
+	prefs, err := s.store.GetPreferences(ctx, user.SteamID)
+	if err != nil {
+		log.Printf("Failed to get preferences for %s: %v", user.SteamID, err)
+	}
+	if prefs != nil {
+		player.PreferredRoles = prefs.Roles
+		player.PreferredHeroes = prefs.Heroes
+	}
+	return player
+}
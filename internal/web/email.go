@@ -0,0 +1,54 @@
+package web
+
+import (
+	"log"
+	"net/http"
+	"net/mail"
+	"strings"
+
+	"github.com/edvart/dota-inhouse/internal/auth"
+	"github.com/edvart/dota-inhouse/internal/store"
+)
+
+// handleSaveEmailSettings updates the current user's email address and
+// whether they want match notifications sent to it.
+func (s *Server) handleSaveEmailSettings(w http.ResponseWriter, r *http.Request) {
+	user := auth.UserFromContext(r.Context())
+	if user == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if !s.email {
+		http.Error(w, "email notifications are not configured", http.StatusNotFound)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	settings := &store.EmailSettings{
+		SteamID: user.SteamID,
+		Email:   strings.TrimSpace(r.FormValue("email")),
+		Enabled: r.FormValue("enabled") == "on",
+	}
+	if settings.Email != "" {
+		// Only a bare address is accepted, so it can't smuggle in headers
+		addr, err := mail.ParseAddress(settings.Email)
+		if err != nil || addr.Address != settings.Email {
+			http.Error(w, "invalid email address", http.StatusBadRequest)
+			return
+		}
+	} else if settings.Enabled {
+		http.Error(w, "an email address is required to enable notifications", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.store.SaveEmailSettings(r.Context(), settings); err != nil {
+		log.Printf("Failed to save email settings for %s: %v", user.SteamID, err)
+		http.Error(w, "failed to save email settings", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/player/"+user.SteamID, http.StatusSeeOther)
+}
@@ -0,0 +1,188 @@
+package web
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/edvart/dota-inhouse/internal/store"
+)
+
+// exportPageSize is how many matches are read from the store at a time
+// while exporting, so a large history is streamed instead of loaded whole.
+const exportPageSize = 100
+
+// exportColumns are the CSV columns, one row per player per match.
+var exportColumns = []string{
+	"match_id", "dota_match_id", "ended_at", "duration", "winner",
+	"steam_id", "name", "team", "was_captain",
+}
+
+// exportMatch is one completed match in the JSON export.
+type exportMatch struct {
+	MatchID     string         `json:"match_id"`
+	DotaMatchID uint64         `json:"dota_match_id,omitempty"`
+	EndedAt     *time.Time     `json:"ended_at"`
+	Duration    *int           `json:"duration"` // Seconds; null if unknown
+	Winner      *string        `json:"winner"`
+	Players     []exportPlayer `json:"players"`
+}
+
+type exportPlayer struct {
+	SteamID    string `json:"steam_id"`
+	Name       string `json:"name"`
+	Team       string `json:"team"`
+	WasCaptain bool   `json:"was_captain"`
+}
+
+// handleAdminExport downloads every completed match with its players, as
+// CSV (the default) or JSON depending on the format query parameter.
+func (s *Server) handleAdminExport(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "json" {
+		http.Error(w, "format must be 'csv' or 'json'", http.StatusBadRequest)
+		return
+	}
+
+	filename := "matches-" + time.Now().Format("2006-01-02") + "." + format
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+	var err error
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		err = s.exportCSV(r.Context(), w)
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+		err = s.exportJSON(r.Context(), w)
+	}
+	if err != nil {
+		// The response may have started, so the download is just cut short.
+		log.Printf("Failed to export matches: %v", err)
+		return
+	}
+
+	s.recordAdminAction(r, "export_matches", "", format)
+}
+
+func (s *Server) exportCSV(ctx context.Context, w http.ResponseWriter) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(exportColumns); err != nil {
+		return err
+	}
+
+	err := s.forEachCompletedMatch(ctx, func(m store.MatchWithPlayers) error {
+		em := toExportMatch(m)
+		dotaMatchID, endedAt, duration, winner := "", "", "", ""
+		if em.DotaMatchID != 0 {
+			dotaMatchID = strconv.FormatUint(em.DotaMatchID, 10)
+		}
+		if em.EndedAt != nil {
+			endedAt = em.EndedAt.UTC().Format(time.RFC3339)
+		}
+		if em.Duration != nil {
+			duration = strconv.Itoa(*em.Duration)
+		}
+		if em.Winner != nil {
+			winner = *em.Winner
+		}
+		for _, p := range em.Players {
+			if err := cw.Write([]string{
+				em.MatchID, dotaMatchID, endedAt, duration, winner,
+				p.SteamID, csvSafe(p.Name), p.Team, strconv.FormatBool(p.WasCaptain),
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	cw.Flush()
+	if err != nil {
+		return err
+	}
+	return cw.Error()
+}
+
+// csvSafe keeps a user-controlled cell from being run as a formula when the
+// export is opened in a spreadsheet, by prefixing a quote to cells that
+// start like one.
+func csvSafe(cell string) string {
+	if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+		return "'" + cell
+	}
+	return cell
+}
+
+// exportJSON writes a JSON array of matches, encoding one match at a time.
+func (s *Server) exportJSON(ctx context.Context, w http.ResponseWriter) error {
+	if _, err := w.Write([]byte("[\n")); err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+	first := true
+	err := s.forEachCompletedMatch(ctx, func(m store.MatchWithPlayers) error {
+		if !first {
+			if _, err := w.Write([]byte(",")); err != nil {
+				return err
+			}
+		}
+		first = false
+		return enc.Encode(toExportMatch(m))
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write([]byte("]\n"))
+	return err
+}
+
+// forEachCompletedMatch calls fn for every completed match, newest first,
+// reading exportPageSize matches at a time. Matches that finish while it
+// runs shift the pages, so one may occasionally be repeated.
+func (s *Server) forEachCompletedMatch(ctx context.Context, fn func(store.MatchWithPlayers) error) error {
+	for offset := 0; ; offset += exportPageSize {
+		matches, err := s.store.ListMatchesWithPlayersPaged(ctx, exportPageSize, offset)
+		if err != nil {
+			return err
+		}
+		for _, m := range matches {
+			if err := fn(m); err != nil {
+				return err
+			}
+		}
+		if len(matches) < exportPageSize {
+			return nil
+		}
+	}
+}
+
+func toExportMatch(m store.MatchWithPlayers) exportMatch {
+	em := exportMatch{
+		MatchID:     m.ID,
+		DotaMatchID: m.DotaMatchID,
+		EndedAt:     m.EndedAt,
+		Duration:    m.Duration,
+		Winner:      m.Winner,
+		Players:     make([]exportPlayer, 0, len(m.Radiant)+len(m.Dire)),
+	}
+	for _, team := range [][]store.MatchPlayerInfo{m.Radiant, m.Dire} {
+		for _, p := range team {
+			em.Players = append(em.Players, exportPlayer{
+				SteamID:    p.SteamID,
+				Name:       p.Name,
+				Team:       p.Team,
+				WasCaptain: p.WasCaptain,
+			})
+		}
+	}
+	return em
+}
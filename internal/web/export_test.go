@@ -0,0 +1,24 @@
+package web
+
+import "testing"
+
+func TestCSVSafe(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"", ""},
+		{"Player One", "Player One"},
+		{"a=b", "a=b"},
+		{`=HYPERLINK("http://example.com","click")`, `'=HYPERLINK("http://example.com","click")`},
+		{"+1+1", "'+1+1"},
+		{"-2+3", "'-2+3"},
+		{"@SUM(A1)", "'@SUM(A1)"},
+		{"\t=1", "'\t=1"},
+		{"\r=1", "'\r=1"},
+	}
+	for _, tt := range tests {
+		if got := csvSafe(tt.in); got != tt.want {
+			t.Errorf("csvSafe(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -1,9 +1,11 @@
 package web
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -24,26 +26,61 @@ func waitForResponse(resp <-chan error) error {
 	}
 }
 
+// queueVersion returns the queue version the client acted on, or 0 if it
+// didn't send one.
+func queueVersion(r *http.Request) int {
+	v, _ := strconv.Atoi(r.FormValue("queue_version"))
+	return v
+}
+
+// writeQueueError responds to a failed queue change. The harmless error,
+// such as leaving twice on a double click, is treated as success, and a
+// stale queue version is a conflict the client resolves with the next
+// queue update.
+func writeQueueError(w http.ResponseWriter, err, harmless error) {
+	switch {
+	case errors.Is(err, harmless):
+		w.WriteHeader(http.StatusNoContent)
+	case errors.Is(err, coordinator.ErrStaleQueue), errors.Is(err, coordinator.ErrQueueFull):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	}
+}
+
 func (s *Server) handleJoinQueue(w http.ResponseWriter, r *http.Request) {
+	s.joinQueue(w, r, queueVersion(r))
+}
+
+// handleQueueAgain puts a player who just finished a match straight back in
+// the queue. It skips the queue version check since the button is shown on
+// the match result, not next to the queue.
+func (s *Server) handleQueueAgain(w http.ResponseWriter, r *http.Request) {
+	s.joinQueue(w, r, 0)
+}
+
+func (s *Server) joinQueue(w http.ResponseWriter, r *http.Request, expectedVersion int) {
 	user := auth.UserFromContext(r.Context())
 	if user == nil {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
+	if err := s.checkQueueAccess(r.Context(), user.SteamID); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
 	resp := make(chan error, 1)
 	s.coordinator.Send(coordinator.JoinQueue{
-		Player: coordinator.Player{
-			SteamID:         user.SteamID,
-			Name:            user.Name,
-			AvatarURL:       user.AvatarURL,
-			CaptainPriority: user.CaptainPriority,
-		},
-		Response: resp,
+		Player:          s.queuePlayer(r.Context(), user),
+		QueueID:         r.FormValue("queue_id"),
+		Response:        resp,
+		ExpectedVersion: expectedVersion,
 	})
 
 	if err := waitForResponse(resp); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeQueueError(w, err, coordinator.ErrAlreadyInQueue)
 		return
 	}
 
@@ -51,15 +88,20 @@ func (s *Server) handleJoinQueue(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
-func (s *Server) handleLeaveQueue(w http.ResponseWriter, r *http.Request) {
+func (s *Server) handleRejoinQueue(w http.ResponseWriter, r *http.Request) {
 	user := auth.UserFromContext(r.Context())
 	if user == nil {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
+	if err := s.checkQueueAccess(r.Context(), user.SteamID); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
 	resp := make(chan error, 1)
-	s.coordinator.Send(coordinator.LeaveQueue{
+	s.coordinator.Send(coordinator.RejoinQueue{
 		PlayerID: user.SteamID,
 		Response: resp,
 	})
@@ -69,6 +111,42 @@ func (s *Server) handleLeaveQueue(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	log.Printf("Player %s (%s) rejoined queue", user.Name, user.SteamID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleQueueHeartbeat records that a queued player is still active.
+func (s *Server) handleQueueHeartbeat(w http.ResponseWriter, r *http.Request) {
+	user := auth.UserFromContext(r.Context())
+	if user == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	s.coordinator.Send(coordinator.QueueHeartbeat{PlayerID: user.SteamID})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleLeaveQueue(w http.ResponseWriter, r *http.Request) {
+	user := auth.UserFromContext(r.Context())
+	if user == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	resp := make(chan error, 1)
+	s.coordinator.Send(coordinator.LeaveQueue{
+		PlayerID:        user.SteamID,
+		QueueID:         r.FormValue("queue_id"),
+		Response:        resp,
+		ExpectedVersion: queueVersion(r),
+	})
+
+	if err := waitForResponse(resp); err != nil {
+		writeQueueError(w, err, coordinator.ErrNotInQueue)
+		return
+	}
+
 	log.Printf("Player %s (%s) left queue", user.Name, user.SteamID)
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -102,6 +180,35 @@ func (s *Server) handleAcceptMatch(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
+func (s *Server) handleDeclineMatch(w http.ResponseWriter, r *http.Request) {
+	user := auth.UserFromContext(r.Context())
+	if user == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	matchID := chi.URLParam(r, "matchID")
+	if matchID == "" {
+		http.Error(w, "match ID required", http.StatusBadRequest)
+		return
+	}
+
+	resp := make(chan error, 1)
+	s.coordinator.Send(coordinator.DeclineMatch{
+		PlayerID: user.SteamID,
+		MatchID:  matchID,
+		Response: resp,
+	})
+
+	if err := waitForResponse(resp); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("Player %s (%s) declined match %s", user.Name, user.SteamID, matchID[:8])
+	w.WriteHeader(http.StatusNoContent)
+}
+
 func (s *Server) handlePickPlayer(w http.ResponseWriter, r *http.Request) {
 	user := auth.UserFromContext(r.Context())
 	if user == nil {
@@ -132,6 +239,91 @@ func (s *Server) handlePickPlayer(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
+func (s *Server) handleVoteCancel(w http.ResponseWriter, r *http.Request) {
+	user := auth.UserFromContext(r.Context())
+	if user == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	matchID := chi.URLParam(r, "matchID")
+	if matchID == "" {
+		http.Error(w, "match ID required", http.StatusBadRequest)
+		return
+	}
+
+	resp := make(chan error, 1)
+	s.coordinator.Send(coordinator.VoteCancel{
+		PlayerID: user.SteamID,
+		MatchID:  matchID,
+		Response: resp,
+	})
+
+	if err := waitForResponse(resp); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleRequestRedraft(w http.ResponseWriter, r *http.Request) {
+	user := auth.UserFromContext(r.Context())
+	if user == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	matchID := chi.URLParam(r, "matchID")
+	if matchID == "" {
+		http.Error(w, "match ID required", http.StatusBadRequest)
+		return
+	}
+
+	resp := make(chan error, 1)
+	s.coordinator.Send(coordinator.RequestRedraft{
+		CaptainID: user.SteamID,
+		MatchID:   matchID,
+		Response:  resp,
+	})
+
+	if err := waitForResponse(resp); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleMatchChat(w http.ResponseWriter, r *http.Request) {
+	user := auth.UserFromContext(r.Context())
+	if user == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	matchID := chi.URLParam(r, "matchID")
+	if matchID == "" {
+		http.Error(w, "match ID required", http.StatusBadRequest)
+		return
+	}
+
+	resp := make(chan error, 1)
+	s.coordinator.Send(coordinator.SendChatMessage{
+		PlayerID: user.SteamID,
+		MatchID:  matchID,
+		Text:     r.FormValue("message"),
+		Response: resp,
+	})
+
+	if err := waitForResponse(resp); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
 func (s *Server) handleSSE(w http.ResponseWriter, r *http.Request) {
 	user, _ := s.sessions.GetUser(r.Context(), r)
 
@@ -158,7 +350,7 @@ func (s *Server) handleAddFakePlayers(w http.ResponseWriter, r *http.Request) {
 				SteamID:         fmt.Sprintf("fake_%d", i),
 				Name:            fmt.Sprintf("Player %d", i),
 				AvatarURL:       "",
-				CaptainPriority: 5, // Default priority
+				CaptainPriority: auth.DefaultCaptainPriority,
 			},
 			Response: resp,
 		})
@@ -0,0 +1,58 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+)
+
+// healthCheckTimeout bounds each dependency check so a wedged dependency
+// fails the check instead of hanging the monitor.
+const healthCheckTimeout = 2 * time.Second
+
+type healthStatus struct {
+	Status      string `json:"status"` // "ok" or "unavailable"
+	Database    string `json:"database"`
+	Coordinator string `json:"coordinator"`
+	BotsOnline  *int   `json:"botsOnline,omitempty"` // Omitted before the bot manager starts
+}
+
+// handleHealthz reports the status of the server's dependencies. It returns
+// 503 if the database or coordinator is unresponsive. Bots being offline
+// doesn't fail the check, since the site still works without them.
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	health := healthStatus{Status: "ok", Database: "ok", Coordinator: "ok"}
+
+	ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+	defer cancel()
+	if err := s.store.Ping(ctx); err != nil {
+		log.Printf("Health check: database ping failed: %v", err)
+		health.Status, health.Database = "unavailable", err.Error()
+	}
+
+	ctx, cancel = context.WithTimeout(r.Context(), healthCheckTimeout)
+	defer cancel()
+	if err := s.coordinator.Ping(ctx); err != nil {
+		log.Printf("Health check: coordinator did not respond: %v", err)
+		health.Status, health.Coordinator = "unavailable", err.Error()
+	}
+
+	if s.bots != nil {
+		online := 0
+		for _, b := range s.bots.Status() {
+			if b.LoggedIn {
+				online++
+			}
+		}
+		health.BotsOnline = &online
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if health.Status != "ok" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(health)
+}
@@ -0,0 +1,63 @@
+package web
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/edvart/dota-inhouse/internal/coordinator"
+)
+
+// handleMetrics exposes basic gauges in the Prometheus text format.
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	queue, matches, _ := s.coordinator.GetState()
+
+	byState := map[coordinator.MatchState]int{
+		coordinator.MatchStateAccepting:     0,
+		coordinator.MatchStateDrafting:      0,
+		coordinator.MatchStateWaitingForBot: 0,
+		coordinator.MatchStateInProgress:    0,
+	}
+	for _, m := range matches {
+		byState[m.State]++
+	}
+
+	var b strings.Builder
+
+	writeMetric(&b, "inhouse_queue_players", "gauge", "Players currently in the queue.")
+	fmt.Fprintf(&b, "inhouse_queue_players %d\n", len(queue))
+
+	writeMetric(&b, "inhouse_active_matches", "gauge", "Active matches by state.")
+	for _, state := range []coordinator.MatchState{
+		coordinator.MatchStateAccepting,
+		coordinator.MatchStateDrafting,
+		coordinator.MatchStateWaitingForBot,
+		coordinator.MatchStateInProgress,
+	} {
+		fmt.Fprintf(&b, "inhouse_active_matches{state=%q} %d\n", state.String(), byState[state])
+	}
+
+	if completed, err := s.store.CountCompletedMatches(r.Context()); err != nil {
+		log.Printf("Failed to count completed matches for metrics: %v", err)
+	} else {
+		writeMetric(&b, "inhouse_matches_completed_total", "counter", "Matches completed with a recorded result.")
+		fmt.Fprintf(&b, "inhouse_matches_completed_total %d\n", completed)
+	}
+
+	if s.bots != nil {
+		writeMetric(&b, "inhouse_bots_available", "gauge", "Bots logged in and free to host a lobby.")
+		fmt.Fprintf(&b, "inhouse_bots_available %d\n", s.bots.AvailableBotCount())
+	}
+
+	writeMetric(&b, "inhouse_sse_clients", "gauge", "Connected SSE clients.")
+	fmt.Fprintf(&b, "inhouse_sse_clients %d\n", s.sse.ClientCount())
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write([]byte(b.String()))
+}
+
+func writeMetric(b *strings.Builder, name, kind, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(b, "# TYPE %s %s\n", name, kind)
+}
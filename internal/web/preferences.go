@@ -0,0 +1,99 @@
+package web
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/edvart/dota-inhouse/internal/auth"
+	"github.com/edvart/dota-inhouse/internal/dotaapi"
+	"github.com/edvart/dota-inhouse/internal/store"
+)
+
+// MaxPreferredHeroes is how many heroes a player may list as preferred.
+const MaxPreferredHeroes = 3
+
+// handleSavePreferences updates the current user's preferred positions and
+// heroes. They apply from the next time the user joins the queue.
+func (s *Server) handleSavePreferences(w http.ResponseWriter, r *http.Request) {
+	user := auth.UserFromContext(r.Context())
+	if user == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	roles, err := parseIDList(r.Form["roles"], func(id int) bool { return id >= 1 && id <= 5 })
+	if err != nil {
+		http.Error(w, "invalid position "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	heroes, err := parseIDList(r.Form["heroes"], dotaapi.IsHero)
+	if err != nil {
+		http.Error(w, "unknown hero ID "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(heroes) > MaxPreferredHeroes {
+		http.Error(w, fmt.Sprintf("at most %d preferred heroes", MaxPreferredHeroes), http.StatusBadRequest)
+		return
+	}
+
+	prefs := &store.PlayerPreferences{
+		SteamID: user.SteamID,
+		Roles:   roles,
+		Heroes:  heroes,
+	}
+	if err := s.store.SetPreferences(r.Context(), prefs); err != nil {
+		log.Printf("Failed to save preferences for %s: %v", user.SteamID, err)
+		http.Error(w, "failed to save preferences", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/player/"+user.SteamID, http.StatusSeeOther)
+}
+
+// parseIDList parses form values as sorted, unique IDs. It returns the first
+// value that isn't a number or isn't valid as the error.
+func parseIDList(values []string, valid func(int) bool) ([]int, error) {
+	var ids []int
+	seen := make(map[int]bool)
+	for _, v := range values {
+		id, err := strconv.Atoi(v)
+		if err != nil || !valid(id) {
+			return nil, fmt.Errorf("%s", v)
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	return ids, nil
+}
+
+// formatPreferences summarises preferred positions and heroes for captains,
+// e.g. "pos 1/2 · Invoker, Pudge". It is empty if there are none.
+func formatPreferences(roles, heroes []int) string {
+	var parts []string
+	if len(roles) > 0 {
+		positions := make([]string, len(roles))
+		for i, role := range roles {
+			positions[i] = strconv.Itoa(role)
+		}
+		parts = append(parts, "pos "+strings.Join(positions, "/"))
+	}
+	if len(heroes) > 0 {
+		names := make([]string, len(heroes))
+		for i, id := range heroes {
+			names[i] = dotaapi.HeroName(id)
+		}
+		parts = append(parts, strings.Join(names, ", "))
+	}
+	return strings.Join(parts, " · ")
+}
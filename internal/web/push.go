@@ -117,3 +117,48 @@ func (s *Server) handleTestPush(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{"status": "Test notification sent"})
 }
+
+// handleGetPushPreferences returns the current user's notification preferences
+func (s *Server) handleGetPushPreferences(w http.ResponseWriter, r *http.Request) {
+	user := auth.UserFromContext(r.Context())
+	if user == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	prefs, err := s.store.GetPushPreferences(r.Context(), user.SteamID)
+	if err != nil {
+		http.Error(w, "Failed to load preferences", http.StatusInternalServerError)
+		return
+	}
+	if prefs == nil {
+		prefs = store.DefaultPushPreferences(user.SteamID)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(prefs)
+}
+
+// handleSavePushPreferences updates the current user's notification preferences
+func (s *Server) handleSavePushPreferences(w http.ResponseWriter, r *http.Request) {
+	user := auth.UserFromContext(r.Context())
+	if user == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	prefs := store.DefaultPushPreferences(user.SteamID)
+	if err := json.NewDecoder(r.Body).Decode(prefs); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	prefs.SteamID = user.SteamID
+
+	if err := s.store.SavePushPreferences(r.Context(), prefs); err != nil {
+		http.Error(w, "Failed to save preferences", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(prefs)
+}
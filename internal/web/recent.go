@@ -0,0 +1,74 @@
+package web
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/edvart/dota-inhouse/internal/coordinator"
+	"github.com/edvart/dota-inhouse/internal/store"
+)
+
+// recentMatchesCount is how many completed matches the index page shows.
+const recentMatchesCount = 3
+
+// RecentMatchesData is the recently completed matches strip on the index page.
+type RecentMatchesData struct {
+	Matches    []store.MatchWithPlayers
+	TeamLabels [2]string
+}
+
+// recentMatches returns the last few completed matches, newest first. The
+// recorder saves a completed match in the background, so a match that has
+// just completed is added from its event until the store has it.
+func recentMatches(ctx context.Context, st store.Store, completed *coordinator.MatchCompleted) []store.MatchWithPlayers {
+	matches, err := st.ListMatchesWithPlayers(ctx, recentMatchesCount)
+	if err != nil {
+		log.Printf("Failed to list recent matches: %v", err)
+	}
+	if completed == nil {
+		return matches
+	}
+	for _, m := range matches {
+		if m.ID == completed.MatchID {
+			return matches
+		}
+	}
+
+	matches = append([]store.MatchWithPlayers{completedMatch(*completed)}, matches...)
+	if len(matches) > recentMatchesCount {
+		matches = matches[:recentMatchesCount]
+	}
+	return matches
+}
+
+// completedMatch builds the history entry for a match from its event.
+func completedMatch(e coordinator.MatchCompleted) store.MatchWithPlayers {
+	now := time.Now()
+	m := store.MatchWithPlayers{
+		Match: store.Match{
+			ID:          e.MatchID,
+			DotaMatchID: e.DotaMatchID,
+			State:       "completed",
+			EndedAt:     &now,
+			Winner:      e.Winner,
+			GameMode:    e.GameMode,
+		},
+	}
+	m.Radiant = matchPlayerInfos(e.Radiant, "radiant")
+	m.Dire = matchPlayerInfos(e.Dire, "dire")
+	return m
+}
+
+func matchPlayerInfos(players []coordinator.Player, team string) []store.MatchPlayerInfo {
+	infos := make([]store.MatchPlayerInfo, len(players))
+	for i, p := range players {
+		infos[i] = store.MatchPlayerInfo{
+			SteamID:   p.SteamID,
+			Name:      p.Name,
+			AvatarURL: p.AvatarURL,
+			Team:      team,
+		}
+	}
+	return infos
+}
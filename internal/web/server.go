@@ -1,15 +1,22 @@
 package web
 
 import (
+	"context"
 	"html/template"
 	"io/fs"
 	"log"
 	"net/http"
+	"strconv"
+	"sync/atomic"
 	"time"
 
 	"github.com/edvart/dota-inhouse/internal/auth"
+	"github.com/edvart/dota-inhouse/internal/bot"
 	"github.com/edvart/dota-inhouse/internal/coordinator"
+	"github.com/edvart/dota-inhouse/internal/dotaapi"
+	"github.com/edvart/dota-inhouse/internal/matchrecorder"
 	"github.com/edvart/dota-inhouse/internal/push"
+	"github.com/edvart/dota-inhouse/internal/steamid"
 	"github.com/edvart/dota-inhouse/internal/store"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -19,6 +26,7 @@ type Server struct {
 	router      *chi.Mux
 	coordinator *coordinator.Coordinator
 	steamAuth   *auth.SteamAuth
+	discordAuth *auth.DiscordAuth
 	sessions    *auth.SessionManager
 	store       store.Store
 	sse         *SSEHub
@@ -27,13 +35,38 @@ type Server struct {
 	adminConfig *auth.AdminConfig
 	pushService *push.Service
 	logPath     string
+	bots        BotManager
+	importer    MatchImporter
+	metrics     bool
+	allowlist   atomic.Bool // Only allowlisted players may queue
+	minGames    int         // Default leaderboard games threshold
+	email       bool        // Email notifications are configured
+	queueLimit  *rateLimiter
+}
+
+// BotManager is the subset of the bot manager used by admin endpoints.
+type BotManager interface {
+	ForceFreeBot(name string) error
+	AvailableBotCount() int
+	Status() []bot.Status
+}
+
+// MatchImporter records historical matches from the Dota API.
+type MatchImporter interface {
+	ImportMatch(ctx context.Context, dotaMatchID uint64, aliases map[string]string) (*matchrecorder.ImportResult, error)
+	RefreshMatchDetails(ctx context.Context, matchID string, dotaMatchID uint64) (*dotaapi.MatchDetails, error)
 }
 
 type Config struct {
-	DevMode       bool
-	AdminSteamIDs string // Comma-separated list of admin Steam IDs
-	PushService   *push.Service
-	LogPath       string
+	DevMode        bool
+	AdminSteamIDs  string // Comma-separated list of admin Steam IDs
+	PushService    *push.Service
+	LogPath        string
+	DiscordAuth    *auth.DiscordAuth // Optional; enables Discord login when set
+	MetricsEnabled bool              // Exposes Prometheus metrics at /metrics
+	QueueAllowlist bool              // Starts in allowlist mode; admins can toggle it
+	MinGames       int               // Games needed to appear on the leaderboard by default
+	EmailEnabled   bool              // Shows the email notification form on profiles
 }
 
 func NewServer(
@@ -45,20 +78,28 @@ func NewServer(
 	staticFS fs.FS,
 	cfg Config,
 ) *Server {
+	adminConfig := auth.NewAdminConfig(cfg.AdminSteamIDs)
 	s := &Server{
 		router:      chi.NewRouter(),
 		coordinator: coord,
 		steamAuth:   steamAuth,
+		discordAuth: cfg.DiscordAuth,
 		sessions:    sessions,
 		store:       st,
-		sse:         NewSSEHub(templates, coord, cfg.DevMode),
+		sse:         NewSSEHub(templates, coord, st, adminConfig, cfg.DevMode),
 		templates:   templates,
 		devMode:     cfg.DevMode,
-		adminConfig: auth.NewAdminConfig(cfg.AdminSteamIDs),
+		adminConfig: adminConfig,
 		pushService: cfg.PushService,
 		logPath:     cfg.LogPath,
+		metrics:     cfg.MetricsEnabled,
+		minGames:    cfg.MinGames,
+		email:       cfg.EmailEnabled,
+		queueLimit:  newRateLimiter(QueueActionsPerMinute),
 	}
 
+	s.allowlist.Store(cfg.QueueAllowlist)
+
 	s.setupRoutes(staticFS)
 	return s
 }
@@ -69,6 +110,7 @@ func (s *Server) setupRoutes(staticFS fs.FS) {
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.RealIP)
+	r.Use(auth.CSRFMiddleware(s.sessions))
 
 	r.Handle("/static/*", http.StripPrefix("/static/", http.FileServer(http.FS(staticFS))))
 
@@ -97,8 +139,14 @@ func (s *Server) setupRoutes(staticFS fs.FS) {
 	r.Get("/auth/login", s.steamAuth.LoginHandler)
 	r.Get("/auth/callback", s.steamAuth.CallbackHandler)
 	r.Get("/auth/logout", s.steamAuth.LogoutHandler)
+	r.Post("/auth/logout-all", s.steamAuth.LogoutAllHandler)
 	r.Get("/me", s.steamAuth.MeHandler)
 
+	if s.discordAuth != nil {
+		r.Get("/auth/discord/login", s.discordAuth.LoginHandler)
+		r.Get("/auth/discord/callback", s.discordAuth.CallbackHandler)
+	}
+
 	if s.devMode {
 		r.Get("/dev/login", s.steamAuth.DevLoginHandler)
 		r.Post("/dev/add-fake-players", s.handleAddFakePlayers)
@@ -110,27 +158,57 @@ func (s *Server) setupRoutes(staticFS fs.FS) {
 	}
 
 	r.Get("/events", s.handleSSE)
+	r.Get("/healthz", s.handleHealthz)
+
+	if s.metrics {
+		r.Get("/metrics", s.handleMetrics)
+	}
+
+	// Public read-only JSON API
+	r.Get("/api/queue", s.handleAPIQueue)
+	r.Get("/api/matches", s.handleAPIMatches)
+	r.Get("/api/matches/{matchID}", s.handleAPIMatch)
+	r.Get("/api/player/{steamID}/status", s.handleAPIPlayerStatus)
 
 	// Push notification endpoints
 	r.Get("/api/push/vapid-public-key", s.handleGetVAPIDPublicKey)
+	r.Get("/api/csrf-token", s.handleCSRFToken)
 
 	r.Group(func(r chi.Router) {
 		r.Use(auth.RequireAuth(s.sessions))
 
-		r.Post("/queue/join", s.handleJoinQueue)
-		r.Post("/queue/leave", s.handleLeaveQueue)
+		r.Group(func(r chi.Router) {
+			r.Use(s.queueLimit.limitPerUser)
+
+			r.Post("/queue/join", s.handleJoinQueue)
+			r.Post("/queue/leave", s.handleLeaveQueue)
+			r.Post("/queue/rejoin", s.handleRejoinQueue)
+			r.Post("/queue/rejoin-last", s.handleQueueAgain)
+		})
+		r.Post("/queue/heartbeat", s.handleQueueHeartbeat)
 		r.Post("/match/{matchID}/accept", s.handleAcceptMatch)
+		r.Post("/match/{matchID}/decline", s.handleDeclineMatch)
 		r.Post("/match/{matchID}/pick/{playerID}", s.handlePickPlayer)
+		r.Post("/match/{matchID}/vote-cancel", s.handleVoteCancel)
+		r.Post("/match/{matchID}/redraft", s.handleRequestRedraft)
+		r.Post("/match/{matchID}/chat", s.handleMatchChat)
 
 		// Push subscription management
 		r.Post("/api/push/subscribe", s.handleSubscribePush)
 		r.Post("/api/push/unsubscribe", s.handleUnsubscribePush)
 		r.Post("/api/push/test", s.handleTestPush)
+		r.Get("/api/push/preferences", s.handleGetPushPreferences)
+		r.Post("/api/push/preferences", s.handleSavePushPreferences)
+
+		r.Post("/profile/email", s.handleSaveEmailSettings)
+		r.Post("/profile/preferences", s.handleSavePreferences)
 	})
 
 	r.Get("/", s.handleIndex)
 	r.Get("/history", s.handleHistory)
 	r.Get("/leaderboard", s.handleLeaderboard)
+	r.Get("/stats", s.handleStats)
+	r.Get("/player/{steamID}", s.handlePlayerProfile)
 
 	r.Group(func(r chi.Router) {
 		r.Use(auth.AdminMiddleware(s.adminConfig, s.sessions))
@@ -139,14 +217,46 @@ func (s *Server) setupRoutes(staticFS fs.FS) {
 		r.Get("/admin/state", s.handleAdminState)
 		r.Post("/admin/match/{matchID}/cancel", s.handleAdminCancelMatch)
 		r.Post("/admin/match/{matchID}/result/{winner}", s.handleAdminSetResult)
+		r.Post("/admin/match/{matchID}/game-started", s.handleAdminGameStarted)
+		r.Post("/admin/match/{matchID}/swap", s.handleAdminSwapPlayers)
+		r.Post("/admin/match/{matchID}/shuffle", s.handleAdminShuffleTeams)
 		r.Post("/admin/queue/kick/{playerID}", s.handleAdminKickPlayer)
+		r.Post("/admin/force-start", s.handleAdminForceStart)
+		r.Post("/admin/import-match", s.handleAdminImportMatch)
+		r.Post("/admin/queue/pause", s.handleAdminPauseQueue)
+		r.Post("/admin/queue/resume", s.handleAdminResumeQueue)
 		r.Post("/admin/player/{playerID}/priority/{priority}", s.handleAdminSetCaptainPriority)
 		r.Post("/admin/settings", s.handleAdminSetLobbySettings)
+		r.Post("/admin/broadcast", s.handleAdminBroadcast)
+		r.Post("/admin/ban/{steamID}", s.handleAdminBan)
+		r.Delete("/admin/ban/{steamID}", s.handleAdminUnban)
+		r.Post("/admin/allow/{steamID}", s.handleAdminAllow)
+		r.Delete("/admin/allow/{steamID}", s.handleAdminDisallow)
+		r.Post("/admin/allowlist", s.handleAdminSetAllowlist)
 		r.Post("/admin/history/{matchID}/result/{winner}", s.handleAdminSetHistoryResult)
+		r.Post("/admin/history/{matchID}/requeue", s.handleAdminRequeueMatch)
+		r.Post("/admin/history/{matchID}/details", s.handleAdminRefreshMatchDetails)
+		r.Delete("/admin/history/{matchID}", s.handleAdminDeleteMatch)
 		r.Get("/admin/logs", s.handleAdminLogs)
+		r.Get("/admin/audit", s.handleAdminAudit)
+		r.Get("/admin/export", s.handleAdminExport)
+		r.Get("/admin/bots", s.handleAdminBots)
+		r.Post("/admin/bot/{name}/free", s.handleAdminForceFreeBot)
 	})
 }
 
+// SetBotManager enables admin bot controls. The bot manager is started after
+// the server, so it is attached separately from Config.
+func (s *Server) SetBotManager(m BotManager) {
+	s.bots = m
+}
+
+// SetMatchImporter enables importing historical matches. It is only set when
+// the Dota API is configured.
+func (s *Server) SetMatchImporter(m MatchImporter) {
+	s.importer = m
+}
+
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	s.router.ServeHTTP(w, r)
 }
@@ -158,7 +268,8 @@ func (s *Server) StartSSE(events <-chan coordinator.Event) {
 func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
 	user, _ := s.sessions.GetUser(r.Context(), r)
 
-	queue, matches, _ := s.coordinator.GetState()
+	_, matches, settings := s.coordinator.GetState()
+	queueStatus := s.coordinator.QueueStatus()
 
 	matchList := make([]*coordinator.Match, 0, len(matches))
 	for _, m := range matches {
@@ -166,21 +277,34 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
 	}
 
 	data := PageData{
-		User:    user,
-		Queue:   queue,
-		Matches: matchList,
-		DevMode: s.devMode,
+		User:         user,
+		Queues:       queueStatus.Queues,
+		Matches:      matchList,
+		DevMode:      s.devMode,
+		DiscordLogin: s.discordAuth != nil,
+		CSRFToken:    s.sessions.CSRFToken(r),
+		QueueVersion: queueStatus.Version,
+		Paused:       queueStatus.Paused,
+		Recent: RecentMatchesData{
+			Matches:    recentMatches(r.Context(), s.store, nil),
+			TeamLabels: settings.TeamLabels(),
+		},
 	}
 
 	if user != nil {
-		for _, p := range queue {
-			if p.SteamID == user.SteamID {
+		for _, q := range queueStatus.Queues {
+			if isUserInPlayers(user.SteamID, q.Players) {
+				data.QueueID = q.ID
 				data.InQueue = true
 				break
 			}
 		}
 		data.Match = s.coordinator.GetPlayerMatch(user.SteamID)
 		data.InMatch = data.Match != nil
+		if data.Match != nil {
+			data.VoteCancel = newVoteCancelData(data.Match.ID, len(data.Match.Players), data.Match.CancelVotes, user.SteamID)
+			data.Redraft = newRedraftData(data.Match, user.SteamID)
+		}
 	}
 
 	if err := s.templates.ExecuteTemplate(w, "index.html", data); err != nil {
@@ -190,26 +314,62 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
 }
 
 type PageData struct {
-	User    interface{}
-	Queue   []coordinator.Player
-	Match   *coordinator.Match
-	Matches []*coordinator.Match
-	InQueue bool
-	InMatch bool
-	DevMode bool
+	User         interface{}
+	Queues       []coordinator.Queue
+	QueueID      string // Queue the user is in, if any
+	Match        *coordinator.Match
+	Matches      []*coordinator.Match
+	InQueue      bool
+	InMatch      bool
+	DevMode      bool
+	DiscordLogin bool
+	VoteCancel   VoteCancelData
+	Redraft      RedraftData
+	CSRFToken    string
+	QueueVersion int
+	Paused       bool
+	Recent       RecentMatchesData
 }
 
 type HistoryPageData struct {
-	User    interface{}
-	Matches []store.MatchWithPlayers
-	DevMode bool
-	IsAdmin bool
+	User       interface{}
+	Matches    []store.MatchWithPlayers
+	Page       int
+	PerPage    int
+	TotalPages int
+	DevMode    bool
+	IsAdmin    bool
+	CSRFToken  string
+	TeamLabels [2]string
 }
 
+const (
+	defaultHistoryPerPage = 25
+	maxHistoryPerPage     = 100
+)
+
 func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request) {
 	user, _ := s.sessions.GetUser(r.Context(), r)
 
-	matches, err := s.store.ListMatchesWithPlayers(r.Context(), 50)
+	perPage := defaultHistoryPerPage
+	if n, err := strconv.Atoi(r.URL.Query().Get("per_page")); err == nil && n > 0 {
+		perPage = min(n, maxHistoryPerPage)
+	}
+	page := 1
+	if n, err := strconv.Atoi(r.URL.Query().Get("page")); err == nil && n > 0 {
+		page = n
+	}
+
+	total, err := s.store.CountCompletedMatches(r.Context())
+	if err != nil {
+		log.Printf("Failed to count matches: %v", err)
+		http.Error(w, "Failed to load history", http.StatusInternalServerError)
+		return
+	}
+	totalPages := max((total+perPage-1)/perPage, 1)
+	page = min(page, totalPages)
+
+	matches, err := s.store.ListMatchesWithPlayersPaged(r.Context(), perPage, (page-1)*perPage)
 	if err != nil {
 		log.Printf("Failed to load match history: %v", err)
 		http.Error(w, "Failed to load history", http.StatusInternalServerError)
@@ -222,10 +382,15 @@ func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request) {
 	}
 
 	data := HistoryPageData{
-		User:    user,
-		Matches: matches,
-		DevMode: s.devMode,
-		IsAdmin: isAdmin,
+		User:       user,
+		Matches:    matches,
+		Page:       page,
+		PerPage:    perPage,
+		TotalPages: totalPages,
+		DevMode:    s.devMode,
+		IsAdmin:    isAdmin,
+		CSRFToken:  s.sessions.CSRFToken(r),
+		TeamLabels: s.teamLabels(),
 	}
 
 	if err := s.templates.ExecuteTemplate(w, "history.html", data); err != nil {
@@ -234,69 +399,165 @@ func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-type LeaderboardPageData struct {
-	User       interface{}
-	Entries    []store.LeaderboardEntry
-	StartDate  string
-	EndDate    string
-	FilterName string
-	DevMode    bool
+// dateFilter is the period selected by the start, end and preset query
+// parameters shared by the leaderboard and stats pages.
+type dateFilter struct {
+	Start, End       *time.Time
+	StartStr, EndStr string
+	Name             string
 }
 
-func (s *Server) handleLeaderboard(w http.ResponseWriter, r *http.Request) {
-	user, _ := s.sessions.GetUser(r.Context(), r)
-
-	var startDate, endDate *time.Time
-	startStr := r.URL.Query().Get("start")
-	endStr := r.URL.Query().Get("end")
-	filterName := "All Time"
+func parseDateFilter(r *http.Request) dateFilter {
+	f := dateFilter{
+		StartStr: r.URL.Query().Get("start"),
+		EndStr:   r.URL.Query().Get("end"),
+		Name:     "All Time",
+	}
 
-	if startStr != "" {
-		if t, err := time.Parse("2006-01-02", startStr); err == nil {
-			startDate = &t
+	if f.StartStr != "" {
+		if t, err := time.Parse("2006-01-02", f.StartStr); err == nil {
+			f.Start = &t
 		}
 	}
-	if endStr != "" {
-		if t, err := time.Parse("2006-01-02", endStr); err == nil {
+	if f.EndStr != "" {
+		if t, err := time.Parse("2006-01-02", f.EndStr); err == nil {
 			endOfDay := t.Add(24*time.Hour - time.Second)
-			endDate = &endOfDay
+			f.End = &endOfDay
 		}
 	}
 
-	preset := r.URL.Query().Get("preset")
 	now := time.Now()
-	switch preset {
+	switch r.URL.Query().Get("preset") {
 	case "week":
 		start := now.AddDate(0, 0, -7)
-		startDate = &start
-		filterName = "Last 7 Days"
+		f.Start = &start
+		f.Name = "Last 7 Days"
 	case "month":
 		start := now.AddDate(0, -1, 0)
-		startDate = &start
-		filterName = "Last 30 Days"
+		f.Start = &start
+		f.Name = "Last 30 Days"
 	case "year":
 		start := now.AddDate(-1, 0, 0)
-		startDate = &start
-		filterName = "Last Year"
+		f.Start = &start
+		f.Name = "Last Year"
 	default:
-		if startStr != "" || endStr != "" {
-			filterName = "Custom Range"
+		if f.StartStr != "" || f.EndStr != "" {
+			f.Name = "Custom Range"
+		}
+	}
+	return f
+}
+
+// SidesData renders side win rates under the configured team labels.
+type SidesData struct {
+	*store.SideWinRates
+	TeamLabels [2]string
+}
+
+// sidesData returns nil if there are no side win rates.
+func (s *Server) sidesData(sides *store.SideWinRates) *SidesData {
+	if sides == nil {
+		return nil
+	}
+	return &SidesData{SideWinRates: sides, TeamLabels: s.teamLabels()}
+}
+
+// teamLabels returns the current display names of Radiant and Dire.
+func (s *Server) teamLabels() [2]string {
+	_, _, settings := s.coordinator.GetState()
+	return settings.TeamLabels()
+}
+
+// RankTier is a leaderboard badge earned by reaching an Elo rating.
+type RankTier struct {
+	Name   string
+	Class  string
+	MinElo int
+}
+
+// rankTiers are the leaderboard badges, highest first. Everyone starts at
+// 1000 Elo, in Silver.
+var rankTiers = []RankTier{
+	{Name: "Diamond", Class: "tier-diamond", MinElo: 1200},
+	{Name: "Gold", Class: "tier-gold", MinElo: 1100},
+	{Name: "Silver", Class: "tier-silver", MinElo: 950},
+	{Name: "Bronze", Class: "tier-bronze"},
+}
+
+// rankTier returns the badge for an Elo rating.
+func rankTier(elo int) RankTier {
+	for _, t := range rankTiers {
+		if elo >= t.MinElo {
+			return t
+		}
+	}
+	return rankTiers[len(rankTiers)-1]
+}
+
+type LeaderboardPageData struct {
+	User       interface{}
+	Entries    []store.LeaderboardEntry
+	Sides      *SidesData
+	StartDate  string
+	EndDate    string
+	FilterName string
+	GameMode   string
+	GameModes  map[string]string
+	Sort       store.LeaderboardSort
+	Sorts      map[store.LeaderboardSort]string
+	MinGames   int // Threshold applied to this page
+	DefaultMin int // Configured default threshold
+	DevMode    bool
+}
+
+func (s *Server) handleLeaderboard(w http.ResponseWriter, r *http.Request) {
+	user, _ := s.sessions.GetUser(r.Context(), r)
+
+	filter := parseDateFilter(r)
+
+	gameMode := r.URL.Query().Get("mode")
+	if _, ok := coordinator.ValidGameModes[gameMode]; !ok {
+		gameMode = ""
+	}
+
+	minGames := s.minGames
+	if v := r.URL.Query().Get("minGames"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			minGames = n
 		}
 	}
 
-	entries, err := s.store.GetLeaderboard(r.Context(), startDate, endDate)
+	sortBy := store.LeaderboardSort(r.URL.Query().Get("sort"))
+	if _, ok := store.LeaderboardSorts[sortBy]; !ok {
+		sortBy = store.SortNetWins
+	}
+
+	entries, err := s.store.GetLeaderboard(r.Context(), filter.Start, filter.End, gameMode, minGames, sortBy)
 	if err != nil {
 		log.Printf("Failed to load leaderboard: %v", err)
 		http.Error(w, "Failed to load leaderboard", http.StatusInternalServerError)
 		return
 	}
 
+	// Side win rates are a sidebar; the leaderboard still renders without them.
+	sides, err := s.store.GetSideWinRates(r.Context(), filter.Start, filter.End)
+	if err != nil {
+		log.Printf("Failed to load side win rates: %v", err)
+	}
+
 	data := LeaderboardPageData{
 		User:       user,
 		Entries:    entries,
-		StartDate:  startStr,
-		EndDate:    endStr,
-		FilterName: filterName,
+		Sides:      s.sidesData(sides),
+		StartDate:  filter.StartStr,
+		EndDate:    filter.EndStr,
+		FilterName: filter.Name,
+		GameMode:   gameMode,
+		GameModes:  coordinator.ValidGameModes,
+		Sort:       sortBy,
+		Sorts:      store.LeaderboardSorts,
+		MinGames:   minGames,
+		DefaultMin: s.minGames,
 		DevMode:    s.devMode,
 	}
 
@@ -305,3 +566,145 @@ func (s *Server) handleLeaderboard(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 	}
 }
+
+type StatsPageData struct {
+	User       interface{}
+	Stats      *store.AggregateStats
+	Sides      *SidesData
+	StartDate  string
+	EndDate    string
+	FilterName string
+	DevMode    bool
+}
+
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	user, _ := s.sessions.GetUser(r.Context(), r)
+	filter := parseDateFilter(r)
+
+	stats, err := s.store.GetAggregateStats(r.Context(), filter.Start, filter.End)
+	if err != nil {
+		log.Printf("Failed to load stats: %v", err)
+		http.Error(w, "Failed to load stats", http.StatusInternalServerError)
+		return
+	}
+	sides, err := s.store.GetSideWinRates(r.Context(), filter.Start, filter.End)
+	if err != nil {
+		log.Printf("Failed to load side win rates: %v", err)
+		http.Error(w, "Failed to load stats", http.StatusInternalServerError)
+		return
+	}
+
+	data := StatsPageData{
+		User:       user,
+		Stats:      stats,
+		Sides:      s.sidesData(sides),
+		StartDate:  filter.StartStr,
+		EndDate:    filter.EndStr,
+		FilterName: filter.Name,
+		DevMode:    s.devMode,
+	}
+
+	if err := s.templates.ExecuteTemplate(w, "stats.html", data); err != nil {
+		log.Printf("Template error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+type ProfilePageData struct {
+	User        interface{}
+	Player      *store.User
+	Stats       *store.LeaderboardEntry
+	Reliability *store.PlayerReliability
+	Matches     []store.PlayerMatch
+	DevMode     bool
+	Email       *store.EmailSettings // Set on the viewer's own profile when email is enabled
+	OwnProfile  bool
+	DiscordLink bool // Discord login is on and this is the viewer's own profile
+	CSRFToken   string
+	Preferences *store.PlayerPreferences // Never nil
+	Heroes      []dotaapi.Hero           // Choices for the preferences form on the viewer's own profile
+	TeamLabels  [2]string
+}
+
+func (s *Server) handlePlayerProfile(w http.ResponseWriter, r *http.Request) {
+	user, _ := s.sessions.GetUser(r.Context(), r)
+	// Accept 32-bit account IDs too, as shown by Dota clients and sites
+	steamID, err := steamid.Normalize(chi.URLParam(r, "steamID"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	player, err := s.store.GetUser(r.Context(), steamID)
+	if err != nil {
+		log.Printf("Failed to load player %s: %v", steamID, err)
+		http.Error(w, "Failed to load player", http.StatusInternalServerError)
+		return
+	}
+	if player == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	stats, err := s.store.GetPlayerStats(r.Context(), steamID)
+	if err != nil {
+		log.Printf("Failed to load stats for %s: %v", steamID, err)
+		http.Error(w, "Failed to load player stats", http.StatusInternalServerError)
+		return
+	}
+
+	reliability, err := s.store.GetPlayerReliability(r.Context(), steamID, 50)
+	if err != nil {
+		log.Printf("Failed to load reliability for %s: %v", steamID, err)
+		http.Error(w, "Failed to load player stats", http.StatusInternalServerError)
+		return
+	}
+
+	matches, err := s.store.GetPlayerMatches(r.Context(), steamID, 20)
+	if err != nil {
+		log.Printf("Failed to load matches for %s: %v", steamID, err)
+		http.Error(w, "Failed to load player matches", http.StatusInternalServerError)
+		return
+	}
+
+	data := ProfilePageData{
+		User:        user,
+		Player:      player,
+		Stats:       stats,
+		Reliability: reliability,
+		Matches:     matches,
+		DevMode:     s.devMode,
+		OwnProfile:  user != nil && user.SteamID == steamID,
+		DiscordLink: s.discordAuth != nil && user != nil && user.SteamID == steamID,
+		CSRFToken:   s.sessions.CSRFToken(r),
+		TeamLabels:  s.teamLabels(),
+	}
+
+	prefs, err := s.store.GetPreferences(r.Context(), steamID)
+	if err != nil {
+		log.Printf("Failed to load preferences for %s: %v", steamID, err)
+	}
+	if prefs == nil {
+		prefs = &store.PlayerPreferences{SteamID: steamID}
+	}
+	data.Preferences = prefs
+	if data.OwnProfile {
+		data.Heroes = dotaapi.Heroes()
+	}
+
+	if s.email && data.OwnProfile {
+		settings, err := s.store.GetEmailSettings(r.Context(), steamID)
+		if err != nil {
+			log.Printf("Failed to load email settings for %s: %v", steamID, err)
+		}
+		if settings == nil {
+			settings = &store.EmailSettings{SteamID: steamID}
+		}
+		data.Email = settings
+	}
+
+	if err := s.templates.ExecuteTemplate(w, "profile.html", data); err != nil {
+		log.Printf("Template error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
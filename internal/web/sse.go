@@ -2,39 +2,87 @@ package web
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"html/template"
 	"log"
 	"net/http"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/edvart/dota-inhouse/internal/auth"
 	"github.com/edvart/dota-inhouse/internal/coordinator"
+	"github.com/edvart/dota-inhouse/internal/store"
+)
+
+// sseKeepaliveInterval is how long a connection may stay idle before a
+// keepalive comment is sent. Must be below the proxy's read timeout.
+const sseKeepaliveInterval = 25 * time.Second
+
+const (
+	// sseHistorySize bounds how many rendered messages are kept per user for
+	// replay after a reconnect.
+	sseHistorySize = 50
+	// sseReplayWindow is how long messages keep being buffered for a user
+	// after their last connection closes.
+	sseReplayWindow = 2 * time.Minute
 )
 
 type SSEClient struct {
 	ID      string
 	UserID  string
-	Channel chan string
+	Channel chan sseMessage
+}
+
+// sseMessage is a rendered payload with its sequence number, sent as the
+// SSE id field so reconnecting clients can report what they last saw.
+type sseMessage struct {
+	ID   uint64
+	Data string
+}
+
+// userHistory holds recent messages for one user so they can be replayed
+// when a dropped connection reconnects with Last-Event-ID.
+type userHistory struct {
+	messages       []sseMessage
+	floor          uint64 // Messages with IDs above this are all still buffered
+	conns          int
+	disconnectedAt time.Time
 }
 
 type SSEHub struct {
 	clients     map[*SSEClient]bool
+	history     map[string]*userHistory // Guarded by mu
+	seq         uint64                  // Guarded by mu
 	mu          sync.RWMutex
 	templates   *template.Template
 	coordinator *coordinator.Coordinator
+	store       store.Store
+	admins      *auth.AdminConfig
 	devMode     bool
 }
 
-func NewSSEHub(templates *template.Template, coord *coordinator.Coordinator, devMode bool) *SSEHub {
+func NewSSEHub(templates *template.Template, coord *coordinator.Coordinator, st store.Store, admins *auth.AdminConfig, devMode bool) *SSEHub {
 	return &SSEHub{
 		clients:     make(map[*SSEClient]bool),
+		history:     make(map[string]*userHistory),
 		templates:   templates,
 		coordinator: coord,
+		store:       st,
+		admins:      admins,
 		devMode:     devMode,
 	}
 }
 
+// ClientCount returns the number of connected SSE clients.
+func (h *SSEHub) ClientCount() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.clients)
+}
+
 func (h *SSEHub) Run(events <-chan coordinator.Event) {
 	log.Println("SSE hub started")
 	for event := range events {
@@ -43,16 +91,22 @@ func (h *SSEHub) Run(events <-chan coordinator.Event) {
 }
 
 func (h *SSEHub) broadcast(event coordinator.Event) {
-	h.mu.RLock()
-	defer h.mu.RUnlock()
+	h.mu.Lock()
+	defer h.mu.Unlock()
 
 	var matchesHTML string
 	if h.isMatchEvent(event) {
 		matchesHTML = h.renderActiveMatches()
 	}
+	if e, ok := event.(coordinator.MatchCompleted); ok {
+		matchesHTML += h.renderRecentMatches(e)
+	}
 
-	for client := range h.clients {
-		html := h.renderEventForUser(event, client.UserID)
+	// Render once per user, including users who disconnected recently so
+	// they can catch up when they reconnect.
+	messages := make(map[string]sseMessage)
+	for userID := range h.activeUsers() {
+		html := h.renderEventForUser(event, userID)
 
 		if html == "" && matchesHTML != "" {
 			html = matchesHTML
@@ -63,8 +117,16 @@ func (h *SSEHub) broadcast(event coordinator.Event) {
 		if html == "" {
 			continue
 		}
+		messages[userID] = h.record(userID, html)
+	}
+
+	for client := range h.clients {
+		msg, ok := messages[client.UserID]
+		if !ok {
+			continue
+		}
 		select {
-		case client.Channel <- html:
+		case client.Channel <- msg:
 		default:
 			// Client too slow, skip
 			log.Printf("Dropping message for slow client %s", client.ID)
@@ -72,6 +134,65 @@ func (h *SSEHub) broadcast(event coordinator.Event) {
 	}
 }
 
+// activeUsers returns the users that are connected or still within the
+// replay window, dropping history for everyone else. Caller must hold mu.
+func (h *SSEHub) activeUsers() map[string]bool {
+	users := make(map[string]bool)
+	for client := range h.clients {
+		users[client.UserID] = true
+	}
+	for userID, hist := range h.history {
+		if hist.conns > 0 {
+			users[userID] = true
+		} else if time.Since(hist.disconnectedAt) < sseReplayWindow {
+			users[userID] = true
+		} else {
+			delete(h.history, userID)
+		}
+	}
+	return users
+}
+
+// historyFor returns the user's history, creating it if needed. Caller must hold mu.
+func (h *SSEHub) historyFor(userID string) *userHistory {
+	hist, ok := h.history[userID]
+	if !ok {
+		hist = &userHistory{floor: h.seq}
+		h.history[userID] = hist
+	}
+	return hist
+}
+
+// record assigns the next sequence number to a payload and buffers it for
+// the user. Caller must hold mu.
+func (h *SSEHub) record(userID, html string) sseMessage {
+	h.seq++
+	msg := sseMessage{ID: h.seq, Data: html}
+
+	hist := h.historyFor(userID)
+	hist.messages = append(hist.messages, msg)
+	if len(hist.messages) > sseHistorySize {
+		hist.floor = hist.messages[0].ID
+		hist.messages = hist.messages[1:]
+	}
+	return msg
+}
+
+// since returns the buffered messages after lastID, or false if some of
+// them have already been dropped.
+func (hist *userHistory) since(lastID uint64) ([]sseMessage, bool) {
+	if lastID < hist.floor {
+		return nil, false
+	}
+	var missed []sseMessage
+	for _, msg := range hist.messages {
+		if msg.ID > lastID {
+			missed = append(missed, msg)
+		}
+	}
+	return missed, true
+}
+
 func (h *SSEHub) isMatchEvent(event coordinator.Event) bool {
 	switch event.(type) {
 	case coordinator.MatchAcceptStarted,
@@ -83,6 +204,7 @@ func (h *SSEHub) isMatchEvent(event coordinator.Event) bool {
 		coordinator.LobbyCancelled,
 		coordinator.RequestBotLobby,
 		coordinator.MatchStarted,
+		coordinator.MatchProgress,
 		coordinator.MatchCompleted:
 		return true
 	default:
@@ -95,19 +217,9 @@ func (h *SSEHub) renderEventForUser(event coordinator.Event, userID string) stri
 
 	switch e := event.(type) {
 	case coordinator.QueueUpdated:
-		inQueue := false
-		for _, p := range e.Queue {
-			if p.SteamID == userID {
-				inQueue = true
-				break
-			}
-		}
 		inMatch := h.coordinator.GetPlayerMatch(userID) != nil
-		data := struct {
-			Queue   []coordinator.Player
-			InQueue bool
-			InMatch bool
-		}{Queue: e.Queue, InQueue: inQueue, InMatch: inMatch}
+		status := coordinator.QueueStatus{Queues: e.Queues, Version: e.Version, Paused: e.Paused}
+		data := newQueuePanelData(status, userID, inMatch)
 		if err := h.templates.ExecuteTemplate(&buf, "queue-sse", data); err != nil {
 			log.Printf("Failed to render queue: %v", err)
 			return ""
@@ -127,15 +239,17 @@ func (h *SSEHub) renderEventForUser(event coordinator.Event, userID string) stri
 			Total        int
 			UserID       string
 			UserAccepted bool
+			VoteCancel   VoteCancelData
 		}{
 			MatchID:      e.MatchID,
 			Players:      e.Players,
 			Accepted:     make(map[string]bool),
 			Deadline:     e.Deadline.Format("2006-01-02T15:04:05Z"),
 			Count:        0,
-			Total:        coordinator.MaxPlayers,
+			Total:        len(e.Players),
 			UserID:       userID,
 			UserAccepted: false,
+			VoteCancel:   newVoteCancelData(e.MatchID, len(e.Players), nil, userID),
 		}
 		if err := h.templates.ExecuteTemplate(&buf, "accept-dialog", data); err != nil {
 			log.Printf("Failed to render accept dialog: %v", err)
@@ -162,7 +276,7 @@ func (h *SSEHub) renderEventForUser(event coordinator.Event, userID string) stri
 			Players:      match.Players,
 			Accepted:     e.Accepted,
 			Count:        len(e.Accepted),
-			Total:        coordinator.MaxPlayers,
+			Total:        len(match.Players),
 			UserID:       userID,
 			UserAccepted: userAccepted,
 		}
@@ -190,6 +304,14 @@ func (h *SSEHub) renderEventForUser(event coordinator.Event, userID string) stri
 			CurrentPicker:    0,
 			DevMode:          h.devMode,
 			Deadline:         e.Deadline.Format("2006-01-02T15:04:05Z"),
+			BankTime:         e.BankTime,
+			TeamLabels:       e.TeamLabels,
+		}
+		data.Chat = ChatData{MatchID: e.MatchID}
+		if match := h.coordinator.GetPlayerMatch(userID); match != nil && match.ID == e.MatchID {
+			data.VoteCancel = newVoteCancelData(match.ID, len(match.Players), match.CancelVotes, userID)
+			data.Redraft = newRedraftData(match, userID)
+			data.Chat.Messages = match.Chat
 		}
 		if err := h.templates.ExecuteTemplate(&buf, "draft", data); err != nil {
 			log.Printf("Failed to render draft: %v", err)
@@ -210,12 +332,63 @@ func (h *SSEHub) renderEventForUser(event coordinator.Event, userID string) stri
 			CurrentPicker:    e.CurrentPicker,
 			DevMode:          h.devMode,
 			Deadline:         e.Deadline.Format("2006-01-02T15:04:05Z"),
+			Picks:            newDraftPicks(e.Picks, e.Radiant, e.Dire),
+			BankTime:         e.BankTime,
+			UsingBank:        e.UsingBank,
+			TeamLabels:       e.TeamLabels,
+		}
+		data.Chat = ChatData{MatchID: e.MatchID}
+		if match := h.coordinator.GetPlayerMatch(userID); match != nil && match.ID == e.MatchID {
+			data.VoteCancel = newVoteCancelData(match.ID, len(match.Players), match.CancelVotes, userID)
+			data.Redraft = newRedraftData(match, userID)
+			data.Chat.Messages = match.Chat
 		}
 		if err := h.templates.ExecuteTemplate(&buf, "draft", data); err != nil {
 			log.Printf("Failed to render draft: %v", err)
 			return ""
 		}
 
+	case coordinator.ChatMessageSent:
+		if !isUserInPlayers(userID, e.Players) {
+			return ""
+		}
+		if err := h.templates.ExecuteTemplate(&buf, "chat-message", e.Message); err != nil {
+			log.Printf("Failed to render chat message: %v", err)
+			return ""
+		}
+
+	case coordinator.DraftPickWarning:
+		if userID != e.Captain.SteamID {
+			return ""
+		}
+		if err := h.templates.ExecuteTemplate(&buf, "pick-warning", e); err != nil {
+			log.Printf("Failed to render pick warning: %v", err)
+			return ""
+		}
+
+	case coordinator.RedraftRequested:
+		if userID != e.Captains[0].SteamID && userID != e.Captains[1].SteamID {
+			return ""
+		}
+		match := h.coordinator.GetPlayerMatch(userID)
+		if match == nil || match.ID != e.MatchID {
+			return ""
+		}
+		if err := h.templates.ExecuteTemplate(&buf, "redraft", newRedraftData(match, userID)); err != nil {
+			log.Printf("Failed to render redraft request: %v", err)
+			return ""
+		}
+
+	case coordinator.VoteCancelUpdated:
+		if !isUserInPlayers(userID, e.Players) {
+			return ""
+		}
+		data := newVoteCancelData(e.MatchID, len(e.Players), e.Votes, userID)
+		if err := h.templates.ExecuteTemplate(&buf, "vote-cancel", data); err != nil {
+			log.Printf("Failed to render cancel vote: %v", err)
+			return ""
+		}
+
 	case coordinator.MatchCancelled:
 		// Players are already returned to queue, so check they're not in a different match
 		match := h.coordinator.GetPlayerMatch(userID)
@@ -227,6 +400,22 @@ func (h *SSEHub) renderEventForUser(event coordinator.Event, userID string) stri
 			return ""
 		}
 
+	case coordinator.MatchBackfilled:
+		if !isUserInPlayers(userID, e.Removed) {
+			return ""
+		}
+		data := struct {
+			Declined bool
+			Requeued bool
+		}{
+			Declined: isUserInPlayers(userID, e.Declined),
+			Requeued: isUserInPlayers(userID, e.Requeued),
+		}
+		if err := h.templates.ExecuteTemplate(&buf, "match-backfilled", data); err != nil {
+			log.Printf("Failed to render match backfilled: %v", err)
+			return ""
+		}
+
 	case coordinator.DraftCancelled:
 		// Send to users who were returned to queue (everyone except failed captain)
 		wasInMatch := isUserInPlayers(userID, e.ReturnedToQueue) || e.FailedCaptain.SteamID == userID
@@ -238,19 +427,7 @@ func (h *SSEHub) renderEventForUser(event coordinator.Event, userID string) stri
 			return ""
 		}
 		if isUserInPlayers(userID, e.ReturnedToQueue) {
-			queue, _, _ := h.coordinator.GetState()
-			inQueue := false
-			for _, p := range queue {
-				if p.SteamID == userID {
-					inQueue = true
-					break
-				}
-			}
-			queueData := struct {
-				Queue   []coordinator.Player
-				InQueue bool
-				InMatch bool
-			}{Queue: queue, InQueue: inQueue, InMatch: false}
+			queueData := newQueuePanelData(h.coordinator.QueueStatus(), userID, false)
 			if err := h.templates.ExecuteTemplate(&buf, "queue-sse", queueData); err != nil {
 				log.Printf("Failed to render queue after draft cancelled: %v", err)
 			}
@@ -266,43 +443,99 @@ func (h *SSEHub) renderEventForUser(event coordinator.Event, userID string) stri
 			return ""
 		}
 		if isUserInPlayers(userID, e.ReturnedToQueue) {
-			queue, _, _ := h.coordinator.GetState()
-			inQueue := false
-			for _, p := range queue {
-				if p.SteamID == userID {
-					inQueue = true
-					break
-				}
-			}
-			queueData := struct {
-				Queue   []coordinator.Player
-				InQueue bool
-				InMatch bool
-			}{Queue: queue, InQueue: inQueue, InMatch: false}
+			queueData := newQueuePanelData(h.coordinator.QueueStatus(), userID, false)
 			if err := h.templates.ExecuteTemplate(&buf, "queue-sse", queueData); err != nil {
 				log.Printf("Failed to render queue after lobby cancelled: %v", err)
 			}
 		}
 
-	case coordinator.RequestBotLobby:
-		// Only send to users in this match
-		if !isUserInPlayers(userID, e.Players) {
+	case coordinator.QueueRejoinAvailable:
+		if e.PlayerID != userID {
 			return ""
 		}
 		data := struct {
-			MatchID  string
-			Message  string
 			Deadline string
 		}{
-			MatchID:  e.MatchID,
-			Message:  "Waiting for Dota 2 lobby...",
 			Deadline: e.Deadline.Format("2006-01-02T15:04:05Z"),
 		}
+		if err := h.templates.ExecuteTemplate(&buf, "rejoin-available", data); err != nil {
+			log.Printf("Failed to render rejoin offer: %v", err)
+			return ""
+		}
+
+	case coordinator.PlayerAway:
+		if e.PlayerID != userID {
+			return ""
+		}
+		data := struct {
+			Minutes   int
+			QueueTime bool
+		}{
+			Minutes:   int(coordinator.AFKTimeout / time.Minute),
+			QueueTime: e.QueueTime,
+		}
+		if e.QueueTime {
+			data.Minutes = int(coordinator.MaxQueueTime / time.Minute)
+		}
+		if err := h.templates.ExecuteTemplate(&buf, "player-away", data); err != nil {
+			log.Printf("Failed to render away notice: %v", err)
+			return ""
+		}
+
+	case coordinator.RequestBotLobby:
+		// Only send to users in this match
+		if !isUserInPlayers(userID, e.Players) {
+			return ""
+		}
+		data := WaitingForBotData{
+			MatchID:     e.MatchID,
+			Message:     "Waiting for Dota 2 lobby...",
+			Deadline:    e.Deadline.Format("2006-01-02T15:04:05Z"),
+			LobbyName:   e.LobbyName,
+			ManualLobby: e.Manual,
+			Radiant:     e.Radiant,
+			Dire:        e.Dire,
+		}
 		if err := h.templates.ExecuteTemplate(&buf, "waiting-for-bot", data); err != nil {
 			log.Printf("Failed to render waiting: %v", err)
 			return ""
 		}
 
+	case coordinator.LobbyReady:
+		if !isUserInPlayers(userID, e.Players) {
+			return ""
+		}
+		data := WaitingForBotData{
+			MatchID:       e.MatchID,
+			Message:       "Lobby ready, join in Dota 2",
+			Deadline:      e.Deadline.Format("2006-01-02T15:04:05Z"),
+			LobbyName:     e.LobbyName,
+			LobbyPassword: e.Password,
+		}
+		if err := h.templates.ExecuteTemplate(&buf, "waiting-for-bot", data); err != nil {
+			log.Printf("Failed to render lobby ready: %v", err)
+			return ""
+		}
+
+	case coordinator.LobbyJoinProgress:
+		if !isUserInPlayers(userID, e.Players) {
+			return ""
+		}
+		data := LobbyJoinData{Joined: e.Joined, Missing: e.Missing}
+		if err := h.templates.ExecuteTemplate(&buf, "lobby-join-progress-sse", data); err != nil {
+			log.Printf("Failed to render lobby join progress: %v", err)
+			return ""
+		}
+
+	case coordinator.LobbyJoinWarning:
+		if !isUserInPlayers(userID, e.Missing) {
+			return ""
+		}
+		if err := h.templates.ExecuteTemplate(&buf, "lobby-join-warning", e); err != nil {
+			log.Printf("Failed to render lobby join warning: %v", err)
+			return ""
+		}
+
 	case coordinator.MatchCompleted:
 		if !isUserInPlayers(userID, e.Players) {
 			return ""
@@ -311,19 +544,7 @@ func (h *SSEHub) renderEventForUser(event coordinator.Event, userID string) stri
 			log.Printf("Failed to render match completed: %v", err)
 			return ""
 		}
-		queue, _, _ := h.coordinator.GetState()
-		inQueue := false
-		for _, p := range queue {
-			if p.SteamID == userID {
-				inQueue = true
-				break
-			}
-		}
-		queueData := struct {
-			Queue   []coordinator.Player
-			InQueue bool
-			InMatch bool
-		}{Queue: queue, InQueue: inQueue, InMatch: false}
+		queueData := newQueuePanelData(h.coordinator.QueueStatus(), userID, false)
 		if err := h.templates.ExecuteTemplate(&buf, "queue-sse", queueData); err != nil {
 			log.Printf("Failed to render queue after match completed: %v", err)
 		}
@@ -347,19 +568,7 @@ func (h *SSEHub) renderEventForUser(event coordinator.Event, userID string) stri
 			return ""
 		}
 		if e.ReturnedToQueue {
-			queue, _, _ := h.coordinator.GetState()
-			inQueue := false
-			for _, p := range queue {
-				if p.SteamID == userID {
-					inQueue = true
-					break
-				}
-			}
-			queueData := struct {
-				Queue   []coordinator.Player
-				InQueue bool
-				InMatch bool
-			}{Queue: queue, InQueue: inQueue, InMatch: false}
+			queueData := newQueuePanelData(h.coordinator.QueueStatus(), userID, false)
 			if err := h.templates.ExecuteTemplate(&buf, "queue-sse", queueData); err != nil {
 				log.Printf("Failed to render queue after admin cancel: %v", err)
 			}
@@ -368,6 +577,16 @@ func (h *SSEHub) renderEventForUser(event coordinator.Event, userID string) stri
 			log.Printf("Failed to render active matches after admin cancel: %v", err)
 		}
 
+	case coordinator.LobbySettingsUpdated:
+		// Keep open admin pages in sync
+		if !h.admins.IsAdmin(userID) {
+			return ""
+		}
+		if err := h.templates.ExecuteTemplate(&buf, "lobby-settings-sse", lobbySettingsData(e.Settings)); err != nil {
+			log.Printf("Failed to render lobby settings: %v", err)
+			return ""
+		}
+
 	default:
 		return ""
 	}
@@ -384,18 +603,147 @@ type DraftData struct {
 	CurrentPicker    int
 	DevMode          bool
 	Deadline         string
+	VoteCancel       VoteCancelData
+	Redraft          RedraftData
+	Picks            []DraftPick
+	Chat             ChatData
+	BankTime         [2]time.Duration
+	UsingBank        bool
+	TeamLabels       [2]string
 }
 
-func (h *SSEHub) renderInitialState(userID string) string {
-	queue, matches, _ := h.coordinator.GetState()
+// ChatData renders a match's chat box.
+type ChatData struct {
+	MatchID  string
+	Messages []coordinator.ChatMessage
+}
 
-	inQueue := false
-	for _, p := range queue {
-		if p.SteamID == userID {
-			inQueue = true
+// QueuePanelData renders the queue panel for one user.
+type QueuePanelData struct {
+	Queues       []coordinator.Queue
+	QueueID      string // Queue the user is in, if any
+	InQueue      bool
+	InMatch      bool
+	QueueVersion int
+	Paused       bool
+}
+
+func newQueuePanelData(status coordinator.QueueStatus, userID string, inMatch bool) QueuePanelData {
+	data := QueuePanelData{
+		Queues:       status.Queues,
+		InMatch:      inMatch,
+		QueueVersion: status.Version,
+		Paused:       status.Paused,
+	}
+	for _, q := range status.Queues {
+		if isUserInPlayers(userID, q.Players) {
+			data.QueueID = q.ID
+			data.InQueue = true
 			break
 		}
 	}
+	return data
+}
+
+// WaitingForBotData renders the lobby phase. LobbyPassword is empty until
+// the bot has created the lobby; fields are named like the Match fields so
+// "lobby-connect-info" and "manual-lobby" can render either.
+type WaitingForBotData struct {
+	MatchID       string
+	Message       string
+	Deadline      string
+	LobbyName     string
+	LobbyPassword string
+	ManualLobby   bool
+	Radiant       []coordinator.Player
+	Dire          []coordinator.Player
+}
+
+// LobbyJoinData renders who has and hasn't joined the bot lobby yet.
+type LobbyJoinData struct {
+	Joined  []coordinator.Player
+	Missing []coordinator.Player
+}
+
+// DraftPick is a pick in the draft timeline, with names resolved. Its
+// fields mirror store.MatchPick so both render with "pick-timeline".
+type DraftPick struct {
+	PickNumber  int
+	Team        string // "radiant" or "dire"
+	CaptainName string
+	PickedName  string
+}
+
+// newDraftPicks resolves pick records against the given players. Unknown
+// IDs fall back to the Steam ID.
+func newDraftPicks(picks []coordinator.PickRecord, players ...[]coordinator.Player) []DraftPick {
+	names := make(map[string]string)
+	for _, list := range players {
+		for _, p := range list {
+			names[p.SteamID] = p.Name
+		}
+	}
+	nameOf := func(id string) string {
+		if name, ok := names[id]; ok {
+			return name
+		}
+		return id
+	}
+
+	result := make([]DraftPick, 0, len(picks))
+	for _, pick := range picks {
+		team := "radiant"
+		if pick.Team == 1 {
+			team = "dire"
+		}
+		result = append(result, DraftPick{
+			PickNumber:  pick.PickNumber,
+			Team:        team,
+			CaptainName: nameOf(pick.CaptainID),
+			PickedName:  nameOf(pick.PickedID),
+		})
+	}
+	return result
+}
+
+// VoteCancelData renders the vote-to-cancel control for one user.
+type VoteCancelData struct {
+	MatchID   string
+	Votes     int
+	Needed    int
+	UserVoted bool
+}
+
+func newVoteCancelData(matchID string, players int, votes map[string]bool, userID string) VoteCancelData {
+	return VoteCancelData{
+		MatchID:   matchID,
+		Votes:     len(votes),
+		Needed:    coordinator.CancelVotesNeeded(players),
+		UserVoted: votes[userID],
+	}
+}
+
+// RedraftData renders the redraft control, which only captains see.
+type RedraftData struct {
+	MatchID       string
+	IsCaptain     bool
+	Used          bool // The match has already been redrafted
+	UserRequested bool
+	Requested     bool // Either captain has asked
+}
+
+func newRedraftData(match *coordinator.Match, userID string) RedraftData {
+	return RedraftData{
+		MatchID:       match.ID,
+		IsCaptain:     userID == match.Captains[0].SteamID || userID == match.Captains[1].SteamID,
+		Used:          match.Redrafted,
+		UserRequested: match.RedraftVotes[userID],
+		Requested:     len(match.RedraftVotes) > 0,
+	}
+}
+
+func (h *SSEHub) renderInitialState(userID string) string {
+	_, matches, _ := h.coordinator.GetState()
 
 	inMatch := h.coordinator.GetPlayerMatch(userID) != nil
 
@@ -406,11 +754,7 @@ func (h *SSEHub) renderInitialState(userID string) string {
 
 	var buf bytes.Buffer
 
-	queueData := struct {
-		Queue   []coordinator.Player
-		InQueue bool
-		InMatch bool
-	}{Queue: queue, InQueue: inQueue, InMatch: inMatch}
+	queueData := newQueuePanelData(h.coordinator.QueueStatus(), userID, inMatch)
 	if err := h.templates.ExecuteTemplate(&buf, "queue-sse", queueData); err != nil {
 		log.Printf("Failed to render initial queue: %v", err)
 		return ""
@@ -427,6 +771,23 @@ func (h *SSEHub) renderInitialState(userID string) string {
 	return buf.String()
 }
 
+// renderRecentMatches renders the recently completed matches strip, with
+// the match that just completed first.
+func (h *SSEHub) renderRecentMatches(completed coordinator.MatchCompleted) string {
+	_, _, settings := h.coordinator.GetState()
+	data := RecentMatchesData{
+		Matches:    recentMatches(context.Background(), h.store, &completed),
+		TeamLabels: settings.TeamLabels(),
+	}
+
+	var buf bytes.Buffer
+	if err := h.templates.ExecuteTemplate(&buf, "recent-matches-sse", data); err != nil {
+		log.Printf("Failed to render recent matches: %v", err)
+		return ""
+	}
+	return buf.String()
+}
+
 func (h *SSEHub) renderActiveMatches() string {
 	_, matches, _ := h.coordinator.GetState()
 
@@ -459,11 +820,23 @@ func (h *SSEHub) HandleConnection(w http.ResponseWriter, r *http.Request, userID
 	client := &SSEClient{
 		ID:      fmt.Sprintf("%p", r),
 		UserID:  userID,
-		Channel: make(chan string, 10),
+		Channel: make(chan sseMessage, 10),
 	}
 
+	lastID, hasLastID := parseLastEventID(r)
+
 	h.mu.Lock()
 	h.clients[client] = true
+	hist := h.historyFor(userID)
+	hist.conns++
+	var replay []sseMessage
+	canReplay := false
+	// An ID above the current sequence was issued before a server restart,
+	// so nothing buffered here follows on from it.
+	if hasLastID && lastID <= h.seq {
+		replay, canReplay = hist.since(lastID)
+	}
+	currentID := h.seq
 	clientCount := len(h.clients)
 	h.mu.Unlock()
 
@@ -474,6 +847,12 @@ func (h *SSEHub) HandleConnection(w http.ResponseWriter, r *http.Request, userID
 	defer func() {
 		h.mu.Lock()
 		delete(h.clients, client)
+		if hist, ok := h.history[userID]; ok {
+			hist.conns--
+			if hist.conns == 0 {
+				hist.disconnectedAt = time.Now()
+			}
+		}
 		clientCount := len(h.clients)
 		h.mu.Unlock()
 		close(client.Channel)
@@ -489,41 +868,49 @@ func (h *SSEHub) HandleConnection(w http.ResponseWriter, r *http.Request, userID
 	fmt.Fprintf(w, ": connected\n\n")
 	flusher.Flush()
 
-	if initialHTML := h.renderInitialState(userID); initialHTML != "" {
-		lines := strings.Split(initialHTML, "\n")
-		for _, line := range lines {
-			fmt.Fprintf(w, "data: %s\n", line)
+	if canReplay {
+		// Reconnect after a short drop: send only what was missed
+		for _, msg := range replay {
+			writeSSEMessage(w, msg)
 		}
-		fmt.Fprintf(w, "\n")
+		flusher.Flush()
+	} else if initialHTML := h.renderInitialState(userID); initialHTML != "" {
+		writeSSEMessage(w, sseMessage{ID: currentID, Data: initialHTML})
 		flusher.Flush()
 	}
 
+	// Proxies drop SSE connections that stay silent too long, so send a
+	// comment line whenever nothing else has been written for a while.
+	keepalive := time.NewTicker(sseKeepaliveInterval)
+	defer keepalive.Stop()
+
 	for {
 		select {
 		case <-r.Context().Done():
 			return
+		case <-keepalive.C:
+			fmt.Fprintf(w, ": keepalive\n\n")
+			flusher.Flush()
 		case msg, ok := <-client.Channel:
 			if !ok {
 				return
 			}
-			lines := strings.Split(msg, "\n")
-			for _, line := range lines {
-				fmt.Fprintf(w, "data: %s\n", line)
-			}
-			fmt.Fprintf(w, "\n")
+			writeSSEMessage(w, msg)
 			flusher.Flush()
+			keepalive.Reset(sseKeepaliveInterval)
 		}
 	}
 }
 
 func (h *SSEHub) SendToUser(userID string, html string) {
-	h.mu.RLock()
-	defer h.mu.RUnlock()
+	h.mu.Lock()
+	defer h.mu.Unlock()
 
+	msg := h.record(userID, html)
 	for client := range h.clients {
 		if client.UserID == userID {
 			select {
-			case client.Channel <- html:
+			case client.Channel <- msg:
 			default:
 			}
 			return
@@ -531,6 +918,57 @@ func (h *SSEHub) SendToUser(userID string, html string) {
 	}
 }
 
+// Broadcast sends html to every connected client regardless of user.
+func (h *SSEHub) Broadcast(html string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	messages := make(map[string]sseMessage)
+	for userID := range h.activeUsers() {
+		messages[userID] = h.record(userID, html)
+	}
+
+	for client := range h.clients {
+		select {
+		case client.Channel <- messages[client.UserID]:
+		default:
+			log.Printf("Dropping message for slow client %s", client.ID)
+		}
+	}
+}
+
+// Announce shows a dismissable banner with message on every connected page.
+func (h *SSEHub) Announce(message string) error {
+	var buf bytes.Buffer
+	if err := h.templates.ExecuteTemplate(&buf, "announcement", message); err != nil {
+		return err
+	}
+	h.Broadcast(buf.String())
+	return nil
+}
+
+func writeSSEMessage(w http.ResponseWriter, msg sseMessage) {
+	fmt.Fprintf(w, "id: %d\n", msg.ID)
+	for _, line := range strings.Split(msg.Data, "\n") {
+		fmt.Fprintf(w, "data: %s\n", line)
+	}
+	fmt.Fprintf(w, "\n")
+}
+
+// parseLastEventID reads the sequence number a reconnecting EventSource
+// last received, if any.
+func parseLastEventID(r *http.Request) (uint64, bool) {
+	header := r.Header.Get("Last-Event-ID")
+	if header == "" {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(header, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return id, true
+}
+
 func isUserInMatch(userID string, players []coordinator.Player) bool {
 	return isUserInPlayers(userID, players)
 }
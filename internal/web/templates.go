@@ -6,8 +6,10 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/edvart/dota-inhouse/internal/coordinator"
+	"github.com/edvart/dota-inhouse/internal/dotaapi"
 )
 
 // LoadTemplates loads all templates from the filesystem.
@@ -48,6 +50,24 @@ func LoadTemplates(templatesFS fs.FS) (*template.Template, error) {
 // templateFuncs returns the common template functions.
 func templateFuncs() template.FuncMap {
 	return template.FuncMap{
+		"heroName":      dotaapi.HeroName,
+		"dotaMatchLink": dotaMatchLink,
+		"preferences":   formatPreferences,
+		"rankTier":      rankTier,
+		"teamName": func(labels [2]string, team string) string {
+			if team == "dire" {
+				return labels[1]
+			}
+			return labels[0]
+		},
+		"hasID": func(ids []int, id int) bool {
+			for _, v := range ids {
+				if v == id {
+					return true
+				}
+			}
+			return false
+		},
 		"sub": func(a, b int) int {
 			return a - b
 		},
@@ -79,6 +99,16 @@ func templateFuncs() template.FuncMap {
 		"getPlayerName": func(p coordinator.Player) string {
 			return p.Name
 		},
+		"draftPicks": func(m *coordinator.Match) []DraftPick {
+			return newDraftPicks(m.Picks, m.Players)
+		},
+		"lobbyJoin": func(m *coordinator.Match) LobbyJoinData {
+			joined, missing := coordinator.LobbyJoinStatus(m)
+			return LobbyJoinData{Joined: joined, Missing: missing}
+		},
+		"matchChat": func(m *coordinator.Match) ChatData {
+			return ChatData{MatchID: m.ID, Messages: m.Chat}
+		},
 		"matchStateName": func(state coordinator.MatchState) string {
 			switch state {
 			case coordinator.MatchStateAccepting:
@@ -121,6 +151,22 @@ func templateFuncs() template.FuncMap {
 			s := *seconds % 60
 			return fmt.Sprintf("%d:%02d", m, s)
 		},
+		"gameClock": func(d time.Duration) string {
+			secs := int(d / time.Second)
+			return fmt.Sprintf("%d:%02d", secs/60, secs%60)
+		},
+	}
+}
+
+// dotaMatchLink returns the URL of a Dota match on "dotabuff" or "opendota".
+func dotaMatchLink(site string, matchID uint64) string {
+	switch site {
+	case "dotabuff":
+		return fmt.Sprintf("https://www.dotabuff.com/matches/%d", matchID)
+	case "opendota":
+		return fmt.Sprintf("https://www.opendota.com/matches/%d", matchID)
+	default:
+		return ""
 	}
 }
 
@@ -0,0 +1,218 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/edvart/dota-inhouse/internal/coordinator"
+)
+
+const (
+	requestTimeout = 5 * time.Second
+	maxAttempts    = 3
+	initialBackoff = 1 * time.Second
+	queueSize      = 100
+)
+
+// Player is a player as sent in webhook payloads.
+type Player struct {
+	SteamID string `json:"steamId"`
+	Name    string `json:"name"`
+}
+
+// Payload is the JSON body POSTed to the webhook URL.
+type Payload struct {
+	Event       string    `json:"event"` // "match_started", "match_completed", "match_cancelled"
+	MatchID     string    `json:"matchId"`
+	DotaMatchID uint64    `json:"dotaMatchId,omitempty"`
+	Radiant     []Player  `json:"radiant,omitempty"`
+	Dire        []Player  `json:"dire,omitempty"`
+	Winner      *string   `json:"winner,omitempty"`
+	Failed      []Player  `json:"failedPlayers,omitempty"`
+	Reason      string    `json:"reason,omitempty"` // For match_cancelled: "accept", "vote", "draft", "lobby", or "admin"
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+// Notifier listens to coordinator events and POSTs match lifecycle events to a URL.
+type Notifier struct {
+	url        string
+	httpClient *http.Client
+	queue      chan Payload
+}
+
+func New(url string) *Notifier {
+	return &Notifier{
+		url: url,
+		httpClient: &http.Client{
+			Timeout: requestTimeout,
+		},
+		queue: make(chan Payload, queueSize),
+	}
+}
+
+// Run consumes events and hands payloads to a background worker so slow
+// webhook endpoints never block the event loop.
+func (n *Notifier) Run(ctx context.Context, events <-chan coordinator.Event) {
+	log.Println("Webhook notifier started")
+	go n.worker(ctx)
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("Webhook notifier shutting down")
+			return
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if payload, ok := payloadForEvent(event); ok {
+				n.enqueue(payload)
+			}
+		}
+	}
+}
+
+func (n *Notifier) enqueue(p Payload) {
+	select {
+	case n.queue <- p:
+	default:
+		log.Printf("Webhook: queue full, dropping %s event for match %s", p.Event, p.MatchID)
+	}
+}
+
+func (n *Notifier) worker(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case p := <-n.queue:
+			if err := n.sendWithRetry(ctx, p); err != nil {
+				log.Printf("Webhook: failed to deliver %s event for match %s: %v", p.Event, p.MatchID, err)
+			}
+		}
+	}
+}
+
+func payloadForEvent(event coordinator.Event) (Payload, bool) {
+	now := time.Now()
+	switch e := event.(type) {
+	case coordinator.MatchStarted:
+		return Payload{
+			Event:       "match_started",
+			MatchID:     e.MatchID,
+			DotaMatchID: e.DotaMatchID,
+			Radiant:     toPlayers(e.Radiant),
+			Dire:        toPlayers(e.Dire),
+			Timestamp:   now,
+		}, true
+	case coordinator.MatchCompleted:
+		return Payload{
+			Event:       "match_completed",
+			MatchID:     e.MatchID,
+			DotaMatchID: e.DotaMatchID,
+			Radiant:     toPlayers(e.Radiant),
+			Dire:        toPlayers(e.Dire),
+			Winner:      e.Winner,
+			Timestamp:   now,
+		}, true
+	case coordinator.MatchCancelled:
+		reason := "accept"
+		if e.Voted {
+			reason = "vote"
+		}
+		return Payload{
+			Event:     "match_cancelled",
+			MatchID:   e.MatchID,
+			Failed:    toPlayers(e.FailedPlayers),
+			Reason:    reason,
+			Timestamp: now,
+		}, true
+	case coordinator.DraftCancelled:
+		return Payload{
+			Event:     "match_cancelled",
+			MatchID:   e.MatchID,
+			Failed:    toPlayers([]coordinator.Player{e.FailedCaptain}),
+			Reason:    "draft",
+			Timestamp: now,
+		}, true
+	case coordinator.LobbyCancelled:
+		return Payload{
+			Event:     "match_cancelled",
+			MatchID:   e.MatchID,
+			Failed:    toPlayers(e.FailedPlayers),
+			Reason:    "lobby",
+			Timestamp: now,
+		}, true
+	case coordinator.MatchCancelledByAdmin:
+		return Payload{
+			Event:     "match_cancelled",
+			MatchID:   e.MatchID,
+			Reason:    "admin",
+			Timestamp: now,
+		}, true
+	}
+	return Payload{}, false
+}
+
+func toPlayers(players []coordinator.Player) []Player {
+	result := make([]Player, 0, len(players))
+	for _, p := range players {
+		result = append(result, Player{SteamID: p.SteamID, Name: p.Name})
+	}
+	return result
+}
+
+// sendWithRetry POSTs the payload, retrying with exponential backoff.
+func (n *Notifier) sendWithRetry(ctx context.Context, p Payload) error {
+	body, err := json.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	backoff := initialBackoff
+	var lastErr error
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		if attempt > 1 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+
+		lastErr = n.send(ctx, body)
+		if lastErr == nil {
+			return nil
+		}
+		log.Printf("Webhook: attempt %d/%d for match %s failed: %v", attempt, maxAttempts, p.MatchID, lastErr)
+	}
+	return lastErr
+}
+
+func (n *Notifier) send(ctx context.Context, body []byte) error {
+	reqCtx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(reqCtx, "POST", n.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -1,5 +1,11 @@
 let audioUnlocked = false;
 
+// CSRF token for state-changing fetch requests; htmx sends it via hx-headers.
+function csrfToken() {
+    const meta = document.querySelector('meta[name="csrf-token"]');
+    return meta ? meta.content : '';
+}
+
 document.addEventListener('DOMContentLoaded', () => {
     if ('serviceWorker' in navigator) {
         navigator.serviceWorker.register('/sw.js')
@@ -18,8 +24,32 @@ document.addEventListener('DOMContentLoaded', () => {
         console.log('Running in standalone mode');
         requestNotificationPermission();
     }
+
+    loadPushPreferences();
+});
+
+// Queue heartbeat: tell the server the page is still open, so players whose
+// browser is closed or asleep drop out of the queue. Waiting in a background
+// tab is normal, so hidden tabs keep sending them too.
+const HEARTBEAT_INTERVAL = 60 * 1000;
+
+document.addEventListener('visibilitychange', () => {
+    if (document.visibilityState === 'visible') {
+        sendHeartbeat();
+    }
 });
 
+function sendHeartbeat() {
+    if (!csrfToken()) return; // Not logged in
+
+    fetch('/queue/heartbeat', {
+        method: 'POST',
+        headers: { 'X-CSRF-Token': csrfToken() }
+    }).catch(() => {});
+}
+
+setInterval(sendHeartbeat, HEARTBEAT_INTERVAL);
+
 // Play notification sound when HTMX loads an element with data-play-notification
 document.body.addEventListener('htmx:load', function(event) {
     if (event.detail.elt.getAttribute('data-play-notification') === 'true') {
@@ -182,6 +212,7 @@ async function sendSubscriptionToServer(subscription) {
             method: 'POST',
             headers: {
                 'Content-Type': 'application/json',
+                'X-CSRF-Token': csrfToken(),
             },
             body: JSON.stringify(subData)
         });
@@ -228,6 +259,7 @@ async function testPushNotification() {
             method: 'POST',
             headers: {
                 'Content-Type': 'application/json',
+                'X-CSRF-Token': csrfToken(),
             }
         });
 
@@ -246,6 +278,49 @@ async function testPushNotification() {
     }
 }
 
+// Load which push notifications the user wants into the settings panel
+async function loadPushPreferences() {
+    const panel = document.getElementById('push-preferences');
+    if (!panel) return;
+
+    try {
+        const response = await fetch('/api/push/preferences');
+        if (!response.ok) return;
+        const prefs = await response.json();
+        for (const input of panel.querySelectorAll('input[type=checkbox]')) {
+            input.checked = prefs[input.name] !== false;
+        }
+    } catch (error) {
+        console.error('Error loading push preferences:', error);
+    }
+}
+
+async function savePushPreferences() {
+    const panel = document.getElementById('push-preferences');
+    if (!panel) return;
+
+    const prefs = {};
+    for (const input of panel.querySelectorAll('input[type=checkbox]')) {
+        prefs[input.name] = input.checked;
+    }
+
+    try {
+        const response = await fetch('/api/push/preferences', {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+                'X-CSRF-Token': csrfToken(),
+            },
+            body: JSON.stringify(prefs)
+        });
+        if (!response.ok) {
+            console.error('Failed to save push preferences:', response.status);
+        }
+    } catch (error) {
+        console.error('Error saving push preferences:', error);
+    }
+}
+
 // Check push notification status (for debugging)
 async function checkPushStatus() {
     console.log('=== Push Notification Status ===');
@@ -195,14 +195,20 @@ self.addEventListener('pushsubscriptionchange', (event) => {
             .then(subscription => {
                 console.log('✅ Re-subscribed to push notifications');
 
-                // Send new subscription to server
-                return fetch('/api/push/subscribe', {
-                    method: 'POST',
-                    headers: {
-                        'Content-Type': 'application/json',
-                    },
-                    body: JSON.stringify(subscription.toJSON())
-                });
+                // The worker can't read the page's CSRF token, so fetch it
+                return fetch('/api/csrf-token')
+                    .then(response => response.json())
+                    .then(data => {
+                        // Send new subscription to server
+                        return fetch('/api/push/subscribe', {
+                            method: 'POST',
+                            headers: {
+                                'Content-Type': 'application/json',
+                                'X-CSRF-Token': data.token,
+                            },
+                            body: JSON.stringify(subscription.toJSON())
+                        });
+                    });
             })
             .then(() => {
                 console.log('✅ New subscription sent to server');